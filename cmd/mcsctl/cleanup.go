@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/janitor"
+)
+
+// cleanupOptions holds the flags of the cleanup command.
+type cleanupOptions struct {
+	clusterSetId    string
+	clusterId       string
+	service         string
+	minExportAge    time.Duration
+	deleteServices  bool
+	deleteNamespace bool
+	dryRun          bool
+	yes             bool
+}
+
+func setCleanupFlags(flags *flag.FlagSet, opts *options) {
+	flags.StringVar(&opts.cleanup.clusterSetId, "clusterset-id", "",
+		"The clusterset whose instances are removed. Defaults to the clusterset of the cluster.")
+	flags.StringVar(&opts.cleanup.clusterId, "cluster-id", "",
+		"Only remove the instances of this cluster. Defaults to all clusters of the clusterset.")
+	flags.StringVar(&opts.cleanup.service, "service", "",
+		"Only remove the instances of this service. Defaults to all services.")
+	flags.DurationVar(&opts.cleanup.minExportAge, "min-export-age", 0,
+		"Only remove the instances whose ServiceExport was created at least this long ago, e.g. 72h.")
+	flags.BoolVar(&opts.cleanup.deleteServices, "delete-services", false,
+		"Delete the services left without instances of any cluster.")
+	flags.BoolVar(&opts.cleanup.deleteNamespace, "delete-namespace", false,
+		"Delete the Cloud Map namespaces left without services. Requires --delete-services, and no --service.")
+	flags.BoolVar(&opts.cleanup.dryRun, "dry-run", false, "Print the resources to remove without removing them.")
+	flags.BoolVar(&opts.cleanup.yes, "yes", false, "Remove the resources without asking for confirmation.")
+}
+
+func runCleanup(ctx context.Context, opts *options, args []string, s streams) error {
+	if opts.cleanup.deleteNamespace && (!opts.cleanup.deleteServices || opts.cleanup.service != "") {
+		return errors.New("--delete-namespace requires --delete-services, and no --service")
+	}
+	format, c, err := opts.setup(ctx, args, 0)
+	if err != nil {
+		return err
+	}
+
+	clusterSetId := opts.cleanup.clusterSetId
+	if clusterSetId == "" {
+		clusterSetId = c.clusterSetId
+	}
+	j, err := c.janitor(clusterSetId)
+	if err != nil {
+		return fmt.Errorf("unable to configure the Cloud Map namespace mapping: %w", err)
+	}
+	namespaces, err := c.inspector().Namespaces(ctx, opts.namespace)
+	if err != nil {
+		return err
+	}
+
+	scope := janitor.Scope{
+		ClusterId:       opts.cleanup.clusterId,
+		Service:         opts.cleanup.service,
+		MinExportAge:    opts.cleanup.minExportAge,
+		DeleteServices:  opts.cleanup.deleteServices,
+		DeleteNamespace: opts.cleanup.deleteNamespace,
+	}
+	plans := make([]*janitor.Plan, 0)
+	for _, namespace := range namespaces {
+		plan, err := j.Plan(ctx, namespace, scope)
+		if err != nil {
+			return err
+		}
+		if !plan.IsEmpty() {
+			plans = append(plans, plan)
+		}
+	}
+
+	if len(plans) == 0 {
+		fmt.Fprintf(s.err, "nothing to clean up in clusterset %s\n", clusterSetId)
+		return printCleanup(s.out, format, plans)
+	}
+	if opts.cleanup.dryRun {
+		fmt.Fprintf(s.err, "dry-run: would remove %s of clusterset %s\n", summarizeCleanup(plans), clusterSetId)
+		return printCleanup(s.out, format, plans)
+	}
+	if !opts.cleanup.yes {
+		if err = printCleanup(s.err, tableOutput, plans); err != nil {
+			return err
+		}
+		fmt.Fprintf(s.err, "Remove %s of clusterset %s? [y/N]: ", summarizeCleanup(plans), clusterSetId)
+		if !confirmed(s) {
+			return errors.New("cleanup cancelled")
+		}
+	}
+
+	removed := make([]*janitor.Plan, 0, len(plans))
+	for _, plan := range plans {
+		result, applyErr := j.Apply(ctx, plan)
+		removed = append(removed, result)
+		if applyErr != nil {
+			err = applyErr
+			break
+		}
+	}
+	fmt.Fprintf(s.err, "removed %s of clusterset %s\n", summarizeCleanup(removed), clusterSetId)
+	if printErr := printCleanup(s.out, format, removed); err == nil {
+		err = printErr
+	}
+	return err
+}
+
+// confirmed reads the answer to a confirmation prompt.
+func confirmed(s streams) bool {
+	answer, _ := bufio.NewReader(s.in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// summarizeCleanup returns the number of resources of the plans.
+func summarizeCleanup(plans []*janitor.Plan) string {
+	instances, services, namespaces := 0, 0, 0
+	for _, plan := range plans {
+		instances += len(plan.Instances)
+		services += len(plan.Services)
+		if plan.DeleteNamespace {
+			namespaces++
+		}
+	}
+	return fmt.Sprintf("%d instance(s), %d service(s) and %d namespace(s)", instances, services, namespaces)
+}
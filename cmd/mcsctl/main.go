@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	aboutv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/about/v1alpha1"
+	multiclusterv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/multicluster/v1alpha1"
+	policyv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/policy/v1alpha1"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/cloudmap"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/clusterset"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/janitor"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/version"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(multiclusterv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(aboutv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(policyv1alpha1.AddToScheme(scheme))
+}
+
+// command is a mcsctl subcommand.
+type command struct {
+	usage       string
+	description string
+	// setFlags optionally adds the flags specific to the command
+	setFlags func(flags *flag.FlagSet, opts *options)
+	run      func(ctx context.Context, opts *options, args []string, s streams) error
+}
+
+var commands = map[string]command{
+	"services": {
+		usage:       "services [flags]",
+		description: "List the clusterset services with their clusters and ready endpoints",
+		run:         runServices,
+	},
+	"endpoints": {
+		usage:       "endpoints [flags] <namespace>/<name>",
+		description: "Show the endpoints of a clusterset service grouped by cluster",
+		run:         runEndpoints,
+	},
+	"diff": {
+		usage:       "diff [flags]",
+		description: "Compare Cloud Map with the ServiceExports and ServiceImports of the cluster",
+		run:         runDiff,
+	},
+	"conflicts": {
+		usage:       "conflicts [flags]",
+		description: "List the conflicting exports of the clusterset services",
+		run:         runConflicts,
+	},
+	"cleanup": {
+		usage:       "cleanup [flags]",
+		description: "Remove the Cloud Map instances of the clusterset, by cluster, service or age",
+		setFlags:    setCleanupFlags,
+		run:         runCleanup,
+	},
+}
+
+// commandNames lists the commands in the order of the usage message.
+var commandNames = []string{"services", "endpoints", "diff", "conflicts", "cleanup"}
+
+// options holds the flags common to all commands, and those of the cleanup command.
+type options struct {
+	kubeconfig     string
+	kubeContext    string
+	namespace      string
+	output         string
+	nsMapperConfig *cloudmap.NamespaceMapperConfig
+	cleanup        cleanupOptions
+}
+
+// streams holds the standard streams of a command. Results are written to out, messages and prompts to err.
+type streams struct {
+	in  io.Reader
+	out io.Writer
+	err io.Writer
+}
+
+func main() {
+	os.Exit(run(context.Background(), os.Args[1:], streams{in: os.Stdin, out: os.Stdout, err: os.Stderr}))
+}
+
+// run runs the command of the arguments, and returns the exit code.
+func run(ctx context.Context, args []string, s streams) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(s.err)
+		if len(args) == 0 {
+			return 1
+		}
+		return 0
+	}
+	if args[0] == "version" {
+		fmt.Fprintln(s.out, version.GetPackageVersion())
+		return 0
+	}
+
+	cmd, found := commands[args[0]]
+	if !found {
+		fmt.Fprintf(s.err, "unknown command %q\n\n", args[0])
+		printUsage(s.err)
+		return 1
+	}
+
+	opts := &options{nsMapperConfig: cloudmap.DefaultNamespaceMapperConfig()}
+	flags := newFlagSet(cmd, opts, s.err)
+	if err := flags.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 1
+	}
+	if err := cmd.run(ctx, opts, flags.Args(), s); err != nil {
+		fmt.Fprintf(s.err, "error: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func newFlagSet(cmd command, opts *options, stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet(cmd.usage, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "%s\n\nUsage:\n  mcsctl %s\n\nFlags:\n", cmd.description, cmd.usage)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&opts.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file. Defaults to $KUBECONFIG or ~/.kube/config.")
+	flags.StringVar(&opts.kubeContext, "context", "", "The kubeconfig context of the cluster. Defaults to the current context.")
+	flags.StringVar(&opts.namespace, "namespace", "", "The namespace of the services. Defaults to all namespaces.")
+	flags.StringVar(&opts.namespace, "n", "", "Shorthand for --namespace.")
+	flags.StringVar(&opts.output, "output", string(tableOutput), "The output format: table or json.")
+	flags.StringVar(&opts.output, "o", string(tableOutput), "Shorthand for --output.")
+	flags.StringVar(&opts.nsMapperConfig.Template, "cloudmap-namespace-template", "",
+		"Go template of the Cloud Map namespace names, as configured on the controller.")
+	flags.StringVar(&opts.nsMapperConfig.Prefix, "cloudmap-namespace-prefix", "",
+		"The prefix of the Cloud Map namespace names, as configured on the controller.")
+	flags.StringVar(&opts.nsMapperConfig.Suffix, "cloudmap-namespace-suffix", "",
+		"The suffix of the Cloud Map namespace names, as configured on the controller.")
+	if cmd.setFlags != nil {
+		cmd.setFlags(flags, opts)
+	}
+	return flags
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "mcsctl inspects the clusterset services of the AWS Cloud Map MCS Controller.\n\nUsage:\n  mcsctl <command> [flags]\n\nCommands:\n")
+	for _, name := range commandNames {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].description)
+	}
+	fmt.Fprintf(w, "  %-10s %s\n\nRun \"mcsctl <command> -h\" for the flags of a command.\n", "version", "Print the version")
+}
+
+func runServices(ctx context.Context, opts *options, args []string, s streams) error {
+	format, c, err := opts.setup(ctx, args, 0)
+	if err != nil {
+		return err
+	}
+	inspector := c.inspector()
+	namespaces, err := inspector.Namespaces(ctx, opts.namespace)
+	if err != nil {
+		return err
+	}
+	services, err := inspector.Services(ctx, namespaces)
+	if err != nil {
+		return err
+	}
+	return printServices(s.out, format, services)
+}
+
+func runEndpoints(ctx context.Context, opts *options, args []string, s streams) error {
+	if len(args) != 1 {
+		return errors.New("expected a single <namespace>/<name> argument")
+	}
+	name, err := parseServiceName(args[0], opts.namespace)
+	if err != nil {
+		return err
+	}
+	format, c, err := opts.setup(ctx, args, 1)
+	if err != nil {
+		return err
+	}
+	inspector := c.inspector()
+	svc, err := inspector.Service(ctx, name)
+	if err != nil {
+		return err
+	}
+	if svc == nil {
+		return fmt.Errorf("clusterset service %s not found in Cloud Map", name)
+	}
+	return printEndpoints(s.out, format, svc)
+}
+
+func runDiff(ctx context.Context, opts *options, args []string, s streams) error {
+	format, c, err := opts.setup(ctx, args, 0)
+	if err != nil {
+		return err
+	}
+	inspector := c.inspector()
+	namespaces, err := inspector.Namespaces(ctx, opts.namespace)
+	if err != nil {
+		return err
+	}
+	differences, err := inspector.Diff(ctx, namespaces)
+	if err != nil {
+		return err
+	}
+	return printDifferences(s.out, format, differences)
+}
+
+func runConflicts(ctx context.Context, opts *options, args []string, s streams) error {
+	format, c, err := opts.setup(ctx, args, 0)
+	if err != nil {
+		return err
+	}
+	inspector := c.inspector()
+	namespaces, err := inspector.Namespaces(ctx, opts.namespace)
+	if err != nil {
+		return err
+	}
+	conflicts, err := inspector.Conflicts(ctx, namespaces)
+	if err != nil {
+		return err
+	}
+	return printConflicts(s.out, format, conflicts)
+}
+
+// parseServiceName parses a <namespace>/<name> service name, or a <name> in the given namespace.
+func parseServiceName(value string, namespace string) (types.NamespacedName, error) {
+	ns, name, found := strings.Cut(value, "/")
+	if !found {
+		ns, name = namespace, value
+	}
+	if ns == "" || name == "" || strings.Contains(name, "/") {
+		return types.NamespacedName{}, fmt.Errorf("invalid service %q, expected <namespace>/<name>", value)
+	}
+	return types.NamespacedName{Namespace: ns, Name: name}, nil
+}
+
+// setup validates the output format and the number of arguments, and connects to the cluster and Cloud Map.
+func (o *options) setup(ctx context.Context, args []string, expectedArgs int) (outputFormat, *clients, error) {
+	format, err := parseOutputFormat(o.output)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(args) != expectedArgs {
+		return "", nil, fmt.Errorf("unexpected arguments %v", args[expectedArgs:])
+	}
+	c, err := o.connect(ctx)
+	return format, c, err
+}
+
+// clients holds the client of the cluster, its ClusterProperties and the AWS configuration.
+type clients struct {
+	k8sClient      client.Client
+	clusterUtils   model.ClusterUtils
+	clusterId      string
+	clusterSetId   string
+	awsCfg         aws.Config
+	nsMapper       cloudmap.NamespaceMapper
+	nsMapperConfig *cloudmap.NamespaceMapperConfig
+}
+
+// connect connects to the cluster of the kubeconfig context, and loads the default AWS configuration.
+func (o *options) connect(ctx context.Context) (*clients, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = o.kubeconfig
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules,
+		&clientcmd.ConfigOverrides{CurrentContext: o.kubeContext}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the kubeconfig: %w", err)
+	}
+	k8sClient, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to the cluster: %w", err)
+	}
+
+	clusterUtils := model.NewClusterUtils(k8sClient)
+	clusterProperties, err := clusterUtils.GetClusterProperties(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the ClusterProperties of the cluster: %w", err)
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to configure AWS session: %w", err)
+	}
+	if awsCfg.Region == "" {
+		return nil, errors.New("unable to configure AWS session: no region, set AWS_REGION")
+	}
+	nsMapper, err := cloudmap.NewNamespaceMapper(o.nsMapperConfig, k8sClient, clusterUtils)
+	if err != nil {
+		return nil, fmt.Errorf("unable to configure the Cloud Map namespace mapping: %w", err)
+	}
+
+	return &clients{
+		k8sClient:      k8sClient,
+		clusterUtils:   clusterUtils,
+		clusterId:      clusterProperties.ClusterId(),
+		clusterSetId:   clusterProperties.ClusterSetId(),
+		awsCfg:         awsCfg,
+		nsMapper:       nsMapper,
+		nsMapperConfig: o.nsMapperConfig,
+	}, nil
+}
+
+// inspector returns an inspector of the clusterset of the cluster.
+func (c *clients) inspector() *clusterset.Inspector {
+	return &clusterset.Inspector{
+		Client: c.k8sClient,
+		CloudMap: cloudmap.NewServiceDiscoveryClientWithConfig(&c.awsCfg, cloudmap.DefaultSdCacheConfig(),
+			cloudmap.DefaultOperationPollerConfig(), c.nsMapper, c.clusterUtils),
+		ClusterId: c.clusterId,
+	}
+}
+
+// janitor returns a janitor of a clusterset, mapping the namespaces to the Cloud Map namespaces of that clusterset.
+func (c *clients) janitor(clusterSetId string) (janitor.CloudMapJanitor, error) {
+	nsMapper, err := cloudmap.NewNamespaceMapper(c.nsMapperConfig, c.k8sClient, model.NewClusterUtilsWithValues(c.clusterId, clusterSetId))
+	if err != nil {
+		return nil, err
+	}
+	return janitor.NewJanitorFromConfig(&c.awsCfg, clusterSetId, nsMapper), nil
+}
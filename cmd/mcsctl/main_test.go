@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/janitor"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestRun_Usage(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	s := streams{in: &bytes.Buffer{}, out: stdout, err: stderr}
+	assert.Equal(t, 1, run(context.TODO(), []string{}, s))
+	assert.Contains(t, stderr.String(), "Commands:")
+
+	stderr.Reset()
+	assert.Equal(t, 0, run(context.TODO(), []string{"help"}, s))
+	for _, name := range commandNames {
+		assert.Contains(t, stderr.String(), name)
+	}
+
+	stderr.Reset()
+	assert.Equal(t, 0, run(context.TODO(), []string{"diff", "-h"}, s))
+	assert.Contains(t, stderr.String(), "mcsctl diff [flags]")
+	assert.Empty(t, stdout.String())
+}
+
+func TestRun_UnknownCommand(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	s := streams{in: &bytes.Buffer{}, out: stdout, err: stderr}
+	assert.Equal(t, 1, run(context.TODO(), []string{"unknown"}, s))
+	assert.Contains(t, stderr.String(), "unknown command \"unknown\"")
+}
+
+func TestRun_InvalidArguments(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	s := streams{in: &bytes.Buffer{}, out: stdout, err: stderr}
+	assert.Equal(t, 1, run(context.TODO(), []string{"services", "--unknown-flag"}, s))
+
+	stderr.Reset()
+	assert.Equal(t, 1, run(context.TODO(), []string{"services", "-o", "yaml"}, s))
+	assert.Contains(t, stderr.String(), "invalid output format \"yaml\"")
+
+	stderr.Reset()
+	assert.Equal(t, 1, run(context.TODO(), []string{"conflicts", "extra"}, s))
+	assert.Contains(t, stderr.String(), "unexpected arguments [extra]")
+
+	stderr.Reset()
+	assert.Equal(t, 1, run(context.TODO(), []string{"endpoints"}, s))
+	assert.Contains(t, stderr.String(), "expected a single <namespace>/<name> argument")
+	assert.Empty(t, stdout.String())
+}
+
+func TestRun_CleanupInvalidScope(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	s := streams{in: &bytes.Buffer{}, out: stdout, err: stderr}
+	assert.Equal(t, 1, run(context.TODO(), []string{"cleanup", "--delete-namespace"}, s))
+	assert.Contains(t, stderr.String(), "--delete-namespace requires --delete-services")
+
+	stderr.Reset()
+	assert.Equal(t, 1, run(context.TODO(), []string{"cleanup", "--delete-services", "--delete-namespace", "--service", "svc"}, s))
+	assert.Contains(t, stderr.String(), "--delete-namespace requires --delete-services")
+
+	stderr.Reset()
+	assert.Equal(t, 0, run(context.TODO(), []string{"cleanup", "-h"}, s))
+	assert.Contains(t, stderr.String(), "-min-export-age")
+	assert.Empty(t, stdout.String())
+}
+
+func TestConfirmed(t *testing.T) {
+	for answer, expected := range map[string]bool{"y\n": true, "YES\n": true, "yes": true, "n\n": false, "\n": false, "": false} {
+		assert.Equal(t, expected, confirmed(streams{in: bytes.NewBufferString(answer)}), answer)
+	}
+}
+
+func TestSummarizeCleanup(t *testing.T) {
+	plans := []*janitor.Plan{cleanupPlanForTest(), {Namespace: "other", Instances: []janitor.Instance{{Id: "inst"}}}}
+	assert.Equal(t, "3 instance(s), 1 service(s) and 1 namespace(s)", summarizeCleanup(plans))
+}
+
+func TestRun_Version(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	s := streams{in: &bytes.Buffer{}, out: stdout, err: stderr}
+	assert.Equal(t, 0, run(context.TODO(), []string{"version"}, s))
+	assert.Contains(t, stdout.String(), "aws-cloud-map-mcs-controller-for-k8s")
+}
+
+func TestParseServiceName(t *testing.T) {
+	name, err := parseServiceName("ns/svc", "")
+	assert.NoError(t, err)
+	assert.Equal(t, types.NamespacedName{Namespace: "ns", Name: "svc"}, name)
+
+	name, err = parseServiceName("svc", "ns")
+	assert.NoError(t, err)
+	assert.Equal(t, types.NamespacedName{Namespace: "ns", Name: "svc"}, name)
+
+	for _, invalid := range []string{"svc", "ns/", "/svc", "ns/svc/other"} {
+		_, err = parseServiceName(invalid, "")
+		assert.Error(t, err, invalid)
+	}
+}
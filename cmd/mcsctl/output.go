@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/clusterset"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/janitor"
+)
+
+// outputFormat is the format of the command output.
+type outputFormat string
+
+const (
+	tableOutput outputFormat = "table"
+	jsonOutput  outputFormat = "json"
+)
+
+func parseOutputFormat(value string) (outputFormat, error) {
+	switch format := outputFormat(value); format {
+	case tableOutput, jsonOutput:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid output format %q, expected %s or %s", value, tableOutput, jsonOutput)
+	}
+}
+
+// printServices prints the clusterset services with the number of ready endpoints of all their clusters.
+func printServices(w io.Writer, format outputFormat, services []*clusterset.Service) error {
+	if format == jsonOutput {
+		return printJson(w, services)
+	}
+	return printTable(w, []string{"NAMESPACE", "NAME", "TYPE", "CLUSTERS", "READY"}, func(tw io.Writer) {
+		for _, svc := range services {
+			clusterIds := make([]string, 0, len(svc.Clusters))
+			ready, total := 0, 0
+			for _, cluster := range svc.Clusters {
+				clusterIds = append(clusterIds, cluster.ClusterId)
+				clusterReady, clusterTotal := cluster.ReadyEndpoints()
+				ready += clusterReady
+				total += clusterTotal
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d/%d\n", svc.Namespace, svc.Name,
+				valueOrNone(strings.Join(svc.ServiceTypes(), ",")), valueOrNone(strings.Join(clusterIds, ",")), ready, total)
+		}
+	})
+}
+
+// printEndpoints prints the endpoints of a clusterset service grouped by cluster.
+func printEndpoints(w io.Writer, format outputFormat, svc *clusterset.Service) error {
+	if format == jsonOutput {
+		return printJson(w, svc)
+	}
+	return printTable(w, []string{"CLUSTER", "TYPE", "ADDRESS", "PORT", "SERVICE PORT", "READY", "HOSTNAME"}, func(tw io.Writer) {
+		for _, cluster := range svc.Clusters {
+			for _, endpoint := range cluster.Endpoints {
+				servicePort := fmt.Sprintf("%d/%s", endpoint.ServicePort, endpoint.Protocol)
+				if endpoint.PortName != "" {
+					servicePort = endpoint.PortName + ":" + servicePort
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%t\t%s\n", cluster.ClusterId, cluster.ServiceType,
+					endpoint.Address, endpoint.Port, servicePort, endpoint.Ready, valueOrNone(endpoint.Hostname))
+			}
+		}
+	})
+}
+
+// printDifferences prints the differences between Cloud Map and the local cluster.
+func printDifferences(w io.Writer, format outputFormat, differences []clusterset.Difference) error {
+	if format == jsonOutput {
+		return printJson(w, differences)
+	}
+	return printTable(w, []string{"NAMESPACE", "NAME", "KIND", "DETAIL"}, func(tw io.Writer) {
+		for _, difference := range differences {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", difference.Namespace, difference.Name, difference.Kind, difference.Detail)
+		}
+	})
+}
+
+// printConflicts prints the conflicts between the exports of the clusterset services.
+func printConflicts(w io.Writer, format outputFormat, conflicts []clusterset.Conflict) error {
+	if format == jsonOutput {
+		return printJson(w, conflicts)
+	}
+	return printTable(w, []string{"NAMESPACE", "NAME", "KIND", "CLUSTERS", "DETAIL"}, func(tw io.Writer) {
+		for _, conflict := range conflicts {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", conflict.Namespace, conflict.Name, conflict.Kind,
+				strings.Join(conflict.Clusters, ","), conflict.Detail)
+		}
+	})
+}
+
+// printCleanup prints the Cloud Map resources removed, or to remove, by a cleanup.
+func printCleanup(w io.Writer, format outputFormat, plans []*janitor.Plan) error {
+	if format == jsonOutput {
+		return printJson(w, plans)
+	}
+	return printTable(w, []string{"NAMESPACE", "RESOURCE", "NAME", "ID", "CLUSTER"}, func(tw io.Writer) {
+		for _, plan := range plans {
+			for _, inst := range plan.Instances {
+				fmt.Fprintf(tw, "%s\tInstance\t%s\t%s\t%s\n", plan.Namespace, inst.Service, inst.Id, valueOrNone(inst.ClusterId))
+			}
+			for _, svc := range plan.Services {
+				fmt.Fprintf(tw, "%s\tService\t%s\t%s\t<none>\n", plan.Namespace, svc.Name, svc.Id)
+			}
+			if plan.DeleteNamespace {
+				fmt.Fprintf(tw, "%s\tNamespace\t%s\t%s\t<none>\n", plan.Namespace, plan.Namespace, plan.NamespaceId)
+			}
+		}
+	})
+}
+
+func printTable(w io.Writer, headers []string, printRows func(tw io.Writer)) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	printRows(tw)
+	return tw.Flush()
+}
+
+func printJson(w io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
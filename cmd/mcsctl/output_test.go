@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/clusterset"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/janitor"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOutputFormat(t *testing.T) {
+	format, err := parseOutputFormat("table")
+	assert.NoError(t, err)
+	assert.Equal(t, tableOutput, format)
+
+	format, err = parseOutputFormat("json")
+	assert.NoError(t, err)
+	assert.Equal(t, jsonOutput, format)
+
+	_, err = parseOutputFormat("yaml")
+	assert.Error(t, err)
+}
+
+func TestPrintServices(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := printServices(out, tableOutput, []*clusterset.Service{serviceForTest(), {Namespace: "ns", Name: "empty"}})
+	assert.NoError(t, err)
+	assert.Equal(t, ""+
+		"NAMESPACE   NAME    TYPE           CLUSTERS              READY\n"+
+		"ns          svc     ClusterSetIP   cluster-1,cluster-2   2/3\n"+
+		"ns          empty   <none>         <none>                0/0\n", out.String())
+
+	out.Reset()
+	err = printServices(out, jsonOutput, []*clusterset.Service{serviceForTest()})
+	assert.NoError(t, err)
+	var services []*clusterset.Service
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &services))
+	assert.Equal(t, []*clusterset.Service{serviceForTest()}, services)
+}
+
+func TestPrintEndpoints(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := printEndpoints(out, tableOutput, serviceForTest())
+	assert.NoError(t, err)
+	assert.Equal(t, ""+
+		"CLUSTER     TYPE           ADDRESS    PORT   SERVICE PORT    READY   HOSTNAME\n"+
+		"cluster-1   ClusterSetIP   10.0.0.1   80     http:8080/TCP   true    host\n"+
+		"cluster-1   ClusterSetIP   10.0.0.2   80     http:8080/TCP   false   <none>\n"+
+		"cluster-2   ClusterSetIP   10.1.0.1   80     http:8080/TCP   true    <none>\n", out.String())
+
+	out.Reset()
+	err = printEndpoints(out, jsonOutput, serviceForTest())
+	assert.NoError(t, err)
+	svc := &clusterset.Service{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), svc))
+	assert.Equal(t, serviceForTest(), svc)
+}
+
+func TestPrintDifferences(t *testing.T) {
+	differences := []clusterset.Difference{
+		{Namespace: "ns", Name: "svc", Kind: clusterset.ImportMissing, Detail: "detail"},
+	}
+	out := &bytes.Buffer{}
+	assert.NoError(t, printDifferences(out, tableOutput, differences))
+	assert.Equal(t, ""+
+		"NAMESPACE   NAME   KIND            DETAIL\n"+
+		"ns          svc    ImportMissing   detail\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, printDifferences(out, jsonOutput, []clusterset.Difference{}))
+	assert.Equal(t, "[]\n", out.String())
+}
+
+func TestPrintConflicts(t *testing.T) {
+	conflicts := []clusterset.Conflict{
+		{Namespace: "ns", Name: "svc", Kind: clusterset.PortConflict, Clusters: []string{"cluster-1", "cluster-2"}, Detail: "detail"},
+	}
+	out := &bytes.Buffer{}
+	assert.NoError(t, printConflicts(out, tableOutput, conflicts))
+	assert.Equal(t, ""+
+		"NAMESPACE   NAME   KIND   CLUSTERS              DETAIL\n"+
+		"ns          svc    Port   cluster-1,cluster-2   detail\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, printConflicts(out, jsonOutput, conflicts))
+	var printed []clusterset.Conflict
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &printed))
+	assert.Equal(t, conflicts, printed)
+}
+
+func TestPrintCleanup(t *testing.T) {
+	out := &bytes.Buffer{}
+	assert.NoError(t, printCleanup(out, tableOutput, []*janitor.Plan{cleanupPlanForTest()}))
+	assert.Equal(t, ""+
+		"NAMESPACE   RESOURCE    NAME   ID       CLUSTER\n"+
+		"ns          Instance    svc    inst-1   cluster-1\n"+
+		"ns          Instance    svc    inst-2   cluster-2\n"+
+		"ns          Service     svc    svc-id   <none>\n"+
+		"ns          Namespace   ns     ns-id    <none>\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, printCleanup(out, jsonOutput, []*janitor.Plan{cleanupPlanForTest()}))
+	var plans []*janitor.Plan
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &plans))
+	assert.Equal(t, []*janitor.Plan{cleanupPlanForTest()}, plans)
+}
+
+func cleanupPlanForTest() *janitor.Plan {
+	return &janitor.Plan{
+		Namespace:   "ns",
+		NamespaceId: "ns-id",
+		Instances: []janitor.Instance{
+			{Service: "svc", ServiceId: "svc-id", Id: "inst-1", ClusterId: "cluster-1"},
+			{Service: "svc", ServiceId: "svc-id", Id: "inst-2", ClusterId: "cluster-2"},
+		},
+		Services:        []janitor.Service{{Name: "svc", Id: "svc-id"}},
+		DeleteNamespace: true,
+	}
+}
+
+func serviceForTest() *clusterset.Service {
+	return &clusterset.Service{
+		Namespace: "ns",
+		Name:      "svc",
+		Clusters: []clusterset.ClusterEndpoints{
+			{ClusterId: "cluster-1", ServiceType: model.ClusterSetIPType, Endpoints: []clusterset.Endpoint{
+				{Address: "10.0.0.1", Port: 80, Protocol: "TCP", ServicePort: 8080, PortName: "http", Ready: true, Hostname: "host"},
+				{Address: "10.0.0.2", Port: 80, Protocol: "TCP", ServicePort: 8080, PortName: "http", Ready: false},
+			}},
+			{ClusterId: "cluster-2", ServiceType: model.ClusterSetIPType, Endpoints: []clusterset.Endpoint{
+				{Address: "10.1.0.1", Port: 80, Protocol: "TCP", ServicePort: 8080, PortName: "http", Ready: true},
+			}},
+		},
+	}
+}
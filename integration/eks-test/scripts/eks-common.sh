@@ -5,6 +5,7 @@ export KUBECTL_BIN='kubectl'
 export LOGS='./integration/eks-test/testlog'
 export CONFIGS='./integration/eks-test/configs'
 export SCENARIOS='./integration/shared/scenarios'
+export EKS_SCENARIOS='./integration/eks-test/scenarios'
 export NAMESPACE='aws-cloud-map-mcs-eks-e2e'
 export MCS_NAMESPACE='cloud-map-mcs-system'
 export SERVICE='nginx-hello'
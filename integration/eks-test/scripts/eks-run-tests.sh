@@ -10,19 +10,13 @@ if ! endpts=$(./integration/shared/scripts/poll-endpoints.sh "$EXPECTED_ENDPOINT
     exit $?
 fi
 
-# Runner to verify expected endpoints are exported to Cloud Map
-go run $SCENARIOS/runner/main.go $NAMESPACE $SERVICE $CLUSTERID1 $CLUSTERSETID1 $ENDPT_PORT $SERVICE_PORT $SERVICE_TYPE "$endpts"
+# Runner to verify expected endpoints are exported to Cloud Map and imported in the importing cluster
+ENDPOINTS="$endpts" go run $SCENARIOS/runner "$EKS_SCENARIOS/export.yaml" "$EKS_SCENARIOS/import.yaml"
 exit_code=$?
 
-# Check imported endpoints in importing cluster
-if [ "$exit_code" -eq 0 ] ; then
-  $KUBECTL_BIN config use-context $IMPORT_CLS
-  ./integration/shared/scripts/test-import.sh "$EXPECTED_ENDPOINT_COUNT" "$endpts"
-  exit_code=$?
-fi
-  
 # Verifying that importing cluster is properly consuming services
 if [ "$exit_code" -eq 0 ] ; then
+  $KUBECTL_BIN config use-context $IMPORT_CLS
   ./integration/eks-test/scripts/eks-DNS-test.sh
   exit_code=$?
 fi
@@ -47,17 +41,12 @@ if [ "$exit_code" -eq 0 ] ; then
 fi
 
 if [ "$exit_code" -eq 0 ] ; then
-  go run $SCENARIOS/runner/main.go $NAMESPACE $SERVICE $CLUSTERID1 $CLUSTERSETID1 $ENDPT_PORT $SERVICE_PORT $SERVICE_TYPE "$updated_endpoints" 
+  ENDPOINTS="$updated_endpoints" go run $SCENARIOS/runner "$EKS_SCENARIOS/export.yaml" "$EKS_SCENARIOS/import.yaml"
   exit_code=$?
 fi
 
 if [ "$exit_code" -eq 0 ] ; then
   $KUBECTL_BIN config use-context $IMPORT_CLS
-  ./integration/shared/scripts/test-import.sh "$UPDATED_ENDPOINT_COUNT" "$updated_endpoints"
-  exit_code=$?
-fi
-  
-if [ "$exit_code" -eq 0 ] ; then
   ./integration/eks-test/scripts/eks-DNS-test.sh
   exit_code=$?
 fi
@@ -2,22 +2,50 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
 
-	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/integration/janitor"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/cloudmap"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/janitor"
 )
 
 func main() {
-	if len(os.Args) != 4 {
+	nsMapperConfig := cloudmap.DefaultNamespaceMapperConfig()
+	flag.StringVar(&nsMapperConfig.Template, "cloudmap-namespace-template", "", "Go template of the Cloud Map namespace names")
+	flag.StringVar(&nsMapperConfig.Prefix, "cloudmap-namespace-prefix", "", "The prefix of the Cloud Map namespace names")
+	flag.StringVar(&nsMapperConfig.Suffix, "cloudmap-namespace-suffix", "", "The suffix of the Cloud Map namespace names")
+	flag.Parse()
+
+	if flag.NArg() != 3 {
 		fmt.Println("Expected namespace name, clusterId, clusterSetId arguments")
 		os.Exit(1)
 	}
 
-	nsName := os.Args[1]
-	clusterId := os.Args[2]
-	clusterSetId := os.Args[3]
+	nsName := flag.Arg(0)
+	clusterId := flag.Arg(1)
+	clusterSetId := flag.Arg(2)
 
-	j := janitor.NewDefaultJanitor(clusterId, clusterSetId)
-	j.Cleanup(context.TODO(), nsName)
+	j, err := janitor.NewJanitorWithNamespaceMapping(clusterId, clusterSetId, nsMapperConfig)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("Cleaning up all test resources in Cloud Map for namespace : %s\n", nsName)
+	removed, err := j.Cleanup(context.TODO(), nsName)
+	for _, inst := range removed.Instances {
+		fmt.Printf("instance de-registered: %s/%s\n", inst.Service, inst.Id)
+	}
+	for _, svc := range removed.Services {
+		fmt.Printf("service deleted: %s (%s)\n", svc.Name, svc.Id)
+	}
+	if removed.DeleteNamespace {
+		fmt.Printf("namespace deleted: %s (%s)\n", removed.Namespace, removed.NamespaceId)
+	}
+	if err != nil {
+		fmt.Printf("clean up failed: %s\n", err.Error())
+		os.Exit(1)
+	}
+	fmt.Println("clean up successful")
 }
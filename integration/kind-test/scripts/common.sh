@@ -6,6 +6,7 @@ export LOGS='./integration/kind-test/testlog'
 export KIND_CONFIGS='./integration/kind-test/configs'
 export SHARED_CONFIGS='./integration/shared/configs'
 export SCENARIOS='./integration/shared/scenarios'
+export KIND_SCENARIOS='./integration/kind-test/scenarios'
 export NAMESPACE='aws-cloud-map-mcs-e2e'
 export ENDPT_PORT=80
 export SERVICE_PORT=80
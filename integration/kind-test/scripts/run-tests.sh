@@ -25,14 +25,10 @@ mkdir -p "$LOGS"
 CTL_PID=$!
 echo "controller PID:$CTL_PID"
 
-go run $SCENARIOS/runner/main.go $NAMESPACE $SERVICE $CLUSTERID1 $CLUSTERSETID1 $ENDPT_PORT $SERVICE_PORT $SERVICE_TYPE $IP_TYPE "$endpts"
+# Verify the endpoints are exported to Cloud Map and imported back into the cluster
+ENDPOINTS="$endpts" go run $SCENARIOS/runner "$KIND_SCENARIOS/export.yaml" "$KIND_SCENARIOS/import.yaml"
 exit_code=$?
 
-if [ "$exit_code" -eq 0 ] ; then
-  ./integration/shared/scripts/test-import.sh "$EXPECTED_ENDPOINT_COUNT" "$endpts"
-  exit_code=$?
-fi
-
 if [ "$exit_code" -eq 0 ] ; then
   ./integration/kind-test/scripts/dns-test.sh "$EXPECTED_ENDPOINT_COUNT"
   exit_code=$?
@@ -59,12 +55,7 @@ if [ "$exit_code" -eq 0 ] ; then
 fi
 
 if [ "$exit_code" -eq 0 ] ; then
-  go run $SCENARIOS/runner/main.go $NAMESPACE $SERVICE $CLUSTERID1 $CLUSTERSETID1 $ENDPT_PORT $SERVICE_PORT $SERVICE_TYPE $IP_TYPE "$updated_endpoints"
-  exit_code=$?
-fi
-
-if [ "$exit_code" -eq 0 ] ; then
-  ./integration/shared/scripts/test-import.sh "$UPDATED_ENDPOINT_COUNT" "$updated_endpoints"
+  ENDPOINTS="$updated_endpoints" go run $SCENARIOS/runner "$KIND_SCENARIOS/export.yaml" "$KIND_SCENARIOS/import.yaml"
   exit_code=$?
 fi
 
@@ -73,14 +64,18 @@ if [ "$exit_code" -eq 0 ] ; then
   exit_code=$?
 fi
 
-echo "Test Successful. Cleaning up..."
-
 # Remove the deployment and delete service (should also delete ServiceExport)
 if [ "$exit_code" -eq 0 ] ; then
+  echo "Cleaning up..."
   $KUBECTL_BIN delete -f "$KIND_CONFIGS/e2e-deployment.yaml"
   $KUBECTL_BIN delete Service $SERVICE -n $NAMESPACE
-  # TODO: verify service export is not found
-  # TODO: verify cloudmap resources are cleaned up
+  # Verify the endpoints are removed from Cloud Map and from the import
+  go run $SCENARIOS/runner "$KIND_SCENARIOS/deletion.yaml"
+  exit_code=$?
+fi
+
+if [ "$exit_code" -eq 0 ] ; then
+  echo "Test Successful."
 fi
 
 echo "killing controller PID:$CTL_PID"
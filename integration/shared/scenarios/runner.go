@@ -0,0 +1,447 @@
+package scenarios
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	multiclusterv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/multicluster/v1alpha1"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/cloudmap"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/common"
+	controllers "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/controllers/multicluster"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	v1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	defaultScenarioPollInterval = 10 * time.Second
+	defaultScenarioPollTimeout  = 2 * time.Minute
+)
+
+// RunnerConfig holds the clients and polling settings of a scenario Runner.
+type RunnerConfig struct {
+	// CloudMap returns the Cloud Map client reading the services of a clusterset.
+	CloudMap func(clusterSetId string) (cloudmap.ServiceDiscoveryClient, error)
+	// Cluster returns the client of the cluster of a kubeconfig context, the current context if empty.
+	Cluster func(context string) (client.Client, error)
+	// PollInterval is the time between two runs of the checks of a scenario.
+	PollInterval time.Duration
+	// PollTimeout is the time after which a scenario whose checks still fail has failed.
+	PollTimeout time.Duration
+	// Out receives the progress of the scenarios.
+	Out io.Writer
+}
+
+// Runner runs the checks of integration test scenarios until they pass or time out.
+type Runner struct {
+	config RunnerConfig
+}
+
+// check compares the clusterset with a scenario. It returns a mismatchError while the clusterset does not match the
+// scenario yet, and any other error when the clusterset cannot be read.
+type check func(r *Runner, ctx context.Context, s *Scenario) error
+
+// mismatchError is a difference between the clusterset and a scenario, which may disappear as the controllers
+// reconcile.
+type mismatchError struct {
+	msg string
+}
+
+func (e *mismatchError) Error() string {
+	return e.msg
+}
+
+func mismatchf(format string, args ...interface{}) error {
+	return &mismatchError{msg: fmt.Sprintf(format, args...)}
+}
+
+// NewRunner returns a Runner, with the default poll interval and timeout if they are not set.
+func NewRunner(config RunnerConfig) *Runner {
+	if config.PollInterval == 0 {
+		config.PollInterval = defaultScenarioPollInterval
+	}
+	if config.PollTimeout == 0 {
+		config.PollTimeout = defaultScenarioPollTimeout
+	}
+	if config.Out == nil {
+		config.Out = io.Discard
+	}
+	return &Runner{config: config}
+}
+
+// Run polls the checks of the scenario kind until they all pass, and returns the last mismatch if they time out.
+func (r *Runner) Run(ctx context.Context, s *Scenario) error {
+	fmt.Fprintf(r.config.Out, "running %s scenario %s for service %s/%s\n", s.Kind, s.Name, s.Namespace, s.Service)
+	checks := checksOf(s.Kind)
+
+	var mismatch error
+	err := wait.PollImmediate(r.config.PollInterval, r.config.PollTimeout, func() (done bool, err error) {
+		for _, c := range checks {
+			err = c(r, ctx, s)
+			if isMismatch(err) {
+				mismatch = err
+				fmt.Fprintf(r.config.Out, "  not matching yet: %s\n", err)
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+	if errors.Is(err, wait.ErrWaitTimeout) && mismatch != nil {
+		return fmt.Errorf("%w: %s", err, mismatch)
+	}
+	if err == nil {
+		fmt.Fprintf(r.config.Out, "scenario %s passed\n", s.Name)
+	}
+	return err
+}
+
+func checksOf(kind Kind) []check {
+	switch kind {
+	case ExportKind:
+		return []check{(*Runner).checkExports}
+	case ImportKind:
+		return []check{(*Runner).checkImports}
+	case HeadlessKind:
+		return []check{(*Runner).checkExports, (*Runner).checkImports}
+	case ConflictKind:
+		return []check{(*Runner).checkExports, (*Runner).checkConflicts}
+	case DeletionKind:
+		return []check{(*Runner).checkDeletion}
+	}
+	return nil
+}
+
+func isMismatch(err error) bool {
+	var mismatch *mismatchError
+	return errors.As(err, &mismatch)
+}
+
+// checkExports compares the endpoints of the service in Cloud Map with the endpoints of the exports.
+func (r *Runner) checkExports(ctx context.Context, s *Scenario) error {
+	cmService, err := r.getCloudMapService(ctx, s)
+	if err != nil {
+		return err
+	}
+	if cmService == nil {
+		return mismatchf("service %s/%s not found in Cloud Map", s.Namespace, s.Service)
+	}
+
+	expected := make(map[string]*model.Endpoint)
+	for _, endpoint := range s.expectedEndpoints() {
+		expected[endpoint.ClusterId+"/"+endpoint.Id] = endpoint
+	}
+	actual := make(map[string]*model.Endpoint)
+	for _, endpoint := range cmService.Endpoints {
+		actual[endpoint.ClusterId+"/"+endpoint.Id] = comparableEndpoint(endpoint)
+	}
+
+	differences := make([]string, 0)
+	for key, endpoint := range expected {
+		actualEndpoint, found := actual[key]
+		if !found {
+			differences = append(differences, "missing endpoint "+key)
+		} else if !endpoint.Equals(actualEndpoint) {
+			differences = append(differences, fmt.Sprintf("endpoint %s is %s, expected %s", key, actualEndpoint, endpoint))
+		}
+	}
+	for key := range actual {
+		if _, found := expected[key]; !found {
+			differences = append(differences, "unexpected endpoint "+key)
+		}
+	}
+	if len(differences) > 0 {
+		sort.Strings(differences)
+		return mismatchf("Cloud Map service %s/%s: %s", s.Namespace, s.Service, strings.Join(differences, ", "))
+	}
+	return nil
+}
+
+// checkImports compares the ServiceImport, derived Services and imported EndpointSlices of the importing clusters
+// with the exports.
+func (r *Runner) checkImports(ctx context.Context, s *Scenario) error {
+	for _, cluster := range s.Imports {
+		k8sClient, err := r.config.Cluster(cluster.Context)
+		if err != nil {
+			return err
+		}
+		if err = s.checkImport(ctx, k8sClient, cluster.ClusterId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Scenario) checkImport(ctx context.Context, k8sClient client.Client, clusterId string) error {
+	svcImport := &multiclusterv1alpha1.ServiceImport{}
+	err := k8sClient.Get(ctx, types.NamespacedName{Namespace: s.Namespace, Name: s.Service}, svcImport)
+	if apierrors.IsNotFound(err) {
+		return mismatchf("ServiceImport %s/%s not found in cluster %s", s.Namespace, s.Service, clusterId)
+	}
+	if err != nil {
+		return err
+	}
+
+	if expectedType := controllers.ServiceTypetoServiceImportType(s.ServiceType); svcImport.Spec.Type != expectedType {
+		return mismatchf("ServiceImport of cluster %s has type %s, expected %s", clusterId, svcImport.Spec.Type, expectedType)
+	}
+	ports := make([]string, 0, len(svcImport.Spec.Ports))
+	for _, port := range svcImport.Spec.Ports {
+		ports = append(ports, portKey(port.Name, port.Port, string(port.Protocol)))
+	}
+	if !equalSets(ports, s.expectedServicePorts()) {
+		return mismatchf("ServiceImport of cluster %s has ports %v, expected %v", clusterId, sorted(ports), sorted(s.expectedServicePorts()))
+	}
+	importedClusters := make([]string, 0, len(svcImport.Status.Clusters))
+	for _, cluster := range svcImport.Status.Clusters {
+		importedClusters = append(importedClusters, cluster.Cluster)
+	}
+	if !equalSets(importedClusters, s.exportingClusterIds()) {
+		return mismatchf("ServiceImport of cluster %s imports clusters %v, expected %v", clusterId, sorted(importedClusters), sorted(s.exportingClusterIds()))
+	}
+
+	derivedServices := &v1.ServiceList{}
+	if err = k8sClient.List(ctx, derivedServices, client.InNamespace(s.Namespace),
+		client.MatchingLabels{controllers.LabelDerivedServiceOriginatingName: s.Service}); err != nil {
+		return err
+	}
+	derivedClusters := make([]string, 0, len(derivedServices.Items))
+	for _, derivedService := range derivedServices.Items {
+		derivedClusters = append(derivedClusters, derivedService.Labels[controllers.LabelSourceCluster])
+		if headless := derivedService.Spec.ClusterIP == v1.ClusterIPNone; headless != (s.ServiceType == model.HeadlessType) {
+			return mismatchf("derived Service %s of cluster %s has cluster IP %q for a %s service", derivedService.Name, clusterId,
+				derivedService.Spec.ClusterIP, s.ServiceType)
+		}
+	}
+	if !equalSets(derivedClusters, s.exportingClusterIds()) {
+		return mismatchf("cluster %s has derived Services for clusters %v, expected %v", clusterId, sorted(derivedClusters), sorted(s.exportingClusterIds()))
+	}
+
+	addresses, err := importedAddresses(ctx, k8sClient, s.Namespace, s.Service)
+	if err != nil {
+		return err
+	}
+	if !equalSets(addresses, s.expectedAddresses()) {
+		return mismatchf("cluster %s imports addresses %v, expected %v", clusterId, sorted(addresses), sorted(s.expectedAddresses()))
+	}
+	return nil
+}
+
+// checkConflicts checks an exporting cluster recorded a conflict event for its ServiceExport.
+func (r *Runner) checkConflicts(ctx context.Context, s *Scenario) error {
+	for _, export := range s.Exports {
+		k8sClient, err := r.config.Cluster(export.Context)
+		if err != nil {
+			return err
+		}
+		events := &v1.EventList{}
+		if err = k8sClient.List(ctx, events, client.InNamespace(s.Namespace)); err != nil {
+			return err
+		}
+		for _, event := range events.Items {
+			if event.InvolvedObject.Kind == "ServiceExport" && event.InvolvedObject.Name == s.Service &&
+				event.Reason == controllers.ExportConflictEventReason {
+				return nil
+			}
+		}
+	}
+	return mismatchf("no %s event for ServiceExport %s/%s", controllers.ExportConflictEventReason, s.Namespace, s.Service)
+}
+
+// checkDeletion checks the endpoints of the exports are removed from Cloud Map, and from the ServiceImports and
+// derived Services of the importing clusters.
+func (r *Runner) checkDeletion(ctx context.Context, s *Scenario) error {
+	deleted := make(map[string]bool)
+	for _, clusterId := range s.exportingClusterIds() {
+		deleted[clusterId] = true
+	}
+
+	cmService, err := r.getCloudMapService(ctx, s)
+	if err != nil {
+		return err
+	}
+	if cmService != nil {
+		for _, endpoint := range cmService.Endpoints {
+			if deleted[endpoint.ClusterId] {
+				return mismatchf("Cloud Map service %s/%s still has endpoint %s of cluster %s", s.Namespace, s.Service, endpoint.Id, endpoint.ClusterId)
+			}
+		}
+	}
+
+	for _, cluster := range s.Imports {
+		k8sClient, err := r.config.Cluster(cluster.Context)
+		if err != nil {
+			return err
+		}
+		svcImport := &multiclusterv1alpha1.ServiceImport{}
+		err = k8sClient.Get(ctx, types.NamespacedName{Namespace: s.Namespace, Name: s.Service}, svcImport)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, status := range svcImport.Status.Clusters {
+			if deleted[status.Cluster] {
+				return mismatchf("ServiceImport of cluster %s still imports cluster %s", cluster.ClusterId, status.Cluster)
+			}
+		}
+		derivedServices := &v1.ServiceList{}
+		if err = k8sClient.List(ctx, derivedServices, client.InNamespace(s.Namespace),
+			client.MatchingLabels{controllers.LabelDerivedServiceOriginatingName: s.Service}); err != nil {
+			return err
+		}
+		for _, derivedService := range derivedServices.Items {
+			if sourceCluster := derivedService.Labels[controllers.LabelSourceCluster]; deleted[sourceCluster] {
+				return mismatchf("cluster %s still has derived Service %s of cluster %s", cluster.ClusterId, derivedService.Name, sourceCluster)
+			}
+		}
+	}
+	return nil
+}
+
+// getCloudMapService returns the service of the scenario in Cloud Map, nil if it is not found.
+func (r *Runner) getCloudMapService(ctx context.Context, s *Scenario) (*model.Service, error) {
+	cm, err := r.config.CloudMap(s.ClusterSetId)
+	if err != nil {
+		return nil, err
+	}
+	cmService, err := cm.GetService(ctx, s.Namespace, s.Service)
+	if common.IsNotFound(err) {
+		return nil, nil
+	}
+	return cmService, err
+}
+
+// importedAddresses returns the addresses of the ready endpoints of the EndpointSlices imported for a service.
+func importedAddresses(ctx context.Context, k8sClient client.Client, namespace string, name string) ([]string, error) {
+	slices := &discovery.EndpointSliceList{}
+	if err := k8sClient.List(ctx, slices, client.InNamespace(namespace), client.MatchingLabels{
+		controllers.LabelServiceImportName:      name,
+		controllers.LabelEndpointSliceManagedBy: controllers.ValueEndpointSliceManagedBy,
+	}); err != nil {
+		return nil, err
+	}
+	addresses := make([]string, 0)
+	for _, slice := range slices.Items {
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+				addresses = append(addresses, endpoint.Addresses...)
+			}
+		}
+	}
+	return addresses, nil
+}
+
+// expectedEndpoints returns the Cloud Map endpoints of the exports, one for each address and port.
+func (s *Scenario) expectedEndpoints() []*model.Endpoint {
+	endpoints := make([]*model.Endpoint, 0)
+	for _, export := range s.Exports {
+		addressType, _ := model.GetAddressTypeFromString(export.AddressType)
+		for _, port := range export.Ports {
+			endpointPort := model.Port{
+				Name:     port.Name,
+				Port:     port.TargetPort,
+				Protocol: port.Protocol,
+			}
+			for _, address := range export.Addresses {
+				endpoints = append(endpoints, &model.Endpoint{
+					Id:          model.EndpointIdFromIPAddressAndPort(address, endpointPort),
+					IP:          address,
+					AddressType: addressType,
+					ServicePort: model.Port{
+						Name:       port.Name,
+						Port:       port.Port,
+						TargetPort: strconv.Itoa(int(port.TargetPort)),
+						Protocol:   port.Protocol,
+					},
+					EndpointPort: endpointPort,
+					Ready:        true,
+					ClusterId:    export.ClusterId,
+					ClusterSetId: s.ClusterSetId,
+					ServiceType:  export.ServiceType,
+					Attributes:   make(map[string]string),
+				})
+			}
+		}
+	}
+	return endpoints
+}
+
+// expectedServicePorts returns the distinct service ports of the exports.
+func (s *Scenario) expectedServicePorts() []string {
+	ports := make([]string, 0)
+	for _, export := range s.Exports {
+		for _, port := range export.Ports {
+			ports = append(ports, portKey(port.Name, port.Port, port.Protocol))
+		}
+	}
+	return ports
+}
+
+// expectedAddresses returns the addresses of the exports.
+func (s *Scenario) expectedAddresses() []string {
+	addresses := make([]string, 0)
+	for _, export := range s.Exports {
+		addresses = append(addresses, export.Addresses...)
+	}
+	return addresses
+}
+
+// comparableEndpoint returns a copy of a Cloud Map endpoint without the fields scenarios do not describe: the
+// attributes, which depend on the Kubernetes version and ServiceExport annotations, the ServiceExport creation
+// timestamp, and the node and host names, which are platform dependent.
+func comparableEndpoint(endpoint *model.Endpoint) *model.Endpoint {
+	comparable := *endpoint
+	comparable.Attributes = make(map[string]string)
+	comparable.ServiceExportCreationTimestamp = 0
+	comparable.Nodename = ""
+	comparable.Hostname = ""
+	return &comparable
+}
+
+func portKey(name string, port int32, protocol string) string {
+	key := fmt.Sprintf("%d/%s", port, protocol)
+	if name != "" {
+		key = name + ":" + key
+	}
+	return key
+}
+
+// equalSets returns whether two lists hold the same distinct values.
+func equalSets(a []string, b []string) bool {
+	setA, setB := make(map[string]bool), make(map[string]bool)
+	for _, value := range a {
+		setA[value] = true
+	}
+	for _, value := range b {
+		setB[value] = true
+	}
+	if len(setA) != len(setB) {
+		return false
+	}
+	for value := range setA {
+		if !setB[value] {
+			return false
+		}
+	}
+	return true
+}
+
+func sorted(values []string) []string {
+	values = append([]string{}, values...)
+	sort.Strings(values)
+	return values
+}
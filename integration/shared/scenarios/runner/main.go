@@ -2,55 +2,120 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/integration/shared/scenarios"
+	multiclusterv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/multicluster/v1alpha1"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/cloudmap"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	k8sconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
 )
 
 func main() {
-	if len(os.Args) != 10 {
-		fmt.Println("Expected namespace, service, clusterId, clusterSetId, endpoint port, service port, serviceType, endpoint AddressType, and endpoint IP list as arguments")
-		os.Exit(1)
+	var cloudMapEndpoint string
+	runnerConfig := scenarios.RunnerConfig{Out: os.Stdout}
+	nsMapperConfig := cloudmap.DefaultNamespaceMapperConfig()
+	flag.StringVar(&cloudMapEndpoint, "cloudmap-endpoint", "",
+		"The URL of the Cloud Map API, e.g. of a local Cloud Map stand-in. Defaults to the regional endpoint.")
+	flag.DurationVar(&runnerConfig.PollInterval, "poll-interval", 10*time.Second, "The time between two runs of the checks of a scenario.")
+	flag.DurationVar(&runnerConfig.PollTimeout, "poll-timeout", 2*time.Minute, "The time after which a scenario still not matching has failed.")
+	flag.StringVar(&nsMapperConfig.Template, "cloudmap-namespace-template", "", "Go template of the Cloud Map namespace names")
+	flag.StringVar(&nsMapperConfig.Prefix, "cloudmap-namespace-prefix", "", "The prefix of the Cloud Map namespace names")
+	flag.StringVar(&nsMapperConfig.Suffix, "cloudmap-namespace-suffix", "", "The suffix of the Cloud Map namespace names")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <scenario file or directory>...\n", os.Args[0])
+		flag.PrintDefaults()
 	}
+	flag.Parse()
 
-	nsName := os.Args[1]
-	svcName := os.Args[2]
-	clusterId := os.Args[3]
-	clusterSetId := os.Args[4]
-	port := os.Args[5]
-	servicePort := os.Args[6]
-	serviceType := os.Args[7]
-	addressType := os.Args[8]
-	ips := os.Args[9]
-
-	testServiceExport(nsName, svcName, clusterId, clusterSetId, port, servicePort, serviceType, addressType, ips)
-}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
 
-func testServiceExport(nsName string, svcName string, clusterId string, clusterSetId string, port string, servicePort string, serviceType string, addressType string, ips string) {
-	fmt.Printf("Testing service export integration for namespace %s and service %s\n", nsName, svcName)
+	scenarioList, err := scenarios.LoadScenarios(flag.Args())
+	if err != nil {
+		fmt.Printf("Failed to load the integration test scenarios: %s\n", err.Error())
+		os.Exit(1)
+	}
 
-	export, err := scenarios.NewExportServiceScenario(getAwsConfig(), nsName, svcName, clusterId, clusterSetId, port, servicePort, serviceType, addressType, ips)
+	awsCfg, err := config.LoadDefaultConfig(context.TODO(), cloudmap.WithEndpoint(cloudMapEndpoint))
 	if err != nil {
-		fmt.Printf("Failed to setup service export integration test scenario: %s", err.Error())
+		fmt.Printf("unable to configure AWS session: %s\n", err.Error())
 		os.Exit(1)
 	}
+	runnerConfig.CloudMap = cloudMapClients(&awsCfg, nsMapperConfig)
+	runnerConfig.Cluster = clusterClients()
 
-	if err := export.Run(); err != nil {
-		fmt.Printf("Service export integration test scenario failed: %s", err.Error())
+	runner := scenarios.NewRunner(runnerConfig)
+	failed := 0
+	for _, scenario := range scenarioList {
+		if err = runner.Run(context.TODO(), scenario); err != nil {
+			fmt.Printf("Integration test scenario %s failed: %s\n", scenario.Name, err.Error())
+			failed++
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("%d of %d integration test scenarios failed\n", failed, len(scenarioList))
 		os.Exit(1)
 	}
+	fmt.Printf("%d integration test scenarios passed\n", len(scenarioList))
 }
 
-func getAwsConfig() *aws.Config {
-	awsCfg, err := config.LoadDefaultConfig(context.TODO())
-
-	if err != nil {
-		fmt.Printf("unable to configure AWS session: %s", err.Error())
-		os.Exit(1)
+// cloudMapClients returns the Cloud Map clients of the clustersets, with short-lived caches so that every poll reads
+// the latest Cloud Map state.
+func cloudMapClients(awsCfg *aws.Config, nsMapperConfig *cloudmap.NamespaceMapperConfig) func(string) (cloudmap.ServiceDiscoveryClient, error) {
+	sdClients := make(map[string]cloudmap.ServiceDiscoveryClient)
+	return func(clusterSetId string) (cloudmap.ServiceDiscoveryClient, error) {
+		if sdClient, found := sdClients[clusterSetId]; found {
+			return sdClient, nil
+		}
+		// the cluster ID is only used to register endpoints, which the runner never does
+		clusterUtils := model.NewClusterUtilsWithValues("scenario-runner", clusterSetId)
+		nsMapper, err := cloudmap.NewNamespaceMapper(nsMapperConfig, nil, clusterUtils)
+		if err != nil {
+			return nil, err
+		}
+		sdClient := cloudmap.NewServiceDiscoveryClientWithConfig(awsCfg,
+			&cloudmap.SdCacheConfig{
+				NsTTL:    time.Second,
+				SvcTTL:   time.Second,
+				EndptTTL: time.Second,
+			}, cloudmap.DefaultOperationPollerConfig(), nsMapper, clusterUtils)
+		sdClients[clusterSetId] = sdClient
+		return sdClient, nil
 	}
+}
+
+// clusterClients returns the clients of the clusters of the kubeconfig contexts.
+func clusterClients() func(string) (client.Client, error) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(multiclusterv1alpha1.AddToScheme(scheme))
 
-	return &awsCfg
+	k8sClients := make(map[string]client.Client)
+	return func(context string) (client.Client, error) {
+		if k8sClient, found := k8sClients[context]; found {
+			return k8sClient, nil
+		}
+		restConfig, err := k8sconfig.GetConfigWithContext(context)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the kubeconfig of context %q: %w", context, err)
+		}
+		k8sClient, err := client.New(restConfig, client.Options{Scheme: scheme})
+		if err != nil {
+			return nil, err
+		}
+		k8sClients[context] = k8sClient
+		return k8sClient, nil
+	}
 }
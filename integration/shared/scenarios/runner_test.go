@@ -0,0 +1,308 @@
+package scenarios
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	cloudmapMock "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/mocks/pkg/cloudmap"
+	multiclusterv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/multicluster/v1alpha1"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/cloudmap"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/common"
+	controllers "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/controllers/multicluster"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/test"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRunner_Export(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	cm := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+
+	cm.EXPECT().GetService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(&model.Service{Namespace: test.HttpNsName, Name: test.SvcName, Endpoints: multiclusterEndpointsForTest()}, nil)
+
+	out := &bytes.Buffer{}
+	err := runnerForTest(cm, nil, out).Run(context.TODO(), scenarioForTest(ExportKind))
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "scenario test passed")
+}
+
+func TestRunner_ExportMismatch(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	cm := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+
+	wrongType := multiclusterEndpointsForTest()
+	wrongType[1].ServiceType = model.HeadlessType
+	cm.EXPECT().GetService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(nil, common.NotFoundError("service not found")).Times(1)
+	cm.EXPECT().GetService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(&model.Service{Namespace: test.HttpNsName, Name: test.SvcName, Endpoints: multiclusterEndpointsForTest()[:1]}, nil).Times(1)
+	cm.EXPECT().GetService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(&model.Service{Namespace: test.HttpNsName, Name: test.SvcName, Endpoints: wrongType}, nil).AnyTimes()
+
+	out := &bytes.Buffer{}
+	err := runnerForTest(cm, nil, out).Run(context.TODO(), scenarioForTest(ExportKind))
+	assert.ErrorContains(t, err, "timed out waiting for the condition: Cloud Map service http-ns-name/svc-name: endpoint "+test.ClusterId2)
+	assert.Contains(t, out.String(), "not matching yet: service http-ns-name/svc-name not found in Cloud Map")
+	assert.Contains(t, out.String(), "not matching yet: Cloud Map service http-ns-name/svc-name: missing endpoint "+test.ClusterId2)
+}
+
+func TestRunner_CloudMapError(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	cm := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+
+	cm.EXPECT().GetService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(nil, errors.New("AccessDenied"))
+
+	err := runnerForTest(cm, nil, nil).Run(context.TODO(), scenarioForTest(ExportKind))
+	assert.EqualError(t, err, "AccessDenied")
+}
+
+func TestRunner_Import(t *testing.T) {
+	k8sClient := fakeClientForTest(append(importedObjectsForTest(model.ClusterSetIPType), serviceImportForTest(model.ClusterSetIPType))...)
+
+	err := runnerForTest(nil, k8sClient, nil).Run(context.TODO(), scenarioForTest(ImportKind))
+	assert.NoError(t, err)
+}
+
+func TestRunner_ImportMismatch(t *testing.T) {
+	scenario := scenarioForTest(ImportKind)
+	imported := importedObjectsForTest(model.ClusterSetIPType)
+	tests := []struct {
+		name     string
+		objects  []client.Object
+		expected string
+	}{
+		{
+			name:     "no ServiceImport",
+			objects:  importedObjectsForTest(model.ClusterSetIPType),
+			expected: "ServiceImport http-ns-name/svc-name not found in cluster " + test.ClusterId2,
+		},
+		{
+			name:     "type",
+			objects:  append(importedObjectsForTest(model.ClusterSetIPType), serviceImportForTest(model.HeadlessType)),
+			expected: "ServiceImport of cluster " + test.ClusterId2 + " has type Headless, expected ClusterSetIP",
+		},
+		{
+			name:     "derived Service",
+			objects:  append(importedObjectsForTest(model.HeadlessType), serviceImportForTest(model.ClusterSetIPType)),
+			expected: "cluster IP \"None\" for a ClusterSetIP service",
+		},
+		{
+			name:     "addresses",
+			objects:  []client.Object{imported[0], imported[2], serviceImportForTest(model.ClusterSetIPType)},
+			expected: "cluster " + test.ClusterId2 + " imports addresses [], expected [192.168.0.1 192.168.0.2]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := runnerForTest(nil, fakeClientForTest(tt.objects...), nil).Run(context.TODO(), scenario)
+			assert.ErrorContains(t, err, tt.expected)
+		})
+	}
+}
+
+func TestRunner_Headless(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	cm := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+
+	endpoints := multiclusterEndpointsForTest()
+	for _, endpoint := range endpoints {
+		endpoint.ServiceType = model.HeadlessType
+	}
+	cm.EXPECT().GetService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(&model.Service{Namespace: test.HttpNsName, Name: test.SvcName, Endpoints: endpoints}, nil)
+	k8sClient := fakeClientForTest(append(importedObjectsForTest(model.HeadlessType), serviceImportForTest(model.HeadlessType))...)
+
+	scenario := scenarioForTest(HeadlessKind)
+	err := runnerForTest(cm, k8sClient, nil).Run(context.TODO(), scenario)
+	assert.NoError(t, err)
+}
+
+func TestRunner_Conflict(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	cm := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+
+	endpoints := multiclusterEndpointsForTest()
+	endpoints[1].ServiceType = model.HeadlessType
+	cm.EXPECT().GetService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(&model.Service{Namespace: test.HttpNsName, Name: test.SvcName, Endpoints: endpoints}, nil).AnyTimes()
+	scenario := scenarioForTest(ConflictKind)
+
+	err := runnerForTest(cm, fakeClientForTest(), nil).Run(context.TODO(), scenario)
+	assert.ErrorContains(t, err, "no ExportConflict event for ServiceExport http-ns-name/svc-name")
+
+	event := &v1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Namespace: test.HttpNsName, Name: "conflict"},
+		InvolvedObject: v1.ObjectReference{Kind: "ServiceExport", Namespace: test.HttpNsName, Name: test.SvcName},
+		Reason:         controllers.ExportConflictEventReason,
+		Type:           v1.EventTypeWarning,
+	}
+	err = runnerForTest(cm, fakeClientForTest(event), nil).Run(context.TODO(), scenario)
+	assert.NoError(t, err)
+}
+
+func TestRunner_Deletion(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	cm := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+
+	scenario := scenarioForTest(DeletionKind)
+	scenario.Exports = scenario.Exports[1:]
+
+	// the endpoints of the first cluster remain
+	cm.EXPECT().GetService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(&model.Service{Namespace: test.HttpNsName, Name: test.SvcName, Endpoints: multiclusterEndpointsForTest()}, nil).Times(1)
+	cm.EXPECT().GetService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(&model.Service{Namespace: test.HttpNsName, Name: test.SvcName, Endpoints: multiclusterEndpointsForTest()[:1]}, nil).AnyTimes()
+
+	err := runnerForTest(cm, fakeClientForTest(serviceImportForTest(model.ClusterSetIPType)), nil).Run(context.TODO(), scenario)
+	assert.ErrorContains(t, err, "ServiceImport of cluster "+test.ClusterId2+" still imports cluster "+test.ClusterId2)
+
+	svcImport := serviceImportForTest(model.ClusterSetIPType)
+	svcImport.Status.Clusters = svcImport.Status.Clusters[:1]
+	err = runnerForTest(cm, fakeClientForTest(svcImport, importedObjectsForTest(model.ClusterSetIPType)[2]), nil).Run(context.TODO(), scenario)
+	assert.ErrorContains(t, err, "cluster "+test.ClusterId2+" still has derived Service")
+
+	err = runnerForTest(cm, fakeClientForTest(svcImport), nil).Run(context.TODO(), scenario)
+	assert.NoError(t, err)
+}
+
+func TestRunner_DeletionServiceNotFound(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	cm := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+
+	cm.EXPECT().GetService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(nil, common.NotFoundError("service not found"))
+
+	err := runnerForTest(cm, fakeClientForTest(), nil).Run(context.TODO(), scenarioForTest(DeletionKind))
+	assert.NoError(t, err)
+}
+
+func runnerForTest(cm cloudmap.ServiceDiscoveryClient, k8sClient client.Client, out *bytes.Buffer) *Runner {
+	config := RunnerConfig{
+		CloudMap: func(clusterSetId string) (cloudmap.ServiceDiscoveryClient, error) {
+			return cm, nil
+		},
+		Cluster: func(context string) (client.Client, error) {
+			return k8sClient, nil
+		},
+		PollInterval: time.Millisecond,
+		PollTimeout:  50 * time.Millisecond,
+	}
+	if out != nil {
+		config.Out = out
+	}
+	return NewRunner(config)
+}
+
+// scenarioForTest returns a scenario of clusters 1 and 2 exporting the endpoints of GetMulticlusterTestEndpoints,
+// imported by cluster 2.
+func scenarioForTest(kind Kind) *Scenario {
+	scenario := &Scenario{
+		Name:         "test",
+		Kind:         kind,
+		Namespace:    test.HttpNsName,
+		Service:      test.SvcName,
+		ClusterSetId: test.ClusterSet,
+		Exports: []Export{
+			{
+				Cluster:   Cluster{ClusterId: test.ClusterId1},
+				Ports:     []Port{{Name: test.PortName1, Port: test.ServicePort1, TargetPort: test.Port1, Protocol: test.Protocol1}},
+				Addresses: []string{test.EndptIp1},
+			},
+			{
+				Cluster:   Cluster{ClusterId: test.ClusterId2},
+				Ports:     []Port{{Name: test.PortName2, Port: test.ServicePort2, TargetPort: test.Port2, Protocol: test.Protocol2}},
+				Addresses: []string{test.EndptIp2},
+			},
+		},
+		Imports: []Cluster{{ClusterId: test.ClusterId2}},
+	}
+	if kind == ConflictKind {
+		scenario.Exports[1].ServiceType = model.HeadlessType
+	}
+	if kind == HeadlessKind {
+		scenario.ServiceType = model.HeadlessType
+	}
+	scenario.setDefaults()
+	return scenario
+}
+
+func multiclusterEndpointsForTest() []*model.Endpoint {
+	endpoints := test.GetMulticlusterTestEndpoints()
+	endpoints[1].Id = model.EndpointIdFromIPAddressAndPort(test.EndptIp2, endpoints[1].EndpointPort)
+	return endpoints
+}
+
+// importedObjectsForTest returns the derived Service and EndpointSlice of cluster 1, then those of cluster 2.
+func importedObjectsForTest(serviceType model.ServiceType) []client.Object {
+	objects := make([]client.Object, 0)
+	for i, clusterId := range []string{test.ClusterId1, test.ClusterId2} {
+		derivedName := controllers.DerivedName(test.HttpNsName, test.SvcName, clusterId)
+		derivedService := &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: test.HttpNsName, Name: derivedName, Labels: map[string]string{
+				controllers.LabelSourceCluster:                 clusterId,
+				controllers.LabelDerivedServiceOriginatingName: test.SvcName,
+			}},
+		}
+		if serviceType == model.HeadlessType {
+			derivedService.Spec.ClusterIP = v1.ClusterIPNone
+		}
+		ready := true
+		objects = append(objects, derivedService, &discovery.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{Namespace: test.HttpNsName, Name: derivedName + "-slice", Labels: map[string]string{
+				discovery.LabelServiceName:              derivedName,
+				controllers.LabelServiceImportName:      test.SvcName,
+				controllers.LabelEndpointSliceManagedBy: controllers.ValueEndpointSliceManagedBy,
+				controllers.LabelSourceCluster:          clusterId,
+			}},
+			AddressType: discovery.AddressTypeIPv4,
+			Endpoints: []discovery.Endpoint{{
+				Addresses:  []string{[]string{test.EndptIp1, test.EndptIp2}[i]},
+				Conditions: discovery.EndpointConditions{Ready: &ready},
+			}},
+		})
+	}
+	return objects
+}
+
+func serviceImportForTest(serviceType model.ServiceType) *multiclusterv1alpha1.ServiceImport {
+	return &multiclusterv1alpha1.ServiceImport{
+		ObjectMeta: metav1.ObjectMeta{Namespace: test.HttpNsName, Name: test.SvcName},
+		Spec: multiclusterv1alpha1.ServiceImportSpec{
+			Type: controllers.ServiceTypetoServiceImportType(serviceType),
+			Ports: []multiclusterv1alpha1.ServicePort{
+				{Name: test.PortName1, Port: test.ServicePort1, Protocol: test.Protocol1},
+				{Name: test.PortName2, Port: test.ServicePort2, Protocol: test.Protocol2},
+			},
+		},
+		Status: multiclusterv1alpha1.ServiceImportStatus{
+			Clusters: []multiclusterv1alpha1.ClusterStatus{{Cluster: test.ClusterId1}, {Cluster: test.ClusterId2}},
+		},
+	}
+}
+
+func fakeClientForTest(objects ...client.Object) client.Client {
+	s := runtime.NewScheme()
+	_ = scheme.AddToScheme(s)
+	_ = multiclusterv1alpha1.AddToScheme(s)
+	return fake.NewClientBuilder().WithScheme(s).WithObjects(objects...).Build()
+}
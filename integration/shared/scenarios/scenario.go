@@ -0,0 +1,254 @@
+package scenarios
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	v1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Kind is the kind of integration test scenario, which selects the checks run against the clusterset.
+type Kind string
+
+const (
+	// ExportKind checks the endpoints exported to Cloud Map by the exporting clusters.
+	ExportKind Kind = "export"
+	// ImportKind checks the ServiceImport and imported EndpointSlices of the importing clusters.
+	ImportKind Kind = "import"
+	// HeadlessKind checks both the export and the import of a Headless service.
+	HeadlessKind Kind = "headless"
+	// ConflictKind checks the export of clusters with conflicting service types, and the conflict events of their
+	// ServiceExports.
+	ConflictKind Kind = "conflict"
+	// DeletionKind checks the endpoints of clusters no longer exporting the service are removed from Cloud Map and
+	// from the ServiceImports of the importing clusters.
+	DeletionKind Kind = "deletion"
+)
+
+// Scenario describes a service of the clusterset, the clusters exporting and importing it, and the kind of checks to
+// run against them.
+type Scenario struct {
+	// Name identifies the scenario in the runner output, defaults to the name of the file.
+	Name string `json:"name,omitempty"`
+	// Kind selects the checks of the scenario.
+	Kind Kind `json:"kind"`
+	// Namespace is the Kubernetes namespace of the service.
+	Namespace string `json:"namespace"`
+	// Service is the name of the service.
+	Service string `json:"service"`
+	// ClusterSetId is the clusterset of the exporting and importing clusters.
+	ClusterSetId string `json:"clusterSetId"`
+	// ServiceType is the expected type of the service, ClusterSetIP by default.
+	ServiceType model.ServiceType `json:"serviceType,omitempty"`
+	// Exports are the clusters exporting the service, or no longer exporting it for the deletion kind. Imports are
+	// expected to hold the endpoints of all exports.
+	Exports []Export `json:"exports,omitempty"`
+	// Imports are the clusters expected to import the service.
+	Imports []Cluster `json:"imports,omitempty"`
+}
+
+// Cluster is a cluster of the clusterset.
+type Cluster struct {
+	// ClusterId is the ID of the cluster.
+	ClusterId string `json:"clusterId"`
+	// Context is the kubeconfig context of the cluster, the current context if empty.
+	Context string `json:"context,omitempty"`
+}
+
+// Export describes the endpoints a cluster exports to the service.
+type Export struct {
+	Cluster `json:",inline"`
+	// ServiceType overrides the service type of the scenario for this cluster, e.g. for conflicts.
+	ServiceType model.ServiceType `json:"serviceType,omitempty"`
+	// AddressType is the address type of the endpoints, IPv4 by default.
+	AddressType string `json:"addressType,omitempty"`
+	// Ports are the exported ports of the service.
+	Ports []Port `json:"ports,omitempty"`
+	// Addresses are the addresses of the ready endpoints.
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// Port is an exported port of the service.
+type Port struct {
+	// Name is the name of the port, if the service has several ports.
+	Name string `json:"name,omitempty"`
+	// Port is the port of the service.
+	Port int32 `json:"port"`
+	// TargetPort is the port of the endpoints, the port of the service by default.
+	TargetPort int32 `json:"targetPort,omitempty"`
+	// Protocol is the protocol of the port, TCP by default.
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// LoadScenarios reads the scenarios of YAML files, and of the .yaml files of directories, in order. Environment
+// variables referenced as $VAR or ${VAR} in the files are expanded before parsing, so that scenarios can use the
+// values of the test environment, e.g. the endpoint addresses found by the test scripts.
+func LoadScenarios(paths []string) ([]*Scenario, error) {
+	scenarios := make([]*Scenario, 0)
+	for _, path := range paths {
+		files, err := scenarioFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			scenario, err := ParseScenario([]byte(os.ExpandEnv(string(data))))
+			if err != nil {
+				return nil, fmt.Errorf("invalid scenario %s: %w", file, err)
+			}
+			if scenario.Name == "" {
+				scenario.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+			}
+			scenarios = append(scenarios, scenario)
+		}
+	}
+	return scenarios, nil
+}
+
+func scenarioFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	files, err := filepath.Glob(filepath.Join(path, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// ParseScenario parses a YAML scenario, applies its defaults and validates it.
+func ParseScenario(data []byte) (*Scenario, error) {
+	scenario := &Scenario{}
+	if err := yaml.UnmarshalStrict(data, scenario); err != nil {
+		return nil, err
+	}
+	scenario.setDefaults()
+	if err := scenario.Validate(); err != nil {
+		return nil, err
+	}
+	return scenario, nil
+}
+
+func (s *Scenario) setDefaults() {
+	if s.ServiceType == "" {
+		s.ServiceType = model.ClusterSetIPType
+		if s.Kind == HeadlessKind {
+			s.ServiceType = model.HeadlessType
+		}
+	}
+	for i := range s.Exports {
+		export := &s.Exports[i]
+		if export.ServiceType == "" {
+			export.ServiceType = s.ServiceType
+		}
+		if export.AddressType == "" {
+			export.AddressType = string(discovery.AddressTypeIPv4)
+		}
+		for j := range export.Ports {
+			port := &export.Ports[j]
+			if port.TargetPort == 0 {
+				port.TargetPort = port.Port
+			}
+			if port.Protocol == "" {
+				port.Protocol = string(v1.ProtocolTCP)
+			}
+		}
+	}
+}
+
+// Validate checks the scenario has the clusters and ports its kind requires.
+func (s *Scenario) Validate() error {
+	errs := make([]string, 0)
+	if s.Namespace == "" || s.Service == "" || s.ClusterSetId == "" {
+		errs = append(errs, "namespace, service and clusterSetId are required")
+	}
+	if !isValidServiceType(s.ServiceType) {
+		errs = append(errs, fmt.Sprintf("invalid service type %q", s.ServiceType))
+	}
+
+	switch s.Kind {
+	case ExportKind, ImportKind, HeadlessKind, ConflictKind, DeletionKind:
+	default:
+		errs = append(errs, fmt.Sprintf("invalid kind %q, expected one of %s, %s, %s, %s or %s",
+			s.Kind, ExportKind, ImportKind, HeadlessKind, ConflictKind, DeletionKind))
+	}
+	if len(s.Exports) == 0 {
+		errs = append(errs, "scenarios require exports")
+	}
+	if (s.Kind == ImportKind || s.Kind == HeadlessKind) && len(s.Imports) == 0 {
+		errs = append(errs, fmt.Sprintf("%s scenarios require imports", s.Kind))
+	}
+	if s.Kind == HeadlessKind && s.ServiceType != model.HeadlessType {
+		errs = append(errs, "headless scenarios require the Headless service type")
+	}
+	if s.Kind == ConflictKind && len(s.exportedServiceTypes()) < 2 {
+		errs = append(errs, "conflict scenarios require exports of different service types")
+	}
+
+	for _, export := range s.Exports {
+		if export.ClusterId == "" {
+			errs = append(errs, "exports require a clusterId")
+		}
+		if !isValidServiceType(export.ServiceType) {
+			errs = append(errs, fmt.Sprintf("invalid service type %q of cluster %s", export.ServiceType, export.ClusterId))
+		}
+		if _, err := model.GetAddressTypeFromString(export.AddressType); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid address type %q of cluster %s", export.AddressType, export.ClusterId))
+		}
+		if s.Kind != DeletionKind && len(export.Ports) == 0 {
+			errs = append(errs, fmt.Sprintf("exports of cluster %s require ports", export.ClusterId))
+		}
+		for _, port := range export.Ports {
+			if port.Port <= 0 || port.Port > 65535 || port.TargetPort <= 0 || port.TargetPort > 65535 {
+				errs = append(errs, fmt.Sprintf("invalid port %d:%d of cluster %s", port.Port, port.TargetPort, export.ClusterId))
+			}
+		}
+	}
+	for _, cluster := range s.Imports {
+		if cluster.ClusterId == "" {
+			errs = append(errs, "imports require a clusterId")
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// exportedServiceTypes returns the distinct service types of the exports.
+func (s *Scenario) exportedServiceTypes() map[model.ServiceType]bool {
+	serviceTypes := make(map[model.ServiceType]bool)
+	for _, export := range s.Exports {
+		serviceTypes[export.ServiceType] = true
+	}
+	return serviceTypes
+}
+
+// exportingClusterIds returns the IDs of the clusters exporting the service, in order.
+func (s *Scenario) exportingClusterIds() []string {
+	clusterIds := make([]string, 0, len(s.Exports))
+	for _, export := range s.Exports {
+		clusterIds = append(clusterIds, export.ClusterId)
+	}
+	return clusterIds
+}
+
+func isValidServiceType(serviceType model.ServiceType) bool {
+	return serviceType == model.ClusterSetIPType || serviceType == model.HeadlessType
+}
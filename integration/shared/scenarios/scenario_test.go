@@ -0,0 +1,159 @@
+package scenarios
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/test"
+	"github.com/stretchr/testify/assert"
+)
+
+const headlessScenarioYaml = `
+kind: headless
+namespace: http-ns-name
+service: svc-name
+clusterSetId: test-mcs-clustersetid
+exports:
+  - clusterId: test-mcs-clusterid-1
+    context: cls1
+    ports:
+      - name: http
+        port: 11
+        targetPort: 1
+    addresses: [$ENDPOINTS]
+imports:
+  - clusterId: test-mcs-clusterid-2
+    context: cls2
+`
+
+func TestParseScenario(t *testing.T) {
+	scenario, err := ParseScenario([]byte(headlessScenarioYaml))
+	assert.NoError(t, err)
+	assert.Equal(t, &Scenario{
+		Kind:         HeadlessKind,
+		Namespace:    test.HttpNsName,
+		Service:      test.SvcName,
+		ClusterSetId: test.ClusterSet,
+		ServiceType:  model.HeadlessType,
+		Exports: []Export{{
+			Cluster:     Cluster{ClusterId: test.ClusterId1, Context: "cls1"},
+			ServiceType: model.HeadlessType,
+			AddressType: "IPv4",
+			Ports:       []Port{{Name: test.PortName1, Port: test.ServicePort1, TargetPort: test.Port1, Protocol: test.Protocol1}},
+			Addresses:   []string{"$ENDPOINTS"},
+		}},
+		Imports: []Cluster{{ClusterId: test.ClusterId2, Context: "cls2"}},
+	}, scenario)
+}
+
+func TestParseScenario_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		expected string
+	}{
+		{
+			name:     "unknown field",
+			yaml:     "kind: export\nunknown: value",
+			expected: "unknown field",
+		},
+		{
+			name:     "kind",
+			yaml:     "kind: other\nnamespace: ns\nservice: svc\nclusterSetId: cs\nexports: [{clusterId: c1, ports: [{port: 80}]}]",
+			expected: "invalid kind \"other\"",
+		},
+		{
+			name:     "required fields",
+			yaml:     "kind: export\nexports: [{clusterId: c1, ports: [{port: 80}]}]",
+			expected: "namespace, service and clusterSetId are required",
+		},
+		{
+			name:     "no exports",
+			yaml:     "kind: deletion\nnamespace: ns\nservice: svc\nclusterSetId: cs",
+			expected: "scenarios require exports",
+		},
+		{
+			name:     "no imports",
+			yaml:     "kind: import\nnamespace: ns\nservice: svc\nclusterSetId: cs\nexports: [{clusterId: c1, ports: [{port: 80}]}]",
+			expected: "import scenarios require imports",
+		},
+		{
+			name:     "headless type",
+			yaml:     "kind: headless\nnamespace: ns\nservice: svc\nclusterSetId: cs\nserviceType: ClusterSetIP\nexports: [{clusterId: c1, ports: [{port: 80}]}]\nimports: [{clusterId: c2}]",
+			expected: "headless scenarios require the Headless service type",
+		},
+		{
+			name:     "conflict types",
+			yaml:     "kind: conflict\nnamespace: ns\nservice: svc\nclusterSetId: cs\nexports: [{clusterId: c1, ports: [{port: 80}]}, {clusterId: c2, ports: [{port: 80}]}]",
+			expected: "conflict scenarios require exports of different service types",
+		},
+		{
+			name:     "export",
+			yaml:     "kind: export\nnamespace: ns\nservice: svc\nclusterSetId: cs\nexports: [{addressType: IPv5, serviceType: Other, ports: [{port: 70000}]}, {clusterId: c2}]",
+			expected: "exports require a clusterId; invalid service type \"Other\" of cluster ; invalid address type \"IPv5\" of cluster ; invalid port 70000:70000 of cluster ; exports of cluster c2 require ports",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseScenario([]byte(tt.yaml))
+			assert.ErrorContains(t, err, tt.expected)
+		})
+	}
+}
+
+func TestParseScenario_Conflict(t *testing.T) {
+	scenario, err := ParseScenario([]byte(`
+kind: conflict
+namespace: ns
+service: svc
+clusterSetId: cs
+exports:
+  - clusterId: c1
+    ports: [{port: 80}]
+  - clusterId: c2
+    serviceType: Headless
+    addressType: IPv6
+    ports: [{port: 80, protocol: UDP}]
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, model.ClusterSetIPType, scenario.Exports[0].ServiceType)
+	assert.Equal(t, model.HeadlessType, scenario.Exports[1].ServiceType)
+	assert.Equal(t, "IPv6", scenario.Exports[1].AddressType)
+	assert.Equal(t, Port{Port: 80, TargetPort: 80, Protocol: "UDP"}, scenario.Exports[1].Ports[0])
+	assert.Equal(t, []string{"c1", "c2"}, scenario.exportingClusterIds())
+}
+
+func TestLoadScenarios(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "b-headless.yaml"), []byte(headlessScenarioYaml), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a-deletion.yaml"),
+		[]byte("name: deleted\nkind: deletion\nnamespace: ns\nservice: svc\nclusterSetId: cs\nexports: [{clusterId: c1}]"), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "ignored.txt"), []byte("not a scenario"), 0600))
+	t.Setenv("ENDPOINTS", test.EndptIp1+","+test.EndptIp2)
+
+	scenarios, err := LoadScenarios([]string{dir, filepath.Join(dir, "b-headless.yaml")})
+	assert.NoError(t, err)
+	assert.Len(t, scenarios, 3)
+	assert.Equal(t, "deleted", scenarios[0].Name)
+	assert.Equal(t, "b-headless", scenarios[1].Name)
+	assert.Equal(t, []string{test.EndptIp1, test.EndptIp2}, scenarios[1].Exports[0].Addresses)
+	assert.Equal(t, scenarios[1], scenarios[2])
+
+	t.Setenv("ENDPOINTS", "")
+	scenarios, err = LoadScenarios([]string{filepath.Join(dir, "b-headless.yaml")})
+	assert.NoError(t, err)
+	assert.Empty(t, scenarios[0].Exports[0].Addresses)
+}
+
+func TestLoadScenarios_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "invalid.yaml"), []byte("kind: export"), 0600))
+
+	_, err := LoadScenarios([]string{dir})
+	assert.ErrorContains(t, err, "invalid scenario "+filepath.Join(dir, "invalid.yaml"))
+
+	_, err = LoadScenarios([]string{filepath.Join(dir, "missing.yaml")})
+	assert.Error(t, err)
+}
@@ -3,10 +3,12 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"os"
 
 	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/cloudmap"
 	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/common"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/dns"
 	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
 	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/version"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -24,6 +26,7 @@ import (
 
 	aboutv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/about/v1alpha1"
 	multiclusterv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/multicluster/v1alpha1"
+	policyv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/policy/v1alpha1"
 	multiclustercontrollers "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/controllers/multicluster"
 	// +kubebuilder:scaffold:imports
 )
@@ -39,6 +42,8 @@ func init() {
 	utilruntime.Must(multiclusterv1alpha1.AddToScheme(scheme))
 
 	utilruntime.Must(aboutv1alpha1.AddToScheme(scheme))
+
+	utilruntime.Must(policyv1alpha1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -46,11 +51,57 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var dryRun bool
+	var maxInFlightOperations int
+	var enableDebugEndpoint bool
+	var instanceQuota int
+	var cloudMapWorkers int
+	var importMode string
+	var cloudMapEndpoint string
+	nsMapperConfig := cloudmap.DefaultNamespaceMapperConfig()
+	dnsConfig := dns.DefaultConfig()
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"Compute and report the changes to AWS Cloud Map and Kubernetes resources through logs, events and metrics "+
+			"without applying them.")
+	flag.IntVar(&maxInFlightOperations, "max-inflight-operations", cloudmap.DefaultOperationPollerConfig().MaxInFlight,
+		"The maximum number of Cloud Map instance registrations and de-registrations in progress at any time for each reconciled service.")
+	flag.IntVar(&instanceQuota, "instance-quota", multiclustercontrollers.DefaultInstanceQuota,
+		"The AWS Cloud Map quota of instances per service. ServiceExports whose service reaches 80% of it get a warning "+
+			"condition, 0 disables the check.")
+	flag.IntVar(&cloudMapWorkers, "cloudmap-workers", multiclustercontrollers.DefaultCloudMapWorkers,
+		"The number of Cloud Map services imported concurrently.")
+	flag.StringVar(&importMode, "import-mode", string(multiclustercontrollers.AllClustersImportMode),
+		"The import mode of the ServiceImports without a "+multiclustercontrollers.ImportModeAnnotation+" annotation: "+
+			string(multiclustercontrollers.AllClustersImportMode)+" sends traffic to all clusters, "+
+			string(multiclustercontrollers.LocalFirstImportMode)+" to the local cluster while it has ready endpoints.")
+	flag.StringVar(&nsMapperConfig.Template, "cloudmap-namespace-template", "",
+		"Go template of the Cloud Map namespace names, with the .Namespace and .ClusterSetId fields, e.g. "+
+			"\"{{.ClusterSetId}}-{{.Namespace}}\". Defaults to the Kubernetes namespace name.")
+	flag.StringVar(&nsMapperConfig.Prefix, "cloudmap-namespace-prefix", "",
+		"The prefix of the Cloud Map namespace names.")
+	flag.StringVar(&nsMapperConfig.Suffix, "cloudmap-namespace-suffix", "",
+		"The suffix of the Cloud Map namespace names.")
+	flag.StringVar(&cloudMapEndpoint, "cloudmap-endpoint", "",
+		"The URL of the Cloud Map API, e.g. of a local Cloud Map stand-in for testing. Defaults to the regional endpoint.")
+	flag.BoolVar(&enableDebugEndpoint, "enable-debug-endpoint", false,
+		"Serve the cluster properties, cached Cloud Map resources and latest reconciliation results as JSON on the "+
+			multiclustercontrollers.DebugStatePath+" path of the metrics endpoint.")
+	flag.StringVar(&dnsConfig.Address, "dns-bind-address", "",
+		"The UDP and TCP address the DNS responder for the clusterset names of the imported services binds to, "+
+			"e.g. \":5353\". Empty disables the DNS responder.")
+	flag.StringVar(&dnsConfig.Domain, "dns-domain", dnsConfig.Domain,
+		"The clusterset domain answered by the DNS responder.")
+	flag.DurationVar(&dnsConfig.TTL, "dns-ttl", dnsConfig.TTL,
+		"The time to live of the records answered by the DNS responder.")
+	flag.IntVar(&dnsConfig.MaxConcurrentUDPQueries, "dns-max-concurrent-udp-queries", dnsConfig.MaxConcurrentUDPQueries,
+		"The number of UDP queries the DNS responder answers concurrently, further queries are dropped.")
+	flag.IntVar(&dnsConfig.MaxTCPConnections, "dns-max-tcp-connections", dnsConfig.MaxTCPConnections,
+		"The number of TCP connections the DNS responder serves concurrently, further connections are closed.")
 
 	// Add the zap logger flag set to the CLI. The flag set must
 	// be added before calling flag.Parse().
@@ -63,6 +114,14 @@ func main() {
 
 	v := version.GetVersion()
 	log.Info("starting AWS Cloud Map MCS Controller for K8s", "version", v)
+	if dryRun {
+		log.Info("running in dry-run mode, no changes will be applied")
+	}
+
+	if !multiclustercontrollers.IsValidImportMode(multiclustercontrollers.ImportMode(importMode)) {
+		log.Error(fmt.Errorf("invalid import mode %q", importMode), "unable to configure the import mode")
+		os.Exit(1)
+	}
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
@@ -78,7 +137,7 @@ func main() {
 	}
 	log.Info("configuring AWS session")
 	// GO sdk will look for region in order 1) AWS_REGION env var, 2) ~/.aws/config file, 3) EC2 IMDS
-	awsCfg, err := config.LoadDefaultConfig(context.TODO(), config.WithEC2IMDSRegion())
+	awsCfg, err := config.LoadDefaultConfig(context.TODO(), config.WithEC2IMDSRegion(), cloudmap.WithEndpoint(cloudMapEndpoint))
 
 	if err != nil || awsCfg.Region == "" {
 		log.Error(err, "unable to configure AWS session", "AWS_REGION", awsCfg.Region)
@@ -86,33 +145,68 @@ func main() {
 	}
 
 	log.Info("Running with AWS region", "AWS_REGION", awsCfg.Region)
+	if cloudMapEndpoint != "" {
+		log.Info("using Cloud Map endpoint", "endpoint", cloudMapEndpoint)
+	}
 
 	clusterUtils := model.NewClusterUtils(mgr.GetClient())
-	serviceDiscoveryClient := cloudmap.NewDefaultServiceDiscoveryClient(&awsCfg, clusterUtils)
+	pollerConfig := cloudmap.DefaultOperationPollerConfig()
+	pollerConfig.MaxInFlight = maxInFlightOperations
+	nsMapper, err := cloudmap.NewNamespaceMapper(nsMapperConfig, mgr.GetClient(), clusterUtils)
+	if err != nil {
+		log.Error(err, "unable to configure the Cloud Map namespace mapping")
+		os.Exit(1)
+	}
+	serviceDiscoveryClient := cloudmap.NewServiceDiscoveryClientWithConfig(&awsCfg, cloudmap.DefaultSdCacheConfig(), pollerConfig, nsMapper, clusterUtils)
+
+	var reconcileState *multiclustercontrollers.ReconcileState
+	if enableDebugEndpoint {
+		reconcileState = multiclustercontrollers.NewReconcileState()
+		debugHandler := multiclustercontrollers.NewDebugHandler(clusterUtils, serviceDiscoveryClient, reconcileState)
+		if err = mgr.AddMetricsExtraHandler(multiclustercontrollers.DebugStatePath, debugHandler); err != nil {
+			log.Error(err, "unable to set up debug endpoint")
+			os.Exit(1)
+		}
+		log.Info("serving debug endpoint", "path", multiclustercontrollers.DebugStatePath)
+	}
 
 	if err = (&multiclustercontrollers.ServiceExportReconciler{
-		Client:       mgr.GetClient(),
-		Log:          common.NewLogger("controllers", "ServiceExportReconciler"),
-		Scheme:       mgr.GetScheme(),
-		CloudMap:     serviceDiscoveryClient,
-		ClusterUtils: clusterUtils,
+		Client:        mgr.GetClient(),
+		Log:           common.NewLogger("controllers", "ServiceExportReconciler"),
+		Scheme:        mgr.GetScheme(),
+		CloudMap:      serviceDiscoveryClient,
+		ClusterUtils:  clusterUtils,
+		Recorder:      multiclustercontrollers.NewDeduplicatingEventRecorder(mgr.GetEventRecorderFor("ServiceExportReconciler"), multiclustercontrollers.DefaultEventDeduplicationTTL),
+		DryRun:        dryRun,
+		State:         reconcileState,
+		InstanceQuota: instanceQuota,
 	}).SetupWithManager(mgr); err != nil {
 		log.Error(err, "unable to create controller", "controller", "ServiceExportReconciler")
 		os.Exit(1)
 	}
 
-	cloudMapReconciler := &multiclustercontrollers.CloudMapReconciler{
+	if err = (&multiclustercontrollers.CloudMapReconciler{
 		Client:       mgr.GetClient(),
 		Cloudmap:     serviceDiscoveryClient,
 		Log:          common.NewLogger("controllers", "CloudmapReconciler"),
 		ClusterUtils: clusterUtils,
-	}
-
-	if err = mgr.Add(cloudMapReconciler); err != nil {
+		Recorder:     multiclustercontrollers.NewDeduplicatingEventRecorder(mgr.GetEventRecorderFor("CloudmapReconciler"), multiclustercontrollers.DefaultEventDeduplicationTTL),
+		DryRun:       dryRun,
+		State:        reconcileState,
+		Workers:      cloudMapWorkers,
+		ImportMode:   multiclustercontrollers.ImportMode(importMode),
+	}).SetupWithManager(mgr); err != nil {
 		log.Error(err, "unable to create controller", "controller", "CloudmapReconciler")
 		os.Exit(1)
 	}
 
+	if dnsConfig.Address != "" {
+		if err = mgr.Add(dns.NewServer(dnsConfig, mgr.GetClient(), common.NewLogger("dns"))); err != nil {
+			log.Error(err, "unable to set up DNS responder")
+			os.Exit(1)
+		}
+	}
+
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
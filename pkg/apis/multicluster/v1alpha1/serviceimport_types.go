@@ -7,6 +7,7 @@ import (
 
 // +genclient
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
 
 // ServiceImport describes a service imported from clusters in a ClusterSet.
 type ServiceImport struct {
@@ -0,0 +1,61 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
+
+// ClusterSetPolicySpec defines which clusters of the clusterset may export and import services of a namespace
+type ClusterSetPolicySpec struct {
+	// Services are the names of the clusterset services of the namespace the policy applies to. The policy applies to
+	// all services of the namespace when empty.
+	// +optional
+	Services []string `json:"services,omitempty"`
+
+	// ExportClusters are the IDs of the clusters allowed to export the services. All clusters may export the services
+	// when empty.
+	// +optional
+	ExportClusters []string `json:"exportClusters,omitempty"`
+
+	// ImportClusters are the IDs of the clusters allowed to import the services. All clusters may import the services
+	// when empty.
+	// +optional
+	ImportClusters []string `json:"importClusters,omitempty"`
+}
+
+// ClusterSetPolicyStatus defines the observed state of ClusterSetPolicy
+type ClusterSetPolicyStatus struct {
+	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
+	// Important: Run "make" to regenerate code after modifying this file
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// ClusterSetPolicy is the Schema for the clustersetpolicies API. Clusters only export and import the services of its
+// namespace allowed by all the policies applying to them.
+// +kubebuilder:printcolumn:name="services",type=string,JSONPath=`.spec.services`
+// +kubebuilder:printcolumn:name="export clusters",type=string,JSONPath=`.spec.exportClusters`
+// +kubebuilder:printcolumn:name="import clusters",type=string,JSONPath=`.spec.importClusters`
+// +kubebuilder:printcolumn:name="age",type=date,JSONPath=`.metadata.creationTimestamp`
+type ClusterSetPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterSetPolicySpec   `json:"spec,omitempty"`
+	Status ClusterSetPolicyStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterSetPolicyList contains a list of ClusterSetPolicy
+type ClusterSetPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterSetPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterSetPolicy{}, &ClusterSetPolicyList{})
+}
@@ -12,6 +12,10 @@ import (
 
 const (
 	defaultServiceTTLInSeconds int64 = 60
+
+	// DiscoverInstancesMaxResults is the maximum number of instances returned by DiscoverInstances, which does not
+	// paginate its results.
+	DiscoverInstancesMaxResults = 1000
 )
 
 // ServiceDiscoveryApi handles the AWS Cloud Map API request and response processing logic, and converts results to
@@ -23,12 +27,19 @@ type ServiceDiscoveryApi interface {
 	// GetServiceIdMap returns a map of all service IDs for a given namespace indexed by service name.
 	GetServiceIdMap(ctx context.Context, namespaceId string) (serviceIdMap map[string]string, err error)
 
-	// DiscoverInstances returns a list of service instances registered to a given service.
+	// DiscoverInstances returns a list of service instances registered to a given service. At most
+	// DiscoverInstancesMaxResults instances are returned.
 	DiscoverInstances(ctx context.Context, nsName string, svcName string, queryParameters map[string]string) (insts []types.HttpInstanceSummary, err error)
 
+	// ListInstances returns all service instances registered to a given service.
+	ListInstances(ctx context.Context, serviceId string) (insts []types.InstanceSummary, err error)
+
 	// GetOperation returns an operation.
 	GetOperation(ctx context.Context, operationId string) (operation *types.Operation, err error)
 
+	// ListOperations returns the status of all operations matching the given filters indexed by operation ID.
+	ListOperations(ctx context.Context, filters []types.OperationFilter) (operationStatusMap map[string]types.OperationStatus, err error)
+
 	// CreateHttpNamespace creates a HTTP namespace in AWS Cloud Map for a given name.
 	CreateHttpNamespace(ctx context.Context, namespaceName string) (operationId string, err error)
 
@@ -68,6 +79,7 @@ func (sdApi *serviceDiscoveryApi) GetNamespaceMap(ctx context.Context) (map[stri
 	pages := sd.NewListNamespacesPaginator(sdApi.awsFacade, &sd.ListNamespacesInput{})
 	for pages.HasMorePages() {
 		output, err := pages.NextPage(ctx)
+		sdApi.rateLimiter.Observe(common.ListNamespaces, err)
 		if err != nil {
 			return nil, err
 		}
@@ -104,6 +116,7 @@ func (sdApi *serviceDiscoveryApi) GetServiceIdMap(ctx context.Context, nsId stri
 	pages := sd.NewListServicesPaginator(sdApi.awsFacade, &sd.ListServicesInput{Filters: []types.ServiceFilter{filter}})
 	for pages.HasMorePages() {
 		output, err := pages.NextPage(ctx)
+		sdApi.rateLimiter.Observe(common.ListServices, err)
 		if err != nil {
 			return nil, err
 		}
@@ -126,13 +139,13 @@ func (sdApi *serviceDiscoveryApi) DiscoverInstances(ctx context.Context, nsName
 		NamespaceName: aws.String(nsName),
 		ServiceName:   aws.String(svcName),
 		HealthStatus:  types.HealthStatusFilterAll,
-		MaxResults:    aws.Int32(1000),
+		MaxResults:    aws.Int32(DiscoverInstancesMaxResults),
 	}
 	if queryParameters != nil {
 		input.QueryParameters = queryParameters
 	}
 	out, err := sdApi.awsFacade.DiscoverInstances(ctx, input)
-
+	sdApi.rateLimiter.Observe(common.DiscoverInstances, err)
 	if err != nil {
 		return insts, err
 	}
@@ -140,6 +153,26 @@ func (sdApi *serviceDiscoveryApi) DiscoverInstances(ctx context.Context, nsName
 	return out.Instances, nil
 }
 
+func (sdApi *serviceDiscoveryApi) ListInstances(ctx context.Context, svcId string) (insts []types.InstanceSummary, err error) {
+	pages := sd.NewListInstancesPaginator(sdApi.awsFacade, &sd.ListInstancesInput{ServiceId: aws.String(svcId)})
+	for pages.HasMorePages() {
+		// each page is a separate API call
+		if err = sdApi.rateLimiter.Wait(ctx, common.ListInstances); err != nil {
+			return nil, err
+		}
+
+		output, err := pages.NextPage(ctx)
+		sdApi.rateLimiter.Observe(common.ListInstances, err)
+		if err != nil {
+			return nil, err
+		}
+
+		insts = append(insts, output.Instances...)
+	}
+
+	return insts, nil
+}
+
 func (sdApi *serviceDiscoveryApi) GetOperation(ctx context.Context, opId string) (operation *types.Operation, err error) {
 	err = sdApi.rateLimiter.Wait(ctx, common.GetOperation)
 	if err != nil {
@@ -147,7 +180,7 @@ func (sdApi *serviceDiscoveryApi) GetOperation(ctx context.Context, opId string)
 	}
 
 	opResp, err := sdApi.awsFacade.GetOperation(ctx, &sd.GetOperationInput{OperationId: &opId})
-
+	sdApi.rateLimiter.Observe(common.GetOperation, err)
 	if err != nil {
 		return nil, err
 	}
@@ -155,6 +188,30 @@ func (sdApi *serviceDiscoveryApi) GetOperation(ctx context.Context, opId string)
 	return opResp.Operation, nil
 }
 
+func (sdApi *serviceDiscoveryApi) ListOperations(ctx context.Context, filters []types.OperationFilter) (map[string]types.OperationStatus, error) {
+	err := sdApi.rateLimiter.Wait(ctx, common.ListOperations)
+	if err != nil {
+		return nil, err
+	}
+
+	opStatusMap := make(map[string]types.OperationStatus)
+
+	pages := sd.NewListOperationsPaginator(sdApi.awsFacade, &sd.ListOperationsInput{Filters: filters})
+	for pages.HasMorePages() {
+		output, err := pages.NextPage(ctx)
+		sdApi.rateLimiter.Observe(common.ListOperations, err)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, op := range output.Operations {
+			opStatusMap[aws.ToString(op.Id)] = op.Status
+		}
+	}
+
+	return opStatusMap, nil
+}
+
 func (sdApi *serviceDiscoveryApi) CreateHttpNamespace(ctx context.Context, nsName string) (opId string, err error) {
 	err = sdApi.rateLimiter.Wait(ctx, common.CreateHttpNamespace)
 	if err != nil {
@@ -164,7 +221,7 @@ func (sdApi *serviceDiscoveryApi) CreateHttpNamespace(ctx context.Context, nsNam
 	output, err := sdApi.awsFacade.CreateHttpNamespace(ctx, &sd.CreateHttpNamespaceInput{
 		Name: &nsName,
 	})
-
+	sdApi.rateLimiter.Observe(common.CreateHttpNamespace, err)
 	if err != nil {
 		return "", err
 	}
@@ -190,7 +247,7 @@ func (sdApi *serviceDiscoveryApi) CreateService(ctx context.Context, namespace m
 			NamespaceId: &namespace.Id,
 			Name:        &svcName})
 	}
-
+	sdApi.rateLimiter.Observe(common.CreateService, err)
 	if err != nil {
 		return "", err
 	}
@@ -223,7 +280,7 @@ func (sdApi *serviceDiscoveryApi) RegisterInstance(ctx context.Context, svcId st
 		InstanceId: &instId,
 		ServiceId:  &svcId,
 	})
-
+	sdApi.rateLimiter.Observe(common.RegisterInstance, err)
 	if err != nil {
 		return "", err
 	}
@@ -241,7 +298,7 @@ func (sdApi *serviceDiscoveryApi) DeregisterInstance(ctx context.Context, svcId
 		InstanceId: &instId,
 		ServiceId:  &svcId,
 	})
-
+	sdApi.rateLimiter.Observe(common.DeregisterInstance, err)
 	if err != nil {
 		return "", err
 	}
@@ -15,6 +15,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	sd "github.com/aws/aws-sdk-go-v2/service/servicediscovery"
 	"github.com/aws/aws-sdk-go-v2/service/servicediscovery/types"
+	"github.com/aws/smithy-go"
 	"github.com/go-logr/logr/testr"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -128,6 +129,28 @@ func TestServiceDiscoveryApi_DiscoverInstances_HappyCase(t *testing.T) {
 	assert.Equal(t, test.EndptId2, *insts[1].InstanceId)
 }
 
+func TestServiceDiscoveryApi_ListInstances_HappyCase(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	awsFacade := cloudmapMock.NewMockAwsFacade(mockController)
+	sdApi := getServiceDiscoveryApi(t, awsFacade)
+
+	awsFacade.EXPECT().ListInstances(context.TODO(), &sd.ListInstancesInput{ServiceId: aws.String(test.SvcId)}).
+		Return(&sd.ListInstancesOutput{
+			Instances: []types.InstanceSummary{{Id: aws.String(test.EndptId1)}},
+			NextToken: aws.String("next"),
+		}, nil)
+	awsFacade.EXPECT().ListInstances(context.TODO(), &sd.ListInstancesInput{ServiceId: aws.String(test.SvcId), NextToken: aws.String("next")}).
+		Return(&sd.ListInstancesOutput{
+			Instances: []types.InstanceSummary{{Id: aws.String(test.EndptId2)}},
+		}, nil)
+
+	insts, err := sdApi.ListInstances(context.TODO(), test.SvcId)
+	assert.Nil(t, err, "No error for happy case")
+	assert.Equal(t, []types.InstanceSummary{{Id: aws.String(test.EndptId1)}, {Id: aws.String(test.EndptId2)}}, insts)
+}
+
 func TestServiceDiscoveryApi_GetOperation_HappyCase(t *testing.T) {
 	mockController := gomock.NewController(t)
 	defer mockController.Finish()
@@ -144,6 +167,34 @@ func TestServiceDiscoveryApi_GetOperation_HappyCase(t *testing.T) {
 	assert.Equal(t, expectedOp, op)
 }
 
+func TestServiceDiscoveryApi_ListOperations_HappyCase(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	awsFacade := cloudmapMock.NewMockAwsFacade(mockController)
+	sdApi := getServiceDiscoveryApi(t, awsFacade)
+
+	filters := []types.OperationFilter{{
+		Name:      types.OperationFilterNameServiceId,
+		Condition: types.FilterConditionEq,
+		Values:    []string{test.SvcId},
+	}}
+	awsFacade.EXPECT().ListOperations(context.TODO(), &sd.ListOperationsInput{Filters: filters}).
+		Return(&sd.ListOperationsOutput{
+			Operations: []types.OperationSummary{
+				{Id: aws.String(test.OpId1), Status: types.OperationStatusSuccess},
+				{Id: aws.String(test.OpId2), Status: types.OperationStatusFail},
+			},
+		}, nil)
+
+	opStatusMap, err := sdApi.ListOperations(context.TODO(), filters)
+	assert.Nil(t, err, "No error for happy case")
+	assert.Equal(t, map[string]types.OperationStatus{
+		test.OpId1: types.OperationStatusSuccess,
+		test.OpId2: types.OperationStatusFail,
+	}, opStatusMap)
+}
+
 func TestServiceDiscoveryApi_CreateHttNamespace_HappyCase(t *testing.T) {
 	mockController := gomock.NewController(t)
 	defer mockController.Finish()
@@ -263,6 +314,23 @@ func TestServiceDiscoveryApi_RegisterInstance_Error(t *testing.T) {
 	assert.Equal(t, sdkErr, err)
 }
 
+func TestServiceDiscoveryApi_RegisterInstance_Throttled(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	throttlingErr := &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}
+	awsFacade := cloudmapMock.NewMockAwsFacade(mockController)
+	awsFacade.EXPECT().RegisterInstance(context.TODO(), gomock.Any()).Return(nil, throttlingErr)
+
+	sdApi := getServiceDiscoveryApi(t, awsFacade)
+	rateLimiter := sdApi.(*serviceDiscoveryApi).rateLimiter
+	defaultRate := rateLimiter.Rate(common.RegisterInstance)
+
+	_, err := sdApi.RegisterInstance(context.TODO(), test.SvcId, test.EndptId1, map[string]string{})
+	assert.Equal(t, throttlingErr, err)
+	assert.Less(t, rateLimiter.Rate(common.RegisterInstance), defaultRate, "rate lowered after throttling")
+}
+
 func TestServiceDiscoveryApi_DeregisterInstance_HappyCase(t *testing.T) {
 	mockController := gomock.NewController(t)
 	defer mockController.Finish()
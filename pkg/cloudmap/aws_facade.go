@@ -37,6 +37,9 @@ type AwsFacade interface {
 	// DeregisterInstance provides ServiceDiscovery DeregisterInstance wrapper interface.
 	DeregisterInstance(context.Context, *sd.DeregisterInstanceInput, ...func(*sd.Options)) (*sd.DeregisterInstanceOutput, error)
 
+	// ListInstances provides ServiceDiscovery ListInstances wrapper interface for paginator.
+	ListInstances(context.Context, *sd.ListInstancesInput, ...func(*sd.Options)) (*sd.ListInstancesOutput, error)
+
 	// DiscoverInstances provides ServiceDiscovery DiscoverInstances wrapper interface.
 	DiscoverInstances(context.Context, *sd.DiscoverInstancesInput, ...func(*sd.Options)) (*sd.DiscoverInstancesOutput, error)
 }
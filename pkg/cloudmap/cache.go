@@ -3,6 +3,8 @@ package cloudmap
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/common"
@@ -18,18 +20,31 @@ const (
 	defaultNsTTL     = 10 * time.Second
 	defaultSvcTTL    = 10 * time.Second
 	defaultEndptTTL  = 5 * time.Second
+	defaultStaleTTL  = 30 * time.Second
 )
 
+// ServiceDiscoveryClientCache caches AWS Cloud Map resources. Entries past their TTL are still returned, flagged as
+// stale, until their stale window expires, so callers can serve them while reloading them in the background.
 type ServiceDiscoveryClientCache interface {
-	GetNamespaceMap() (namespaces map[string]*model.Namespace, found bool)
+	GetNamespaceMap() (namespaces map[string]*model.Namespace, found bool, stale bool)
 	CacheNamespaceMap(namespaces map[string]*model.Namespace)
 	EvictNamespaceMap()
-	GetServiceIdMap(namespaceName string) (serviceIdMap map[string]string, found bool)
+	GetServiceIdMap(namespaceName string) (serviceIdMap map[string]string, found bool, stale bool)
 	CacheServiceIdMap(namespaceName string, serviceIdMap map[string]string)
+	// AddServiceId adds a service to a cached service ID map. It is a no-op if the map is not cached.
+	AddServiceId(namespaceName string, serviceName string, serviceId string)
 	EvictServiceIdMap(namespaceName string)
-	GetEndpoints(namespaceName string, serviceName string) (endpoints []*model.Endpoint, found bool)
+	GetEndpoints(namespaceName string, serviceName string) (endpoints []*model.Endpoint, found bool, stale bool)
 	CacheEndpoints(namespaceName string, serviceName string, endpoints []*model.Endpoint)
+	// UpsertEndpoints adds or replaces endpoints, matched by ID, in a cached endpoint list. It is a no-op if the list is
+	// not cached.
+	UpsertEndpoints(namespaceName string, serviceName string, endpoints []*model.Endpoint)
+	// RemoveEndpoints removes endpoints, matched by ID, from a cached endpoint list. It is a no-op if the list is not
+	// cached.
+	RemoveEndpoints(namespaceName string, serviceName string, endpoints []*model.Endpoint)
 	EvictEndpoints(namespaceName string, serviceName string)
+	// Snapshot returns the resources currently cached, for troubleshooting.
+	Snapshot() model.CacheSnapshot
 }
 
 type sdCache struct {
@@ -37,77 +52,117 @@ type sdCache struct {
 	defaultCache   *cache.LRUExpireCache
 	endpointsCache *cache.LRUExpireCache
 	config         *SdCacheConfig
+	clock          cache.Clock
+	// serializes the updates of cached entries with their read-modify-write updates
+	mutex sync.Mutex
 }
 
 type SdCacheConfig struct {
 	NsTTL    time.Duration
 	SvcTTL   time.Duration
 	EndptTTL time.Duration
+	// StaleTTL is how long entries are still served after their TTL, while being refreshed.
+	StaleTTL time.Duration
+}
+
+// cacheEntry is a cached value, which is stale after refreshAt and expires after expiresAt.
+type cacheEntry struct {
+	value     interface{}
+	refreshAt time.Time
+	expiresAt time.Time
 }
 
 func NewServiceDiscoveryClientCache(cacheConfig *SdCacheConfig) ServiceDiscoveryClientCache {
+	return newSdCache(cacheConfig, clock{})
+}
+
+func newSdCache(cacheConfig *SdCacheConfig, c cache.Clock) *sdCache {
 	return &sdCache{
 		log:            common.NewLogger("cloudmap"),
-		defaultCache:   cache.NewLRUExpireCache(defaultCacheSize),
-		endpointsCache: cache.NewLRUExpireCache(defaultCacheSize),
+		defaultCache:   cache.NewLRUExpireCacheWithClock(defaultCacheSize, c),
+		endpointsCache: cache.NewLRUExpireCacheWithClock(defaultCacheSize, c),
 		config:         cacheConfig,
+		clock:          c,
 	}
 }
 
 func NewDefaultServiceDiscoveryClientCache() ServiceDiscoveryClientCache {
-	return NewServiceDiscoveryClientCache(
-		&SdCacheConfig{
-			NsTTL:    defaultNsTTL,
-			SvcTTL:   defaultSvcTTL,
-			EndptTTL: defaultEndptTTL,
-		})
+	return NewServiceDiscoveryClientCache(DefaultSdCacheConfig())
 }
 
-func (sdCache *sdCache) GetNamespaceMap() (namespaceMap map[string]*model.Namespace, found bool) {
-	entry, exists := sdCache.defaultCache.Get(nsKey)
+// DefaultSdCacheConfig returns the default resource cache settings.
+func DefaultSdCacheConfig() *SdCacheConfig {
+	return &SdCacheConfig{
+		NsTTL:    defaultNsTTL,
+		SvcTTL:   defaultSvcTTL,
+		EndptTTL: defaultEndptTTL,
+		StaleTTL: defaultStaleTTL,
+	}
+}
+
+func (sdCache *sdCache) GetNamespaceMap() (namespaceMap map[string]*model.Namespace, found bool, stale bool) {
+	entry, exists := sdCache.get(sdCache.defaultCache, nsKey)
 	if !exists {
-		return nil, false
+		return nil, false, false
 	}
 
-	namespaceMap, ok := entry.(map[string]*model.Namespace)
+	namespaceMap, ok := entry.value.(map[string]*model.Namespace)
 	if !ok {
 		sdCache.log.Error(errors.New("failed to retrieve namespaceMap from cache"), "")
 		sdCache.defaultCache.Remove(nsKey)
-		return nil, false
+		return nil, false, false
 	}
 
-	return namespaceMap, true
+	return namespaceMap, true, sdCache.isStale(entry)
 }
 
 func (sdCache *sdCache) CacheNamespaceMap(namespaces map[string]*model.Namespace) {
-	sdCache.defaultCache.Add(nsKey, namespaces, sdCache.config.NsTTL)
+	sdCache.add(sdCache.defaultCache, nsKey, namespaces, sdCache.config.NsTTL)
 }
 
 func (sdCache *sdCache) EvictNamespaceMap() {
 	sdCache.defaultCache.Remove(nsKey)
 }
 
-func (sdCache *sdCache) GetServiceIdMap(nsName string) (serviceIdMap map[string]string, found bool) {
+func (sdCache *sdCache) GetServiceIdMap(nsName string) (serviceIdMap map[string]string, found bool, stale bool) {
 	key := sdCache.buildSvcKey(nsName)
-	entry, exists := sdCache.defaultCache.Get(key)
+	entry, exists := sdCache.get(sdCache.defaultCache, key)
 	if !exists {
-		return nil, false
+		return nil, false, false
 	}
 
-	serviceIdMap, ok := entry.(map[string]string)
+	serviceIdMap, ok := entry.value.(map[string]string)
 	if !ok {
 		err := fmt.Errorf("failed to retrieve service IDs from cache")
 		sdCache.log.Error(err, err.Error(), "namespace", nsName)
 		sdCache.defaultCache.Remove(key)
-		return nil, false
+		return nil, false, false
 	}
 
-	return serviceIdMap, true
+	return serviceIdMap, true, sdCache.isStale(entry)
 }
 
 func (sdCache *sdCache) CacheServiceIdMap(nsName string, serviceIdMap map[string]string) {
 	key := sdCache.buildSvcKey(nsName)
-	sdCache.defaultCache.Add(key, serviceIdMap, sdCache.config.SvcTTL)
+	sdCache.add(sdCache.defaultCache, key, serviceIdMap, sdCache.config.SvcTTL)
+}
+
+func (sdCache *sdCache) AddServiceId(nsName string, svcName string, svcId string) {
+	sdCache.mutex.Lock()
+	defer sdCache.mutex.Unlock()
+
+	serviceIdMap, found, _ := sdCache.GetServiceIdMap(nsName)
+	if !found {
+		return
+	}
+
+	// cached maps are shared with callers, so they are copied rather than modified
+	updated := make(map[string]string, len(serviceIdMap)+1)
+	for name, id := range serviceIdMap {
+		updated[name] = id
+	}
+	updated[svcName] = svcId
+	sdCache.replace(sdCache.defaultCache, sdCache.buildSvcKey(nsName), updated)
 }
 
 func (sdCache *sdCache) EvictServiceIdMap(nsName string) {
@@ -115,27 +170,35 @@ func (sdCache *sdCache) EvictServiceIdMap(nsName string) {
 	sdCache.defaultCache.Remove(key)
 }
 
-func (sdCache *sdCache) GetEndpoints(nsName string, svcName string) (endpts []*model.Endpoint, found bool) {
+func (sdCache *sdCache) GetEndpoints(nsName string, svcName string) (endpts []*model.Endpoint, found bool, stale bool) {
 	key := sdCache.buildEndptsKey(nsName, svcName)
-	entry, exists := sdCache.endpointsCache.Get(key)
+	entry, exists := sdCache.get(sdCache.endpointsCache, key)
 	if !exists {
-		return nil, false
+		return nil, false, false
 	}
 
-	endpts, ok := entry.([]*model.Endpoint)
+	endpts, ok := entry.value.([]*model.Endpoint)
 	if !ok {
 		err := fmt.Errorf("failed to retrieve endpoints from cache")
 		sdCache.log.Error(err, err.Error(), "namespace", nsName, "service", svcName)
 		sdCache.endpointsCache.Remove(key)
-		return nil, false
+		return nil, false, false
 	}
 
-	return endpts, true
+	return endpts, true, sdCache.isStale(entry)
 }
 
 func (sdCache *sdCache) CacheEndpoints(nsName string, svcName string, endpts []*model.Endpoint) {
 	key := sdCache.buildEndptsKey(nsName, svcName)
-	sdCache.endpointsCache.Add(key, endpts, sdCache.config.EndptTTL)
+	sdCache.add(sdCache.endpointsCache, key, endpts, sdCache.config.EndptTTL)
+}
+
+func (sdCache *sdCache) UpsertEndpoints(nsName string, svcName string, endpts []*model.Endpoint) {
+	sdCache.updateEndpoints(nsName, svcName, endpts, true)
+}
+
+func (sdCache *sdCache) RemoveEndpoints(nsName string, svcName string, endpts []*model.Endpoint) {
+	sdCache.updateEndpoints(nsName, svcName, endpts, false)
 }
 
 func (sdCache *sdCache) EvictEndpoints(nsName string, svcName string) {
@@ -143,6 +206,113 @@ func (sdCache *sdCache) EvictEndpoints(nsName string, svcName string) {
 	sdCache.endpointsCache.Remove(key)
 }
 
+// updateEndpoints replaces the cached endpoints matching the IDs of the given endpoints, either with the given
+// endpoints if upsert is true, or with nothing to remove them.
+func (sdCache *sdCache) updateEndpoints(nsName string, svcName string, endpts []*model.Endpoint, upsert bool) {
+	sdCache.mutex.Lock()
+	defer sdCache.mutex.Unlock()
+
+	cached, found, _ := sdCache.GetEndpoints(nsName, svcName)
+	if !found {
+		return
+	}
+
+	changed := make(map[string]*model.Endpoint, len(endpts))
+	for _, endpt := range endpts {
+		changed[endpt.Id] = endpt
+	}
+
+	// cached lists are shared with callers, so they are copied rather than modified
+	updated := make([]*model.Endpoint, 0, len(cached)+len(endpts))
+	for _, endpt := range cached {
+		if _, ok := changed[endpt.Id]; !ok {
+			updated = append(updated, endpt)
+		}
+	}
+	if upsert {
+		updated = append(updated, endpts...)
+	}
+	sdCache.replace(sdCache.endpointsCache, sdCache.buildEndptsKey(nsName, svcName), updated)
+}
+
+func (sdCache *sdCache) Snapshot() model.CacheSnapshot {
+	snapshot := model.CacheSnapshot{
+		ServiceIds: make(map[string]map[string]string),
+		Endpoints:  make(map[string]map[string][]*model.Endpoint),
+	}
+
+	if namespaces, found, _ := sdCache.GetNamespaceMap(); found {
+		snapshot.Namespaces = namespaces
+	}
+
+	for _, key := range sdCache.defaultCache.Keys() {
+		prefix, nsName, ok := strings.Cut(key.(string), ":")
+		if !ok || prefix != svcKeyPrefix {
+			continue
+		}
+		if serviceIdMap, found, _ := sdCache.GetServiceIdMap(nsName); found {
+			snapshot.ServiceIds[nsName] = serviceIdMap
+		}
+	}
+
+	for _, key := range sdCache.endpointsCache.Keys() {
+		nsName, svcName, ok := strings.Cut(key.(string), ":")
+		if !ok {
+			continue
+		}
+		if endpts, found, _ := sdCache.GetEndpoints(nsName, svcName); found {
+			if snapshot.Endpoints[nsName] == nil {
+				snapshot.Endpoints[nsName] = make(map[string][]*model.Endpoint)
+			}
+			snapshot.Endpoints[nsName][svcName] = endpts
+		}
+	}
+
+	return snapshot
+}
+
+func (sdCache *sdCache) get(c *cache.LRUExpireCache, key string) (*cacheEntry, bool) {
+	value, exists := c.Get(key)
+	if !exists {
+		return nil, false
+	}
+	entry, ok := value.(*cacheEntry)
+	if !ok {
+		return &cacheEntry{value: value}, true
+	}
+	return entry, true
+}
+
+func (sdCache *sdCache) add(c *cache.LRUExpireCache, key string, value interface{}, ttl time.Duration) {
+	sdCache.mutex.Lock()
+	defer sdCache.mutex.Unlock()
+
+	now := sdCache.clock.Now()
+	entry := &cacheEntry{
+		value:     value,
+		refreshAt: now.Add(ttl),
+		expiresAt: now.Add(ttl + sdCache.config.StaleTTL),
+	}
+	c.Add(key, entry, entry.expiresAt.Sub(now))
+}
+
+// replace updates the value of a cached entry, keeping its freshness and expiry.
+func (sdCache *sdCache) replace(c *cache.LRUExpireCache, key string, value interface{}) {
+	entry, exists := sdCache.get(c, key)
+	if !exists {
+		return
+	}
+	ttl := entry.expiresAt.Sub(sdCache.clock.Now())
+	if ttl <= 0 {
+		return
+	}
+	c.Add(key, &cacheEntry{value: value, refreshAt: entry.refreshAt, expiresAt: entry.expiresAt}, ttl)
+}
+
+func (sdCache *sdCache) isStale(entry *cacheEntry) bool {
+	return sdCache.clock.Now().After(entry.refreshAt)
+}
+
 func (sdCache *sdCache) buildSvcKey(nsName string) (cacheKey string) {
 	return fmt.Sprintf("%s:%s", svcKeyPrefix, nsName)
 }
@@ -150,3 +320,7 @@ func (sdCache *sdCache) buildSvcKey(nsName string) (cacheKey string) {
 func (sdCache *sdCache) buildEndptsKey(nsName string, svcName string) string {
 	return fmt.Sprintf("%s:%s", nsName, svcName)
 }
+
+type clock struct{}
+
+func (clock) Now() time.Time { return time.Now() }
@@ -9,7 +9,6 @@ import (
 	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/test"
 	"github.com/go-logr/logr/testr"
 	"github.com/stretchr/testify/assert"
-	"k8s.io/apimachinery/pkg/util/cache"
 )
 
 func TestNewServiceDiscoveryClientCache(t *testing.T) {
@@ -17,6 +16,7 @@ func TestNewServiceDiscoveryClientCache(t *testing.T) {
 		NsTTL:    3 * time.Second,
 		SvcTTL:   3 * time.Second,
 		EndptTTL: 3 * time.Second,
+		StaleTTL: 3 * time.Second,
 	}).(*sdCache)
 	if !ok {
 		t.Fatalf("failed to create cache")
@@ -25,6 +25,7 @@ func TestNewServiceDiscoveryClientCache(t *testing.T) {
 	assert.Equal(t, 3*time.Second, sdc.config.NsTTL)
 	assert.Equal(t, 3*time.Second, sdc.config.SvcTTL)
 	assert.Equal(t, 3*time.Second, sdc.config.EndptTTL)
+	assert.Equal(t, 3*time.Second, sdc.config.StaleTTL)
 }
 
 func TestNewDefaultServiceDiscoveryClientCache(t *testing.T) {
@@ -36,6 +37,7 @@ func TestNewDefaultServiceDiscoveryClientCache(t *testing.T) {
 	assert.Equal(t, defaultNsTTL, sdc.config.NsTTL)
 	assert.Equal(t, defaultSvcTTL, sdc.config.SvcTTL)
 	assert.Equal(t, defaultEndptTTL, sdc.config.EndptTTL)
+	assert.Equal(t, defaultStaleTTL, sdc.config.StaleTTL)
 }
 
 func TestServiceDiscoveryClientCacheGetNamespaceMap_Found(t *testing.T) {
@@ -44,7 +46,7 @@ func TestServiceDiscoveryClientCacheGetNamespaceMap_Found(t *testing.T) {
 		test.HttpNsName: test.GetTestHttpNamespace(),
 	})
 
-	nsMap, found := sdc.GetNamespaceMap()
+	nsMap, found, _ := sdc.GetNamespaceMap()
 	assert.True(t, found)
 	assert.Equal(t, test.GetTestHttpNamespace(), nsMap[test.HttpNsName])
 }
@@ -52,7 +54,7 @@ func TestServiceDiscoveryClientCacheGetNamespaceMap_Found(t *testing.T) {
 func TestServiceDiscoveryClientCacheGetNamespaceMap_NotFound(t *testing.T) {
 	sdc := NewDefaultServiceDiscoveryClientCache()
 
-	nsMap, found := sdc.GetNamespaceMap()
+	nsMap, found, _ := sdc.GetNamespaceMap()
 	assert.False(t, found)
 	assert.Nil(t, nsMap)
 }
@@ -61,7 +63,7 @@ func TestServiceDiscoveryClientCacheGetNamespaceMap_Corrupt(t *testing.T) {
 	sdc := getCacheImpl(t)
 	sdc.defaultCache.Add(nsKey, &model.Plan{}, time.Minute)
 
-	nsMap, found := sdc.GetNamespaceMap()
+	nsMap, found, _ := sdc.GetNamespaceMap()
 	assert.False(t, found)
 	assert.Nil(t, nsMap)
 }
@@ -73,7 +75,7 @@ func TestServiceDiscoveryClientEvictNamespaceMap(t *testing.T) {
 	})
 	sdc.EvictNamespaceMap()
 
-	nsMap, found := sdc.GetNamespaceMap()
+	nsMap, found, _ := sdc.GetNamespaceMap()
 	assert.False(t, found)
 	assert.Nil(t, nsMap)
 }
@@ -84,7 +86,7 @@ func TestServiceDiscoveryClientCacheGetServiceIdMap_Found(t *testing.T) {
 		test.SvcName: test.SvcId,
 	})
 
-	svcIdMap, found := sdc.GetServiceIdMap(test.HttpNsName)
+	svcIdMap, found, _ := sdc.GetServiceIdMap(test.HttpNsName)
 	assert.True(t, found)
 	assert.Equal(t, test.SvcId, svcIdMap[test.SvcName])
 }
@@ -92,7 +94,7 @@ func TestServiceDiscoveryClientCacheGetServiceIdMap_Found(t *testing.T) {
 func TestServiceDiscoveryClientCacheGetServiceIdMap_NotFound(t *testing.T) {
 	sdc := NewDefaultServiceDiscoveryClientCache()
 
-	svcIdMap, found := sdc.GetServiceIdMap(test.HttpNsName)
+	svcIdMap, found, _ := sdc.GetServiceIdMap(test.HttpNsName)
 	assert.False(t, found)
 	assert.Empty(t, svcIdMap)
 }
@@ -101,7 +103,7 @@ func TestServiceDiscoveryClientCacheGetServiceIdMap_Corrupt(t *testing.T) {
 	sdc := getCacheImpl(t)
 	sdc.defaultCache.Add(sdc.buildSvcKey(test.HttpNsName), &model.Plan{}, time.Minute)
 
-	svcIdMap, found := sdc.GetServiceIdMap(test.HttpNsName)
+	svcIdMap, found, _ := sdc.GetServiceIdMap(test.HttpNsName)
 	assert.False(t, found)
 	assert.Empty(t, svcIdMap)
 }
@@ -113,7 +115,7 @@ func TestServiceDiscoveryClientEvictServiceIdMap(t *testing.T) {
 	})
 	sdc.EvictServiceIdMap(test.HttpNsName)
 
-	svcIdMap, found := sdc.GetServiceIdMap(test.HttpNsName)
+	svcIdMap, found, _ := sdc.GetServiceIdMap(test.HttpNsName)
 	assert.False(t, found)
 	assert.Empty(t, svcIdMap)
 }
@@ -122,7 +124,7 @@ func TestServiceDiscoveryClientCacheGetEndpoints_Found(t *testing.T) {
 	sdc := NewDefaultServiceDiscoveryClientCache()
 	sdc.CacheEndpoints(test.HttpNsName, test.SvcName, []*model.Endpoint{test.GetTestEndpoint1(), test.GetTestEndpoint2()})
 
-	endpts, found := sdc.GetEndpoints(test.HttpNsName, test.SvcName)
+	endpts, found, _ := sdc.GetEndpoints(test.HttpNsName, test.SvcName)
 	assert.True(t, found)
 	assert.Equal(t, []*model.Endpoint{test.GetTestEndpoint1(), test.GetTestEndpoint2()}, endpts)
 }
@@ -130,7 +132,7 @@ func TestServiceDiscoveryClientCacheGetEndpoints_Found(t *testing.T) {
 func TestServiceDiscoveryClientCacheGetEndpoints_NotFound(t *testing.T) {
 	sdc := NewDefaultServiceDiscoveryClientCache()
 
-	endpts, found := sdc.GetEndpoints(test.HttpNsName, test.SvcName)
+	endpts, found, _ := sdc.GetEndpoints(test.HttpNsName, test.SvcName)
 	assert.False(t, found)
 	assert.Nil(t, endpts)
 }
@@ -139,7 +141,7 @@ func TestServiceDiscoveryClientCacheGetEndpoints_Corrupt(t *testing.T) {
 	sdc := getCacheImpl(t)
 	sdc.defaultCache.Add(sdc.buildEndptsKey(test.HttpNsName, test.SvcName), &model.Plan{}, time.Minute)
 
-	endpts, found := sdc.GetEndpoints(test.HttpNsName, test.SvcName)
+	endpts, found, _ := sdc.GetEndpoints(test.HttpNsName, test.SvcName)
 	assert.False(t, found)
 	assert.Nil(t, endpts)
 }
@@ -149,15 +151,123 @@ func TestServiceDiscoveryClientEvictEndpoints(t *testing.T) {
 	sdc.CacheEndpoints(test.HttpNsName, test.SvcName, []*model.Endpoint{test.GetTestEndpoint1(), test.GetTestEndpoint2()})
 	sdc.EvictEndpoints(test.HttpNsName, test.SvcName)
 
-	endpts, found := sdc.GetEndpoints(test.HttpNsName, test.SvcName)
+	endpts, found, _ := sdc.GetEndpoints(test.HttpNsName, test.SvcName)
 	assert.False(t, found)
 	assert.Nil(t, endpts)
 }
 
-func getCacheImpl(t *testing.T) sdCache {
-	return sdCache{
-		log:            common.NewLoggerWithLogr(testr.New(t)),
-		defaultCache:   cache.NewLRUExpireCache(defaultCacheSize),
-		endpointsCache: cache.NewLRUExpireCache(defaultCacheSize),
-	}
+func getCacheImpl(t *testing.T) *sdCache {
+	sdc := newSdCache(DefaultSdCacheConfig(), clock{})
+	sdc.log = common.NewLoggerWithLogr(testr.New(t))
+	return sdc
+}
+
+func TestServiceDiscoveryClientCache_Stale(t *testing.T) {
+	clk := &fakeClock{now: time.Now()}
+	sdc := newSdCache(&SdCacheConfig{NsTTL: time.Second, StaleTTL: time.Minute}, clk)
+	sdc.CacheNamespaceMap(map[string]*model.Namespace{
+		test.HttpNsName: test.GetTestHttpNamespace(),
+	})
+
+	_, found, stale := sdc.GetNamespaceMap()
+	assert.True(t, found)
+	assert.False(t, stale)
+
+	// entries past their TTL are still served within the stale window
+	clk.now = clk.now.Add(2 * time.Second)
+	nsMap, found, stale := sdc.GetNamespaceMap()
+	assert.True(t, found)
+	assert.True(t, stale)
+	assert.Equal(t, test.GetTestHttpNamespace(), nsMap[test.HttpNsName])
+
+	// and expire after it
+	clk.now = clk.now.Add(time.Minute)
+	_, found, _ = sdc.GetNamespaceMap()
+	assert.False(t, found)
+}
+
+func TestServiceDiscoveryClientCacheAddServiceId(t *testing.T) {
+	sdc := NewDefaultServiceDiscoveryClientCache()
+	cached := map[string]string{test.SvcName: test.SvcId}
+	sdc.CacheServiceIdMap(test.HttpNsName, cached)
+	sdc.AddServiceId(test.HttpNsName, "other-svc", "other-svc-id")
+
+	svcIdMap, found, _ := sdc.GetServiceIdMap(test.HttpNsName)
+	assert.True(t, found)
+	assert.Equal(t, map[string]string{test.SvcName: test.SvcId, "other-svc": "other-svc-id"}, svcIdMap)
+	assert.Len(t, cached, 1, "previously returned maps are not modified")
+
+	// no-op for maps which are not cached
+	sdc.AddServiceId(test.DnsNsName, test.SvcName, test.SvcId)
+	_, found, _ = sdc.GetServiceIdMap(test.DnsNsName)
+	assert.False(t, found)
+}
+
+func TestServiceDiscoveryClientCacheUpsertEndpoints(t *testing.T) {
+	sdc := NewDefaultServiceDiscoveryClientCache()
+	cached := []*model.Endpoint{test.GetTestEndpoint1()}
+	sdc.CacheEndpoints(test.HttpNsName, test.SvcName, cached)
+
+	updated := test.GetTestEndpoint1()
+	updated.Ready = false
+	sdc.UpsertEndpoints(test.HttpNsName, test.SvcName, []*model.Endpoint{updated, test.GetTestEndpoint2()})
+
+	endpts, found, _ := sdc.GetEndpoints(test.HttpNsName, test.SvcName)
+	assert.True(t, found)
+	assert.Equal(t, []*model.Endpoint{updated, test.GetTestEndpoint2()}, endpts)
+	assert.Equal(t, []*model.Endpoint{test.GetTestEndpoint1()}, cached, "previously returned lists are not modified")
+
+	// no-op for lists which are not cached
+	sdc.UpsertEndpoints(test.DnsNsName, test.SvcName, []*model.Endpoint{test.GetTestEndpoint1()})
+	_, found, _ = sdc.GetEndpoints(test.DnsNsName, test.SvcName)
+	assert.False(t, found)
 }
+
+func TestServiceDiscoveryClientCacheRemoveEndpoints(t *testing.T) {
+	sdc := NewDefaultServiceDiscoveryClientCache()
+	sdc.CacheEndpoints(test.HttpNsName, test.SvcName, []*model.Endpoint{test.GetTestEndpoint1(), test.GetTestEndpoint2()})
+	sdc.RemoveEndpoints(test.HttpNsName, test.SvcName, []*model.Endpoint{{Id: test.EndptId1}})
+
+	endpts, found, _ := sdc.GetEndpoints(test.HttpNsName, test.SvcName)
+	assert.True(t, found)
+	assert.Equal(t, []*model.Endpoint{test.GetTestEndpoint2()}, endpts)
+}
+
+func TestServiceDiscoveryClientCacheUpdate_KeepsExpiry(t *testing.T) {
+	clk := &fakeClock{now: time.Now()}
+	sdc := newSdCache(&SdCacheConfig{EndptTTL: time.Second, StaleTTL: time.Second}, clk)
+	sdc.CacheEndpoints(test.HttpNsName, test.SvcName, []*model.Endpoint{test.GetTestEndpoint1()})
+
+	clk.now = clk.now.Add(1500 * time.Millisecond)
+	sdc.UpsertEndpoints(test.HttpNsName, test.SvcName, []*model.Endpoint{test.GetTestEndpoint2()})
+	_, found, stale := sdc.GetEndpoints(test.HttpNsName, test.SvcName)
+	assert.True(t, found)
+	assert.True(t, stale, "updates do not refresh entries")
+
+	clk.now = clk.now.Add(time.Second)
+	_, found, _ = sdc.GetEndpoints(test.HttpNsName, test.SvcName)
+	assert.False(t, found)
+}
+
+func TestServiceDiscoveryClientCacheSnapshot(t *testing.T) {
+	sdc := NewDefaultServiceDiscoveryClientCache()
+	sdc.CacheNamespaceMap(map[string]*model.Namespace{
+		test.HttpNsName: test.GetTestHttpNamespace(),
+	})
+	sdc.CacheServiceIdMap(test.HttpNsName, map[string]string{test.SvcName: test.SvcId})
+	sdc.CacheEndpoints(test.HttpNsName, test.SvcName, []*model.Endpoint{test.GetTestEndpoint1()})
+
+	assert.Equal(t, model.CacheSnapshot{
+		Namespaces: map[string]*model.Namespace{test.HttpNsName: test.GetTestHttpNamespace()},
+		ServiceIds: map[string]map[string]string{test.HttpNsName: {test.SvcName: test.SvcId}},
+		Endpoints: map[string]map[string][]*model.Endpoint{
+			test.HttpNsName: {test.SvcName: {test.GetTestEndpoint1()}},
+		},
+	}, sdc.Snapshot())
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
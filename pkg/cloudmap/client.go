@@ -2,13 +2,24 @@ package cloudmap
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/common"
 	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/servicediscovery/types"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// Maximum duration of the background refresh of a stale cache entry
+	refreshTimeout = 30 * time.Second
+
+	// Maximum duration of a load of AWS Cloud Map resources shared by concurrent callers
+	loadTimeout = 30 * time.Second
 )
 
 // ServiceDiscoveryClient provides the service endpoint management functionality required by the AWS Cloud Map
@@ -17,24 +28,48 @@ type ServiceDiscoveryClient interface {
 	// ListServices returns all services and their endpoints for a given namespace.
 	ListServices(ctx context.Context, namespaceName string) ([]*model.Service, error)
 
+	// ListServiceNames returns the names of all services for a given namespace, without fetching their endpoints.
+	ListServiceNames(ctx context.Context, namespaceName string) ([]string, error)
+
 	// CreateService creates a Cloud Map service resource, and namespace if necessary.
 	CreateService(ctx context.Context, namespaceName string, serviceName string) error
 
-	// GetService returns a service resource fetched from AWS Cloud Map or nil if not found.
+	// GetService returns a service resource fetched from AWS Cloud Map or nil if not found. Its endpoints may be served
+	// stale from the cache while they are refreshed in the background.
 	GetService(ctx context.Context, namespaceName string, serviceName string) (*model.Service, error)
 
+	// GetFreshService returns a service resource like GetService, but reloads endpoints cached past their TTL instead of
+	// serving them stale, for callers that update the endpoints from their differences with the desired ones.
+	GetFreshService(ctx context.Context, namespaceName string, serviceName string) (*model.Service, error)
+
 	// RegisterEndpoints registers all endpoints for given service.
 	RegisterEndpoints(ctx context.Context, namespaceName string, serviceName string, endpoints []*model.Endpoint) error
 
 	// DeleteEndpoints de-registers all endpoints for given service.
 	DeleteEndpoints(ctx context.Context, namespaceName string, serviceName string, endpoints []*model.Endpoint) error
+
+	// CacheSnapshot returns the AWS Cloud Map resources currently cached, for troubleshooting.
+	CacheSnapshot() model.CacheSnapshot
 }
 
 type serviceDiscoveryClient struct {
 	log          common.Logger
 	sdApi        ServiceDiscoveryApi
 	cache        ServiceDiscoveryClientCache
+	pollerConfig *OperationPollerConfig
 	clusterUtils model.ClusterUtils
+	nsMapper     NamespaceMapper
+	// deduplicates concurrent loads of the same resources from AWS Cloud Map
+	loads singleflight.Group
+	// counts the writes to the cached resources of each load key, so that loads started before a write do not cache
+	// their outdated result
+	generations map[string]uint64
+	// serializes the writes to the cached resources with the caching of loaded resources
+	writeMutex sync.Mutex
+	// keys of the cache entries being refreshed in the background
+	refreshing sync.Map
+	// endpoint load keys of the services with more instances than DiscoverInstances returns, which are listed directly
+	largeServices sync.Map
 }
 
 // NewDefaultServiceDiscoveryClient creates a new service discovery client for AWS Cloud Map with default resource cache
@@ -44,21 +79,42 @@ func NewDefaultServiceDiscoveryClient(cfg *aws.Config, clusterUtils model.Cluste
 		log:          common.NewLogger("cloudmap", "client"),
 		sdApi:        NewServiceDiscoveryApiFromConfig(cfg),
 		cache:        NewDefaultServiceDiscoveryClientCache(),
+		pollerConfig: DefaultOperationPollerConfig(),
 		clusterUtils: clusterUtils,
+		nsMapper:     NewDefaultNamespaceMapper(),
 	}
 }
 
 func NewServiceDiscoveryClientWithCustomCache(cfg *aws.Config, cacheConfig *SdCacheConfig, clusterUtils model.ClusterUtils) ServiceDiscoveryClient {
+	return NewServiceDiscoveryClientWithConfig(cfg, cacheConfig, DefaultOperationPollerConfig(), NewDefaultNamespaceMapper(), clusterUtils)
+}
+
+// NewServiceDiscoveryClientWithConfig creates a new service discovery client for AWS Cloud Map with custom resource
+// cache, operation poller settings and namespace mapping from a given AWS client config.
+func NewServiceDiscoveryClientWithConfig(cfg *aws.Config, cacheConfig *SdCacheConfig, pollerConfig *OperationPollerConfig, nsMapper NamespaceMapper, clusterUtils model.ClusterUtils) ServiceDiscoveryClient {
+	return NewServiceDiscoveryClientWithApi(NewServiceDiscoveryApiFromConfig(cfg), cacheConfig, pollerConfig, nsMapper, clusterUtils)
+}
+
+// NewServiceDiscoveryClientWithApi creates a new service discovery client on top of a given AWS Cloud Map API, e.g. an
+// in-memory Cloud Map for testing, with custom resource cache, operation poller settings and namespace mapping.
+func NewServiceDiscoveryClientWithApi(sdApi ServiceDiscoveryApi, cacheConfig *SdCacheConfig, pollerConfig *OperationPollerConfig, nsMapper NamespaceMapper, clusterUtils model.ClusterUtils) ServiceDiscoveryClient {
 	return &serviceDiscoveryClient{
 		log:          common.NewLogger("cloudmap", "client"),
-		sdApi:        NewServiceDiscoveryApiFromConfig(cfg),
+		sdApi:        sdApi,
 		cache:        NewServiceDiscoveryClientCache(cacheConfig),
+		pollerConfig: pollerConfig,
 		clusterUtils: clusterUtils,
+		nsMapper:     nsMapper,
 	}
 }
 
 func (sdc *serviceDiscoveryClient) ListServices(ctx context.Context, nsName string) (svcs []*model.Service, err error) {
-	svcIdMap, err := sdc.getServiceIds(ctx, nsName)
+	cmNsName, err := sdc.nsMapper.CloudMapNamespaceName(ctx, nsName)
+	if err != nil {
+		return svcs, err
+	}
+
+	svcIdMap, err := sdc.getServiceIds(ctx, cmNsName)
 	if err != nil {
 		// Ignore resource not found error, as it will indicate deleted resources in CloudMap
 		if common.IsNotFound(err) {
@@ -68,7 +124,7 @@ func (sdc *serviceDiscoveryClient) ListServices(ctx context.Context, nsName stri
 	}
 
 	for svcName := range svcIdMap {
-		endpts, endptsErr := sdc.getEndpoints(ctx, nsName, svcName)
+		endpts, endptsErr := sdc.getEndpoints(ctx, cmNsName, svcName, true)
 		if endptsErr != nil {
 			return svcs, endptsErr
 		}
@@ -83,36 +139,78 @@ func (sdc *serviceDiscoveryClient) ListServices(ctx context.Context, nsName stri
 	return svcs, nil
 }
 
+func (sdc *serviceDiscoveryClient) ListServiceNames(ctx context.Context, nsName string) (svcNames []string, err error) {
+	cmNsName, err := sdc.nsMapper.CloudMapNamespaceName(ctx, nsName)
+	if err != nil {
+		return nil, err
+	}
+
+	svcIdMap, err := sdc.getServiceIds(ctx, cmNsName)
+	if err != nil {
+		// Ignore resource not found error, as it will indicate deleted resources in CloudMap
+		if common.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	for svcName := range svcIdMap {
+		svcNames = append(svcNames, svcName)
+	}
+	sort.Strings(svcNames)
+	return svcNames, nil
+}
+
 func (sdc *serviceDiscoveryClient) CreateService(ctx context.Context, nsName string, svcName string) error {
-	sdc.log.Info("creating a new service", "namespace", nsName, "name", svcName)
+	cmNsName, err := sdc.nsMapper.CloudMapNamespaceName(ctx, nsName)
+	if err != nil {
+		return err
+	}
+
+	sdc.log.Info("creating a new service", "namespace", nsName, "cloudMapNamespace", cmNsName, "name", svcName)
 
-	namespace, err := sdc.getNamespace(ctx, nsName)
+	namespace, err := sdc.getNamespace(ctx, cmNsName)
 	if common.IsUnknown(err) {
 		return err
 	}
 
 	if common.IsNotFound(err) {
-		sdc.log.Info("namespace not found for service", "namespace", nsName, "service", svcName)
+		sdc.log.Info("namespace not found for service", "namespace", cmNsName, "service", svcName)
 		// Create HttpNamespace if the namespace is not present in CloudMap
-		namespace, err = sdc.createNamespace(ctx, nsName)
+		namespace, err = sdc.createNamespace(ctx, cmNsName)
 		if err != nil {
 			return err
 		}
 	}
 
-	_, err = sdc.sdApi.CreateService(ctx, *namespace, svcName)
+	svcId, err := sdc.sdApi.CreateService(ctx, *namespace, svcName)
 	if err != nil {
 		return err
 	}
 
-	sdc.cache.EvictServiceIdMap(nsName)
+	sdc.write(serviceIdsKey(cmNsName), func() {
+		sdc.cache.AddServiceId(cmNsName, svcName, svcId)
+	})
 
 	return nil
 }
 
 func (sdc *serviceDiscoveryClient) GetService(ctx context.Context, nsName string, svcName string) (svc *model.Service, err error) {
-	sdc.log.Info("fetching a service", "namespace", nsName, "name", svcName)
-	if endpts, found := sdc.cache.GetEndpoints(nsName, svcName); found {
+	return sdc.getService(ctx, nsName, svcName, true)
+}
+
+func (sdc *serviceDiscoveryClient) GetFreshService(ctx context.Context, nsName string, svcName string) (svc *model.Service, err error) {
+	return sdc.getService(ctx, nsName, svcName, false)
+}
+
+func (sdc *serviceDiscoveryClient) getService(ctx context.Context, nsName string, svcName string, allowStale bool) (svc *model.Service, err error) {
+	cmNsName, err := sdc.nsMapper.CloudMapNamespaceName(ctx, nsName)
+	if err != nil {
+		return nil, err
+	}
+
+	sdc.log.Info("fetching a service", "namespace", nsName, "cloudMapNamespace", cmNsName, "name", svcName)
+	if endpts, found := sdc.getCachedEndpoints(cmNsName, svcName, allowStale); found {
 		return &model.Service{
 			Namespace: nsName,
 			Name:      svcName,
@@ -120,12 +218,12 @@ func (sdc *serviceDiscoveryClient) GetService(ctx context.Context, nsName string
 		}, nil
 	}
 
-	_, err = sdc.getServiceId(ctx, nsName, svcName)
+	_, err = sdc.getServiceId(ctx, cmNsName, svcName)
 	if err != nil {
 		return nil, err
 	}
 
-	endpts, err := sdc.getEndpoints(ctx, nsName, svcName)
+	endpts, err := sdc.getEndpoints(ctx, cmNsName, svcName, allowStale)
 	if err != nil {
 		return nil, err
 	}
@@ -143,30 +241,40 @@ func (sdc *serviceDiscoveryClient) RegisterEndpoints(ctx context.Context, nsName
 		return nil
 	}
 
-	sdc.log.Info("registering endpoints", "namespaceName", nsName, "serviceName", svcName, "endpoints", endpts)
+	cmNsName, err := sdc.nsMapper.CloudMapNamespaceName(ctx, nsName)
+	if err != nil {
+		return err
+	}
+
+	sdc.log.Info("registering endpoints", "namespaceName", nsName, "cloudMapNamespace", cmNsName, "serviceName", svcName, "endpoints", endpts)
 
-	svcId, err := sdc.getServiceId(ctx, nsName, svcName)
+	svcId, err := sdc.getServiceId(ctx, cmNsName, svcName)
 	if err != nil {
 		return err
 	}
 
-	operationPoller := NewOperationPoller(sdc.sdApi)
+	operationPoller := sdc.newOperationPoller(svcId)
 	for _, endpt := range endpts {
 		endptId := endpt.Id
 		endptAttrs := endpt.GetCloudMapAttributes()
-		operationPoller.Submit(ctx, func() (opId string, err error) {
+		operationPoller.Submit(ctx, types.OperationTypeRegisterInstance, func() (opId string, err error) {
 			return sdc.sdApi.RegisterInstance(ctx, svcId, endptId, endptAttrs)
 		})
 	}
 
-	// Evict cache entry so next list call reflects changes
-	sdc.cache.EvictEndpoints(nsName, svcName)
-
-	err = operationPoller.Await()
-	if err != nil {
-		return common.Wrap(err, errors.New("failure while registering endpoints"))
+	if err = operationPoller.Await(); err != nil {
+		// Evict cache entry as the registered endpoints are unknown
+		sdc.write(endpointsKey(cmNsName, svcName), func() {
+			sdc.cache.EvictEndpoints(cmNsName, svcName)
+		})
+		return fmt.Errorf("failure while registering endpoints: %w", err)
 	}
 
+	// Update cache entry so next list call reflects changes
+	sdc.write(endpointsKey(cmNsName, svcName), func() {
+		sdc.cache.UpsertEndpoints(cmNsName, svcName, endpts)
+	})
+
 	return nil
 }
 
@@ -176,63 +284,155 @@ func (sdc *serviceDiscoveryClient) DeleteEndpoints(ctx context.Context, nsName s
 		return nil
 	}
 
-	sdc.log.Info("deleting endpoints", "namespaceName", nsName, "serviceName", svcName, "endpoints", endpts)
+	cmNsName, err := sdc.nsMapper.CloudMapNamespaceName(ctx, nsName)
+	if err != nil {
+		return err
+	}
+
+	sdc.log.Info("deleting endpoints", "namespaceName", nsName, "cloudMapNamespace", cmNsName, "serviceName", svcName, "endpoints", endpts)
 
-	svcId, err := sdc.getServiceId(ctx, nsName, svcName)
+	svcId, err := sdc.getServiceId(ctx, cmNsName, svcName)
 	if err != nil {
 		return err
 	}
 
-	operationPoller := NewOperationPoller(sdc.sdApi)
+	operationPoller := sdc.newOperationPoller(svcId)
 	for _, endpt := range endpts {
 		endptId := endpt.Id
-		operationPoller.Submit(ctx, func() (opId string, err error) {
+		operationPoller.Submit(ctx, types.OperationTypeDeregisterInstance, func() (opId string, err error) {
 			return sdc.sdApi.DeregisterInstance(ctx, svcId, endptId)
 		})
 	}
 
-	// Evict cache entry so next list call reflects changes
-	sdc.cache.EvictEndpoints(nsName, svcName)
+	if err = operationPoller.Await(); err != nil {
+		// Evict cache entry as the de-registered endpoints are unknown
+		sdc.write(endpointsKey(cmNsName, svcName), func() {
+			sdc.cache.EvictEndpoints(cmNsName, svcName)
+		})
+		return fmt.Errorf("failure while de-registering endpoints: %w", err)
+	}
+
+	// Update cache entry so next list call reflects changes
+	sdc.write(endpointsKey(cmNsName, svcName), func() {
+		sdc.cache.RemoveEndpoints(cmNsName, svcName, endpts)
+	})
 
-	err = operationPoller.Await()
-	if err != nil {
-		return common.Wrap(err, errors.New("failure while de-registering endpoints"))
+	return nil
+}
+
+func (sdc *serviceDiscoveryClient) CacheSnapshot() model.CacheSnapshot {
+	return sdc.cache.Snapshot()
+}
+
+func (sdc *serviceDiscoveryClient) getEndpoints(ctx context.Context, nsName string, svcName string, allowStale bool) (endpts []*model.Endpoint, err error) {
+	if endpts, found := sdc.getCachedEndpoints(nsName, svcName, allowStale); found {
+		return endpts, nil
 	}
+	return sdc.loadEndpoints(ctx, nsName, svcName)
+}
 
-	return err
+// getCachedEndpoints returns the cached endpoints of a service, and refreshes them in the background if stale. Stale
+// endpoints are reported as not found unless allowStale is set, so that the caller loads them.
+func (sdc *serviceDiscoveryClient) getCachedEndpoints(nsName string, svcName string, allowStale bool) (endpts []*model.Endpoint, found bool) {
+	endpts, found, stale := sdc.cache.GetEndpoints(nsName, svcName)
+	if found && stale && !allowStale {
+		return nil, false
+	}
+	if found && stale {
+		sdc.refresh(endpointsKey(nsName, svcName), func(ctx context.Context) error {
+			_, err := sdc.loadEndpoints(ctx, nsName, svcName)
+			return err
+		})
+	}
+	return endpts, found
 }
 
-func (sdc *serviceDiscoveryClient) getEndpoints(ctx context.Context, nsName string, svcName string) (endpts []*model.Endpoint, err error) {
-	endpts, found := sdc.cache.GetEndpoints(nsName, svcName)
-	if found {
+func (sdc *serviceDiscoveryClient) loadEndpoints(ctx context.Context, nsName string, svcName string) ([]*model.Endpoint, error) {
+	result, err := sdc.load(ctx, endpointsKey(nsName, svcName), func(ctx context.Context) (interface{}, error) {
+		clusterProperties, err := sdc.clusterUtils.GetClusterProperties(ctx)
+		if err != nil {
+			sdc.log.Error(err, "failed to retrieve clusterSetId")
+			return nil, err
+		}
+
+		insts, err := sdc.discoverInstances(ctx, nsName, svcName, clusterProperties.ClusterSetId())
+		if err != nil {
+			return nil, err
+		}
+
+		var endpts []*model.Endpoint
+		for _, inst := range insts {
+			endpt, endptErr := model.NewEndpointFromInstance(&inst)
+			if endptErr != nil {
+				sdc.log.Error(endptErr, "skipping instance to endpoint conversion", "instanceId", *inst.InstanceId)
+				continue
+			}
+			endpts = append(endpts, endpt)
+		}
 		return endpts, nil
+	}, func(value interface{}) {
+		sdc.cache.CacheEndpoints(nsName, svcName, value.([]*model.Endpoint))
+	})
+	if err != nil {
+		return nil, err
 	}
+	return result.([]*model.Endpoint), nil
+}
 
-	clusterProperties, err := sdc.clusterUtils.GetClusterProperties(ctx)
+// discoverInstances returns the instances of a service registered by clusters of the given clusterset. DiscoverInstances
+// does not paginate, so the instances of larger services are listed instead, and services found large are listed
+// directly until they shrink below the DiscoverInstances limit.
+func (sdc *serviceDiscoveryClient) discoverInstances(ctx context.Context, nsName string, svcName string, clusterSetId string) ([]types.HttpInstanceSummary, error) {
+	key := endpointsKey(nsName, svcName)
+	if _, large := sdc.largeServices.Load(key); !large {
+		queryParameters := map[string]string{
+			model.ClusterSetIdAttr: clusterSetId,
+		}
+		insts, err := sdc.sdApi.DiscoverInstances(ctx, nsName, svcName, queryParameters)
+		if err != nil || len(insts) < DiscoverInstancesMaxResults {
+			return insts, err
+		}
+		sdc.log.Info("listing instances of a large service", "namespace", nsName, "service", svcName)
+	}
+
+	insts, err := sdc.listInstances(ctx, nsName, svcName, clusterSetId)
 	if err != nil {
-		sdc.log.Error(err, "failed to retrieve clusterSetId")
 		return nil, err
 	}
+	if len(insts) >= DiscoverInstancesMaxResults {
+		sdc.largeServices.Store(key, struct{}{})
+	} else {
+		sdc.largeServices.Delete(key)
+	}
+	return insts, nil
+}
 
-	queryParameters := map[string]string{
-		model.ClusterSetIdAttr: clusterProperties.ClusterSetId(),
+// listInstances returns all instances of a service registered by clusters of the given clusterset.
+func (sdc *serviceDiscoveryClient) listInstances(ctx context.Context, nsName string, svcName string, clusterSetId string) ([]types.HttpInstanceSummary, error) {
+	svcId, err := sdc.getServiceId(ctx, nsName, svcName)
+	if err != nil {
+		return nil, err
 	}
-	insts, err := sdc.sdApi.DiscoverInstances(ctx, nsName, svcName, queryParameters)
+
+	insts, err := sdc.sdApi.ListInstances(ctx, svcId)
 	if err != nil {
 		return nil, err
 	}
 
+	clusterSetInsts := make([]types.HttpInstanceSummary, 0, len(insts))
 	for _, inst := range insts {
-		endpt, endptErr := model.NewEndpointFromInstance(&inst)
-		if endptErr != nil {
-			sdc.log.Error(endptErr, "skipping instance to endpoint conversion", "instanceId", *inst.InstanceId)
+		if inst.Attributes[model.ClusterSetIdAttr] != clusterSetId {
 			continue
 		}
-		endpts = append(endpts, endpt)
+		clusterSetInsts = append(clusterSetInsts, types.HttpInstanceSummary{
+			InstanceId:    inst.Id,
+			NamespaceName: aws.String(nsName),
+			ServiceName:   aws.String(svcName),
+			Attributes:    inst.Attributes,
+		})
 	}
-	sdc.cache.CacheEndpoints(nsName, svcName, endpts)
 
-	return endpts, nil
+	return clusterSetInsts, nil
 }
 
 func (sdc *serviceDiscoveryClient) getNamespace(ctx context.Context, nsName string) (namespace *model.Namespace, err error) {
@@ -250,18 +450,30 @@ func (sdc *serviceDiscoveryClient) getNamespace(ctx context.Context, nsName stri
 
 func (sdc *serviceDiscoveryClient) getNamespaces(ctx context.Context) (namespaces map[string]*model.Namespace, err error) {
 	// We are assuming a unique namespace name per account
-	namespaces, found := sdc.cache.GetNamespaceMap()
+	namespaces, found, stale := sdc.cache.GetNamespaceMap()
 	if found {
+		if stale {
+			sdc.refresh(namespacesKey, func(ctx context.Context) error {
+				_, err := sdc.loadNamespaces(ctx)
+				return err
+			})
+		}
 		return namespaces, nil
 	}
 
-	namespaces, err = sdc.sdApi.GetNamespaceMap(ctx)
+	return sdc.loadNamespaces(ctx)
+}
+
+func (sdc *serviceDiscoveryClient) loadNamespaces(ctx context.Context) (map[string]*model.Namespace, error) {
+	result, err := sdc.load(ctx, namespacesKey, func(ctx context.Context) (interface{}, error) {
+		return sdc.sdApi.GetNamespaceMap(ctx)
+	}, func(value interface{}) {
+		sdc.cache.CacheNamespaceMap(value.(map[string]*model.Namespace))
+	})
 	if err != nil {
 		return nil, err
 	}
-	sdc.cache.CacheNamespaceMap(namespaces)
-
-	return namespaces, nil
+	return result.(map[string]*model.Namespace), nil
 }
 
 func (sdc *serviceDiscoveryClient) getServiceId(ctx context.Context, nsName string, svcName string) (svcId string, err error) {
@@ -278,23 +490,34 @@ func (sdc *serviceDiscoveryClient) getServiceId(ctx context.Context, nsName stri
 }
 
 func (sdc *serviceDiscoveryClient) getServiceIds(ctx context.Context, nsName string) (map[string]string, error) {
-	serviceIdMap, found := sdc.cache.GetServiceIdMap(nsName)
+	serviceIdMap, found, stale := sdc.cache.GetServiceIdMap(nsName)
 	if found {
+		if stale {
+			sdc.refresh(serviceIdsKey(nsName), func(ctx context.Context) error {
+				_, err := sdc.loadServiceIds(ctx, nsName)
+				return err
+			})
+		}
 		return serviceIdMap, nil
 	}
 
-	namespace, err := sdc.getNamespace(ctx, nsName)
-	if err != nil {
-		return nil, err
-	}
+	return sdc.loadServiceIds(ctx, nsName)
+}
 
-	serviceIdMap, err = sdc.sdApi.GetServiceIdMap(ctx, namespace.Id)
+func (sdc *serviceDiscoveryClient) loadServiceIds(ctx context.Context, nsName string) (map[string]string, error) {
+	result, err := sdc.load(ctx, serviceIdsKey(nsName), func(ctx context.Context) (interface{}, error) {
+		namespace, err := sdc.getNamespace(ctx, nsName)
+		if err != nil {
+			return nil, err
+		}
+		return sdc.sdApi.GetServiceIdMap(ctx, namespace.Id)
+	}, func(value interface{}) {
+		sdc.cache.CacheServiceIdMap(nsName, value.(map[string]string))
+	})
 	if err != nil {
 		return nil, err
 	}
-	sdc.cache.CacheServiceIdMap(nsName, serviceIdMap)
-
-	return serviceIdMap, nil
+	return result.(map[string]string), nil
 }
 
 func (sdc *serviceDiscoveryClient) createNamespace(ctx context.Context, nsName string) (namespace *model.Namespace, err error) {
@@ -304,7 +527,7 @@ func (sdc *serviceDiscoveryClient) createNamespace(ctx context.Context, nsName s
 		return nil, err
 	}
 
-	op, err := NewOperationPoller(sdc.sdApi).Poll(ctx, opId)
+	op, err := sdc.newOperationPoller("").Poll(ctx, types.OperationTypeCreateNamespace, opId)
 	if err != nil {
 		return nil, err
 	}
@@ -319,6 +542,95 @@ func (sdc *serviceDiscoveryClient) createNamespace(ctx context.Context, nsName s
 		Type: model.HttpNamespaceType,
 	}
 
-	sdc.cache.EvictNamespaceMap()
+	sdc.write(namespacesKey, sdc.cache.EvictNamespaceMap)
 	return namespace, nil
 }
+
+// newOperationPoller creates an operation poller, which optionally only looks up the operations of the given service.
+func (sdc *serviceDiscoveryClient) newOperationPoller(svcId string) OperationPoller {
+	pollerConfig := *sdc.pollerConfig
+	pollerConfig.ServiceId = svcId
+	return NewOperationPollerWithConfig(&pollerConfig, sdc.sdApi)
+}
+
+// load fetches AWS Cloud Map resources once for all concurrent callers with the same key, and caches them with store
+// unless they were written since the load started. The fetch runs with its own timeout rather than the context of the
+// first caller, so that a cancelled caller does not fail the others, and each caller stops waiting once its own
+// context is done.
+func (sdc *serviceDiscoveryClient) load(ctx context.Context, key string, fetch func(ctx context.Context) (interface{}, error), store func(value interface{})) (interface{}, error) {
+	results := sdc.loads.DoChan(key, func() (interface{}, error) {
+		generation := sdc.generation(key)
+
+		loadCtx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+		defer cancel()
+		value, err := fetch(loadCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		sdc.writeMutex.Lock()
+		defer sdc.writeMutex.Unlock()
+		if sdc.generations[key] == generation {
+			store(value)
+		} else {
+			sdc.log.Debug("not caching resources written during their load", "key", key)
+		}
+		return value, nil
+	})
+
+	select {
+	case result := <-results:
+		return result.Val, result.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// generation returns the number of writes to the cached resources of a load key.
+func (sdc *serviceDiscoveryClient) generation(key string) uint64 {
+	sdc.writeMutex.Lock()
+	defer sdc.writeMutex.Unlock()
+	return sdc.generations[key]
+}
+
+// write applies a write to the cached resources of a load key. Loads in progress do not cache their result
+// afterwards, and later callers do not wait for them.
+func (sdc *serviceDiscoveryClient) write(key string, update func()) {
+	sdc.writeMutex.Lock()
+	defer sdc.writeMutex.Unlock()
+	if sdc.generations == nil {
+		sdc.generations = make(map[string]uint64)
+	}
+	sdc.generations[key]++
+	sdc.loads.Forget(key)
+	update()
+}
+
+// refresh reloads a stale cache entry in the background, unless it is already being refreshed. Callers keep being
+// served the stale entry meanwhile.
+func (sdc *serviceDiscoveryClient) refresh(key string, load func(ctx context.Context) error) {
+	if _, refreshing := sdc.refreshing.LoadOrStore(key, struct{}{}); refreshing {
+		return
+	}
+
+	go func() {
+		defer sdc.refreshing.Delete(key)
+
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		defer cancel()
+		if err := load(ctx); err != nil {
+			sdc.log.Error(err, "failed to refresh cached resources", "key", key)
+		}
+	}()
+}
+
+// Keys of the loads of AWS Cloud Map resources
+const namespacesKey = "namespaces"
+
+func serviceIdsKey(nsName string) string {
+	return fmt.Sprintf("services:%s", nsName)
+}
+
+func endpointsKey(nsName string, svcName string) string {
+	return fmt.Sprintf("endpoints:%s:%s", nsName, svcName)
+}
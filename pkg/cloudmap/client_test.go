@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -38,17 +40,17 @@ func TestServiceDiscoveryClient_ListServices_HappyCase(t *testing.T) {
 	tc := getTestSdClient(t)
 	defer tc.close()
 
-	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(nil, false)
+	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(nil, false, false)
 
-	tc.mockCache.EXPECT().GetNamespaceMap().Return(nil, false)
-	tc.mockApi.EXPECT().GetNamespaceMap(context.TODO()).Return(getNamespaceMapForTest(), nil)
+	tc.mockCache.EXPECT().GetNamespaceMap().Return(nil, false, false)
+	tc.mockApi.EXPECT().GetNamespaceMap(gomock.Any()).Return(getNamespaceMapForTest(), nil)
 	tc.mockCache.EXPECT().CacheNamespaceMap(getNamespaceMapForTest())
 
-	tc.mockApi.EXPECT().GetServiceIdMap(context.TODO(), test.HttpNsId).Return(getServiceIdMapForTest(), nil)
+	tc.mockApi.EXPECT().GetServiceIdMap(gomock.Any(), test.HttpNsId).Return(getServiceIdMapForTest(), nil)
 	tc.mockCache.EXPECT().CacheServiceIdMap(test.HttpNsName, getServiceIdMapForTest())
 
-	tc.mockCache.EXPECT().GetEndpoints(test.HttpNsName, test.SvcName).Return(nil, false)
-	tc.mockApi.EXPECT().DiscoverInstances(context.TODO(), test.HttpNsName, test.SvcName, map[string]string{
+	tc.mockCache.EXPECT().GetEndpoints(test.HttpNsName, test.SvcName).Return(nil, false, false)
+	tc.mockApi.EXPECT().DiscoverInstances(gomock.Any(), test.HttpNsName, test.SvcName, map[string]string{
 		model.ClusterSetIdAttr: test.ClusterSet,
 	}).Return(getHttpInstanceSummaryForTest(), nil)
 
@@ -67,25 +69,52 @@ func TestServiceDiscoveryClient_ListServices_HappyCaseCachedResults(t *testing.T
 	dnsService := test.GetTestService()
 	dnsService.Namespace = test.DnsNsName
 
-	tc.mockCache.EXPECT().GetServiceIdMap(test.DnsNsName).Return(getServiceIdMapForTest(), true)
+	tc.mockCache.EXPECT().GetServiceIdMap(test.DnsNsName).Return(getServiceIdMapForTest(), true, false)
 
 	tc.mockCache.EXPECT().GetEndpoints(test.DnsNsName, test.SvcName).
-		Return([]*model.Endpoint{test.GetTestEndpoint1(), test.GetTestEndpoint2()}, true)
+		Return([]*model.Endpoint{test.GetTestEndpoint1(), test.GetTestEndpoint2()}, true, false)
 
 	svcs, err := tc.client.ListServices(context.TODO(), test.DnsNsName)
 	assert.Equal(t, []*model.Service{dnsService}, svcs)
 	assert.Nil(t, err, "No error for happy case")
 }
 
+func TestServiceDiscoveryClient_ListServiceNames(t *testing.T) {
+	tc := getTestSdClient(t)
+	defer tc.close()
+
+	// the endpoints of the services are not fetched
+	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).
+		Return(map[string]string{test.SvcName: test.SvcId, "other": "other-id"}, true, false)
+
+	svcNames, err := tc.client.ListServiceNames(context.TODO(), test.HttpNsName)
+	assert.Equal(t, []string{"other", test.SvcName}, svcNames)
+	assert.Nil(t, err)
+}
+
+func TestServiceDiscoveryClient_ListServiceNames_NamespaceNotFound(t *testing.T) {
+	tc := getTestSdClient(t)
+	defer tc.close()
+
+	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(nil, false, false)
+	tc.mockCache.EXPECT().GetNamespaceMap().Return(nil, false, false)
+	tc.mockApi.EXPECT().GetNamespaceMap(gomock.Any()).Return(map[string]*model.Namespace{}, nil)
+	tc.mockCache.EXPECT().CacheNamespaceMap(map[string]*model.Namespace{})
+
+	svcNames, err := tc.client.ListServiceNames(context.TODO(), test.HttpNsName)
+	assert.Empty(t, svcNames)
+	assert.Nil(t, err)
+}
+
 func TestServiceDiscoveryClient_ListServices_NamespaceError(t *testing.T) {
 	tc := getTestSdClient(t)
 	defer tc.close()
 
-	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(nil, false)
+	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(nil, false, false)
 
 	nsErr := errors.New("error listing namespaces")
-	tc.mockCache.EXPECT().GetNamespaceMap().Return(nil, false)
-	tc.mockApi.EXPECT().GetNamespaceMap(context.TODO()).Return(nil, nsErr)
+	tc.mockCache.EXPECT().GetNamespaceMap().Return(nil, false, false)
+	tc.mockApi.EXPECT().GetNamespaceMap(gomock.Any()).Return(nil, nsErr)
 
 	svcs, err := tc.client.ListServices(context.TODO(), test.HttpNsName)
 	assert.Equal(t, nsErr, err)
@@ -96,12 +125,12 @@ func TestServiceDiscoveryClient_ListServices_ServiceError(t *testing.T) {
 	tc := getTestSdClient(t)
 	defer tc.close()
 
-	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(nil, false)
+	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(nil, false, false)
 
-	tc.mockCache.EXPECT().GetNamespaceMap().Return(getNamespaceMapForTest(), true)
+	tc.mockCache.EXPECT().GetNamespaceMap().Return(getNamespaceMapForTest(), true, false)
 
 	svcErr := errors.New("error listing services")
-	tc.mockApi.EXPECT().GetServiceIdMap(context.TODO(), test.HttpNsId).
+	tc.mockApi.EXPECT().GetServiceIdMap(gomock.Any(), test.HttpNsId).
 		Return(nil, svcErr)
 
 	svcs, err := tc.client.ListServices(context.TODO(), test.HttpNsName)
@@ -113,11 +142,11 @@ func TestServiceDiscoveryClient_ListServices_InstanceError(t *testing.T) {
 	tc := getTestSdClient(t)
 	defer tc.close()
 
-	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(getServiceIdMapForTest(), true)
+	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(getServiceIdMapForTest(), true, false)
 
 	endptErr := errors.New("error listing endpoints")
-	tc.mockCache.EXPECT().GetEndpoints(test.HttpNsName, test.SvcName).Return(nil, false)
-	tc.mockApi.EXPECT().DiscoverInstances(context.TODO(), test.HttpNsName, test.SvcName, map[string]string{
+	tc.mockCache.EXPECT().GetEndpoints(test.HttpNsName, test.SvcName).Return(nil, false, false)
+	tc.mockApi.EXPECT().DiscoverInstances(gomock.Any(), test.HttpNsName, test.SvcName, map[string]string{
 		model.ClusterSetIdAttr: test.ClusterSet,
 	}).
 		Return([]types.HttpInstanceSummary{}, endptErr)
@@ -127,12 +156,71 @@ func TestServiceDiscoveryClient_ListServices_InstanceError(t *testing.T) {
 	assert.Empty(t, svcs)
 }
 
+func TestServiceDiscoveryClient_ListServices_LargeService(t *testing.T) {
+	tc := getTestSdClient(t)
+	defer tc.close()
+
+	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(getServiceIdMapForTest(), true, false).Times(2)
+	tc.mockCache.EXPECT().GetEndpoints(test.HttpNsName, test.SvcName).Return(nil, false, false)
+
+	// DiscoverInstances results are truncated
+	truncated := make([]types.HttpInstanceSummary, DiscoverInstancesMaxResults)
+	tc.mockApi.EXPECT().DiscoverInstances(gomock.Any(), test.HttpNsName, test.SvcName, map[string]string{
+		model.ClusterSetIdAttr: test.ClusterSet,
+	}).Return(truncated, nil)
+
+	// instances of other clustersets are filtered out
+	otherClusterSetInst := types.InstanceSummary{
+		Id:         aws.String("other-clusterset-instance"),
+		Attributes: map[string]string{model.ClusterSetIdAttr: "other-clusterset"},
+	}
+	insts := []types.InstanceSummary{otherClusterSetInst}
+	for _, inst := range getHttpInstanceSummaryForTest() {
+		insts = append(insts, types.InstanceSummary{Id: inst.InstanceId, Attributes: inst.Attributes})
+	}
+	tc.mockApi.EXPECT().ListInstances(gomock.Any(), test.SvcId).Return(insts, nil)
+
+	tc.mockCache.EXPECT().CacheEndpoints(test.HttpNsName, test.SvcName,
+		[]*model.Endpoint{test.GetTestEndpoint1(), test.GetTestEndpoint2()})
+
+	svcs, err := tc.client.ListServices(context.TODO(), test.HttpNsName)
+	assert.Nil(t, err)
+	assert.Equal(t, []*model.Service{test.GetTestService()}, svcs)
+}
+
+func TestServiceDiscoveryClient_GetService_LargeServiceListedDirectly(t *testing.T) {
+	tc := getTestSdClient(t)
+	defer tc.close()
+
+	tc.mockCache.EXPECT().GetEndpoints(test.HttpNsName, test.SvcName).Return(nil, false, false).AnyTimes()
+	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(getServiceIdMapForTest(), true, false).AnyTimes()
+
+	// only the first load discovers the truncated instances
+	tc.mockApi.EXPECT().DiscoverInstances(gomock.Any(), test.HttpNsName, test.SvcName, map[string]string{
+		model.ClusterSetIdAttr: test.ClusterSet,
+	}).Return(make([]types.HttpInstanceSummary, DiscoverInstancesMaxResults), nil)
+
+	inst := getHttpInstanceSummaryForTest()[0]
+	insts := make([]types.InstanceSummary, 0, DiscoverInstancesMaxResults)
+	for i := 0; i < DiscoverInstancesMaxResults; i++ {
+		insts = append(insts, types.InstanceSummary{Id: aws.String("instance-" + strconv.Itoa(i)), Attributes: inst.Attributes})
+	}
+	tc.mockApi.EXPECT().ListInstances(gomock.Any(), test.SvcId).Return(insts, nil).Times(2)
+	tc.mockCache.EXPECT().CacheEndpoints(test.HttpNsName, test.SvcName, gomock.Any()).Times(2)
+
+	for i := 0; i < 2; i++ {
+		svc, err := tc.client.GetService(context.TODO(), test.HttpNsName, test.SvcName)
+		assert.Nil(t, err)
+		assert.Len(t, svc.Endpoints, DiscoverInstancesMaxResults)
+	}
+}
+
 func TestServiceDiscoveryClient_ListServices_NamespaceNotFound(t *testing.T) {
 	tc := getTestSdClient(t)
 	defer tc.close()
 
-	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(nil, false)
-	tc.mockCache.EXPECT().GetNamespaceMap().Return(nil, true)
+	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(nil, false, false)
+	tc.mockCache.EXPECT().GetNamespaceMap().Return(nil, true, false)
 
 	svcs, err := tc.client.ListServices(context.TODO(), test.HttpNsName)
 	assert.Empty(t, svcs)
@@ -143,11 +231,11 @@ func TestServiceDiscoveryClient_CreateService_HappyCase(t *testing.T) {
 	tc := getTestSdClient(t)
 	defer tc.close()
 
-	tc.mockCache.EXPECT().GetNamespaceMap().Return(getNamespaceMapForTest(), true)
+	tc.mockCache.EXPECT().GetNamespaceMap().Return(getNamespaceMapForTest(), true, false)
 
 	tc.mockApi.EXPECT().CreateService(context.TODO(), *test.GetTestHttpNamespace(), test.SvcName).
 		Return(test.SvcId, nil)
-	tc.mockCache.EXPECT().EvictServiceIdMap(test.HttpNsName)
+	tc.mockCache.EXPECT().AddServiceId(test.HttpNsName, test.SvcName, test.SvcId)
 
 	err := tc.client.CreateService(context.TODO(), test.HttpNsName, test.SvcName)
 	assert.Nil(t, err, "No error for happy case")
@@ -157,11 +245,11 @@ func TestServiceDiscoveryClient_CreateService_HappyCaseForDNSNamespace(t *testin
 	tc := getTestSdClient(t)
 	defer tc.close()
 
-	tc.mockCache.EXPECT().GetNamespaceMap().Return(getNamespaceMapForTest(), true)
+	tc.mockCache.EXPECT().GetNamespaceMap().Return(getNamespaceMapForTest(), true, false)
 
 	tc.mockApi.EXPECT().CreateService(context.TODO(), *test.GetTestDnsNamespace(), test.SvcName).
 		Return(test.SvcId, nil)
-	tc.mockCache.EXPECT().EvictServiceIdMap(test.DnsNsName)
+	tc.mockCache.EXPECT().AddServiceId(test.DnsNsName, test.SvcName, test.SvcId)
 
 	err := tc.client.CreateService(context.TODO(), test.DnsNsName, test.SvcName)
 	assert.Nil(t, err, "No error for happy case")
@@ -173,8 +261,8 @@ func TestServiceDiscoveryClient_CreateService_NamespaceError(t *testing.T) {
 
 	nsErr := errors.New("error listing namespaces")
 
-	tc.mockCache.EXPECT().GetNamespaceMap().Return(nil, false)
-	tc.mockApi.EXPECT().GetNamespaceMap(context.TODO()).Return(nil, nsErr)
+	tc.mockCache.EXPECT().GetNamespaceMap().Return(nil, false, false)
+	tc.mockApi.EXPECT().GetNamespaceMap(gomock.Any()).Return(nil, nsErr)
 
 	err := tc.client.CreateService(context.TODO(), test.HttpNsName, test.SvcName)
 	assert.Equal(t, nsErr, err)
@@ -184,7 +272,7 @@ func TestServiceDiscoveryClient_CreateService_NamespaceNotFound(t *testing.T) {
 	tc := getTestSdClient(t)
 	defer tc.close()
 
-	tc.mockCache.EXPECT().GetNamespaceMap().Return(map[string]*model.Namespace{}, true)
+	tc.mockCache.EXPECT().GetNamespaceMap().Return(map[string]*model.Namespace{}, true, false)
 	tc.mockApi.EXPECT().CreateHttpNamespace(context.TODO(), test.HttpNsName).Return(test.OpId1, nil)
 	tc.mockApi.EXPECT().GetOperation(context.TODO(), test.OpId1).
 		Return(&types.Operation{Status: types.OperationStatusSuccess,
@@ -193,7 +281,7 @@ func TestServiceDiscoveryClient_CreateService_NamespaceNotFound(t *testing.T) {
 
 	tc.mockApi.EXPECT().CreateService(context.TODO(), *test.GetTestHttpNamespace(), test.SvcName).
 		Return(test.SvcId, nil)
-	tc.mockCache.EXPECT().EvictServiceIdMap(test.HttpNsName)
+	tc.mockCache.EXPECT().AddServiceId(test.HttpNsName, test.SvcName, test.SvcId)
 
 	err := tc.client.CreateService(context.TODO(), test.HttpNsName, test.SvcName)
 	assert.Nil(t, err)
@@ -203,7 +291,7 @@ func TestServiceDiscoveryClient_CreateService_CreateServiceError(t *testing.T) {
 	tc := getTestSdClient(t)
 	defer tc.close()
 
-	tc.mockCache.EXPECT().GetNamespaceMap().Return(getNamespaceMapForTest(), true)
+	tc.mockCache.EXPECT().GetNamespaceMap().Return(getNamespaceMapForTest(), true, false)
 
 	svcErr := errors.New("error creating service")
 	tc.mockApi.EXPECT().CreateService(context.TODO(), *test.GetTestDnsNamespace(), test.SvcName).
@@ -219,7 +307,7 @@ func TestServiceDiscoveryClient_CreateService_CreatesNamespace_HappyCase(t *test
 
 	tc.mockCache.EXPECT().GetNamespaceMap().Return(map[string]*model.Namespace{
 		test.DnsNsName: test.GetTestDnsNamespace(),
-	}, true)
+	}, true, false)
 
 	tc.mockApi.EXPECT().CreateHttpNamespace(context.TODO(), test.HttpNsName).
 		Return(test.OpId1, nil)
@@ -230,7 +318,7 @@ func TestServiceDiscoveryClient_CreateService_CreatesNamespace_HappyCase(t *test
 
 	tc.mockApi.EXPECT().CreateService(context.TODO(), *test.GetTestHttpNamespace(), test.SvcName).
 		Return(test.SvcId, nil)
-	tc.mockCache.EXPECT().EvictServiceIdMap(test.HttpNsName)
+	tc.mockCache.EXPECT().AddServiceId(test.HttpNsName, test.SvcName, test.SvcId)
 
 	err := tc.client.CreateService(context.TODO(), test.HttpNsName, test.SvcName)
 	assert.Nil(t, err, "No error for happy case")
@@ -240,7 +328,7 @@ func TestServiceDiscoveryClient_CreateService_CreatesNamespace_PollError(t *test
 	tc := getTestSdClient(t)
 	defer tc.close()
 
-	tc.mockCache.EXPECT().GetNamespaceMap().Return(nil, true)
+	tc.mockCache.EXPECT().GetNamespaceMap().Return(nil, true, false)
 
 	pollErr := errors.New("polling error")
 	tc.mockApi.EXPECT().CreateHttpNamespace(context.TODO(), test.HttpNsName).
@@ -256,7 +344,7 @@ func TestServiceDiscoveryClient_CreateService_CreatesNamespace_CreateNsError(t *
 	tc := getTestSdClient(t)
 	defer tc.close()
 
-	tc.mockCache.EXPECT().GetNamespaceMap().Return(nil, true)
+	tc.mockCache.EXPECT().GetNamespaceMap().Return(nil, true, false)
 
 	nsErr := errors.New("create namespace error")
 	tc.mockApi.EXPECT().CreateHttpNamespace(context.TODO(), test.HttpNsName).
@@ -270,21 +358,21 @@ func TestServiceDiscoveryClient_GetService_HappyCase(t *testing.T) {
 	tc := getTestSdClient(t)
 	defer tc.close()
 
-	tc.mockCache.EXPECT().GetEndpoints(test.HttpNsName, test.SvcName).Return(nil, false)
+	tc.mockCache.EXPECT().GetEndpoints(test.HttpNsName, test.SvcName).Return(nil, false, false)
 
-	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(nil, false)
+	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(nil, false, false)
 
-	tc.mockCache.EXPECT().GetNamespaceMap().Return(nil, false)
-	tc.mockApi.EXPECT().GetNamespaceMap(context.TODO()).
+	tc.mockCache.EXPECT().GetNamespaceMap().Return(nil, false, false)
+	tc.mockApi.EXPECT().GetNamespaceMap(gomock.Any()).
 		Return(getNamespaceMapForTest(), nil)
 	tc.mockCache.EXPECT().CacheNamespaceMap(getNamespaceMapForTest())
 
-	tc.mockApi.EXPECT().GetServiceIdMap(context.TODO(), test.HttpNsId).
+	tc.mockApi.EXPECT().GetServiceIdMap(gomock.Any(), test.HttpNsId).
 		Return(map[string]string{test.SvcName: test.SvcId}, nil)
 	tc.mockCache.EXPECT().CacheServiceIdMap(test.HttpNsName, getServiceIdMapForTest())
 
-	tc.mockCache.EXPECT().GetEndpoints(test.HttpNsName, test.SvcName).Return([]*model.Endpoint{}, false)
-	tc.mockApi.EXPECT().DiscoverInstances(context.TODO(), test.HttpNsName, test.SvcName, map[string]string{
+	tc.mockCache.EXPECT().GetEndpoints(test.HttpNsName, test.SvcName).Return([]*model.Endpoint{}, false, false)
+	tc.mockApi.EXPECT().DiscoverInstances(gomock.Any(), test.HttpNsName, test.SvcName, map[string]string{
 		model.ClusterSetIdAttr: test.ClusterSet,
 	}).Return(getHttpInstanceSummaryForTest(), nil)
 	tc.mockCache.EXPECT().CacheEndpoints(test.HttpNsName, test.SvcName,
@@ -300,7 +388,43 @@ func TestServiceDiscoveryClient_GetService_CachedValues(t *testing.T) {
 	defer tc.close()
 
 	tc.mockCache.EXPECT().GetEndpoints(test.HttpNsName, test.SvcName).
-		Return([]*model.Endpoint{test.GetTestEndpoint1(), test.GetTestEndpoint2()}, true)
+		Return([]*model.Endpoint{test.GetTestEndpoint1(), test.GetTestEndpoint2()}, true, false)
+
+	svc, err := tc.client.GetService(context.TODO(), test.HttpNsName, test.SvcName)
+	assert.Nil(t, err)
+	assert.Equal(t, test.GetTestService(), svc)
+}
+
+func TestServiceDiscoveryClient_GetFreshService_StaleCachedValues(t *testing.T) {
+	tc := getTestSdClient(t)
+	defer tc.close()
+
+	// stale endpoints are reloaded rather than served
+	tc.mockCache.EXPECT().GetEndpoints(test.HttpNsName, test.SvcName).
+		Return([]*model.Endpoint{test.GetTestEndpoint1()}, true, true).Times(2)
+	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(getServiceIdMapForTest(), true, false)
+	tc.mockApi.EXPECT().DiscoverInstances(gomock.Any(), test.HttpNsName, test.SvcName, map[string]string{
+		model.ClusterSetIdAttr: test.ClusterSet,
+	}).Return(getHttpInstanceSummaryForTest(), nil)
+	tc.mockCache.EXPECT().CacheEndpoints(test.HttpNsName, test.SvcName,
+		[]*model.Endpoint{test.GetTestEndpoint1(), test.GetTestEndpoint2()})
+
+	svc, err := tc.client.GetFreshService(context.TODO(), test.HttpNsName, test.SvcName)
+	assert.Nil(t, err)
+	assert.Equal(t, test.GetTestService(), svc)
+}
+
+func TestServiceDiscoveryClient_GetService_MappedNamespace(t *testing.T) {
+	tc := getTestSdClient(t)
+	defer tc.close()
+
+	nsMapper, err := NewNamespaceMapper(&NamespaceMapperConfig{Prefix: "prefix-"}, nil, tc.client.clusterUtils)
+	assert.NoError(t, err)
+	tc.client.nsMapper = nsMapper
+
+	// resources are looked up by the Cloud Map namespace name, and returned with the Kubernetes namespace name
+	tc.mockCache.EXPECT().GetEndpoints("prefix-"+test.HttpNsName, test.SvcName).
+		Return([]*model.Endpoint{test.GetTestEndpoint1(), test.GetTestEndpoint2()}, true, false)
 
 	svc, err := tc.client.GetService(context.TODO(), test.HttpNsName, test.SvcName)
 	assert.Nil(t, err)
@@ -311,17 +435,17 @@ func TestServiceDiscoveryClient_GetService_ServiceNotFound(t *testing.T) {
 	tc := getTestSdClient(t)
 	defer tc.close()
 
-	tc.mockCache.EXPECT().GetEndpoints(test.HttpNsName, test.SvcName).Return(nil, false)
+	tc.mockCache.EXPECT().GetEndpoints(test.HttpNsName, test.SvcName).Return(nil, false, false)
 
-	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(nil, false)
+	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(nil, false, false)
 
-	tc.mockCache.EXPECT().GetNamespaceMap().Return(nil, false)
-	tc.mockApi.EXPECT().GetNamespaceMap(context.TODO()).
+	tc.mockCache.EXPECT().GetNamespaceMap().Return(nil, false, false)
+	tc.mockApi.EXPECT().GetNamespaceMap(gomock.Any()).
 		Return(getNamespaceMapForTest(), nil)
 	tc.mockCache.EXPECT().CacheNamespaceMap(getNamespaceMapForTest())
 
 	// return empty list from CloudMap's api
-	tc.mockApi.EXPECT().GetServiceIdMap(context.TODO(), test.HttpNsId).
+	tc.mockApi.EXPECT().GetServiceIdMap(gomock.Any(), test.HttpNsId).
 		Return(map[string]string{}, nil)
 	tc.mockCache.EXPECT().CacheServiceIdMap(test.HttpNsName, map[string]string{})
 
@@ -335,18 +459,20 @@ func TestServiceDiscoveryClient_RegisterEndpoints(t *testing.T) {
 	tc := getTestSdClient(t)
 	defer tc.close()
 
-	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(getServiceIdMapForTest(), true)
+	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(getServiceIdMapForTest(), true, false)
 
 	tc.mockApi.EXPECT().RegisterInstance(context.TODO(), test.SvcId, test.EndptId1, getAttrs1()).
 		Return(test.OpId1, nil)
 	tc.mockApi.EXPECT().RegisterInstance(context.TODO(), test.SvcId, test.EndptId2, getAttrs2()).
 		Return(test.OpId2, nil)
-	tc.mockApi.EXPECT().GetOperation(context.TODO(), test.OpId1).
-		Return(&types.Operation{Status: types.OperationStatusSuccess}, nil)
-	tc.mockApi.EXPECT().GetOperation(context.TODO(), test.OpId2).
-		Return(&types.Operation{Status: types.OperationStatusSuccess}, nil)
+	tc.mockApi.EXPECT().ListOperations(context.TODO(), gomock.Any()).
+		Return(map[string]types.OperationStatus{
+			test.OpId1: types.OperationStatusSuccess,
+			test.OpId2: types.OperationStatusSuccess,
+		}, nil).AnyTimes()
 
-	tc.mockCache.EXPECT().EvictEndpoints(test.HttpNsName, test.SvcName)
+	tc.mockCache.EXPECT().UpsertEndpoints(test.HttpNsName, test.SvcName,
+		[]*model.Endpoint{test.GetTestEndpoint1(), test.GetTestEndpoint2()})
 
 	err := tc.client.RegisterEndpoints(context.TODO(), test.HttpNsName, test.SvcName,
 		[]*model.Endpoint{test.GetTestEndpoint1(), test.GetTestEndpoint2()})
@@ -358,16 +484,19 @@ func TestServiceDiscoveryClient_RegisterEndpoints_PollFailure(t *testing.T) {
 	tc := getTestSdClient(t)
 	defer tc.close()
 
-	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(getServiceIdMapForTest(), true)
+	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(getServiceIdMapForTest(), true, false)
 
 	tc.mockApi.EXPECT().RegisterInstance(context.TODO(), test.SvcId, test.EndptId1, getAttrs1()).
 		Return(test.OpId1, nil)
 	tc.mockApi.EXPECT().RegisterInstance(context.TODO(), test.SvcId, test.EndptId2, getAttrs2()).
 		Return(test.OpId2, nil)
+	tc.mockApi.EXPECT().ListOperations(context.TODO(), gomock.Any()).
+		Return(map[string]types.OperationStatus{
+			test.OpId1: types.OperationStatusFail,
+			test.OpId2: types.OperationStatusSuccess,
+		}, nil).AnyTimes()
 	tc.mockApi.EXPECT().GetOperation(context.TODO(), test.OpId1).
 		Return(&types.Operation{Status: types.OperationStatusFail}, nil)
-	tc.mockApi.EXPECT().GetOperation(context.TODO(), test.OpId2).
-		Return(&types.Operation{Status: types.OperationStatusSuccess}, nil)
 
 	tc.mockCache.EXPECT().EvictEndpoints(test.HttpNsName, test.SvcName)
 
@@ -382,18 +511,19 @@ func TestServiceDiscoveryClient_DeleteEndpoints(t *testing.T) {
 	tc := getTestSdClient(t)
 	defer tc.close()
 
-	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(getServiceIdMapForTest(), true)
+	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(getServiceIdMapForTest(), true, false)
 
 	tc.mockApi.EXPECT().DeregisterInstance(context.TODO(), test.SvcId, test.EndptId1).
 		Return(test.OpId1, nil)
 	tc.mockApi.EXPECT().DeregisterInstance(context.TODO(), test.SvcId, test.EndptId2).
 		Return(test.OpId2, nil)
-	tc.mockApi.EXPECT().GetOperation(context.TODO(), test.OpId1).
-		Return(&types.Operation{Status: types.OperationStatusSuccess}, nil)
-	tc.mockApi.EXPECT().GetOperation(context.TODO(), test.OpId2).
-		Return(&types.Operation{Status: types.OperationStatusSuccess}, nil)
+	tc.mockApi.EXPECT().ListOperations(context.TODO(), gomock.Any()).
+		Return(map[string]types.OperationStatus{
+			test.OpId1: types.OperationStatusSuccess,
+			test.OpId2: types.OperationStatusSuccess,
+		}, nil).AnyTimes()
 
-	tc.mockCache.EXPECT().EvictEndpoints(test.HttpNsName, test.SvcName)
+	tc.mockCache.EXPECT().RemoveEndpoints(test.HttpNsName, test.SvcName, gomock.Len(2))
 
 	err := tc.client.DeleteEndpoints(context.TODO(), test.HttpNsName, test.SvcName,
 		[]*model.Endpoint{
@@ -407,16 +537,19 @@ func TestServiceDiscoveryClient_DeleteEndpoints_PollFailure(t *testing.T) {
 	tc := getTestSdClient(t)
 	defer tc.close()
 
-	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(getServiceIdMapForTest(), true)
+	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(getServiceIdMapForTest(), true, false)
 
 	tc.mockApi.EXPECT().DeregisterInstance(context.TODO(), test.SvcId, test.EndptId1).
 		Return(test.OpId1, nil)
 	tc.mockApi.EXPECT().DeregisterInstance(context.TODO(), test.SvcId, test.EndptId2).
 		Return(test.OpId2, nil)
+	tc.mockApi.EXPECT().ListOperations(context.TODO(), gomock.Any()).
+		Return(map[string]types.OperationStatus{
+			test.OpId1: types.OperationStatusFail,
+			test.OpId2: types.OperationStatusSuccess,
+		}, nil).AnyTimes()
 	tc.mockApi.EXPECT().GetOperation(context.TODO(), test.OpId1).
 		Return(&types.Operation{Status: types.OperationStatusFail}, nil)
-	tc.mockApi.EXPECT().GetOperation(context.TODO(), test.OpId2).
-		Return(&types.Operation{Status: types.OperationStatusSuccess}, nil)
 
 	tc.mockCache.EXPECT().EvictEndpoints(test.HttpNsName, test.SvcName)
 
@@ -430,6 +563,139 @@ func TestServiceDiscoveryClient_DeleteEndpoints_PollFailure(t *testing.T) {
 	assert.Contains(t, err.Error(), test.OpId1)
 }
 
+func TestServiceDiscoveryClient_ListServices_StaleCachedResults(t *testing.T) {
+	tc := getTestSdClient(t)
+	defer tc.close()
+
+	refreshed := make(chan struct{})
+	tc.mockCache.EXPECT().GetServiceIdMap(test.HttpNsName).Return(getServiceIdMapForTest(), true, true)
+	tc.mockCache.EXPECT().GetNamespaceMap().Return(getNamespaceMapForTest(), true, false)
+	tc.mockApi.EXPECT().GetServiceIdMap(gomock.Any(), test.HttpNsId).Return(getServiceIdMapForTest(), nil)
+	tc.mockCache.EXPECT().CacheServiceIdMap(test.HttpNsName, getServiceIdMapForTest()).
+		Do(func(string, map[string]string) { close(refreshed) })
+
+	tc.mockCache.EXPECT().GetEndpoints(test.HttpNsName, test.SvcName).
+		Return([]*model.Endpoint{test.GetTestEndpoint1(), test.GetTestEndpoint2()}, true, false)
+
+	// stale entries are served while being refreshed in the background
+	svcs, err := tc.client.ListServices(context.TODO(), test.HttpNsName)
+	assert.Nil(t, err)
+	assert.Equal(t, []*model.Service{test.GetTestService()}, svcs)
+
+	select {
+	case <-refreshed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stale service IDs were not refreshed")
+	}
+}
+
+func TestServiceDiscoveryClient_ListServices_CoalescesLoads(t *testing.T) {
+	tc := getTestSdClient(t)
+	defer tc.close()
+	tc.client.cache = NewDefaultServiceDiscoveryClientCache()
+
+	release := make(chan struct{})
+	tc.mockApi.EXPECT().GetNamespaceMap(gomock.Any()).Return(getNamespaceMapForTest(), nil)
+	tc.mockApi.EXPECT().GetServiceIdMap(gomock.Any(), test.HttpNsId).Return(getServiceIdMapForTest(), nil)
+	tc.mockApi.EXPECT().DiscoverInstances(gomock.Any(), test.HttpNsName, test.SvcName, gomock.Any()).
+		DoAndReturn(func(context.Context, string, string, map[string]string) ([]types.HttpInstanceSummary, error) {
+			<-release
+			return getHttpInstanceSummaryForTest(), nil
+		})
+
+	// concurrent callers share a single load of each resource
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make([][]*model.Service, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = tc.client.ListServices(context.TODO(), test.HttpNsName)
+		}(i)
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for _, svcs := range results {
+		assert.Equal(t, []*model.Service{test.GetTestService()}, svcs)
+	}
+}
+
+func TestServiceDiscoveryClient_RegisterEndpoints_DuringLoad(t *testing.T) {
+	tc := getTestSdClient(t)
+	defer tc.close()
+	tc.client.cache = NewDefaultServiceDiscoveryClientCache()
+	tc.client.cache.CacheServiceIdMap(test.HttpNsName, getServiceIdMapForTest())
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	// the load reads the instances before the second endpoint is registered
+	tc.mockApi.EXPECT().DiscoverInstances(gomock.Any(), test.HttpNsName, test.SvcName, gomock.Any()).
+		DoAndReturn(func(context.Context, string, string, map[string]string) ([]types.HttpInstanceSummary, error) {
+			close(started)
+			<-release
+			return getHttpInstanceSummaryForTest()[:1], nil
+		})
+	tc.mockApi.EXPECT().RegisterInstance(context.TODO(), test.SvcId, test.EndptId2, getAttrs2()).Return(test.OpId2, nil)
+	tc.mockApi.EXPECT().ListOperations(context.TODO(), gomock.Any()).
+		Return(map[string]types.OperationStatus{test.OpId2: types.OperationStatusSuccess}, nil).AnyTimes()
+
+	loaded := make(chan *model.Service)
+	go func() {
+		svc, _ := tc.client.GetService(context.TODO(), test.HttpNsName, test.SvcName)
+		loaded <- svc
+	}()
+	<-started
+
+	err := tc.client.RegisterEndpoints(context.TODO(), test.HttpNsName, test.SvcName, []*model.Endpoint{test.GetTestEndpoint2()})
+	assert.Nil(t, err)
+	close(release)
+	assert.Equal(t, []*model.Endpoint{test.GetTestEndpoint1()}, (<-loaded).Endpoints)
+
+	// the outdated result of the load is not cached over the registration
+	_, found, _ := tc.client.cache.GetEndpoints(test.HttpNsName, test.SvcName)
+	assert.False(t, found)
+}
+
+func TestServiceDiscoveryClient_ListServices_CancelledCaller(t *testing.T) {
+	tc := getTestSdClient(t)
+	defer tc.close()
+	tc.client.cache = NewDefaultServiceDiscoveryClientCache()
+	tc.client.cache.CacheServiceIdMap(test.HttpNsName, getServiceIdMapForTest())
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	tc.mockApi.EXPECT().DiscoverInstances(gomock.Any(), test.HttpNsName, test.SvcName, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, _ string, _ string, _ map[string]string) ([]types.HttpInstanceSummary, error) {
+			close(started)
+			<-release
+			return getHttpInstanceSummaryForTest(), ctx.Err()
+		})
+
+	// the load started by the first caller outlives its cancelled context
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancelled := make(chan error)
+	go func() {
+		_, err := tc.client.ListServices(ctx, test.HttpNsName)
+		cancelled <- err
+	}()
+	<-started
+
+	waiting := make(chan []*model.Service)
+	go func() {
+		svcs, _ := tc.client.ListServices(context.TODO(), test.HttpNsName)
+		waiting <- svcs
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-cancelled, context.Canceled)
+	close(release)
+	assert.Equal(t, []*model.Service{test.GetTestService()}, <-waiting)
+}
+
 func getTestSdClient(t *testing.T) *testSdClient {
 	test.SetTestVersion()
 	mockController := gomock.NewController(t)
@@ -443,7 +709,9 @@ func getTestSdClient(t *testing.T) *testSdClient {
 			log:          common.NewLoggerWithLogr(testr.New(t)),
 			sdApi:        mockApi,
 			cache:        mockCache,
+			pollerConfig: &OperationPollerConfig{PollInterval: interval, PollTimeout: timeout, MaxInFlight: 1},
 			clusterUtils: model.NewClusterUtils(fakeClient),
+			nsMapper:     NewDefaultNamespaceMapper(),
 		},
 		mockApi:   *mockApi,
 		mockCache: *mockCache,
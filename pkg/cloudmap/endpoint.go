@@ -0,0 +1,28 @@
+package cloudmap
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	sd "github.com/aws/aws-sdk-go-v2/service/servicediscovery"
+)
+
+// WithEndpoint returns an AWS config load option sending the Cloud Map API calls to the given URL instead of the
+// regional endpoint, e.g. to a local Cloud Map stand-in. The calls of other services keep their regional endpoints.
+// An empty URL keeps the regional endpoint of Cloud Map too.
+func WithEndpoint(url string) config.LoadOptionsFunc {
+	return func(opts *config.LoadOptions) error {
+		if url == "" {
+			return nil
+		}
+		opts.EndpointResolverWithOptions = aws.EndpointResolverWithOptionsFunc(
+			func(service, region string, _ ...interface{}) (aws.Endpoint, error) {
+				if service != sd.ServiceID {
+					// fall back to the default endpoint resolution
+					return aws.Endpoint{}, &aws.EndpointNotFoundError{}
+				}
+				// the hostname is immutable so that DiscoverInstances does not prefix it with "data-"
+				return aws.Endpoint{URL: url, SigningRegion: region, HostnameImmutable: true}, nil
+			})
+		return nil
+	}
+}
@@ -0,0 +1,28 @@
+package cloudmap
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	sd "github.com/aws/aws-sdk-go-v2/service/servicediscovery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithEndpoint(t *testing.T) {
+	opts := config.LoadOptions{}
+	assert.NoError(t, WithEndpoint("http://localhost:4566")(&opts))
+
+	endpoint, err := opts.EndpointResolverWithOptions.ResolveEndpoint(sd.ServiceID, "us-west-2")
+	assert.NoError(t, err)
+	assert.Equal(t, aws.Endpoint{URL: "http://localhost:4566", SigningRegion: "us-west-2", HostnameImmutable: true}, endpoint)
+
+	_, err = opts.EndpointResolverWithOptions.ResolveEndpoint("STS", "us-west-2")
+	assert.ErrorAs(t, err, new(*aws.EndpointNotFoundError))
+}
+
+func TestWithEndpoint_Empty(t *testing.T) {
+	opts := config.LoadOptions{}
+	assert.NoError(t, WithEndpoint("")(&opts))
+	assert.Nil(t, opts.EndpointResolverWithOptions)
+}
@@ -0,0 +1,107 @@
+package cloudmap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/template"
+
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NamespaceNameAnnotation annotates a Kubernetes namespace with the name of its AWS Cloud Map namespace, overriding
+// the configured mapping.
+const NamespaceNameAnnotation = "multicluster.k8s.aws/cloudmap-namespace"
+
+// NamespaceMapper maps Kubernetes namespaces to AWS Cloud Map namespaces. Cloud Map namespace names are unique per
+// account, so clustersets sharing an account must map their namespaces to distinct names.
+type NamespaceMapper interface {
+	// CloudMapNamespaceName returns the name of the AWS Cloud Map namespace of a Kubernetes namespace.
+	CloudMapNamespaceName(ctx context.Context, namespaceName string) (string, error)
+}
+
+// NamespaceMapperConfig holds the mapping of Kubernetes namespace names to AWS Cloud Map namespace names.
+type NamespaceMapperConfig struct {
+	// Template of the Cloud Map namespace names, with the .Namespace and .ClusterSetId fields, e.g.
+	// "{{.ClusterSetId}}-{{.Namespace}}". Defaults to the Kubernetes namespace name.
+	Template string
+	// Prefix prepended to the Cloud Map namespace names
+	Prefix string
+	// Suffix appended to the Cloud Map namespace names
+	Suffix string
+}
+
+type namespaceMapper struct {
+	prefix       string
+	suffix       string
+	template     *template.Template
+	client       client.Reader
+	clusterUtils model.ClusterUtils
+}
+
+type namespaceTemplateData struct {
+	Namespace    string
+	ClusterSetId string
+}
+
+// DefaultNamespaceMapperConfig returns the default mapping, where Cloud Map namespaces are named after Kubernetes
+// namespaces.
+func DefaultNamespaceMapperConfig() *NamespaceMapperConfig {
+	return &NamespaceMapperConfig{}
+}
+
+// NewDefaultNamespaceMapper returns a mapper naming Cloud Map namespaces after Kubernetes namespaces.
+func NewDefaultNamespaceMapper() NamespaceMapper {
+	return &namespaceMapper{}
+}
+
+// NewNamespaceMapper returns a mapper with the given configuration. Kubernetes namespaces annotated with
+// NamespaceNameAnnotation are mapped to the annotation value instead, when a Kubernetes client is given. The
+// clusterset ID of the template is read from the cluster properties.
+func NewNamespaceMapper(cfg *NamespaceMapperConfig, k8sClient client.Reader, clusterUtils model.ClusterUtils) (NamespaceMapper, error) {
+	mapper := &namespaceMapper{
+		prefix:       cfg.Prefix,
+		suffix:       cfg.Suffix,
+		client:       k8sClient,
+		clusterUtils: clusterUtils,
+	}
+	if cfg.Template != "" {
+		tmpl, err := template.New("namespace").Parse(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Cloud Map namespace name template %q: %w", cfg.Template, err)
+		}
+		mapper.template = tmpl
+	}
+	return mapper, nil
+}
+
+func (m *namespaceMapper) CloudMapNamespaceName(ctx context.Context, namespaceName string) (string, error) {
+	if m.client != nil {
+		namespace := &v1.Namespace{}
+		err := m.client.Get(ctx, client.ObjectKey{Name: namespaceName}, namespace)
+		if client.IgnoreNotFound(err) != nil {
+			return "", err
+		}
+		if name := namespace.Annotations[NamespaceNameAnnotation]; name != "" {
+			return name, nil
+		}
+	}
+
+	name := namespaceName
+	if m.template != nil {
+		clusterProperties, err := m.clusterUtils.GetClusterProperties(ctx)
+		if err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		data := namespaceTemplateData{Namespace: namespaceName, ClusterSetId: clusterProperties.ClusterSetId()}
+		if err = m.template.Execute(&buf, data); err != nil {
+			return "", fmt.Errorf("failed to map namespace %s: %w", namespaceName, err)
+		}
+		name = buf.String()
+	}
+
+	return m.prefix + name + m.suffix, nil
+}
@@ -0,0 +1,64 @@
+package cloudmap
+
+import (
+	"context"
+	"testing"
+
+	aboutv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/about/v1alpha1"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/test"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNewDefaultNamespaceMapper(t *testing.T) {
+	name, err := NewDefaultNamespaceMapper().CloudMapNamespaceName(context.TODO(), test.HttpNsName)
+	assert.NoError(t, err)
+	assert.Equal(t, test.HttpNsName, name)
+}
+
+func TestNamespaceMapper_CloudMapNamespaceName(t *testing.T) {
+	annotated := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "annotated",
+		Annotations: map[string]string{NamespaceNameAnnotation: "explicit-name"},
+	}}
+	scheme := runtime.NewScheme()
+	_ = v1.AddToScheme(scheme)
+	scheme.AddKnownTypes(aboutv1alpha1.GroupVersion, &aboutv1alpha1.ClusterProperty{}, &aboutv1alpha1.ClusterPropertyList{})
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(annotated, test.ClusterIdForTest(), test.ClusterSetIdForTest()).Build()
+
+	tests := []struct {
+		name      string
+		cfg       *NamespaceMapperConfig
+		namespace string
+		want      string
+	}{
+		{name: "default", cfg: DefaultNamespaceMapperConfig(), namespace: test.HttpNsName, want: test.HttpNsName},
+		{name: "prefix_suffix", cfg: &NamespaceMapperConfig{Prefix: "pre-", Suffix: "-post"}, namespace: test.HttpNsName, want: "pre-" + test.HttpNsName + "-post"},
+		{name: "template", cfg: &NamespaceMapperConfig{Template: "{{.ClusterSetId}}-{{.Namespace}}"}, namespace: test.HttpNsName, want: test.ClusterSet + "-" + test.HttpNsName},
+		{name: "annotation", cfg: &NamespaceMapperConfig{Prefix: "pre-"}, namespace: annotated.Name, want: "explicit-name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapper, err := NewNamespaceMapper(tt.cfg, fakeClient, model.NewClusterUtils(fakeClient))
+			assert.NoError(t, err)
+			name, err := mapper.CloudMapNamespaceName(context.TODO(), tt.namespace)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, name)
+		})
+	}
+}
+
+func TestNamespaceMapper_InvalidTemplate(t *testing.T) {
+	_, err := NewNamespaceMapper(&NamespaceMapperConfig{Template: "{{.Namespace"}, nil, model.NewClusterUtilsWithValues(test.ClusterId1, test.ClusterSet))
+	assert.Error(t, err)
+
+	mapper, err := NewNamespaceMapper(&NamespaceMapperConfig{Template: "{{.Unknown}}"}, nil, model.NewClusterUtilsWithValues(test.ClusterId1, test.ClusterSet))
+	assert.NoError(t, err)
+	_, err = mapper.CloudMapNamespaceName(context.TODO(), test.HttpNsName)
+	assert.Error(t, err)
+}
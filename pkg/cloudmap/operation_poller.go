@@ -3,6 +3,8 @@ package cloudmap
 import (
 	"context"
 	"fmt"
+	"math"
+	"strconv"
 	"sync"
 	"time"
 
@@ -13,34 +15,109 @@ import (
 )
 
 const (
-	// Interval between each getOperation call.
-	defaultOperationPollInterval = 2 * time.Second
+	// Initial interval between each operation status check, grows exponentially until the maximum interval.
+	defaultOperationPollInterval = 1 * time.Second
+
+	// Maximum interval between each operation status check.
+	defaultOperationMaxPollInterval = 10 * time.Second
+
+	// Growth factor and jitter of the interval between each operation status check.
+	operationPollBackoffFactor = 1.5
+	operationPollBackoffJitter = 0.2
 
 	// Time until we stop polling the operation
 	defaultOperationPollTimeout = 1 * time.Minute
 
+	// Time until we stop polling namespace operations, which take longer than service instance operations.
+	defaultNamespaceOperationPollTimeout = 5 * time.Minute
+
+	// Margin added to both ends of the window of update dates of the listed operations, so that a clock skew between
+	// the controller and Cloud Map does not leave completed operations out of the list until they time out.
+	operationClockSkewMargin = 5 * time.Minute
+
+	// Maximum number of submitted operations in progress at any time
+	defaultMaxInFlightOperations = 100
+
 	operationPollTimoutErrorMessage = "timed out while polling operations"
 )
 
 // OperationPoller polls a list operations for a terminal status
 type OperationPoller interface {
-	// Submit operations to async poll
-	Submit(ctx context.Context, opProvider func() (opId string, err error))
+	// Submit operations of a given type to async poll
+	Submit(ctx context.Context, opType types.OperationType, opProvider func() (opId string, err error))
 
-	// Poll operations for a terminal state
-	Poll(ctx context.Context, opId string) (*types.Operation, error)
+	// Poll an operation of a given type for a terminal state
+	Poll(ctx context.Context, opType types.OperationType, opId string) (*types.Operation, error)
 
 	// Await waits for all operation results from async poll
 	Await() (err error)
 }
 
+// OperationPollerConfig holds the settings of an operation poller.
+type OperationPollerConfig struct {
+	// PollInterval is the initial interval between each check of the pending operations.
+	PollInterval time.Duration
+
+	// MaxPollInterval caps the exponentially growing interval between each check of the pending operations.
+	MaxPollInterval time.Duration
+
+	// PollTimeout is the time after which an operation which has not reached a terminal state is failed.
+	PollTimeout time.Duration
+
+	// OperationTimeouts overrides PollTimeout for the given operation types.
+	OperationTimeouts map[types.OperationType]time.Duration
+
+	// MaxInFlight is the maximum number of submitted operations which are started, but not completed at any time.
+	MaxInFlight int
+
+	// ServiceId optionally restricts the lookup of pending operations to the operations of a single service.
+	ServiceId string
+}
+
+// DefaultOperationPollerConfig returns the default operation poller settings.
+func DefaultOperationPollerConfig() *OperationPollerConfig {
+	return &OperationPollerConfig{
+		PollInterval:    defaultOperationPollInterval,
+		MaxPollInterval: defaultOperationMaxPollInterval,
+		PollTimeout:     defaultOperationPollTimeout,
+		OperationTimeouts: map[types.OperationType]time.Duration{
+			types.OperationTypeCreateNamespace: defaultNamespaceOperationPollTimeout,
+			types.OperationTypeDeleteNamespace: defaultNamespaceOperationPollTimeout,
+		},
+		MaxInFlight: defaultMaxInFlightOperations,
+	}
+}
+
+// OperationTimeoutError indicates an operation did not reach a terminal state before the poll timeout. The operation
+// may still complete, so callers should retry later rather than fail.
+type OperationTimeoutError struct {
+	OperationId   string
+	OperationType types.OperationType
+	Timeout       time.Duration
+}
+
+func (e *OperationTimeoutError) Error() string {
+	return fmt.Sprintf("%s, opId: %s, type: %s, timeout: %s", operationPollTimoutErrorMessage, e.OperationId, e.OperationType, e.Timeout)
+}
+
+// Transient indicates the operation may still complete, see common.ErrorClassTransient.
+func (e *OperationTimeoutError) Transient() bool {
+	return true
+}
+
 type operationPoller struct {
-	log          common.Logger
-	sdApi        ServiceDiscoveryApi
-	opChan       chan opResult
-	waitGroup    sync.WaitGroup
-	pollInterval time.Duration
-	pollTimeout  time.Duration
+	log       common.Logger
+	sdApi     ServiceDiscoveryApi
+	config    OperationPollerConfig
+	startTime time.Time
+	ctx       context.Context
+	tasks     []operationTask
+	mutex     sync.Mutex
+}
+
+type operationTask struct {
+	opType     types.OperationType
+	opProvider func() (opId string, err error)
 }
 
 type opResult struct {
@@ -48,75 +125,135 @@ type opResult struct {
 	err  error
 }
 
+// pendingOperation is an operation started by a worker which waits for the monitor to report its terminal state.
+type pendingOperation struct {
+	opId     string
+	opType   types.OperationType
+	deadline time.Time
+	done     chan error
+}
+
 // NewOperationPoller creates a new operation poller
 func NewOperationPoller(sdApi ServiceDiscoveryApi) OperationPoller {
-	return NewOperationPollerWithConfig(defaultOperationPollInterval, defaultOperationPollTimeout, sdApi)
+	return NewOperationPollerWithConfig(DefaultOperationPollerConfig(), sdApi)
 }
 
 // NewOperationPollerWithConfig creates a new operation poller
-func NewOperationPollerWithConfig(pollInterval, pollTimeout time.Duration, sdApi ServiceDiscoveryApi) OperationPoller {
+func NewOperationPollerWithConfig(config *OperationPollerConfig, sdApi ServiceDiscoveryApi) OperationPoller {
+	pollerConfig := *config
+	if pollerConfig.MaxInFlight <= 0 {
+		pollerConfig.MaxInFlight = defaultMaxInFlightOperations
+	}
+	if pollerConfig.MaxPollInterval < pollerConfig.PollInterval {
+		pollerConfig.MaxPollInterval = pollerConfig.PollInterval
+	}
+
 	return &operationPoller{
-		log:          common.NewLogger("cloudmap", "OperationPoller"),
-		sdApi:        sdApi,
-		opChan:       make(chan opResult),
-		pollInterval: pollInterval,
-		pollTimeout:  pollTimeout,
+		log:       common.NewLogger("cloudmap", "OperationPoller"),
+		sdApi:     sdApi,
+		config:    pollerConfig,
+		startTime: time.Now(),
 	}
 }
 
-func (p *operationPoller) Submit(ctx context.Context, opProvider func() (opId string, err error)) {
-	p.waitGroup.Add(1)
-
-	// Poll for the operation in a separate go routine
-	go func() {
-		// Indicate the polling done i.e. decrement the WaitGroup counter when the goroutine returns
-		defer p.waitGroup.Done()
-
-		opId, err := opProvider()
-		// Poll for the operationId if the provider doesn't throw error
-		if err == nil {
-			_, err = p.Poll(ctx, opId)
-		}
+// Submit queues an operation to be started by Await. At most MaxInFlight operations are started, but not completed,
+// at any time. The context of the first submitted operation is used to check the status of all pending operations.
+func (p *operationPoller) Submit(ctx context.Context, opType types.OperationType, opProvider func() (opId string, err error)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
 
-		p.opChan <- opResult{opId: opId, err: err}
-	}()
+	if p.ctx == nil {
+		p.ctx = ctx
+	}
+	p.tasks = append(p.tasks, operationTask{opType: opType, opProvider: opProvider})
 }
 
-func (p *operationPoller) Poll(ctx context.Context, opId string) (op *types.Operation, err error) {
-	// poll tries a condition func until it returns true, an error, or the timeout is reached.
-	err = wait.Poll(p.pollInterval, p.pollTimeout, func() (done bool, err error) {
-		p.log.Info("polling operation", "opId", opId)
+// Poll checks the status of an operation with an exponentially growing interval until it reaches a terminal state.
+// It returns the context error as soon as the context is done, and an OperationTimeoutError once the poll timeout of
+// the operation type is reached.
+func (p *operationPoller) Poll(ctx context.Context, opType types.OperationType, opId string) (op *types.Operation, err error) {
+	timeout := p.timeout(opType)
+	deadline := time.Now().Add(timeout)
+	backoff := p.backoff()
+
+	for {
+		p.log.Info("polling operation", "opId", opId, "type", opType)
 
 		op, err = p.sdApi.GetOperation(ctx, opId)
 		if err != nil {
-			return true, err
+			return nil, err
 		}
 
 		switch op.Status {
 		case types.OperationStatusSuccess:
-			return true, nil
+			return op, nil
 		case types.OperationStatusFail:
-			return true, fmt.Errorf("operation failed, opId: %s, reason: %s", opId, aws.ToString(op.ErrorMessage))
-		default:
-			return false, nil
+			return op, fmt.Errorf("operation failed, opId: %s, reason: %s", opId, aws.ToString(op.ErrorMessage))
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return op, &OperationTimeoutError{OperationId: opId, OperationType: opType, Timeout: timeout}
+		}
+
+		delay := backoff.Step()
+		if delay > remaining {
+			delay = remaining
 		}
-	})
-	if err == wait.ErrWaitTimeout {
-		err = fmt.Errorf("%s, opId: %s", operationPollTimoutErrorMessage, opId)
-	}
 
-	return op, err
+		select {
+		case <-ctx.Done():
+			return op, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
 }
 
+// Await starts the submitted operations with a bounded pool of workers, and waits for all of them to reach a terminal
+// state. Pending operations are checked together with a single ListOperations call per poll interval.
 func (p *operationPoller) Await() (err error) {
-	// Run wait in separate go routine to unblock reading from the channel.
-	go func() {
-		// Block till the polling done i.e. WaitGroup counter is zero, and then close the channel
-		p.waitGroup.Wait()
-		close(p.opChan)
-	}()
-
-	for res := range p.opChan {
+	p.mutex.Lock()
+	tasks, ctx := p.tasks, p.ctx
+	p.tasks = nil
+	p.mutex.Unlock()
+
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	taskChan := make(chan operationTask, len(tasks))
+	for _, task := range tasks {
+		taskChan <- task
+	}
+	close(taskChan)
+
+	resultChan := make(chan opResult, len(tasks))
+	pendingChan := make(chan *pendingOperation)
+	stopChan := make(chan struct{})
+	go p.monitor(ctx, pendingChan, stopChan)
+
+	workers := p.config.MaxInFlight
+	if workers > len(tasks) {
+		workers = len(tasks)
+	}
+
+	var waitGroup sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for task := range taskChan {
+				resultChan <- p.run(ctx, task, pendingChan)
+			}
+		}()
+	}
+
+	// Block till all workers are done, all operations have reached a terminal state at this point
+	waitGroup.Wait()
+	close(stopChan)
+	close(resultChan)
+
+	for res := range resultChan {
 		if res.err != nil {
 			p.log.Error(res.err, "operation failed", "opId", res.opId)
 			err = common.Wrap(err, res.err)
@@ -127,3 +264,174 @@ func (p *operationPoller) Await() (err error) {
 
 	return err
 }
+
+// run starts an operation and blocks until the monitor reports its terminal state. Operations are not started once the
+// context is done.
+func (p *operationPoller) run(ctx context.Context, task operationTask, pendingChan chan<- *pendingOperation) opResult {
+	if err := ctx.Err(); err != nil {
+		return opResult{err: err}
+	}
+
+	opId, err := task.opProvider()
+	if err != nil {
+		return opResult{opId: opId, err: err}
+	}
+
+	op := &pendingOperation{
+		opId:     opId,
+		opType:   task.opType,
+		deadline: time.Now().Add(p.timeout(task.opType)),
+		done:     make(chan error, 1),
+	}
+	pendingChan <- op
+
+	return opResult{opId: opId, err: <-op.done}
+}
+
+// monitor tracks the operations started by the workers, and reports their terminal state once they complete, fail
+// or time out. The interval between each check grows exponentially, and is reset when new operations are started.
+// All pending operations fail as soon as the context is done.
+func (p *operationPoller) monitor(ctx context.Context, pendingChan <-chan *pendingOperation, stopChan <-chan struct{}) {
+	backoff := p.backoff()
+	timer := time.NewTimer(backoff.Step())
+	defer timer.Stop()
+
+	pending := make(map[string]*pendingOperation)
+	for {
+		select {
+		case op := <-pendingChan:
+			if err := ctx.Err(); err != nil {
+				op.done <- err
+				continue
+			}
+			if len(pending) == 0 {
+				backoff = p.backoff()
+				resetTimer(timer, backoff.Step())
+			}
+			pending[op.opId] = op
+		case <-timer.C:
+			if len(pending) > 0 {
+				p.checkPending(ctx, pending)
+			}
+			timer.Reset(backoff.Step())
+		case <-ctx.Done():
+			for opId, op := range pending {
+				op.done <- ctx.Err()
+				delete(pending, opId)
+			}
+			// keep serving operations started before the workers noticed the cancellation
+			select {
+			case op := <-pendingChan:
+				op.done <- ctx.Err()
+			case <-stopChan:
+				return
+			}
+		case <-stopChan:
+			return
+		}
+	}
+}
+
+func (p *operationPoller) checkPending(ctx context.Context, pending map[string]*pendingOperation) {
+	p.log.Info("polling operations", "count", len(pending))
+
+	opStatusMap, err := p.sdApi.ListOperations(ctx, p.filters())
+	if err != nil {
+		switch common.Classify(err) {
+		case common.ErrorClassThrottled, common.ErrorClassTransient:
+			// the pending operations are checked again on the next tick, until their deadline
+			p.log.Info("failed to list operations, retrying", "error", err.Error())
+		default:
+			for opId, op := range pending {
+				op.done <- err
+				delete(pending, opId)
+			}
+			return
+		}
+	}
+
+	for opId, op := range pending {
+		switch status, found := opStatusMap[opId]; {
+		case found && status == types.OperationStatusSuccess:
+			op.done <- nil
+		case found && status == types.OperationStatusFail:
+			op.done <- p.operationFailure(ctx, opId)
+		case !time.Now().Before(op.deadline):
+			op.done <- &OperationTimeoutError{OperationId: opId, OperationType: op.opType, Timeout: p.timeout(op.opType)}
+		default:
+			continue
+		}
+		delete(pending, opId)
+	}
+}
+
+// filters selects the operations which reached a terminal state since the poller was created, within a margin
+// covering the clock skew with Cloud Map.
+func (p *operationPoller) filters() []types.OperationFilter {
+	filters := []types.OperationFilter{
+		{
+			Name:      types.OperationFilterNameStatus,
+			Condition: types.FilterConditionIn,
+			Values: []string{
+				string(types.OperationStatusSuccess),
+				string(types.OperationStatusFail),
+			},
+		},
+		{
+			Name:      types.OperationFilterNameUpdateDate,
+			Condition: types.FilterConditionBetween,
+			Values: []string{
+				strconv.FormatInt(p.startTime.Add(-operationClockSkewMargin).UnixMilli(), 10),
+				strconv.FormatInt(time.Now().Add(operationClockSkewMargin).UnixMilli(), 10),
+			},
+		},
+	}
+
+	if p.config.ServiceId != "" {
+		filters = append(filters, types.OperationFilter{
+			Name:      types.OperationFilterNameServiceId,
+			Condition: types.FilterConditionEq,
+			Values:    []string{p.config.ServiceId},
+		})
+	}
+
+	return filters
+}
+
+// operationFailure fetches the reason of a failed operation.
+func (p *operationPoller) operationFailure(ctx context.Context, opId string) error {
+	op, err := p.sdApi.GetOperation(ctx, opId)
+	if err != nil {
+		return fmt.Errorf("operation failed, opId: %s: %w", opId, err)
+	}
+	return fmt.Errorf("operation failed, opId: %s, reason: %s", opId, aws.ToString(op.ErrorMessage))
+}
+
+// timeout returns the poll timeout of an operation type.
+func (p *operationPoller) timeout(opType types.OperationType) time.Duration {
+	if timeout, found := p.config.OperationTimeouts[opType]; found {
+		return timeout
+	}
+	return p.config.PollTimeout
+}
+
+// backoff returns the exponentially growing and jittered intervals between each operation status check.
+func (p *operationPoller) backoff() wait.Backoff {
+	return wait.Backoff{
+		Duration: p.config.PollInterval,
+		Factor:   operationPollBackoffFactor,
+		Jitter:   operationPollBackoffJitter,
+		Steps:    math.MaxInt32,
+		Cap:      p.config.MaxPollInterval,
+	}
+}
+
+func resetTimer(timer *time.Timer, delay time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(delay)
+}
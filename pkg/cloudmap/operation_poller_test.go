@@ -2,13 +2,17 @@ package cloudmap
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	cloudmapMock "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/mocks/pkg/cloudmap"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/servicediscovery/types"
+	"github.com/aws/smithy-go"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 )
@@ -27,21 +31,18 @@ func TestOperationPoller_HappyCase(t *testing.T) {
 
 	sdApi := cloudmapMock.NewMockServiceDiscoveryApi(mockController)
 
-	op1First := sdApi.EXPECT().GetOperation(gomock.Any(), op1).Return(opSubmitted(), nil)
-	op1Second := sdApi.EXPECT().GetOperation(gomock.Any(), op1).Return(opPending(), nil)
-	op1Third := sdApi.EXPECT().GetOperation(gomock.Any(), op1).Return(opSuccess(), nil)
-	gomock.InOrder(op1First, op1Second, op1Third)
+	first := sdApi.EXPECT().ListOperations(gomock.Any(), gomock.Any()).
+		Return(map[string]types.OperationStatus{op3: types.OperationStatusSuccess}, nil)
+	second := sdApi.EXPECT().ListOperations(gomock.Any(), gomock.Any()).
+		Return(map[string]types.OperationStatus{op2: types.OperationStatusSuccess, op3: types.OperationStatusSuccess}, nil)
+	third := sdApi.EXPECT().ListOperations(gomock.Any(), gomock.Any()).
+		Return(map[string]types.OperationStatus{op1: types.OperationStatusSuccess, op2: types.OperationStatusSuccess}, nil).AnyTimes()
+	gomock.InOrder(first, second, third)
 
-	op2First := sdApi.EXPECT().GetOperation(gomock.Any(), op2).Return(opPending(), nil)
-	op2Second := sdApi.EXPECT().GetOperation(gomock.Any(), op2).Return(opSuccess(), nil)
-	gomock.InOrder(op2First, op2Second)
-
-	sdApi.EXPECT().GetOperation(gomock.Any(), op3).Return(opSuccess(), nil)
-
-	op := NewOperationPollerWithConfig(interval, timeout, sdApi)
-	op.Submit(context.TODO(), func() (opId string, err error) { return op1, nil })
-	op.Submit(context.TODO(), func() (opId string, err error) { return op2, nil })
-	op.Submit(context.TODO(), func() (opId string, err error) { return op3, nil })
+	op := NewOperationPollerWithConfig(getPollerConfig(3), sdApi)
+	op.Submit(context.TODO(), types.OperationTypeRegisterInstance, func() (opId string, err error) { return op1, nil })
+	op.Submit(context.TODO(), types.OperationTypeRegisterInstance, func() (opId string, err error) { return op2, nil })
+	op.Submit(context.TODO(), types.OperationTypeRegisterInstance, func() (opId string, err error) { return op3, nil })
 
 	result := op.Await()
 	assert.Nil(t, result)
@@ -53,20 +54,16 @@ func TestOperationPoller_AllFail(t *testing.T) {
 
 	sdApi := cloudmapMock.NewMockServiceDiscoveryApi(mockController)
 
-	op1First := sdApi.EXPECT().GetOperation(gomock.Any(), op1).Return(opSubmitted(), nil)
-	op1Second := sdApi.EXPECT().GetOperation(gomock.Any(), op1).Return(opPending(), nil)
-	op1Third := sdApi.EXPECT().GetOperation(gomock.Any(), op1).Return(opFailed(), nil)
-	gomock.InOrder(op1First, op1Second, op1Third)
-
-	op2First := sdApi.EXPECT().GetOperation(gomock.Any(), op2).Return(opSubmitted(), nil)
-	op2Second := sdApi.EXPECT().GetOperation(gomock.Any(), op2).Return(opFailed(), nil)
-	gomock.InOrder(op2First, op2Second)
+	sdApi.EXPECT().ListOperations(gomock.Any(), gomock.Any()).
+		Return(map[string]types.OperationStatus{op1: types.OperationStatusFail, op2: types.OperationStatusFail}, nil).AnyTimes()
+	sdApi.EXPECT().GetOperation(gomock.Any(), op1).Return(opFailed(), nil)
+	sdApi.EXPECT().GetOperation(gomock.Any(), op2).Return(opFailed(), nil)
 
-	op := NewOperationPollerWithConfig(interval, timeout, sdApi)
-	op.Submit(context.TODO(), func() (opId string, err error) { return op1, nil })
-	op.Submit(context.TODO(), func() (opId string, err error) { return op2, nil })
+	op := NewOperationPollerWithConfig(getPollerConfig(3), sdApi)
+	op.Submit(context.TODO(), types.OperationTypeRegisterInstance, func() (opId string, err error) { return op1, nil })
+	op.Submit(context.TODO(), types.OperationTypeRegisterInstance, func() (opId string, err error) { return op2, nil })
 	unknown := "failed to reg error"
-	op.Submit(context.TODO(), func() (opId string, err error) {
+	op.Submit(context.TODO(), types.OperationTypeRegisterInstance, func() (opId string, err error) {
 		return "", fmt.Errorf(unknown)
 	})
 
@@ -83,19 +80,16 @@ func TestOperationPoller_Mixed(t *testing.T) {
 
 	sdApi := cloudmapMock.NewMockServiceDiscoveryApi(mockController)
 
-	op1First := sdApi.EXPECT().GetOperation(gomock.Any(), op1).Return(opSubmitted(), nil)
-	op1Second := sdApi.EXPECT().GetOperation(gomock.Any(), op1).Return(opPending(), nil)
-	op1Third := sdApi.EXPECT().GetOperation(gomock.Any(), op1).Return(opFailed(), nil)
-	gomock.InOrder(op1First, op1Second, op1Third)
+	first := sdApi.EXPECT().ListOperations(gomock.Any(), gomock.Any()).
+		Return(map[string]types.OperationStatus{}, nil)
+	second := sdApi.EXPECT().ListOperations(gomock.Any(), gomock.Any()).
+		Return(map[string]types.OperationStatus{op1: types.OperationStatusFail, op2: types.OperationStatusSuccess}, nil).AnyTimes()
+	gomock.InOrder(first, second)
+	sdApi.EXPECT().GetOperation(gomock.Any(), op1).Return(opFailed(), nil)
 
-	op2First := sdApi.EXPECT().GetOperation(gomock.Any(), op2).Return(opSubmitted(), nil)
-	op2Second := sdApi.EXPECT().GetOperation(gomock.Any(), op2).Return(opPending(), nil)
-	op2Third := sdApi.EXPECT().GetOperation(gomock.Any(), op2).Return(opSuccess(), nil)
-	gomock.InOrder(op2First, op2Second, op2Third)
-
-	op := NewOperationPollerWithConfig(interval, timeout, sdApi)
-	op.Submit(context.TODO(), func() (opId string, err error) { return op1, nil })
-	op.Submit(context.TODO(), func() (opId string, err error) { return op2, nil })
+	op := NewOperationPollerWithConfig(getPollerConfig(3), sdApi)
+	op.Submit(context.TODO(), types.OperationTypeRegisterInstance, func() (opId string, err error) { return op1, nil })
+	op.Submit(context.TODO(), types.OperationTypeRegisterInstance, func() (opId string, err error) { return op2, nil })
 
 	err := op.Await()
 	assert.NotNil(t, err)
@@ -109,21 +103,116 @@ func TestOperationPoller_Timeout(t *testing.T) {
 
 	sdApi := cloudmapMock.NewMockServiceDiscoveryApi(mockController)
 
-	sdApi.EXPECT().GetOperation(gomock.Any(), op1).Return(opPending(), nil).AnyTimes()
-
-	op2First := sdApi.EXPECT().GetOperation(gomock.Any(), op2).Return(opPending(), nil)
-	op2Second := sdApi.EXPECT().GetOperation(gomock.Any(), op2).Return(opSuccess(), nil)
-	gomock.InOrder(op2First, op2Second)
+	first := sdApi.EXPECT().ListOperations(gomock.Any(), gomock.Any()).
+		Return(map[string]types.OperationStatus{}, nil)
+	second := sdApi.EXPECT().ListOperations(gomock.Any(), gomock.Any()).
+		Return(map[string]types.OperationStatus{op2: types.OperationStatusSuccess}, nil).AnyTimes()
+	gomock.InOrder(first, second)
 
-	op := NewOperationPollerWithConfig(interval, timeout, sdApi)
-	op.Submit(context.TODO(), func() (opId string, err error) { return op1, nil })
-	op.Submit(context.TODO(), func() (opId string, err error) { return op2, nil })
+	op := NewOperationPollerWithConfig(getPollerConfig(3), sdApi)
+	op.Submit(context.TODO(), types.OperationTypeRegisterInstance, func() (opId string, err error) { return op1, nil })
+	op.Submit(context.TODO(), types.OperationTypeRegisterInstance, func() (opId string, err error) { return op2, nil })
 
 	err := op.Await()
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), op1)
 	assert.Contains(t, err.Error(), operationPollTimoutErrorMessage)
 	assert.NotContains(t, err.Error(), op2)
+	var timeoutErr *OperationTimeoutError
+	assert.ErrorAs(t, err, &timeoutErr)
+}
+
+func TestOperationPoller_ListOperationsError(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	sdApi := cloudmapMock.NewMockServiceDiscoveryApi(mockController)
+
+	listErr := errors.New("list operations error")
+	sdApi.EXPECT().ListOperations(gomock.Any(), gomock.Any()).Return(nil, listErr).AnyTimes()
+
+	op := NewOperationPollerWithConfig(getPollerConfig(3), sdApi)
+	op.Submit(context.TODO(), types.OperationTypeRegisterInstance, func() (opId string, err error) { return op1, nil })
+	op.Submit(context.TODO(), types.OperationTypeRegisterInstance, func() (opId string, err error) { return op2, nil })
+
+	err := op.Await()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), listErr.Error())
+}
+
+func TestOperationPoller_ListOperationsRetryableError(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	sdApi := cloudmapMock.NewMockServiceDiscoveryApi(mockController)
+
+	first := sdApi.EXPECT().ListOperations(gomock.Any(), gomock.Any()).
+		Return(nil, &smithy.GenericAPIError{Code: "ThrottlingException"})
+	second := sdApi.EXPECT().ListOperations(gomock.Any(), gomock.Any()).
+		Return(nil, &smithy.GenericAPIError{Code: "ServiceUnavailable"})
+	third := sdApi.EXPECT().ListOperations(gomock.Any(), gomock.Any()).
+		Return(map[string]types.OperationStatus{op1: types.OperationStatusSuccess, op2: types.OperationStatusSuccess}, nil).AnyTimes()
+	gomock.InOrder(first, second, third)
+
+	op := NewOperationPollerWithConfig(getPollerConfig(3), sdApi)
+	op.Submit(context.TODO(), types.OperationTypeRegisterInstance, func() (opId string, err error) { return op1, nil })
+	op.Submit(context.TODO(), types.OperationTypeRegisterInstance, func() (opId string, err error) { return op2, nil })
+
+	assert.Nil(t, op.Await())
+}
+
+func TestOperationPoller_MaxInFlight(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	sdApi := cloudmapMock.NewMockServiceDiscoveryApi(mockController)
+
+	var inFlight, maxInFlight int32
+	sdApi.EXPECT().ListOperations(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(context.Context, []types.OperationFilter) (map[string]types.OperationStatus, error) {
+			atomic.StoreInt32(&inFlight, 0)
+			return map[string]types.OperationStatus{
+				op1: types.OperationStatusSuccess,
+				op2: types.OperationStatusSuccess,
+				op3: types.OperationStatusSuccess,
+			}, nil
+		}).AnyTimes()
+
+	op := NewOperationPollerWithConfig(getPollerConfig(1), sdApi)
+	for _, opId := range []string{op1, op2, op3} {
+		id := opId
+		op.Submit(context.TODO(), types.OperationTypeRegisterInstance, func() (string, error) {
+			current := atomic.AddInt32(&inFlight, 1)
+			if current > atomic.LoadInt32(&maxInFlight) {
+				atomic.StoreInt32(&maxInFlight, current)
+			}
+			return id, nil
+		})
+	}
+
+	err := op.Await()
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&maxInFlight))
+}
+
+func TestOperationPoller_Filters(t *testing.T) {
+	config := getPollerConfig(1)
+	config.ServiceId = "svc-id"
+	poller := NewOperationPollerWithConfig(config, nil).(*operationPoller)
+
+	filters := poller.filters()
+	assert.Equal(t, 3, len(filters))
+	assert.Equal(t, types.OperationFilterNameStatus, filters[0].Name)
+	assert.Equal(t, []string{string(types.OperationStatusSuccess), string(types.OperationStatusFail)}, filters[0].Values)
+	assert.Equal(t, types.OperationFilterNameUpdateDate, filters[1].Name)
+	assert.Equal(t, types.FilterConditionBetween, filters[1].Condition)
+	// the window covers a clock skew with Cloud Map on both ends
+	assert.Equal(t, strconv.FormatInt(poller.startTime.Add(-operationClockSkewMargin).UnixMilli(), 10), filters[1].Values[0])
+	end, err := strconv.ParseInt(filters[1].Values[1], 10, 64)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, end, time.Now().Add(operationClockSkewMargin-time.Second).UnixMilli())
+	assert.Equal(t, types.OperationFilterNameServiceId, filters[2].Name)
+	assert.Equal(t, []string{"svc-id"}, filters[2].Values)
 }
 
 func TestOperationPoller_Poll_HappyCase(t *testing.T) {
@@ -135,11 +224,111 @@ func TestOperationPoller_Poll_HappyCase(t *testing.T) {
 	sdApi.EXPECT().GetOperation(context.TODO(), op1).Return(opPending(), nil)
 	sdApi.EXPECT().GetOperation(context.TODO(), op1).Return(opSuccess(), nil)
 
-	op := NewOperationPollerWithConfig(interval, timeout, sdApi)
-	_, err := op.Poll(context.TODO(), op1)
+	op := NewOperationPollerWithConfig(getPollerConfig(1), sdApi)
+	_, err := op.Poll(context.TODO(), types.OperationTypeRegisterInstance, op1)
 	assert.Nil(t, err)
 }
 
+func TestOperationPoller_Poll_Timeout(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	sdApi := cloudmapMock.NewMockServiceDiscoveryApi(mockController)
+
+	sdApi.EXPECT().GetOperation(context.TODO(), op1).Return(opPending(), nil).AnyTimes()
+
+	config := getPollerConfig(1)
+	config.OperationTimeouts = map[types.OperationType]time.Duration{types.OperationTypeCreateNamespace: 2 * interval}
+	op := NewOperationPollerWithConfig(config, sdApi)
+
+	start := time.Now()
+	_, err := op.Poll(context.TODO(), types.OperationTypeCreateNamespace, op1)
+	assert.Less(t, time.Since(start), timeout, "operation type timeout overrides the default timeout")
+
+	var timeoutErr *OperationTimeoutError
+	assert.True(t, errors.As(err, &timeoutErr))
+	assert.Equal(t, op1, timeoutErr.OperationId)
+	assert.Equal(t, types.OperationTypeCreateNamespace, timeoutErr.OperationType)
+}
+
+func TestOperationPoller_Poll_ContextCanceled(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	sdApi := cloudmapMock.NewMockServiceDiscoveryApi(mockController)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	sdApi.EXPECT().GetOperation(ctx, op1).DoAndReturn(func(context.Context, string) (*types.Operation, error) {
+		cancel()
+		return opPending(), nil
+	})
+
+	config := getPollerConfig(1)
+	config.PollInterval = time.Minute
+	op := NewOperationPollerWithConfig(config, sdApi)
+
+	start := time.Now()
+	_, err := op.Poll(ctx, types.OperationTypeRegisterInstance, op1)
+	assert.Equal(t, context.Canceled, err)
+	assert.Less(t, time.Since(start), interval)
+	var timeoutErr *OperationTimeoutError
+	assert.False(t, errors.As(err, &timeoutErr))
+}
+
+func TestOperationPoller_Await_ContextCanceled(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	sdApi := cloudmapMock.NewMockServiceDiscoveryApi(mockController)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	config := getPollerConfig(1)
+	config.PollInterval = time.Minute
+	op := NewOperationPollerWithConfig(config, sdApi)
+	op.Submit(ctx, types.OperationTypeRegisterInstance, func() (opId string, err error) {
+		cancel()
+		return op1, nil
+	})
+	// not started, as the context is canceled by the first operation
+	op.Submit(ctx, types.OperationTypeRegisterInstance, func() (opId string, err error) {
+		t.Error("operation started after context cancellation")
+		return op2, nil
+	})
+
+	start := time.Now()
+	err := op.Await()
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), interval)
+}
+
+func TestOperationPoller_Backoff(t *testing.T) {
+	config := getPollerConfig(1)
+	config.MaxPollInterval = 2 * interval
+	poller := NewOperationPollerWithConfig(config, nil).(*operationPoller)
+
+	// the interval grows from the initial interval, and stays capped at the maximum interval plus jitter
+	backoff := poller.backoff()
+	for i := 0; i < 10; i++ {
+		delay := backoff.Step()
+		assert.GreaterOrEqual(t, delay, interval)
+		assert.LessOrEqual(t, delay, time.Duration(float64(config.MaxPollInterval)*(1+operationPollBackoffJitter)))
+	}
+}
+
+func TestDefaultOperationPollerConfig_NamespaceTimeouts(t *testing.T) {
+	poller := NewOperationPoller(nil).(*operationPoller)
+	assert.Equal(t, defaultNamespaceOperationPollTimeout, poller.timeout(types.OperationTypeCreateNamespace))
+	assert.Equal(t, defaultOperationPollTimeout, poller.timeout(types.OperationTypeRegisterInstance))
+}
+
+func getPollerConfig(maxInFlight int) *OperationPollerConfig {
+	return &OperationPollerConfig{
+		PollInterval: interval,
+		PollTimeout:  timeout,
+		MaxInFlight:  maxInFlight,
+	}
+}
+
 func opPending() *types.Operation {
 	return &types.Operation{
 		Status: types.OperationStatusPending,
@@ -153,12 +342,6 @@ func opFailed() *types.Operation {
 	}
 }
 
-func opSubmitted() *types.Operation {
-	return &types.Operation{
-		Status: types.OperationStatusSubmitted,
-	}
-}
-
 func opSuccess() *types.Operation {
 	return &types.Operation{
 		Status: types.OperationStatusSuccess,
@@ -0,0 +1,434 @@
+package clusterset
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	multiclusterv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/multicluster/v1alpha1"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/cloudmap"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/common"
+	controllers "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/controllers/multicluster"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Inspector reads the clusterset services from AWS Cloud Map, and compares them with the ServiceExports and
+// ServiceImports of the local cluster.
+type Inspector struct {
+	// Client reads the namespaces, ServiceExports, ServiceImports and ClusterSetPolicies of the local cluster
+	Client client.Reader
+	// CloudMap reads the clusterset services of the Cloud Map namespaces mapped from the local namespaces
+	CloudMap cloudmap.ServiceDiscoveryClient
+	// ClusterId is the ID of the local cluster
+	ClusterId string
+}
+
+// Service is a clusterset service with the endpoints exported by each cluster.
+type Service struct {
+	Namespace string             `json:"namespace"`
+	Name      string             `json:"name"`
+	Clusters  []ClusterEndpoints `json:"clusters"`
+}
+
+// ClusterEndpoints holds the endpoints a cluster exports to a clusterset service.
+type ClusterEndpoints struct {
+	ClusterId   string            `json:"clusterId"`
+	ServiceType model.ServiceType `json:"serviceType"`
+	Endpoints   []Endpoint        `json:"endpoints"`
+}
+
+// Endpoint is an endpoint exported to a clusterset service.
+type Endpoint struct {
+	Address     string `json:"address"`
+	Port        int32  `json:"port"`
+	Protocol    string `json:"protocol"`
+	ServicePort int32  `json:"servicePort"`
+	PortName    string `json:"portName,omitempty"`
+	Ready       bool   `json:"ready"`
+	Hostname    string `json:"hostname,omitempty"`
+}
+
+// DifferenceKind classifies the differences between Cloud Map and the local cluster.
+type DifferenceKind string
+
+const (
+	// ExportMissing indicates a ServiceExport whose Service has no endpoints of the local cluster in Cloud Map
+	ExportMissing DifferenceKind = "ExportMissing"
+
+	// ExportStale indicates endpoints of the local cluster in Cloud Map without a ServiceExport exporting them
+	ExportStale DifferenceKind = "ExportStale"
+
+	// ImportMissing indicates a clusterset service without a ServiceImport
+	ImportMissing DifferenceKind = "ImportMissing"
+
+	// ImportStale indicates a ServiceImport without a clusterset service in Cloud Map
+	ImportStale DifferenceKind = "ImportStale"
+
+	// ImportOutdated indicates a ServiceImport listing other clusters than those exporting the clusterset service
+	ImportOutdated DifferenceKind = "ImportOutdated"
+)
+
+// Difference is a difference between Cloud Map and the ServiceExports or ServiceImports of the local cluster.
+type Difference struct {
+	Namespace string         `json:"namespace"`
+	Name      string         `json:"name"`
+	Kind      DifferenceKind `json:"kind"`
+	Detail    string         `json:"detail"`
+}
+
+// ConflictKind classifies the conflicts between the exports of a clusterset service.
+type ConflictKind string
+
+const (
+	// ServiceTypeConflict indicates clusters export the service as different service types
+	ServiceTypeConflict ConflictKind = "ServiceType"
+
+	// PortConflict indicates clusters export the same service port name with different port numbers or protocols
+	PortConflict ConflictKind = "Port"
+)
+
+// Conflict is a conflict between the exports of a clusterset service by several clusters.
+type Conflict struct {
+	Namespace string       `json:"namespace"`
+	Name      string       `json:"name"`
+	Kind      ConflictKind `json:"kind"`
+	Clusters  []string     `json:"clusters"`
+	Detail    string       `json:"detail"`
+}
+
+// Namespaces returns the given namespace, or all the namespaces of the local cluster if empty.
+func (i *Inspector) Namespaces(ctx context.Context, namespace string) ([]string, error) {
+	if namespace != "" {
+		return []string{namespace}, nil
+	}
+	namespaces := v1.NamespaceList{}
+	if err := i.Client.List(ctx, &namespaces); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(namespaces.Items))
+	for _, ns := range namespaces.Items {
+		names = append(names, ns.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Services returns the clusterset services of the given namespaces, sorted by namespace and name.
+func (i *Inspector) Services(ctx context.Context, namespaces []string) ([]*Service, error) {
+	services := make([]*Service, 0)
+	for _, namespace := range namespaces {
+		cmServices, err := i.CloudMap.ListServices(ctx, namespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the Cloud Map services of namespace %s: %w", namespace, err)
+		}
+		for _, cmService := range cmServices {
+			services = append(services, newService(cmService))
+		}
+	}
+	sort.Slice(services, func(a, b int) bool {
+		if services[a].Namespace != services[b].Namespace {
+			return services[a].Namespace < services[b].Namespace
+		}
+		return services[a].Name < services[b].Name
+	})
+	return services, nil
+}
+
+// Service returns a clusterset service, or nil if it does not exist in Cloud Map.
+func (i *Inspector) Service(ctx context.Context, name types.NamespacedName) (*Service, error) {
+	cmService, err := i.CloudMap.GetService(ctx, name.Namespace, name.Name)
+	if common.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the Cloud Map service %s: %w", name, err)
+	}
+	if cmService == nil {
+		return nil, nil
+	}
+	return newService(cmService), nil
+}
+
+// Diff returns the differences between the clusterset services of the given namespaces in Cloud Map and the
+// ServiceExports and ServiceImports of the local cluster, sorted by namespace, name and kind.
+func (i *Inspector) Diff(ctx context.Context, namespaces []string) ([]Difference, error) {
+	services, err := i.Services(ctx, namespaces)
+	if err != nil {
+		return nil, err
+	}
+	servicesByName := make(map[types.NamespacedName]*Service, len(services))
+	for _, svc := range services {
+		servicesByName[types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}] = svc
+	}
+
+	differences := make([]Difference, 0)
+	exported := make(map[types.NamespacedName]bool)
+	for _, namespace := range namespaces {
+		svcExports := multiclusterv1alpha1.ServiceExportList{}
+		if err = i.Client.List(ctx, &svcExports, client.InNamespace(namespace)); err != nil {
+			return nil, err
+		}
+		for _, svcExport := range svcExports.Items {
+			name := controllers.ExportedServiceName(&svcExport)
+			exported[name] = true
+			if svc := servicesByName[name]; svc == nil || svc.cluster(i.ClusterId) == nil {
+				differences = append(differences, Difference{Namespace: name.Namespace, Name: name.Name, Kind: ExportMissing,
+					Detail: fmt.Sprintf("ServiceExport %s/%s has no endpoints of cluster %s in Cloud Map", svcExport.Namespace, svcExport.Name, i.ClusterId)})
+			}
+		}
+	}
+
+	for _, svc := range services {
+		name := types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}
+		if svc.cluster(i.ClusterId) != nil && !exported[name] {
+			differences = append(differences, Difference{Namespace: svc.Namespace, Name: svc.Name, Kind: ExportStale,
+				Detail: fmt.Sprintf("endpoints of cluster %s are registered without a ServiceExport", i.ClusterId)})
+		}
+	}
+
+	importDifferences, err := i.diffImports(ctx, namespaces, servicesByName)
+	if err != nil {
+		return nil, err
+	}
+	differences = append(differences, importDifferences...)
+
+	sort.Slice(differences, func(a, b int) bool {
+		if differences[a].Namespace != differences[b].Namespace {
+			return differences[a].Namespace < differences[b].Namespace
+		}
+		if differences[a].Name != differences[b].Name {
+			return differences[a].Name < differences[b].Name
+		}
+		return differences[a].Kind < differences[b].Kind
+	})
+	return differences, nil
+}
+
+// diffImports compares the ServiceImports of the local cluster with the clusterset services it is allowed to import.
+func (i *Inspector) diffImports(ctx context.Context, namespaces []string, services map[types.NamespacedName]*Service) ([]Difference, error) {
+	differences := make([]Difference, 0)
+	imported := make(map[types.NamespacedName]bool)
+	for _, namespace := range namespaces {
+		svcImports := multiclusterv1alpha1.ServiceImportList{}
+		if err := i.Client.List(ctx, &svcImports, client.InNamespace(namespace)); err != nil {
+			return nil, err
+		}
+		for _, svcImport := range svcImports.Items {
+			name := types.NamespacedName{Namespace: svcImport.Namespace, Name: svcImport.Name}
+			imported[name] = true
+			svc := services[name]
+			if svc == nil {
+				differences = append(differences, Difference{Namespace: name.Namespace, Name: name.Name, Kind: ImportStale,
+					Detail: "ServiceImport has no clusterset service in Cloud Map"})
+				continue
+			}
+
+			expected, err := i.importedClusters(ctx, svc)
+			if err != nil {
+				return nil, err
+			}
+			actual := make([]string, 0, len(svcImport.Status.Clusters))
+			for _, cluster := range svcImport.Status.Clusters {
+				actual = append(actual, cluster.Cluster)
+			}
+			sort.Strings(actual)
+			if strings.Join(expected, ",") != strings.Join(actual, ",") {
+				differences = append(differences, Difference{Namespace: name.Namespace, Name: name.Name, Kind: ImportOutdated,
+					Detail: fmt.Sprintf("ServiceImport lists clusters [%s], Cloud Map has endpoints of clusters [%s]",
+						strings.Join(actual, ", "), strings.Join(expected, ", "))})
+			}
+		}
+	}
+
+	for name, svc := range services {
+		if imported[name] {
+			continue
+		}
+		expected, err := i.importedClusters(ctx, svc)
+		if err != nil {
+			return nil, err
+		}
+		if len(expected) > 0 {
+			differences = append(differences, Difference{Namespace: name.Namespace, Name: name.Name, Kind: ImportMissing,
+				Detail: fmt.Sprintf("clusterset service exported by clusters [%s] has no ServiceImport", strings.Join(expected, ", "))})
+		}
+	}
+	return differences, nil
+}
+
+// importedClusters returns the sorted IDs of the clusters whose endpoints of a clusterset service the local cluster
+// imports, according to the ClusterSetPolicies of the local cluster.
+func (i *Inspector) importedClusters(ctx context.Context, svc *Service) ([]string, error) {
+	policy, err := controllers.GetServicePolicy(ctx, i.Client, types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name})
+	if err != nil {
+		return nil, err
+	}
+	clusterIds := make([]string, 0, len(svc.Clusters))
+	if !policy.AllowsImport(i.ClusterId) {
+		return clusterIds, nil
+	}
+	for _, cluster := range svc.Clusters {
+		if policy.AllowsExport(cluster.ClusterId) {
+			clusterIds = append(clusterIds, cluster.ClusterId)
+		}
+	}
+	return clusterIds, nil
+}
+
+// Conflicts returns the conflicts between the exports of the clusterset services of the given namespaces, sorted by
+// namespace, name and kind.
+func (i *Inspector) Conflicts(ctx context.Context, namespaces []string) ([]Conflict, error) {
+	services, err := i.Services(ctx, namespaces)
+	if err != nil {
+		return nil, err
+	}
+	conflicts := make([]Conflict, 0)
+	for _, svc := range services {
+		conflicts = append(conflicts, svc.conflicts()...)
+	}
+	return conflicts, nil
+}
+
+func newService(cmService *model.Service) *Service {
+	clusters := make(map[string]*ClusterEndpoints)
+	for _, endpoint := range cmService.Endpoints {
+		cluster, found := clusters[endpoint.ClusterId]
+		if !found {
+			cluster = &ClusterEndpoints{ClusterId: endpoint.ClusterId, ServiceType: endpoint.ServiceType}
+			clusters[endpoint.ClusterId] = cluster
+		}
+		cluster.Endpoints = append(cluster.Endpoints, Endpoint{
+			Address:     endpoint.IP,
+			Port:        endpoint.EndpointPort.Port,
+			Protocol:    endpoint.EndpointPort.Protocol,
+			ServicePort: endpoint.ServicePort.Port,
+			PortName:    endpoint.ServicePort.Name,
+			Ready:       endpoint.Ready,
+			Hostname:    endpoint.Hostname,
+		})
+	}
+
+	svc := &Service{Namespace: cmService.Namespace, Name: cmService.Name, Clusters: make([]ClusterEndpoints, 0, len(clusters))}
+	for _, cluster := range clusters {
+		sort.Slice(cluster.Endpoints, func(a, b int) bool {
+			if cluster.Endpoints[a].Address != cluster.Endpoints[b].Address {
+				return cluster.Endpoints[a].Address < cluster.Endpoints[b].Address
+			}
+			return cluster.Endpoints[a].Port < cluster.Endpoints[b].Port
+		})
+		svc.Clusters = append(svc.Clusters, *cluster)
+	}
+	sort.Slice(svc.Clusters, func(a, b int) bool { return svc.Clusters[a].ClusterId < svc.Clusters[b].ClusterId })
+	return svc
+}
+
+// cluster returns the endpoints of a cluster, or nil if it does not export the service.
+func (s *Service) cluster(clusterId string) *ClusterEndpoints {
+	for i := range s.Clusters {
+		if s.Clusters[i].ClusterId == clusterId {
+			return &s.Clusters[i]
+		}
+	}
+	return nil
+}
+
+// ServiceTypes returns the sorted service types the clusters export the service as.
+func (s *Service) ServiceTypes() []string {
+	unique := make(map[string]bool)
+	for _, cluster := range s.Clusters {
+		unique[string(cluster.ServiceType)] = true
+	}
+	serviceTypes := make([]string, 0, len(unique))
+	for serviceType := range unique {
+		serviceTypes = append(serviceTypes, serviceType)
+	}
+	sort.Strings(serviceTypes)
+	return serviceTypes
+}
+
+// ReadyEndpoints returns the number of ready endpoints and the total number of endpoints of a cluster.
+func (c *ClusterEndpoints) ReadyEndpoints() (ready int, total int) {
+	for _, endpoint := range c.Endpoints {
+		if endpoint.Ready {
+			ready++
+		}
+	}
+	return ready, len(c.Endpoints)
+}
+
+func (s *Service) conflicts() []Conflict {
+	conflicts := make([]Conflict, 0)
+
+	clustersByType := make(map[string][]string)
+	for _, cluster := range s.Clusters {
+		clustersByType[string(cluster.ServiceType)] = append(clustersByType[string(cluster.ServiceType)], cluster.ClusterId)
+	}
+	if serviceTypes := s.ServiceTypes(); len(serviceTypes) > 1 {
+		details := make([]string, 0, len(serviceTypes))
+		for _, serviceType := range serviceTypes {
+			details = append(details, fmt.Sprintf("%s by [%s]", serviceType, strings.Join(clustersByType[serviceType], ", ")))
+		}
+		conflicts = append(conflicts, Conflict{Namespace: s.Namespace, Name: s.Name, Kind: ServiceTypeConflict,
+			Clusters: s.clusterIds(), Detail: "exported as " + strings.Join(details, " and ")})
+	}
+
+	// clusters exporting each definition of each service port name
+	definitions := make(map[string]map[string][]string)
+	for _, cluster := range s.Clusters {
+		seen := make(map[string]bool)
+		for _, endpoint := range cluster.Endpoints {
+			definition := fmt.Sprintf("%d/%s", endpoint.ServicePort, endpoint.Protocol)
+			if seen[endpoint.PortName+" "+definition] {
+				continue
+			}
+			seen[endpoint.PortName+" "+definition] = true
+			if definitions[endpoint.PortName] == nil {
+				definitions[endpoint.PortName] = make(map[string][]string)
+			}
+			definitions[endpoint.PortName][definition] = append(definitions[endpoint.PortName][definition], cluster.ClusterId)
+		}
+	}
+	portNames := make([]string, 0, len(definitions))
+	for portName := range definitions {
+		portNames = append(portNames, portName)
+	}
+	sort.Strings(portNames)
+	for _, portName := range portNames {
+		if len(definitions[portName]) < 2 {
+			continue
+		}
+		details := make([]string, 0, len(definitions[portName]))
+		clusters := make(map[string]bool)
+		for definition, clusterIds := range definitions[portName] {
+			details = append(details, fmt.Sprintf("%s by [%s]", definition, strings.Join(clusterIds, ", ")))
+			for _, clusterId := range clusterIds {
+				clusters[clusterId] = true
+			}
+		}
+		sort.Strings(details)
+		conflicts = append(conflicts, Conflict{Namespace: s.Namespace, Name: s.Name, Kind: PortConflict,
+			Clusters: sortedKeys(clusters), Detail: fmt.Sprintf("port %q exported as %s", portName, strings.Join(details, " and "))})
+	}
+	return conflicts
+}
+
+func (s *Service) clusterIds() []string {
+	clusterIds := make([]string, 0, len(s.Clusters))
+	for _, cluster := range s.Clusters {
+		clusterIds = append(clusterIds, cluster.ClusterId)
+	}
+	return clusterIds
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,228 @@
+package clusterset
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	cloudmapMock "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/mocks/pkg/cloudmap"
+	aboutv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/about/v1alpha1"
+	multiclusterv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/multicluster/v1alpha1"
+	policyv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/policy/v1alpha1"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/common"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/test"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestInspector_Namespaces(t *testing.T) {
+	inspector := &Inspector{Client: fakeClientForTest(
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: test.HttpNsName}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: test.DnsNsName}})}
+
+	namespaces, err := inspector.Namespaces(context.TODO(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{test.DnsNsName, test.HttpNsName}, namespaces)
+
+	namespaces, err = inspector.Namespaces(context.TODO(), "other")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"other"}, namespaces)
+}
+
+func TestInspector_Services(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	notReady := test.GetTestEndpoint2()
+	notReady.Ready = false
+	cloudMap := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	cloudMap.EXPECT().ListServices(context.TODO(), test.HttpNsName).Return([]*model.Service{
+		test.GetTestServiceWithEndpoint([]*model.Endpoint{cluster2EndpointForTest(), notReady, test.GetTestEndpoint1()}),
+		{Namespace: test.HttpNsName, Name: "other"},
+	}, nil)
+
+	inspector := &Inspector{Client: fakeClientForTest(), CloudMap: cloudMap, ClusterId: test.ClusterId1}
+	services, err := inspector.Services(context.TODO(), []string{test.HttpNsName})
+	assert.NoError(t, err)
+	assert.Equal(t, []*Service{
+		{Namespace: test.HttpNsName, Name: "other", Clusters: []ClusterEndpoints{}},
+		{Namespace: test.HttpNsName, Name: test.SvcName, Clusters: []ClusterEndpoints{
+			{ClusterId: test.ClusterId1, ServiceType: model.ClusterSetIPType, Endpoints: []Endpoint{
+				{Address: test.EndptIp1, Port: test.Port1, Protocol: test.Protocol1, ServicePort: test.ServicePort1,
+					PortName: test.PortName1, Ready: true, Hostname: test.Hostname},
+				{Address: test.EndptIp2, Port: test.Port2, Protocol: test.Protocol2, ServicePort: test.ServicePort2,
+					PortName: test.PortName2, Ready: false, Hostname: test.Hostname},
+			}},
+			{ClusterId: test.ClusterId2, ServiceType: model.ClusterSetIPType, Endpoints: []Endpoint{
+				{Address: test.EndptIp2, Port: test.Port2, Protocol: test.Protocol2, ServicePort: test.ServicePort2,
+					PortName: test.PortName2, Ready: true, Hostname: test.Hostname},
+			}},
+		}},
+	}, services)
+
+	ready, total := services[1].Clusters[0].ReadyEndpoints()
+	assert.Equal(t, 1, ready)
+	assert.Equal(t, 2, total)
+}
+
+func TestInspector_Services_Error(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	cloudMap := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	cloudMap.EXPECT().ListServices(context.TODO(), test.HttpNsName).Return(nil, errors.New("error"))
+
+	inspector := &Inspector{Client: fakeClientForTest(), CloudMap: cloudMap, ClusterId: test.ClusterId1}
+	_, err := inspector.Services(context.TODO(), []string{test.HttpNsName})
+	assert.Error(t, err)
+}
+
+func TestInspector_Service(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	cloudMap := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	cloudMap.EXPECT().GetService(context.TODO(), test.HttpNsName, test.SvcName).Return(test.GetTestMulticlusterService(), nil)
+	cloudMap.EXPECT().GetService(context.TODO(), test.HttpNsName, "other").Return(nil, common.NotFoundError("service: other"))
+	cloudMap.EXPECT().GetService(context.TODO(), test.HttpNsName, "failing").Return(nil, errors.New("error"))
+
+	inspector := &Inspector{Client: fakeClientForTest(), CloudMap: cloudMap, ClusterId: test.ClusterId1}
+	svc, err := inspector.Service(context.TODO(), types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName})
+	assert.NoError(t, err)
+	assert.Equal(t, test.SvcName, svc.Name)
+	assert.Len(t, svc.Clusters, 2)
+	assert.Equal(t, []string{string(model.ClusterSetIPType)}, svc.ServiceTypes())
+
+	// services missing from Cloud Map are not found
+	svc, err = inspector.Service(context.TODO(), types.NamespacedName{Namespace: test.HttpNsName, Name: "other"})
+	assert.NoError(t, err)
+	assert.Nil(t, svc)
+
+	_, err = inspector.Service(context.TODO(), types.NamespacedName{Namespace: test.HttpNsName, Name: "failing"})
+	assert.Error(t, err)
+}
+
+func TestInspector_Diff(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	// exported by cluster 2 only
+	exportedByOther := test.GetTestServiceWithEndpoint([]*model.Endpoint{cluster2EndpointForTest()})
+	exportedByOther.Name = "exported-by-other"
+	// exported by this cluster without a ServiceExport
+	staleExport := test.GetTestServiceWithEndpoint([]*model.Endpoint{test.GetTestEndpoint1()})
+	staleExport.Name = "stale-export"
+
+	cloudMap := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	cloudMap.EXPECT().ListServices(context.TODO(), test.HttpNsName).
+		Return([]*model.Service{test.GetTestMulticlusterService(), exportedByOther, staleExport}, nil)
+
+	inspector := &Inspector{
+		Client: fakeClientForTest(
+			serviceExportForTest(test.SvcName),
+			serviceExportForTest("missing-export"),
+			serviceImportForTest(test.SvcName, test.ClusterId1, test.ClusterId2),
+			serviceImportForTest("stale-export", test.ClusterId2),
+			serviceImportForTest("stale-import", test.ClusterId2)),
+		CloudMap:  cloudMap,
+		ClusterId: test.ClusterId1,
+	}
+	differences, err := inspector.Diff(context.TODO(), []string{test.HttpNsName})
+	assert.NoError(t, err)
+	assert.Equal(t, []Difference{
+		{Namespace: test.HttpNsName, Name: "exported-by-other", Kind: ImportMissing,
+			Detail: "clusterset service exported by clusters [test-mcs-clusterid-2] has no ServiceImport"},
+		{Namespace: test.HttpNsName, Name: "missing-export", Kind: ExportMissing,
+			Detail: "ServiceExport http-ns-name/missing-export has no endpoints of cluster test-mcs-clusterid-1 in Cloud Map"},
+		{Namespace: test.HttpNsName, Name: "stale-export", Kind: ExportStale,
+			Detail: "endpoints of cluster test-mcs-clusterid-1 are registered without a ServiceExport"},
+		{Namespace: test.HttpNsName, Name: "stale-export", Kind: ImportOutdated,
+			Detail: "ServiceImport lists clusters [test-mcs-clusterid-2], Cloud Map has endpoints of clusters [test-mcs-clusterid-1]"},
+		{Namespace: test.HttpNsName, Name: "stale-import", Kind: ImportStale,
+			Detail: "ServiceImport has no clusterset service in Cloud Map"},
+	}, differences)
+}
+
+func TestInspector_Diff_Policy(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	cloudMap := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	cloudMap.EXPECT().ListServices(context.TODO(), test.HttpNsName).
+		Return([]*model.Service{test.GetTestMulticlusterService()}, nil)
+
+	// cluster 2 is not allowed to export the service, so the ServiceImport lists cluster 1 only
+	policy := &policyv1alpha1.ClusterSetPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: test.HttpNsName, Name: "policy"},
+		Spec:       policyv1alpha1.ClusterSetPolicySpec{ExportClusters: []string{test.ClusterId1}},
+	}
+	inspector := &Inspector{
+		Client:    fakeClientForTest(policy, serviceExportForTest(test.SvcName), serviceImportForTest(test.SvcName, test.ClusterId1)),
+		CloudMap:  cloudMap,
+		ClusterId: test.ClusterId1,
+	}
+	differences, err := inspector.Diff(context.TODO(), []string{test.HttpNsName})
+	assert.NoError(t, err)
+	assert.Empty(t, differences)
+}
+
+func TestInspector_Conflicts(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	// cluster 2 exports the http port with another port number, as a headless service
+	endpoint2 := cluster2EndpointForTest()
+	endpoint2.ServicePort.Name = test.PortName1
+	endpoint2.ServiceType = model.HeadlessType
+	conflicting := test.GetTestServiceWithEndpoint([]*model.Endpoint{test.GetTestEndpoint1(), endpoint2})
+
+	cloudMap := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	cloudMap.EXPECT().ListServices(context.TODO(), test.HttpNsName).Return([]*model.Service{conflicting}, nil)
+	cloudMap.EXPECT().ListServices(context.TODO(), test.DnsNsName).Return([]*model.Service{test.GetTestMulticlusterService()}, nil)
+
+	inspector := &Inspector{Client: fakeClientForTest(), CloudMap: cloudMap, ClusterId: test.ClusterId1}
+	conflicts, err := inspector.Conflicts(context.TODO(), []string{test.HttpNsName, test.DnsNsName})
+	assert.NoError(t, err)
+	assert.Equal(t, []Conflict{
+		{Namespace: test.HttpNsName, Name: test.SvcName, Kind: ServiceTypeConflict,
+			Clusters: []string{test.ClusterId1, test.ClusterId2},
+			Detail:   "exported as ClusterSetIP by [test-mcs-clusterid-1] and Headless by [test-mcs-clusterid-2]"},
+		{Namespace: test.HttpNsName, Name: test.SvcName, Kind: PortConflict,
+			Clusters: []string{test.ClusterId1, test.ClusterId2},
+			Detail:   "port \"http\" exported as 11/TCP by [test-mcs-clusterid-1] and 22/UDP by [test-mcs-clusterid-2]"},
+	}, conflicts)
+}
+
+// cluster2EndpointForTest returns the endpoint 2, exported by cluster 2.
+func cluster2EndpointForTest() *model.Endpoint {
+	return test.GetMulticlusterTestEndpoints()[1]
+}
+
+func fakeClientForTest(objects ...client.Object) client.Client {
+	s := runtime.NewScheme()
+	_ = scheme.AddToScheme(s)
+	_ = aboutv1alpha1.AddToScheme(s)
+	_ = multiclusterv1alpha1.AddToScheme(s)
+	_ = policyv1alpha1.AddToScheme(s)
+	return fake.NewClientBuilder().WithScheme(s).WithObjects(objects...).Build()
+}
+
+func serviceExportForTest(name string) *multiclusterv1alpha1.ServiceExport {
+	return &multiclusterv1alpha1.ServiceExport{ObjectMeta: metav1.ObjectMeta{Namespace: test.HttpNsName, Name: name}}
+}
+
+func serviceImportForTest(name string, clusterIds ...string) *multiclusterv1alpha1.ServiceImport {
+	svcImport := &multiclusterv1alpha1.ServiceImport{ObjectMeta: metav1.ObjectMeta{Namespace: test.HttpNsName, Name: name}}
+	for _, clusterId := range clusterIds {
+		svcImport.Status.Clusters = append(svcImport.Status.Clusters, multiclusterv1alpha1.ClusterStatus{Cluster: clusterId})
+	}
+	return svcImport
+}
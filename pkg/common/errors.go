@@ -1,27 +1,213 @@
 package common
 
 import (
-	"github.com/pkg/errors"
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/aws/smithy-go"
+	pkgerrors "github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ErrorClass is the class of an error, which determines how callers should handle it.
+type ErrorClass string
+
+const (
+	// ErrorClassNotFound indicates a resource was not found.
+	ErrorClassNotFound ErrorClass = "NotFound"
+
+	// ErrorClassAlreadyExists indicates a resource to create already exists.
+	ErrorClassAlreadyExists ErrorClass = "AlreadyExists"
+
+	// ErrorClassThrottled indicates a request was throttled, and should be retried after a delay.
+	ErrorClassThrottled ErrorClass = "Throttled"
+
+	// ErrorClassTransient indicates a failure likely to succeed when retried.
+	ErrorClassTransient ErrorClass = "Transient"
+
+	// ErrorClassPermanent indicates a failure unlikely to succeed without a change, e.g. invalid input or permissions.
+	ErrorClassPermanent ErrorClass = "Permanent"
+)
+
+// Classes of aggregated errors, ordered from the most to the least severe
+var errorClassSeverity = []ErrorClass{
+	ErrorClassPermanent,
+	ErrorClassThrottled,
+	ErrorClassTransient,
+	ErrorClassAlreadyExists,
+	ErrorClassNotFound,
+}
+
+// Error codes returned by AWS Cloud Map APIs
+var (
+	notFoundErrorCodes = map[string]struct{}{
+		"NamespaceNotFound": {},
+		"ServiceNotFound":   {},
+		"InstanceNotFound":  {},
+		"OperationNotFound": {},
+	}
+	alreadyExistsErrorCodes = map[string]struct{}{
+		"NamespaceAlreadyExists": {},
+		"ServiceAlreadyExists":   {},
+		"DuplicateRequest":       {},
+	}
+	transientErrorCodes = map[string]struct{}{
+		"InternalFailure":         {},
+		"InternalServerError":     {},
+		"ServiceUnavailable":      {},
+		"RequestTimeout":          {},
+		"RequestTimeoutException": {},
+	}
 )
 
 var notFound = errors.New("resource was not found")
 
+// IsNotFound returns true if the error, or every error aggregated in it, indicates a resource was not found.
 func IsNotFound(err error) bool {
-	return errors.Is(err, notFound)
+	return Classify(err) == ErrorClassNotFound
 }
 
 func IsUnknown(err error) bool {
-	return err != nil && !errors.Is(err, notFound)
+	return err != nil && !IsNotFound(err)
 }
 
 func NotFoundError(message string) error {
-	return errors.Wrap(notFound, message)
+	return pkgerrors.Wrap(notFound, message)
 }
 
+// Classify returns the class of an error. Errors aggregated in a MultiError are classified individually, and the
+// most severe class is returned. It returns an empty class for nil errors.
+func Classify(err error) ErrorClass {
+	if err == nil {
+		return ""
+	}
+
+	var multiErr *MultiError
+	if errors.As(err, &multiErr) {
+		return classifyAll(multiErr.Errors())
+	}
+
+	switch {
+	case errors.Is(err, notFound) || hasErrorCode(err, notFoundErrorCodes) || apierrors.IsNotFound(err):
+		return ErrorClassNotFound
+	case hasErrorCode(err, alreadyExistsErrorCodes) || apierrors.IsAlreadyExists(err):
+		return ErrorClassAlreadyExists
+	case IsThrottling(err) || apierrors.IsTooManyRequests(err):
+		return ErrorClassThrottled
+	case isTransient(err):
+		return ErrorClassTransient
+	default:
+		return ErrorClassPermanent
+	}
+}
+
+func classifyAll(errs []error) ErrorClass {
+	classes := make(map[ErrorClass]bool)
+	for _, err := range errs {
+		classes[Classify(err)] = true
+	}
+	for _, class := range errorClassSeverity {
+		if classes[class] {
+			return class
+		}
+	}
+	return ""
+}
+
+func isTransient(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	// errors of this module which are expected to be retried, e.g. operations which did not complete in time
+	var transientErr interface{ Transient() bool }
+	if errors.As(err, &transientErr) && transientErr.Transient() {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		if _, found := transientErrorCodes[apiErr.ErrorCode()]; found || apiErr.ErrorFault() == smithy.FaultServer {
+			return true
+		}
+	}
+
+	var httpErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &httpErr) && httpErr.HTTPStatusCode() >= 500 {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return apierrors.IsConflict(err) || apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) ||
+		apierrors.IsServiceUnavailable(err) || apierrors.IsInternalError(err)
+}
+
+func hasErrorCode(err error, codes map[string]struct{}) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	_, found := codes[apiErr.ErrorCode()]
+	return found
+}
+
+// MultiError aggregates several errors, and preserves each of their chains for errors.Is and errors.As.
+type MultiError struct {
+	errs []error
+}
+
+// Errors returns the aggregated errors.
+func (e *MultiError) Errors() []error {
+	return e.errs
+}
+
+func (e *MultiError) Error() string {
+	messages := make([]string, 0, len(e.errs))
+	for _, err := range e.errs {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Is returns true if any aggregated error matches the target.
+func (e *MultiError) Is(target error) bool {
+	for _, err := range e.errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first aggregated error matching the target, and sets the target to that error.
+func (e *MultiError) As(target interface{}) bool {
+	for _, err := range e.errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unwrap returns the aggregated errors.
+func (e *MultiError) Unwrap() []error {
+	return e.errs
+}
+
+// Wrap aggregates two errors into a MultiError, preserving both chains. Nil errors are skipped, and a single non-nil
+// error is returned as is.
 func Wrap(err1 error, err2 error) error {
 	switch {
 	case err1 != nil && err2 != nil:
-		return errors.Wrap(err1, err2.Error())
+		errs := make([]error, 0, 2)
+		errs = append(errs, flatten(err1)...)
+		return &MultiError{errs: append(errs, flatten(err2)...)}
 	case err1 != nil:
 		return err1
 	case err2 != nil:
@@ -30,3 +216,10 @@ func Wrap(err1 error, err2 error) error {
 		return nil
 	}
 }
+
+func flatten(err error) []error {
+	if multiErr, ok := err.(*MultiError); ok {
+		return multiErr.errs
+	}
+	return []error{err}
+}
@@ -1,8 +1,15 @@
 package common
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"testing"
+
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 func TestIsNotFound(t *testing.T) {
@@ -86,3 +93,123 @@ func TestNotFoundError(t *testing.T) {
 		})
 	}
 }
+
+type transientTestError struct{}
+
+func (transientTestError) Error() string   { return "transient" }
+func (transientTestError) Transient() bool { return true }
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{
+			name: "nil",
+			err:  nil,
+			want: "",
+		},
+		{
+			name: "notFound",
+			err:  NotFoundError("service"),
+			want: ErrorClassNotFound,
+		},
+		{
+			name: "awsNotFound",
+			err:  &smithy.GenericAPIError{Code: "ServiceNotFound"},
+			want: ErrorClassNotFound,
+		},
+		{
+			name: "k8sNotFound",
+			err:  apierrors.NewNotFound(schema.GroupResource{Resource: "services"}, "svc"),
+			want: ErrorClassNotFound,
+		},
+		{
+			name: "awsAlreadyExists",
+			err:  &smithy.GenericAPIError{Code: "NamespaceAlreadyExists"},
+			want: ErrorClassAlreadyExists,
+		},
+		{
+			name: "throttled",
+			err:  fmt.Errorf("failed: %w", &smithy.GenericAPIError{Code: "ThrottlingException"}),
+			want: ErrorClassThrottled,
+		},
+		{
+			name: "serverFault",
+			err:  &smithy.GenericAPIError{Code: "Unknown", Fault: smithy.FaultServer},
+			want: ErrorClassTransient,
+		},
+		{
+			name: "deadlineExceeded",
+			err:  fmt.Errorf("failed: %w", context.DeadlineExceeded),
+			want: ErrorClassTransient,
+		},
+		{
+			name: "transientInterface",
+			err:  fmt.Errorf("failed: %w", transientTestError{}),
+			want: ErrorClassTransient,
+		},
+		{
+			name: "k8sConflict",
+			err:  apierrors.NewConflict(schema.GroupResource{Resource: "services"}, "svc", errors.New("conflict")),
+			want: ErrorClassTransient,
+		},
+		{
+			name: "clientFault",
+			err:  &smithy.GenericAPIError{Code: "InvalidInput", Fault: smithy.FaultClient},
+			want: ErrorClassPermanent,
+		},
+		{
+			name: "unknown",
+			err:  errors.New("test"),
+			want: ErrorClassPermanent,
+		},
+		{
+			name: "aggregatedMostSevere",
+			err:  Wrap(NotFoundError("1"), Wrap(transientTestError{}, &smithy.GenericAPIError{Code: "ThrottlingException"})),
+			want: ErrorClassThrottled,
+		},
+		{
+			name: "aggregatedNotFound",
+			err:  Wrap(NotFoundError("1"), NotFoundError("2")),
+			want: ErrorClassNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Classify(tt.err))
+		})
+	}
+}
+
+func TestIsNotFound_Aggregated(t *testing.T) {
+	err := Wrap(NotFoundError("1"), errors.New("test"))
+	assert.False(t, IsNotFound(err), "aggregated errors are not found only if every error is")
+	assert.True(t, IsUnknown(err))
+}
+
+func TestWrap(t *testing.T) {
+	err1 := errors.New("one")
+	err2 := &smithy.GenericAPIError{Code: "ThrottlingException", Message: "two"}
+	err3 := NotFoundError("three")
+
+	assert.Nil(t, Wrap(nil, nil))
+	assert.Equal(t, err1, Wrap(err1, nil))
+	assert.Equal(t, err1, Wrap(nil, err1))
+
+	err := Wrap(Wrap(err1, err2), err3)
+	var multiErr *MultiError
+	assert.True(t, errors.As(err, &multiErr))
+	assert.Equal(t, []error{err1, err2, err3}, multiErr.Errors(), "aggregated errors are flattened")
+	assert.Contains(t, err.Error(), "one")
+	assert.Contains(t, err.Error(), "two")
+	assert.Contains(t, err.Error(), "three")
+
+	// every chain is preserved
+	assert.True(t, errors.Is(err, err1))
+	assert.True(t, errors.Is(err, notFound))
+	var apiErr smithy.APIError
+	assert.True(t, errors.As(fmt.Errorf("wrapped: %w", err), &apiErr))
+	assert.Equal(t, "ThrottlingException", apiErr.ErrorCode())
+}
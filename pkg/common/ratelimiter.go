@@ -2,48 +2,213 @@ package common
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"sync"
+	"time"
 
+	"github.com/aws/smithy-go"
+	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/time/rate"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
 const (
 	ListNamespaces      Event = "ListNamespaces"
 	ListServices        Event = "ListServices"
 	GetOperation        Event = "GetOperation"
+	ListOperations      Event = "ListOperations"
 	DiscoverInstances   Event = "DiscoverInstances"
+	ListInstances       Event = "ListInstances"
 	CreateHttpNamespace Event = "CreateHttpNamespace"
 	CreateService       Event = "CreateService"
 	RegisterInstance    Event = "RegisterInstance"
 	DeregisterInstance  Event = "DeregisterInstance"
 )
 
+const (
+	// Factor applied to the rate of an API after a throttling response.
+	throttlingDecreaseFactor = 0.5
+
+	// Lowest rate of an API as a fraction of its default rate.
+	minRateFactor = 0.1
+
+	// Rate recovered after each recovery interval without throttling, as a fraction of the default rate.
+	recoveryIncreaseFactor = 0.1
+
+	// Minimum time between two rate increases of an API.
+	recoveryInterval = 1 * time.Second
+
+	// Minimum time between two rate decreases of an API, so a burst of throttled concurrent calls lowers the rate once.
+	throttlingCooldown = 1 * time.Second
+)
+
+// Error codes returned by AWS APIs when requests are throttled
+var throttlingErrorCodes = map[string]struct{}{
+	"ThrottlingException":      {},
+	"Throttling":               {},
+	"RequestLimitExceeded":     {},
+	"TooManyRequestsException": {},
+	"RequestThrottled":         {},
+}
+
+// defaultLimits are the default rates and bursts of the AWS CloudMap's APIs, they are lowered when the APIs are throttled
+// TODO: make it customizable in the future
+var defaultLimits = map[Event]apiLimit{
+	ListNamespaces:      {rate.Limit(0.5), 5},    // 1 ListNamespaces API calls per second
+	ListServices:        {rate.Limit(2), 10},     // 2 ListServices API calls per second
+	GetOperation:        {rate.Limit(100), 200},  // 100 GetOperation API calls per second
+	ListOperations:      {rate.Limit(10), 20},    // 10 ListOperations API calls per second
+	DiscoverInstances:   {rate.Limit(500), 1000}, // 500 DiscoverInstances API calls per second
+	ListInstances:       {rate.Limit(50), 100},   // 50 ListInstances API calls per second
+	CreateHttpNamespace: {rate.Limit(0.5), 5},    // 1 CreateHttpNamespace API calls per second
+	CreateService:       {rate.Limit(5), 50},     // 5 CreateService API calls per second
+	RegisterInstance:    {rate.Limit(50), 100},   // 50 RegisterInstance API calls per second
+	DeregisterInstance:  {rate.Limit(50), 100},   // 50 DeregisterInstance API calls per second
+}
+
+type apiLimit struct {
+	limit rate.Limit
+	burst int
+}
+
+// rateLimitGauge exposes the current effective rate of each AWS Cloud Map API. The gauge is per process: it starts at
+// the default rates and follows the last adjusted limiter of each API, which is the only one when the process runs a
+// single Cloud Map client.
+var rateLimitGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "mcs_controller_cloudmap_api_rate_limit",
+		Help: "Current rate limit of the AWS Cloud Map API calls in requests per second.",
+	},
+	[]string{"api"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(rateLimitGauge)
+	for event, limit := range defaultLimits {
+		rateLimitGauge.WithLabelValues(string(event)).Set(float64(limit.limit))
+	}
+}
+
 type Event string
 
 type RateLimiter struct {
-	rateLimiters map[Event]*rate.Limiter
+	rateLimiters map[Event]*adaptiveLimiter
+}
+
+// adaptiveLimiter adjusts the rate of a token bucket with an additive increase, multiplicative decrease (AIMD)
+// strategy: the rate is halved after a throttling response, and recovers gradually up to the default rate. The burst
+// follows the rate in the same proportion, so a lowered rate cannot be bypassed by a full bucket of tokens.
+type adaptiveLimiter struct {
+	event         Event
+	limiter       *rate.Limiter
+	maxRate       rate.Limit
+	maxBurst      int
+	minRate       rate.Limit
+	lastChanged   time.Time
+	lastDecreased time.Time
+	now           func() time.Time
+	mutex         sync.Mutex
+}
+
+func newAdaptiveLimiter(event Event, limit apiLimit) *adaptiveLimiter {
+	return &adaptiveLimiter{
+		event:    event,
+		limiter:  rate.NewLimiter(limit.limit, limit.burst),
+		maxRate:  limit.limit,
+		maxBurst: limit.burst,
+		minRate:  limit.limit * minRateFactor,
+		now:      time.Now,
+	}
 }
 
 // NewDefaultRateLimiter returns the rate limiters with the default limits for the AWS CloudMap's API calls
 func NewDefaultRateLimiter() RateLimiter {
-	return RateLimiter{rateLimiters: map[Event]*rate.Limiter{
-		// Below are the default limits for the AWS CloudMap's APIs
-		// TODO: make it customizable in the future
-		ListNamespaces:      rate.NewLimiter(rate.Limit(0.5), 5),    // 1 ListNamespaces API calls per second
-		ListServices:        rate.NewLimiter(rate.Limit(2), 10),     // 2 ListServices API calls per second
-		GetOperation:        rate.NewLimiter(rate.Limit(100), 200),  // 100 GetOperation API calls per second
-		DiscoverInstances:   rate.NewLimiter(rate.Limit(500), 1000), // 500 DiscoverInstances API calls per second
-		CreateHttpNamespace: rate.NewLimiter(rate.Limit(0.5), 5),    // 1 CreateHttpNamespace API calls per second
-		CreateService:       rate.NewLimiter(rate.Limit(5), 50),     // 5 CreateService API calls per second
-		RegisterInstance:    rate.NewLimiter(rate.Limit(50), 100),   // 50 RegisterInstance API calls per second
-		DeregisterInstance:  rate.NewLimiter(rate.Limit(50), 100),   // 50 DeregisterInstance API calls per second
-	}}
+	rateLimiters := make(map[Event]*adaptiveLimiter, len(defaultLimits))
+	for event, limit := range defaultLimits {
+		rateLimiters[event] = newAdaptiveLimiter(event, limit)
+	}
+	return RateLimiter{rateLimiters: rateLimiters}
 }
 
 // Wait blocks until limit permits an event to happen. It returns an error if the Context is canceled, or the expected wait time exceeds the Context's Deadline.
 func (r RateLimiter) Wait(ctx context.Context, event Event) error {
 	if limiter, ok := r.rateLimiters[event]; ok {
-		return limiter.Wait(ctx)
+		return limiter.limiter.Wait(ctx)
 	}
 	return fmt.Errorf("event %s not found in the list of limiters", event)
 }
+
+// Observe adjusts the rate of an event from the outcome of the API call: the rate is lowered after a throttling error,
+// and gradually recovers after successful calls. Other errors leave the rate unchanged.
+func (r RateLimiter) Observe(event Event, err error) {
+	if limiter, ok := r.rateLimiters[event]; ok {
+		limiter.observe(err)
+	}
+}
+
+// Rate returns the current effective rate of an event in events per second.
+func (r RateLimiter) Rate(event Event) float64 {
+	if limiter, ok := r.rateLimiters[event]; ok {
+		return float64(limiter.limiter.Limit())
+	}
+	return 0
+}
+
+func (l *adaptiveLimiter) observe(err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	current := l.limiter.Limit()
+	now := l.now()
+
+	var updated rate.Limit
+	switch {
+	case IsThrottling(err):
+		if now.Sub(l.lastDecreased) < throttlingCooldown {
+			return
+		}
+		// throttling also delays the recovery, even when the rate is already at its minimum
+		l.lastDecreased = now
+		l.lastChanged = now
+		updated = current * throttlingDecreaseFactor
+		if updated < l.minRate {
+			updated = l.minRate
+		}
+	case err == nil && current < l.maxRate && now.Sub(l.lastChanged) >= recoveryInterval:
+		updated = current + l.maxRate*recoveryIncreaseFactor
+		if updated > l.maxRate {
+			updated = l.maxRate
+		}
+	default:
+		return
+	}
+
+	if updated == current {
+		return
+	}
+	l.limiter.SetLimit(updated)
+	l.limiter.SetBurst(l.burstFor(updated))
+	l.lastChanged = now
+	rateLimitGauge.WithLabelValues(string(l.event)).Set(float64(updated))
+}
+
+// burstFor scales the default burst to a rate, the default burst is restored with the default rate.
+func (l *adaptiveLimiter) burstFor(limit rate.Limit) int {
+	burst := int(math.Ceil(float64(l.maxBurst) * float64(limit/l.maxRate)))
+	if burst < 1 {
+		return 1
+	}
+	return burst
+}
+
+// IsThrottling returns true if the error is an AWS API error indicating the request was throttled.
+func IsThrottling(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	_, found := throttlingErrorCodes[apiErr.ErrorCode()]
+	return found
+}
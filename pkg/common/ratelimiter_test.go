@@ -2,7 +2,13 @@ package common
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestRateLimiter_Wait(t *testing.T) {
@@ -62,3 +68,79 @@ func ctxCanceled(ctx context.Context) context.Context {
 	defer cancel() // cancel after function call
 	return ret
 }
+
+func TestRateLimiter_Observe(t *testing.T) {
+	r := NewDefaultRateLimiter()
+	now := time.Now()
+	r.rateLimiters[RegisterInstance].now = func() time.Time { return now }
+
+	throttled := &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}
+
+	// throttling halves the rate and the burst
+	r.Observe(RegisterInstance, throttled)
+	assert.Equal(t, 25.0, r.Rate(RegisterInstance))
+	assert.Equal(t, 50, r.rateLimiters[RegisterInstance].limiter.Burst())
+
+	// throttled calls in the same burst do not lower the rate again
+	r.Observe(RegisterInstance, throttled)
+	assert.Equal(t, 25.0, r.Rate(RegisterInstance))
+
+	// other errors leave the rate unchanged
+	now = now.Add(throttlingCooldown)
+	r.Observe(RegisterInstance, errors.New("internal error"))
+	assert.Equal(t, 25.0, r.Rate(RegisterInstance))
+
+	// the rate never drops below the minimum
+	for i := 0; i < 10; i++ {
+		now = now.Add(throttlingCooldown)
+		r.Observe(RegisterInstance, throttled)
+	}
+	assert.Equal(t, 5.0, r.Rate(RegisterInstance))
+	assert.Equal(t, 10, r.rateLimiters[RegisterInstance].limiter.Burst())
+
+	// successful calls recover the rate gradually
+	r.Observe(RegisterInstance, nil)
+	assert.Equal(t, 5.0, r.Rate(RegisterInstance), "no increase within the recovery interval")
+	now = now.Add(recoveryInterval)
+	r.Observe(RegisterInstance, nil)
+	assert.Equal(t, 10.0, r.Rate(RegisterInstance))
+	assert.Equal(t, 20, r.rateLimiters[RegisterInstance].limiter.Burst())
+
+	// up to the default rate and burst
+	for i := 0; i < 20; i++ {
+		now = now.Add(recoveryInterval)
+		r.Observe(RegisterInstance, nil)
+	}
+	assert.Equal(t, 50.0, r.Rate(RegisterInstance))
+	assert.Equal(t, 100, r.rateLimiters[RegisterInstance].limiter.Burst())
+
+	// other limiters are not affected
+	assert.Equal(t, 50.0, r.Rate(DeregisterInstance))
+	assert.Equal(t, 100, r.rateLimiters[DeregisterInstance].limiter.Burst())
+}
+
+func TestRateLimiter_Observe_UnknownEvent(t *testing.T) {
+	r := NewDefaultRateLimiter()
+	r.Observe("test", &smithy.GenericAPIError{Code: "ThrottlingException"})
+	assert.Equal(t, 0.0, r.Rate("test"))
+}
+
+func TestIsThrottling(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "throttling", err: &smithy.GenericAPIError{Code: "ThrottlingException"}, want: true},
+		{name: "request_limit", err: &smithy.GenericAPIError{Code: "RequestLimitExceeded"}, want: true},
+		{name: "wrapped", err: fmt.Errorf("failed: %w", &smithy.GenericAPIError{Code: "ThrottlingException"}), want: true},
+		{name: "other_api_error", err: &smithy.GenericAPIError{Code: "ServiceNotFound"}, want: false},
+		{name: "other_error", err: errors.New("throttling"), want: false},
+		{name: "nil", err: nil, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsThrottling(tt.err))
+		})
+	}
+}
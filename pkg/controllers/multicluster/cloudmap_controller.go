@@ -3,6 +3,8 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	multiclusterv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/multicluster/v1alpha1"
@@ -12,121 +14,341 @@ import (
 	v1 "k8s.io/api/core/v1"
 	discovery "k8s.io/api/discovery/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 const (
 	// TODO move to configuration
 	syncPeriod = 2 * time.Second
+
+	// DefaultCloudMapWorkers is the default number of services reconciled concurrently by the CloudMapReconciler.
+	DefaultCloudMapWorkers = 5
+
+	cloudMapControllerRuntimeName = "cloudmap"
 )
 
-// CloudMapReconciler reconciles state of Cloud Map services with local ServiceImport objects
+// CloudMapReconciler reconciles state of Cloud Map services with local ServiceImport objects. Each service is
+// reconciled individually from a rate-limited work queue, which is fed by a periodic scan of Cloud Map and by changes
+// to the local ServiceImports and derived Services.
 type CloudMapReconciler struct {
 	Client       client.Client
 	Cloudmap     cloudmap.ServiceDiscoveryClient
 	Log          common.Logger
 	ClusterUtils model.ClusterUtils
+	Recorder     record.EventRecorder
+	// DryRun computes and reports the changes to ServiceImports, derived Services and EndpointSlices without applying them
+	DryRun bool
+	// State records the computed changes and errors of each service for the debug endpoint, if set
+	State *ReconcileState
+	// Workers is the number of services reconciled concurrently, DefaultCloudMapWorkers if not set
+	Workers int
+	// ImportMode is the ImportMode of the ServiceImports without an import mode annotation, AllClusters if not set
+	ImportMode ImportMode
+	// services requeued after a delay, which the periodic scan does not enqueue before their delay
+	requeues delayedRequeues
+}
+
+// cloudMapScanner periodically lists the services of Cloud Map and the local ServiceImports, and sends an event for
+// each of them to the CloudMapReconciler.
+type cloudMapScanner struct {
+	reconciler *CloudMapReconciler
+	events     chan<- event.GenericEvent
 }
 
-// +kubebuilder:rbac:groups="",resources=namespaces,verbs=list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=services,verbs=create;get;list;watch;update;delete
 // +kubebuilder:rbac:groups=about.k8s.io,resources=clusterproperties,verbs=create;get;list;watch;update;patch;delete
 // +kubebuilder:rbac:groups="discovery.k8s.io",resources=endpointslices,verbs=list;get;create;watch;update;delete;deletecollection
 // +kubebuilder:rbac:groups=multicluster.x-k8s.io,resources=serviceimports,verbs=create;get;list;watch;update;patch;delete
+// +kubebuilder:rbac:groups=multicluster.x-k8s.io,resources=serviceimports/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=policy.multicluster.k8s.aws,resources=clustersetpolicies,verbs=get;list;watch
+
+// Reconcile reconciles the ServiceImport, derived Services and EndpointSlices of a single Cloud Map service
+func (r *CloudMapReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	result, err := r.reconcile(ctx, req)
+	r.requeues.track(req.NamespacedName, result, err)
+	return result, err
+}
+
+func (r *CloudMapReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	clusterProperties, err := r.ClusterUtils.GetClusterProperties(ctx)
+	if err != nil {
+		r.Log.Error(err, "unable to retrieve ClusterId and ClusterSetId")
+		return ctrl.Result{}, err
+	}
+	r.Log.Debug("syncing service", "namespace", req.Namespace, "name", req.Name,
+		"ClusterId", clusterProperties.ClusterId(), "ClusterSetId", clusterProperties.ClusterSetId())
+
+	svc, err := r.Cloudmap.GetService(ctx, req.Namespace, req.Name)
+	if common.IsUnknown(err) {
+		r.Log.Error(err, "failed to fetch the Cloud Map service", "namespace", req.Namespace, "name", req.Name, "class", common.Classify(err))
+		r.State.recordImportError(req.NamespacedName, err)
+		return requeueResult(r.Log, err)
+	}
+
+	if svc != nil {
+		if svc, err = r.applyPolicy(ctx, clusterProperties.ClusterId(), svc); err != nil {
+			r.Log.Error(err, "error fetching ClusterSetPolicies", "namespace", req.Namespace, "name", req.Name)
+			r.State.recordImportError(req.NamespacedName, err)
+			return requeueResult(r.Log, err)
+		}
+	}
+
+	if svc == nil || len(svc.Endpoints) == 0 {
+		// the service is not exported by any cluster anymore
+		if err = r.deleteServiceImport(ctx, req.NamespacedName); err == nil {
+			r.State.forgetImport(req.NamespacedName)
+		}
+	} else {
+		err = r.reconcileService(ctx, clusterProperties.ClusterId(), svc)
+	}
+	if err != nil {
+		r.Log.Error(err, "error when syncing service", "namespace", req.Namespace, "name", req.Name, "class", common.Classify(err))
+	}
+	r.State.recordImportError(req.NamespacedName, err)
+
+	return requeueResult(r.Log, err)
+}
+
+// applyPolicy returns the Cloud Map service with the endpoints of the clusters ClusterSetPolicies allow to export it,
+// or nil if this cluster is not allowed to import it.
+func (r *CloudMapReconciler) applyPolicy(ctx context.Context, clusterId string, svc *model.Service) (*model.Service, error) {
+	policy, err := GetServicePolicy(ctx, r.Client, types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name})
+	if err != nil {
+		return nil, err
+	}
+	if !policy.AllowsImport(clusterId) {
+		r.Log.Debug("import not allowed by ClusterSetPolicies", "namespace", svc.Namespace, "name", svc.Name, "clusterId", clusterId)
+		return nil, nil
+	}
+	return &model.Service{
+		Namespace: svc.Namespace,
+		Name:      svc.Name,
+		Endpoints: policy.ExportedEndpoints(svc.Endpoints),
+	}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager, along with the periodic scan of Cloud Map.
+func (r *CloudMapReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Recorder == nil {
+		r.Recorder = noopEventRecorder{}
+	}
+	scanEvents := make(chan event.GenericEvent)
+	if err := mgr.Add(&cloudMapScanner{reconciler: r, events: scanEvents}); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(cloudMapControllerRuntimeName).
+		// Reconcile the service of a ServiceImport when the ServiceImport changes
+		For(&multiclusterv1alpha1.ServiceImport{}).
+		// Reconcile the service of a derived Service when the derived Service changes
+		Watches(
+			&source.Kind{Type: &v1.Service{}},
+			handler.EnqueueRequestsFromMapFunc(derivedServiceMappingFunction()),
+		).
+		// Reconcile the services found by the periodic scan of Cloud Map
+		Watches(
+			&source.Channel{Source: scanEvents},
+			r.scanEventHandler(),
+		).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.workers(),
+			// rate-limiting is applied to reconcile responses with an error, for each service
+			RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(500*time.Millisecond, 1000*time.Second),
+		}).
+		Complete(r)
+}
+
+func derivedServiceMappingFunction() handler.MapFunc {
+	return func(object client.Object) []reconcile.Request {
+		serviceName, ok := object.GetLabels()[LabelDerivedServiceOriginatingName]
+		if !ok || serviceName == "" {
+			return nil
+		}
+		return []reconcile.Request{
+			{NamespacedName: types.NamespacedName{
+				Name:      serviceName,
+				Namespace: object.GetNamespace(),
+			}},
+		}
+	}
+}
+
+// scanEventHandler enqueues the services found by the periodic scan, except the services waiting to be retried after
+// a failure or a delay so the scan does not bypass their backoff.
+func (r *CloudMapReconciler) scanEventHandler() handler.EventHandler {
+	return handler.Funcs{
+		GenericFunc: func(evt event.GenericEvent, queue workqueue.RateLimitingInterface) {
+			req := reconcile.Request{NamespacedName: types.NamespacedName{
+				Name:      evt.Object.GetName(),
+				Namespace: evt.Object.GetNamespace(),
+			}}
+			if queue.NumRequeues(req) > 0 || r.requeues.pending(req.NamespacedName) {
+				return
+			}
+			queue.Add(req)
+		},
+	}
+}
 
 // Start implements manager.Runnable
-func (r *CloudMapReconciler) Start(ctx context.Context) error {
-	ticker := time.NewTicker(syncPeriod)
-	defer ticker.Stop()
+func (s *cloudMapScanner) Start(ctx context.Context) error {
 	for {
-		if err := r.Reconcile(ctx); err != nil {
+		services, err := s.reconciler.listServices(ctx)
+		if err != nil {
 			// just log the error and continue running
-			r.Log.Error(err, "Cloud Map reconciliation error")
+			s.reconciler.Log.Error(err, "Cloud Map scan error", "class", common.Classify(err))
+		}
+		for _, svc := range services {
+			evt := event.GenericEvent{Object: &multiclusterv1alpha1.ServiceImport{
+				ObjectMeta: metav1.ObjectMeta{Namespace: svc.Namespace, Name: svc.Name},
+			}}
+			select {
+			case s.events <- evt:
+			case <-ctx.Done():
+				return nil
+			}
 		}
+
 		select {
-		case <-ticker.C:
+		// wait longer before the next scan when Cloud Map requests are throttled
+		case <-time.After(syncDelay(err, syncPeriod)):
 		case <-ctx.Done():
-			r.Log.Info("terminating CloudMapReconciler")
+			s.reconciler.Log.Info("terminating Cloud Map scan")
 			return nil
 		}
 	}
 }
 
-// Reconcile triggers a single reconciliation round
-func (r *CloudMapReconciler) Reconcile(ctx context.Context) (err error) {
-	clusterProperties, err := r.ClusterUtils.GetClusterProperties(ctx)
-	if err != nil {
+// listServices returns the services to reconcile: the services registered in Cloud Map, and the services of the
+// existing ServiceImports, which are deleted when the service is not exported anymore. Only the service names are
+// listed, their endpoints are fetched when the services are reconciled. Namespaces are listed concurrently, services of
+// namespaces which fail to be listed are skipped, and their errors are returned together.
+func (r *CloudMapReconciler) listServices(ctx context.Context) (services []types.NamespacedName, err error) {
+	if _, err = r.ClusterUtils.GetClusterProperties(ctx); err != nil {
 		r.Log.Error(err, "unable to retrieve ClusterId and ClusterSetId")
-		return err
+		return nil, err
 	}
-	r.Log.Debug("clusterProperties found", "ClusterId", clusterProperties.ClusterId(), "ClusterSetId", clusterProperties.ClusterSetId())
 
 	namespaces := v1.NamespaceList{}
 	if err = r.Client.List(ctx, &namespaces); err != nil {
 		r.Log.Error(err, "unable to list cluster namespaces")
-		return err
+		return nil, err
 	}
 
-	for _, ns := range namespaces.Items {
-		reconErr := r.reconcileNamespace(ctx, ns.Name)
-		if reconErr != nil {
-			err = common.Wrap(err, reconErr)
+	found := make(map[types.NamespacedName]bool)
+	for _, res := range r.listServiceNames(ctx, namespaces.Items) {
+		if res.err != nil {
+			r.Log.Error(res.err, "failed to fetch the list Services", "namespace", res.namespace)
+			err = common.Wrap(err, res.err)
+			continue
+		}
+		for _, svcName := range res.svcNames {
+			found[types.NamespacedName{Namespace: res.namespace, Name: svcName}] = true
 		}
 	}
 
-	return err
+	serviceImports := multiclusterv1alpha1.ServiceImportList{}
+	if listErr := r.Client.List(ctx, &serviceImports); listErr != nil {
+		r.Log.Error(listErr, "failed to list ServiceImports")
+		err = common.Wrap(err, listErr)
+	}
+	for _, svcImport := range serviceImports.Items {
+		found[types.NamespacedName{Namespace: svcImport.Namespace, Name: svcImport.Name}] = true
+	}
+
+	services = make([]types.NamespacedName, 0, len(found))
+	for name := range found {
+		services = append(services, name)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].String() < services[j].String()
+	})
+	return services, err
 }
 
-func (r *CloudMapReconciler) reconcileNamespace(ctx context.Context, namespaceName string) (err error) {
-	r.Log.Debug("syncing namespace", "namespace", namespaceName)
+type serviceNamesResult struct {
+	namespace string
+	svcNames  []string
+	err       error
+}
 
-	desiredServices, err := r.Cloudmap.ListServices(ctx, namespaceName)
-	if err != nil {
-		r.Log.Error(err, "failed to fetch the list Services")
-		return err
+// listServiceNames lists the names of the Cloud Map services of each namespace, with as many namespaces listed
+// concurrently as services are reconciled.
+func (r *CloudMapReconciler) listServiceNames(ctx context.Context, namespaces []v1.Namespace) []serviceNamesResult {
+	nsChan := make(chan string, len(namespaces))
+	for _, ns := range namespaces {
+		nsChan <- ns.Name
 	}
+	close(nsChan)
 
-	serviceImports := multiclusterv1alpha1.ServiceImportList{}
-	if err = r.Client.List(ctx, &serviceImports, client.InNamespace(namespaceName)); err != nil {
-		r.Log.Error(err, "failed to reconcile namespace", "namespace", namespaceName)
-		return err
+	resultChan := make(chan serviceNamesResult, len(namespaces))
+	workers := r.workers()
+	if workers > len(namespaces) {
+		workers = len(namespaces)
 	}
 
-	existingImportsMap := make(map[string]multiclusterv1alpha1.ServiceImport)
-	for _, svc := range serviceImports.Items {
-		existingImportsMap[svc.Name] = svc
+	var waitGroup sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for nsName := range nsChan {
+				r.Log.Debug("scanning namespace", "namespace", nsName)
+				svcNames, err := r.Cloudmap.ListServiceNames(ctx, nsName)
+				resultChan <- serviceNamesResult{namespace: nsName, svcNames: svcNames, err: err}
+			}
+		}()
 	}
+	waitGroup.Wait()
+	close(resultChan)
 
-	for _, svc := range desiredServices {
-		if len(svc.Endpoints) == 0 {
-			// skip empty services
-			continue
-		}
+	results := make([]serviceNamesResult, 0, len(namespaces))
+	for res := range resultChan {
+		results = append(results, res)
+	}
+	return results
+}
 
-		if reconErr := r.reconcileService(ctx, svc); reconErr != nil {
-			r.Log.Error(reconErr, "error when syncing service", "namespace", svc.Namespace, "name", svc.Name)
-			err = common.Wrap(err, reconErr)
-		}
-		delete(existingImportsMap, svc.Name)
+// workers returns the number of services reconciled concurrently.
+func (r *CloudMapReconciler) workers() int {
+	if r.Workers <= 0 {
+		return DefaultCloudMapWorkers
 	}
+	return r.Workers
+}
 
-	// delete remaining imports that have not been matched
-	for _, i := range existingImportsMap {
-		r.Log.Info("delete ServiceImport", "namespace", i.Namespace, "name", i.Name)
-		if deleteErr := r.Client.Delete(ctx, &i); deleteErr != nil {
-			r.Log.Error(deleteErr, "error deleting ServiceImport", "namespace", i.Namespace, "name", i.Name)
-			err = common.Wrap(err, deleteErr)
-			continue
-		}
+// deleteServiceImport deletes the ServiceImport of a service without exported endpoints, if it exists. Its derived
+// Services are garbage collected with it.
+func (r *CloudMapReconciler) deleteServiceImport(ctx context.Context, name types.NamespacedName) error {
+	svcImport, err := r.getServiceImport(ctx, name.Namespace, name.Name)
+	if err != nil {
+		return client.IgnoreNotFound(err)
 	}
 
-	return err
+	recordPlannedChanges(cloudMapControllerName, resourceServiceImport, actionDelete, 1, r.DryRun)
+	if r.DryRun {
+		r.Log.Info("dry-run: would delete ServiceImport", "namespace", svcImport.Namespace, "name", svcImport.Name)
+		recordDryRunEvent(r.Recorder, svcImport, "would delete ServiceImport without exported endpoints")
+		return nil
+	}
+	r.Log.Info("delete ServiceImport", "namespace", svcImport.Namespace, "name", svcImport.Name)
+	return client.IgnoreNotFound(r.Client.Delete(ctx, svcImport))
 }
 
-func (r *CloudMapReconciler) reconcileService(ctx context.Context, svc *model.Service) error {
-	r.Log.Debug("syncing service", "namespace", svc.Namespace, "service", svc.Name)
-
+func (r *CloudMapReconciler) reconcileService(ctx context.Context, localClusterId string, svc *model.Service) error {
 	importedSvcPorts := ExtractServicePorts(svc.Endpoints)
 
 	clusterIdToEndpointsMap := make(map[string][]*model.Endpoint)
@@ -138,7 +360,9 @@ func (r *CloudMapReconciler) reconcileService(ctx context.Context, svc *model.Se
 	for clusterId := range clusterIdToEndpointsMap {
 		clusterIds = append(clusterIds, clusterId)
 	}
+	sort.Strings(clusterIds)
 
+	svcImportCreated := false
 	svcImport, err := r.getServiceImport(ctx, svc.Namespace, svc.Name)
 	if err != nil {
 		if !errors.IsNotFound(err) {
@@ -149,13 +373,24 @@ func (r *CloudMapReconciler) reconcileService(ctx context.Context, svc *model.Se
 		if svcImport, err = r.createAndGetServiceImport(ctx, svc, importedSvcPorts, clusterIds); err != nil {
 			return err
 		}
+		svcImportCreated = true
+	}
+
+	// only the endpoints of the clusters receiving traffic according to the import mode, and their weights and
+	// priorities, are ready
+	var traffic *TrafficDistribution
+	if r.checkImportMode(svcImport) == LocalFirstImportMode {
+		traffic = DistributeTrafficLocalFirst(clusterIdToEndpointsMap, svcImport.Spec.Type, localClusterId)
+	} else {
+		traffic = DistributeTraffic(clusterIdToEndpointsMap, svcImport.Spec.Type)
 	}
 
 	// get or create derived Service for each cluster the service is a member of
 	derivedServices := make([]*v1.Service, 0, len(clusterIds))
 	for _, clusterId := range clusterIds {
-		endpoints := clusterIdToEndpointsMap[clusterId]
+		endpoints := traffic.Endpoints[clusterId]
 		clusterImportedSvcPorts := ExtractServicePorts(endpoints)
+		externalName := DerivedServiceExternalName(endpoints)
 
 		derivedService, err := r.getDerivedService(ctx, svc.Namespace, svc.Name, clusterId)
 		if err != nil {
@@ -164,13 +399,16 @@ func (r *CloudMapReconciler) reconcileService(ctx context.Context, svc *model.Se
 			}
 
 			// create derived Service if it doesn't exist
-			if derivedService, err = r.createAndGetDerivedService(ctx, svcImport, clusterId, clusterImportedSvcPorts); err != nil {
+			if derivedService, err = r.createAndGetDerivedService(ctx, svcImport, clusterId, clusterImportedSvcPorts, externalName); err != nil {
 				return err
 			}
+			if !svcImportCreated && !r.DryRun {
+				r.Recorder.Eventf(svcImport, v1.EventTypeNormal, ClusterJoinedEventReason, "cluster %s joined the service", clusterId)
+			}
 		}
 
-		// update derived Service ports to match imported ports if necessary
-		if err = r.updateDerivedService(ctx, derivedService, clusterImportedSvcPorts); err != nil {
+		// update derived Service ports and external name to match imported endpoints if necessary
+		if err = r.updateDerivedService(ctx, svcImport, derivedService, clusterImportedSvcPorts, externalName); err != nil {
 			return err
 		}
 
@@ -179,7 +417,10 @@ func (r *CloudMapReconciler) reconcileService(ctx context.Context, svc *model.Se
 			return err
 		}
 
-		derivedServices = append(derivedServices, derivedService)
+		// the ServiceImport IPs are those of the derived Services of the clusters receiving traffic
+		if traffic.Serving[clusterId] {
+			derivedServices = append(derivedServices, derivedService)
+		}
 	}
 
 	// remove any existing derived services that do not have any endpoints in cloud map
@@ -195,11 +436,31 @@ func (r *CloudMapReconciler) reconcileService(ctx context.Context, svc *model.Se
 			if err := r.DeleteDerivedServiceAndEndpointSlices(ctx, &derivedService); err != nil {
 				return err
 			}
+			if !r.DryRun {
+				r.Recorder.Eventf(svcImport, v1.EventTypeNormal, ClusterLeftEventReason, "cluster %s left the service", clusterId)
+			}
 		}
 	}
 
-	// update service import to match derived service clusterIPs and imported ports if necessary
-	return r.updateServiceImport(ctx, svcImport, derivedServices, importedSvcPorts)
+	// update service import to match derived service clusterIPs, imported ports and clusters if necessary
+	if err = r.updateServiceImport(ctx, svcImport, derivedServices, importedSvcPorts, clusterIds); err != nil {
+		return err
+	}
+
+	return r.updateServiceImportStatus(ctx, svcImport, clusterIds)
+}
+
+// checkImportMode returns the ImportMode of a ServiceImport, and records a warning event when its import mode
+// annotation is invalid.
+func (r *CloudMapReconciler) checkImportMode(svcImport *multiclusterv1alpha1.ServiceImport) ImportMode {
+	mode, valid := ServiceImportMode(svcImport, r.ImportMode)
+	if !valid {
+		value := svcImport.Annotations[ImportModeAnnotation]
+		r.Log.Info("invalid import mode", "namespace", svcImport.Namespace, "name", svcImport.Name, "importMode", value)
+		r.Recorder.Eventf(svcImport, v1.EventTypeWarning, InvalidImportModeEventReason,
+			"invalid import mode %q, expected %s or %s: using %s", value, AllClustersImportMode, LocalFirstImportMode, mode)
+	}
+	return mode
 }
 
 func (r *CloudMapReconciler) getServiceImport(ctx context.Context, namespace string, name string) (*multiclusterv1alpha1.ServiceImport, error) {
@@ -210,12 +471,22 @@ func (r *CloudMapReconciler) getServiceImport(ctx context.Context, namespace str
 
 func (r *CloudMapReconciler) createAndGetServiceImport(ctx context.Context, svc *model.Service, servicePorts []*model.Port, clusterIds []string) (*multiclusterv1alpha1.ServiceImport, error) {
 	toCreate := CreateServiceImportStruct(svc, clusterIds, servicePorts)
+	recordPlannedChanges(cloudMapControllerName, resourceServiceImport, actionCreate, 1, r.DryRun)
+	if r.DryRun {
+		r.Log.Info("dry-run: would create ServiceImport", "namespace", svc.Namespace, "name", svc.Name)
+		return toCreate, nil
+	}
 	if err := r.Client.Create(ctx, toCreate); err != nil {
 		return nil, err
 	}
 	r.Log.Info("created ServiceImport", "namespace", svc.Namespace, "name", svc.Name)
 
-	return r.getServiceImport(ctx, svc.Namespace, svc.Name)
+	svcImport, err := r.getServiceImport(ctx, svc.Namespace, svc.Name)
+	if err != nil {
+		return nil, err
+	}
+	r.Recorder.Eventf(svcImport, v1.EventTypeNormal, ServiceImportCreatedEventReason, "created ServiceImport for clusters %v", clusterIds)
+	return svcImport, nil
 }
 
 func (r *CloudMapReconciler) getDerivedService(ctx context.Context, namespace string, name string, clusterId string) (*v1.Service, error) {
@@ -225,12 +496,20 @@ func (r *CloudMapReconciler) getDerivedService(ctx context.Context, namespace st
 	return existingService, err
 }
 
-func (r *CloudMapReconciler) createAndGetDerivedService(ctx context.Context, svcImport *multiclusterv1alpha1.ServiceImport, clusterId string, svcPorts []*model.Port) (*v1.Service, error) {
+func (r *CloudMapReconciler) createAndGetDerivedService(ctx context.Context, svcImport *multiclusterv1alpha1.ServiceImport, clusterId string, svcPorts []*model.Port, externalName string) (*v1.Service, error) {
 	toCreate := CreateDerivedServiceStruct(svcImport, svcPorts, clusterId)
+	UpdateDerivedServiceExternalName(toCreate, svcImport, externalName)
+	recordPlannedChanges(cloudMapControllerName, resourceDerivedService, actionCreate, 1, r.DryRun)
+	if r.DryRun {
+		r.Log.Info("dry-run: would create derived Service", "namespace", toCreate.Namespace, "name", toCreate.Name)
+		recordDryRunEvent(r.Recorder, svcImport, "would create derived Service %s for cluster %s", toCreate.Name, clusterId)
+		return toCreate, nil
+	}
 	if err := r.Client.Create(ctx, toCreate); err != nil {
 		return nil, err
 	}
 	r.Log.Info("created derived Service", "namespace", toCreate.Namespace, "name", toCreate.Name)
+	r.Recorder.Eventf(svcImport, v1.EventTypeNormal, DerivedServiceCreatedEventReason, "created derived Service %s for cluster %s", toCreate.Name, clusterId)
 
 	return r.getDerivedService(ctx, svcImport.Namespace, svcImport.Name, clusterId)
 }
@@ -256,6 +535,21 @@ func (r *CloudMapReconciler) updateEndpointSlices(ctx context.Context, svcImport
 	}
 
 	changes := plan.CalculateChanges()
+	r.State.recordImportChanges(types.NamespacedName{Namespace: svcImport.Namespace, Name: svcImport.Name}, clusterId, changes)
+
+	recordPlannedChanges(cloudMapControllerName, resourceEndpointSlice, actionUpdate, len(changes.Update), r.DryRun)
+	recordPlannedChanges(cloudMapControllerName, resourceEndpointSlice, actionDelete, len(changes.Delete), r.DryRun)
+	recordPlannedChanges(cloudMapControllerName, resourceEndpointSlice, actionCreate, len(changes.Create), r.DryRun)
+
+	if r.DryRun {
+		if len(changes.Update)+len(changes.Delete)+len(changes.Create) > 0 {
+			r.Log.Info("dry-run: computed EndpointSlice changes", "namespace", svc.Namespace, "service", svc.Name,
+				"update", len(changes.Update), "delete", len(changes.Delete), "create", len(changes.Create))
+			recordDryRunEvent(r.Recorder, svcImport, "would update %d, delete %d and create %d EndpointSlices for cluster %s",
+				len(changes.Update), len(changes.Delete), len(changes.Create), clusterId)
+		}
+		return nil
+	}
 
 	for _, sliceToUpdate := range changes.Update {
 		r.Log.Debug("updating EndpointSlice", "namespace", sliceToUpdate.Namespace, "name", sliceToUpdate.Name)
@@ -281,9 +575,19 @@ func (r *CloudMapReconciler) updateEndpointSlices(ctx context.Context, svcImport
 	return nil
 }
 
-func (r *CloudMapReconciler) updateServiceImport(ctx context.Context, svcImport *multiclusterv1alpha1.ServiceImport, derivedServices []*v1.Service, importedSvcPorts []*model.Port) error {
+func (r *CloudMapReconciler) updateServiceImport(ctx context.Context, svcImport *multiclusterv1alpha1.ServiceImport, derivedServices []*v1.Service, importedSvcPorts []*model.Port, clusterIds []string) error {
 	updateRequired := false
 
+	derivedServiceAnnotation := CreateDerivedServiceAnnotation(svcImport.Namespace, svcImport.Name, clusterIds)
+	if svcImport.Annotations[DerivedServiceAnnotation] != derivedServiceAnnotation {
+		r.Log.Debug("ServiceImport derived service annotation needs update", "annotation", svcImport.Annotations[DerivedServiceAnnotation], "clusters", clusterIds)
+		if svcImport.Annotations == nil {
+			svcImport.Annotations = make(map[string]string)
+		}
+		svcImport.Annotations[DerivedServiceAnnotation] = derivedServiceAnnotation
+		updateRequired = true
+	}
+
 	clusterIPs := GetClusterIpsFromServices(derivedServices)
 	if !IPsEqualIgnoreOrder(svcImport.Spec.IPs, clusterIPs) {
 		r.Log.Info("ServiceImport IPs need update", "ServiceImport IPs", svcImport.Spec.IPs, "cluster IPs", clusterIPs)
@@ -307,7 +611,8 @@ func (r *CloudMapReconciler) updateServiceImport(ctx context.Context, svcImport
 		svcImportPorts = append(svcImportPorts, &port)
 	}
 
-	if !PortsEqualIgnoreOrder(svcImportPorts, simplifiedSvcPorts) {
+	portsChanged := !PortsEqualIgnoreOrder(svcImportPorts, simplifiedSvcPorts)
+	if portsChanged {
 		r.Log.Debug("ServiceImport ports need update", "ServiceImport Ports", svcImport.Spec.Ports, "imported ports", importedSvcPorts)
 		serviceImportPorts := make([]multiclusterv1alpha1.ServicePort, 0)
 		for _, port := range importedSvcPorts {
@@ -318,18 +623,53 @@ func (r *CloudMapReconciler) updateServiceImport(ctx context.Context, svcImport
 	}
 
 	if updateRequired {
+		recordPlannedChanges(cloudMapControllerName, resourceServiceImport, actionUpdate, 1, r.DryRun)
+		if r.DryRun {
+			r.Log.Info("dry-run: would update ServiceImport",
+				"namespace", svcImport.Namespace, "name", svcImport.Name,
+				"IP", svcImport.Spec.IPs, "ports", svcImport.Spec.Ports)
+			recordDryRunEvent(r.Recorder, svcImport, "would update ServiceImport IPs to %v and ports to %v", svcImport.Spec.IPs, svcImport.Spec.Ports)
+			return nil
+		}
 		if err := r.Client.Update(ctx, svcImport); err != nil {
 			return err
 		}
 		r.Log.Info("updated ServiceImport",
 			"namespace", svcImport.Namespace, "name", svcImport.Name,
 			"IP", svcImport.Spec.IPs, "ports", svcImport.Spec.Ports)
+		if portsChanged {
+			r.Recorder.Eventf(svcImport, v1.EventTypeNormal, PortsChangedEventReason, "ports changed to %s", formatServiceImportPorts(svcImport.Spec.Ports))
+		}
+	}
+
+	return nil
+}
+
+func (r *CloudMapReconciler) updateServiceImportStatus(ctx context.Context, svcImport *multiclusterv1alpha1.ServiceImport, clusterIds []string) error {
+	clusters := CreateServiceImportClusterStatus(clusterIds)
+	if ClustersEqualIgnoreOrder(svcImport.Status.Clusters, clusters) {
+		return nil
+	}
+
+	recordPlannedChanges(cloudMapControllerName, resourceServiceImport, actionUpdate, 1, r.DryRun)
+	if r.DryRun {
+		r.Log.Info("dry-run: would update ServiceImport status",
+			"namespace", svcImport.Namespace, "name", svcImport.Name, "clusters", clusterIds)
+		recordDryRunEvent(r.Recorder, svcImport, "would update ServiceImport clusters to %v", clusterIds)
+		return nil
+	}
+
+	svcImport.Status.Clusters = clusters
+	if err := r.Client.Status().Update(ctx, svcImport); err != nil {
+		return err
 	}
+	r.Log.Info("updated ServiceImport status",
+		"namespace", svcImport.Namespace, "name", svcImport.Name, "clusters", clusterIds)
 
 	return nil
 }
 
-func (r *CloudMapReconciler) updateDerivedService(ctx context.Context, svc *v1.Service, importedSvcPorts []*model.Port) error {
+func (r *CloudMapReconciler) updateDerivedService(ctx context.Context, svcImport *multiclusterv1alpha1.ServiceImport, svc *v1.Service, importedSvcPorts []*model.Port, externalName string) error {
 	svcPorts := make([]*model.Port, 0)
 	for _, p := range svc.Spec.Ports {
 		port := ServicePortToPort(p)
@@ -342,19 +682,36 @@ func (r *CloudMapReconciler) updateDerivedService(ctx context.Context, svc *v1.S
 		for _, importPort := range importedSvcPorts {
 			newSvcPorts = append(newSvcPorts, PortToServicePort(*importPort))
 		}
-
 		svc.Spec.Ports = newSvcPorts
+	}
+	externalNameChanged := UpdateDerivedServiceExternalName(svc, svcImport, externalName)
+
+	if !portsMatch || externalNameChanged {
+		recordPlannedChanges(cloudMapControllerName, resourceDerivedService, actionUpdate, 1, r.DryRun)
+		if r.DryRun {
+			r.Log.Info("dry-run: would update derived Service",
+				"namespace", svc.Namespace, "name", svc.Name, "ports", svc.Spec.Ports, "externalName", svc.Spec.ExternalName)
+			return nil
+		}
 		if err := r.Client.Update(ctx, svc); err != nil {
 			return err
 		}
 		r.Log.Info("updated derived Service",
-			"namespace", svc.Namespace, "name", svc.Name, "ports", svc.Spec.Ports)
+			"namespace", svc.Namespace, "name", svc.Name, "ports", svc.Spec.Ports, "externalName", svc.Spec.ExternalName)
+		if !portsMatch {
+			r.Recorder.Eventf(svc, v1.EventTypeNormal, PortsChangedEventReason, "ports changed to %s", formatServicePorts(svc.Spec.Ports))
+		}
 	}
 
 	return nil
 }
 
 func (r *CloudMapReconciler) DeleteDerivedServiceAndEndpointSlices(ctx context.Context, derivedService *v1.Service) error {
+	recordPlannedChanges(cloudMapControllerName, resourceDerivedService, actionDelete, 1, r.DryRun)
+	if r.DryRun {
+		r.Log.Info("dry-run: would delete derived Service and its EndpointSlices", "namespace", derivedService.Namespace, "name", derivedService.Name)
+		return nil
+	}
 	// delete EndpointSlices
 	if err := r.Client.DeleteAllOf(ctx, &discovery.EndpointSlice{}, client.InNamespace(derivedService.Namespace), client.MatchingLabels{discovery.LabelServiceName: derivedService.Name}); err != nil {
 		return err
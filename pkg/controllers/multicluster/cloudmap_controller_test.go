@@ -2,26 +2,35 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"testing"
+	"time"
 
 	aboutv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/about/v1alpha1"
 	"k8s.io/apimachinery/pkg/runtime"
 
 	cloudmapMock "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/mocks/pkg/cloudmap"
 	multiclusterv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/multicluster/v1alpha1"
+	policyv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/policy/v1alpha1"
 	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/common"
 	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
 	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/test"
+	"github.com/aws/smithy-go"
 	"github.com/go-logr/logr/testr"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/core/v1"
 	discovery "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 func TestCloudMapReconciler_Reconcile(t *testing.T) {
@@ -37,12 +46,19 @@ func TestCloudMapReconciler_Reconcile(t *testing.T) {
 
 	mockSDClient := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
 	// The service model in the Cloudmap
-	mockSDClient.EXPECT().ListServices(context.TODO(), test.HttpNsName).
-		Return([]*model.Service{test.GetTestServiceWithEndpoint([]*model.Endpoint{test.GetTestEndpoint1()})}, nil)
+	mockSDClient.EXPECT().GetService(context.TODO(), test.HttpNsName, test.SvcName).
+		Return(test.GetTestServiceWithEndpoint([]*model.Endpoint{test.GetTestEndpoint1()}), nil)
+	// The service of svcImportToBeDeleted is not in the Cloudmap anymore
+	mockSDClient.EXPECT().GetService(context.TODO(), test.HttpNsName, svcImportToBeDeleted.Name).
+		Return(nil, common.NotFoundError("service: svc1"))
 
 	reconciler := getReconciler(t, mockSDClient, fakeClient)
 
-	err := reconciler.Reconcile(context.TODO())
+	_, err := reconciler.Reconcile(context.TODO(), serviceRequest(test.SvcName))
+	if err != nil {
+		t.Fatalf("reconcile failed: (%v)", err)
+	}
+	_, err = reconciler.Reconcile(context.TODO(), serviceRequest(svcImportToBeDeleted.Name))
 	if err != nil {
 		t.Fatalf("reconcile failed: (%v)", err)
 	}
@@ -86,13 +102,13 @@ func TestCloudMapReconciler_Reconcile_MulticlusterService(t *testing.T) {
 
 	mockSDClient := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
 	// The service model in the Cloudmap.
-	mockSDClient.EXPECT().ListServices(context.TODO(), test.HttpNsName).
+	mockSDClient.EXPECT().GetService(context.TODO(), test.HttpNsName, test.SvcName).
 		// The multicluster service has endpoints in different clusters (different ClusterIds)
-		Return([]*model.Service{test.GetTestMulticlusterService()}, nil)
+		Return(test.GetTestMulticlusterService(), nil)
 
 	reconciler := getReconciler(t, mockSDClient, fakeClient)
 
-	err := reconciler.Reconcile(context.TODO())
+	_, err := reconciler.Reconcile(context.TODO(), serviceRequest(test.SvcName))
 	if err != nil {
 		t.Fatalf("reconcile failed: (%v)", err)
 	}
@@ -142,10 +158,426 @@ func TestCloudMapReconciler_Reconcile_MulticlusterService(t *testing.T) {
 	assertEndpointSlice(t, &endpointSlice2, test.Port2, test.EndptIp2, test.ClusterId2)
 }
 
+func TestCloudMapReconciler_Reconcile_ExternalName(t *testing.T) {
+	fakeClient := fake.NewClientBuilder().WithScheme(getCloudMapReconcilerScheme()).
+		WithObjects(k8sNamespaceForTest(), test.ClusterIdForTest(), test.ClusterSetIdForTest()).Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	// cluster 1 exports the hostname of its load balancer
+	endpoint := test.GetTestEndpoint1()
+	endpoint.IP = "lb.example.com"
+	endpoint.AddressType = discovery.AddressTypeFQDN
+	mockSDClient := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mockSDClient.EXPECT().GetService(context.TODO(), test.HttpNsName, test.SvcName).
+		Return(test.GetTestServiceWithEndpoint([]*model.Endpoint{endpoint}), nil)
+
+	reconciler := getReconciler(t, mockSDClient, fakeClient)
+
+	_, err := reconciler.Reconcile(context.TODO(), serviceRequest(test.SvcName))
+	assert.NoError(t, err)
+
+	derivedService := &v1.Service{}
+	err = fakeClient.Get(context.TODO(), types.NamespacedName{Namespace: test.HttpNsName,
+		Name: DerivedName(test.HttpNsName, test.SvcName, test.ClusterId1)}, derivedService)
+	assert.NoError(t, err)
+	assert.Equal(t, v1.ServiceTypeExternalName, derivedService.Spec.Type)
+	assert.Equal(t, "lb.example.com", derivedService.Spec.ExternalName)
+
+	endpointSliceList := &discovery.EndpointSliceList{}
+	err = fakeClient.List(context.TODO(), endpointSliceList, client.InNamespace(test.HttpNsName))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(endpointSliceList.Items))
+	assert.Equal(t, discovery.AddressTypeFQDN, endpointSliceList.Items[0].AddressType)
+	assert.Equal(t, []string{"lb.example.com"}, endpointSliceList.Items[0].Endpoints[0].Addresses)
+
+	svcImport := &multiclusterv1alpha1.ServiceImport{}
+	err = fakeClient.Get(context.TODO(), types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName}, svcImport)
+	assert.NoError(t, err)
+	assert.Empty(t, svcImport.Spec.IPs)
+}
+
+func TestCloudMapReconciler_Reconcile_ClusterSetPolicy(t *testing.T) {
+	// only cluster 1 is allowed to export the service
+	policy := clusterSetPolicyForTest()
+	policy.Spec.ExportClusters = []string{test.ClusterId1}
+	fakeClient := fake.NewClientBuilder().WithScheme(getCloudMapReconcilerScheme()).
+		WithObjects(k8sNamespaceForTest(), policy, test.ClusterIdForTest(), test.ClusterSetIdForTest()).Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	mockSDClient := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mockSDClient.EXPECT().GetService(context.TODO(), test.HttpNsName, test.SvcName).
+		Return(test.GetTestMulticlusterService(), nil)
+
+	reconciler := getReconciler(t, mockSDClient, fakeClient)
+
+	_, err := reconciler.Reconcile(context.TODO(), serviceRequest(test.SvcName))
+	assert.NoError(t, err)
+
+	svcImport := &multiclusterv1alpha1.ServiceImport{}
+	err = fakeClient.Get(context.TODO(), types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName}, svcImport)
+	assert.NoError(t, err)
+	assert.Equal(t, []multiclusterv1alpha1.ClusterStatus{{Cluster: test.ClusterId1}}, svcImport.Status.Clusters)
+
+	derivedServiceList := &v1.ServiceList{}
+	err = fakeClient.List(context.TODO(), derivedServiceList, client.InNamespace(test.HttpNsName))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(derivedServiceList.Items))
+	assert.Equal(t, DerivedName(test.HttpNsName, test.SvcName, test.ClusterId1), derivedServiceList.Items[0].Name)
+}
+
+func TestCloudMapReconciler_Reconcile_ClusterPriority(t *testing.T) {
+	fakeClient := fake.NewClientBuilder().WithScheme(getCloudMapReconcilerScheme()).
+		WithObjects(k8sNamespaceForTest(), test.ClusterIdForTest(), test.ClusterSetIdForTest()).Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	// cluster 2 is preferred over cluster 1 while it has ready endpoints
+	svc := test.GetTestMulticlusterService()
+	svc.Endpoints[0].Attributes[model.ClusterPriorityAttr] = "1"
+	svc.Endpoints[1].Attributes[model.ClusterPriorityAttr] = "0"
+	mockSDClient := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mockSDClient.EXPECT().GetService(context.TODO(), test.HttpNsName, test.SvcName).Return(svc, nil)
+
+	reconciler := getReconciler(t, mockSDClient, fakeClient)
+
+	_, err := reconciler.Reconcile(context.TODO(), serviceRequest(test.SvcName))
+	assert.NoError(t, err)
+
+	// both clusters are imported, but the endpoints of cluster 1 are not ready
+	svcImport := &multiclusterv1alpha1.ServiceImport{}
+	err = fakeClient.Get(context.TODO(), types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName}, svcImport)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(svcImport.Status.Clusters))
+	assert.Equal(t, 1, len(svcImport.Spec.IPs))
+
+	endpointSliceList := &discovery.EndpointSliceList{}
+	err = fakeClient.List(context.TODO(), endpointSliceList, client.InNamespace(test.HttpNsName))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(endpointSliceList.Items))
+	for _, endpointSlice := range endpointSliceList.Items {
+		clusterId := endpointSlice.Labels[LabelSourceCluster]
+		assert.Equal(t, clusterId == test.ClusterId2, *endpointSlice.Endpoints[0].Conditions.Ready, "readiness of %s", clusterId)
+	}
+
+	// the cached Cloud Map endpoints are not modified
+	assert.True(t, svc.Endpoints[0].Ready)
+}
+
+func TestCloudMapReconciler_Reconcile_LocalFirst(t *testing.T) {
+	svcImport := serviceImportForTest(test.SvcName)
+	svcImport.Annotations = map[string]string{ImportModeAnnotation: string(LocalFirstImportMode)}
+	fakeClient := fake.NewClientBuilder().WithScheme(getCloudMapReconcilerScheme()).
+		WithObjects(k8sNamespaceForTest(), svcImport, test.ClusterIdForTest(), test.ClusterSetIdForTest()).Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	mockSDClient := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mockSDClient.EXPECT().GetService(context.TODO(), test.HttpNsName, test.SvcName).
+		Return(test.GetTestMulticlusterService(), nil)
+
+	reconciler := getReconciler(t, mockSDClient, fakeClient)
+
+	_, err := reconciler.Reconcile(context.TODO(), serviceRequest(test.SvcName))
+	assert.NoError(t, err)
+
+	// the endpoints of the other cluster are not ready while this cluster has ready endpoints
+	endpointSliceList := &discovery.EndpointSliceList{}
+	err = fakeClient.List(context.TODO(), endpointSliceList, client.InNamespace(test.HttpNsName))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(endpointSliceList.Items))
+	for _, endpointSlice := range endpointSliceList.Items {
+		clusterId := endpointSlice.Labels[LabelSourceCluster]
+		assert.Equal(t, clusterId == test.ClusterId1, *endpointSlice.Endpoints[0].Conditions.Ready, "readiness of %s", clusterId)
+	}
+
+	err = fakeClient.Get(context.TODO(), types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName}, svcImport)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(svcImport.Spec.IPs))
+}
+
+func TestCloudMapReconciler_Reconcile_InvalidImportMode(t *testing.T) {
+	svcImport := serviceImportForTest(test.SvcName)
+	svcImport.Annotations = map[string]string{ImportModeAnnotation: "local"}
+	fakeClient := fake.NewClientBuilder().WithScheme(getCloudMapReconcilerScheme()).
+		WithObjects(k8sNamespaceForTest(), svcImport, test.ClusterIdForTest(), test.ClusterSetIdForTest()).Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	mockSDClient := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mockSDClient.EXPECT().GetService(context.TODO(), test.HttpNsName, test.SvcName).
+		Return(test.GetTestMulticlusterService(), nil)
+
+	reconciler := getReconciler(t, mockSDClient, fakeClient)
+
+	_, err := reconciler.Reconcile(context.TODO(), serviceRequest(test.SvcName))
+	assert.NoError(t, err)
+
+	events := reconciler.Recorder.(*record.FakeRecorder).Events
+	assert.Equal(t, "Warning InvalidImportMode invalid import mode \"local\", expected AllClusters or LocalFirst: using AllClusters", <-events)
+
+	// the endpoints of both clusters are ready
+	endpointSliceList := &discovery.EndpointSliceList{}
+	err = fakeClient.List(context.TODO(), endpointSliceList, client.InNamespace(test.HttpNsName))
+	assert.NoError(t, err)
+	for _, endpointSlice := range endpointSliceList.Items {
+		assert.True(t, *endpointSlice.Endpoints[0].Conditions.Ready)
+	}
+}
+
+func TestCloudMapReconciler_Reconcile_ImportNotAllowed(t *testing.T) {
+	// this cluster is not allowed to import the service anymore
+	policy := clusterSetPolicyForTest()
+	policy.Spec.ImportClusters = []string{test.ClusterId2}
+	fakeClient := fake.NewClientBuilder().WithScheme(getCloudMapReconcilerScheme()).
+		WithObjects(k8sNamespaceForTest(), policy, serviceImportForTest(test.SvcName),
+			test.ClusterIdForTest(), test.ClusterSetIdForTest()).Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	mockSDClient := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mockSDClient.EXPECT().GetService(context.TODO(), test.HttpNsName, test.SvcName).
+		Return(test.GetTestMulticlusterService(), nil)
+
+	reconciler := getReconciler(t, mockSDClient, fakeClient)
+	reconciler.State = NewReconcileState()
+	reconciler.State.recordImportError(serviceRequest(test.SvcName).NamespacedName, errors.New("import error"))
+
+	_, err := reconciler.Reconcile(context.TODO(), serviceRequest(test.SvcName))
+	assert.NoError(t, err)
+
+	serviceImports := &multiclusterv1alpha1.ServiceImportList{}
+	err = fakeClient.List(context.TODO(), serviceImports, client.InNamespace(test.HttpNsName))
+	assert.NoError(t, err)
+	assert.Empty(t, serviceImports.Items)
+	assert.Empty(t, reconciler.State.Services(), "the state of the deleted ServiceImport is pruned")
+}
+
+func TestCloudMapReconciler_Reconcile_ClusterLeft(t *testing.T) {
+	// the existing service import still lists both clusters
+	svc := test.GetTestMulticlusterService()
+	svcImport := CreateServiceImportStruct(svc, []string{test.ClusterId1, test.ClusterId2}, []*model.Port{&svc.Endpoints[0].ServicePort})
+	fakeClient := fake.NewClientBuilder().WithScheme(getCloudMapReconcilerScheme()).
+		WithObjects(k8sNamespaceForTest(), svcImport, test.ClusterIdForTest(), test.ClusterSetIdForTest()).Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	mockSDClient := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	// only the first cluster still exports the service
+	mockSDClient.EXPECT().GetService(context.TODO(), test.HttpNsName, test.SvcName).
+		Return(test.GetTestServiceWithEndpoint([]*model.Endpoint{test.GetTestEndpoint1()}), nil)
+
+	reconciler := getReconciler(t, mockSDClient, fakeClient)
+
+	_, err := reconciler.Reconcile(context.TODO(), serviceRequest(test.SvcName))
+	if err != nil {
+		t.Fatalf("reconcile failed: (%v)", err)
+	}
+
+	updatedSvcImport := &multiclusterv1alpha1.ServiceImport{}
+	err = fakeClient.Get(context.TODO(), types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName}, updatedSvcImport)
+	assert.NoError(t, err)
+	assert.Equal(t, []multiclusterv1alpha1.ClusterStatus{{Cluster: test.ClusterId1}}, updatedSvcImport.Status.Clusters)
+	assert.Equal(t, CreateDerivedServiceAnnotation(test.HttpNsName, test.SvcName, []string{test.ClusterId1}),
+		updatedSvcImport.Annotations[DerivedServiceAnnotation])
+}
+
+func TestCloudMapReconciler_Reconcile_DryRun(t *testing.T) {
+	// create a fake controller client and add some objects
+	svcImportToBeDeleted := serviceImportForTest("svc1")
+	fakeClient := fake.NewClientBuilder().WithScheme(getCloudMapReconcilerScheme()).
+		WithObjects(k8sNamespaceForTest(), svcImportToBeDeleted, test.ClusterIdForTest(), test.ClusterSetIdForTest()).Build()
+
+	// create a mock cloudmap service discovery client
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	mockSDClient := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mockSDClient.EXPECT().GetService(context.TODO(), test.HttpNsName, test.SvcName).
+		Return(test.GetTestServiceWithEndpoint([]*model.Endpoint{test.GetTestEndpoint1()}), nil)
+	mockSDClient.EXPECT().GetService(context.TODO(), test.HttpNsName, svcImportToBeDeleted.Name).
+		Return(nil, common.NotFoundError("service: svc1"))
+
+	reconciler := getReconciler(t, mockSDClient, fakeClient)
+	reconciler.DryRun = true
+
+	_, err := reconciler.Reconcile(context.TODO(), serviceRequest(test.SvcName))
+	assert.NoError(t, err)
+	_, err = reconciler.Reconcile(context.TODO(), serviceRequest(svcImportToBeDeleted.Name))
+	assert.NoError(t, err)
+
+	// assert no ServiceImport was created and the existing one was not deleted
+	serviceImports := &multiclusterv1alpha1.ServiceImportList{}
+	err = fakeClient.List(context.TODO(), serviceImports, client.InNamespace(test.HttpNsName))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(serviceImports.Items))
+	assert.Equal(t, svcImportToBeDeleted.Name, serviceImports.Items[0].Name)
+
+	// assert no derived Service or EndpointSlice was created
+	derivedServiceList := &v1.ServiceList{}
+	err = fakeClient.List(context.TODO(), derivedServiceList, client.InNamespace(test.HttpNsName))
+	assert.NoError(t, err)
+	assert.Empty(t, derivedServiceList.Items)
+
+	endpointSliceList := &discovery.EndpointSliceList{}
+	err = fakeClient.List(context.TODO(), endpointSliceList, client.InNamespace(test.HttpNsName))
+	assert.NoError(t, err)
+	assert.Empty(t, endpointSliceList.Items)
+}
+
+func TestCloudMapReconciler_Reconcile_CloudMapError(t *testing.T) {
+	fakeClient := fake.NewClientBuilder().WithScheme(getCloudMapReconcilerScheme()).
+		WithObjects(k8sNamespaceForTest(), serviceImportForTest(test.SvcName), test.ClusterIdForTest(), test.ClusterSetIdForTest()).Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	mockSDClient := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mockSDClient.EXPECT().GetService(context.TODO(), test.HttpNsName, test.SvcName).
+		Return(nil, errors.New("internal error"))
+
+	reconciler := getReconciler(t, mockSDClient, fakeClient)
+
+	// the error is returned to retry the service with backoff
+	_, err := reconciler.Reconcile(context.TODO(), serviceRequest(test.SvcName))
+	assert.Error(t, err)
+
+	// assert the service import is not deleted
+	serviceImport := &multiclusterv1alpha1.ServiceImport{}
+	err = fakeClient.Get(context.TODO(), types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName}, serviceImport)
+	assert.NoError(t, err)
+}
+
+func TestCloudMapReconciler_Reconcile_Throttled(t *testing.T) {
+	fakeClient := fake.NewClientBuilder().WithScheme(getCloudMapReconcilerScheme()).
+		WithObjects(k8sNamespaceForTest(), serviceImportForTest(test.SvcName), test.ClusterIdForTest(), test.ClusterSetIdForTest()).Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	mockSDClient := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mockSDClient.EXPECT().GetService(context.TODO(), test.HttpNsName, test.SvcName).
+		Return(nil, &smithy.GenericAPIError{Code: "ThrottlingException"})
+
+	reconciler := getReconciler(t, mockSDClient, fakeClient)
+	reconciler.State = NewReconcileState()
+
+	// throttled requests are retried after a delay instead of the backoff of the work queue
+	got, err := reconciler.Reconcile(context.TODO(), serviceRequest(test.SvcName))
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{RequeueAfter: throttledRequeueDelay}, got)
+	assert.Equal(t, common.ErrorClassThrottled, reconciler.State.Services()[serviceRequest(test.SvcName).NamespacedName.String()].ImportError.Class)
+}
+
+func TestCloudMapReconciler_ListServices(t *testing.T) {
+	otherNamespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other-namespace"}}
+	fakeClient := fake.NewClientBuilder().WithScheme(getCloudMapReconcilerScheme()).
+		WithObjects(k8sNamespaceForTest(), otherNamespace, serviceImportForTest("svc1"),
+			test.ClusterIdForTest(), test.ClusterSetIdForTest()).Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	mockSDClient := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	// only the service names are listed, the endpoints are fetched by the reconciliation
+	mockSDClient.EXPECT().ListServiceNames(context.TODO(), test.HttpNsName).
+		Return([]string{"empty", test.SvcName}, nil)
+	mockSDClient.EXPECT().ListServiceNames(context.TODO(), otherNamespace.Name).
+		Return(nil, errors.New("internal error"))
+
+	reconciler := getReconciler(t, mockSDClient, fakeClient)
+
+	// the services of the other namespaces are still returned along with the error
+	services, err := reconciler.listServices(context.TODO())
+	assert.Error(t, err)
+	assert.Equal(t, []types.NamespacedName{
+		{Namespace: test.HttpNsName, Name: "empty"},
+		{Namespace: test.HttpNsName, Name: test.SvcName},
+		{Namespace: test.HttpNsName, Name: "svc1"},
+	}, services)
+}
+
+func TestScanEventHandler(t *testing.T) {
+	queue := workqueue.NewRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(time.Hour, time.Hour))
+	defer queue.ShutDown()
+
+	evt := event.GenericEvent{Object: serviceImportForTest(test.SvcName)}
+	handler := (&CloudMapReconciler{}).scanEventHandler()
+
+	// services waiting for a retry after a failure are not enqueued by the scan
+	queue.AddRateLimited(serviceRequest(test.SvcName))
+	handler.Generic(evt, queue)
+	assert.Equal(t, 0, queue.Len())
+
+	queue.Forget(serviceRequest(test.SvcName))
+	handler.Generic(evt, queue)
+	assert.Equal(t, 1, queue.Len())
+
+	// the same service is enqueued once
+	handler.Generic(evt, queue)
+	assert.Equal(t, 1, queue.Len())
+}
+
+func TestScanEventHandler_DelayedRequeue(t *testing.T) {
+	fakeClient := fake.NewClientBuilder().WithScheme(getCloudMapReconcilerScheme()).
+		WithObjects(k8sNamespaceForTest(), serviceImportForTest(test.SvcName), test.ClusterIdForTest(), test.ClusterSetIdForTest()).Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	mockSDClient := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mockSDClient.EXPECT().GetService(context.TODO(), test.HttpNsName, test.SvcName).
+		Return(nil, &smithy.GenericAPIError{Code: "ThrottlingException"})
+
+	reconciler := getReconciler(t, mockSDClient, fakeClient)
+	now := time.Now()
+	reconciler.requeues.now = func() time.Time { return now }
+
+	queue := workqueue.NewRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(time.Hour, time.Hour))
+	defer queue.ShutDown()
+
+	evt := event.GenericEvent{Object: serviceImportForTest(test.SvcName)}
+	handler := reconciler.scanEventHandler()
+
+	// throttled services are not enqueued by the scan before their delay, although the queue forgot their failure
+	got, err := reconciler.Reconcile(context.TODO(), serviceRequest(test.SvcName))
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{RequeueAfter: throttledRequeueDelay}, got)
+	queue.Forget(serviceRequest(test.SvcName))
+	handler.Generic(evt, queue)
+	assert.Equal(t, 0, queue.Len())
+
+	now = now.Add(throttledRequeueDelay)
+	handler.Generic(evt, queue)
+	assert.Equal(t, 1, queue.Len())
+}
+
+func TestDerivedServiceMappingFunction(t *testing.T) {
+	svcImport := serviceImportForTest(test.SvcName)
+	derivedService := CreateDerivedServiceStruct(svcImport, []*model.Port{}, test.ClusterId1)
+	assert.Equal(t, []reconcile.Request{serviceRequest(test.SvcName)}, derivedServiceMappingFunction()(derivedService))
+
+	// other services are ignored
+	assert.Empty(t, derivedServiceMappingFunction()(k8sServiceForTest()))
+}
+
+func serviceRequest(name string) reconcile.Request {
+	return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: test.HttpNsName, Name: name}}
+}
+
 func getCloudMapReconcilerScheme() *runtime.Scheme {
 	s := scheme.Scheme
 	s.AddKnownTypes(multiclusterv1alpha1.GroupVersion, &multiclusterv1alpha1.ServiceImportList{}, &multiclusterv1alpha1.ServiceImport{})
 	s.AddKnownTypes(aboutv1alpha1.GroupVersion, &aboutv1alpha1.ClusterProperty{}, &aboutv1alpha1.ClusterPropertyList{})
+	s.AddKnownTypes(policyv1alpha1.GroupVersion, &policyv1alpha1.ClusterSetPolicy{}, &policyv1alpha1.ClusterSetPolicyList{})
 	return s
 }
 
@@ -155,6 +587,7 @@ func getReconciler(t *testing.T, mockSDClient *cloudmapMock.MockServiceDiscovery
 		Cloudmap:     mockSDClient,
 		Log:          common.NewLoggerWithLogr(testr.New(t)),
 		ClusterUtils: model.NewClusterUtils(client),
+		Recorder:     record.NewFakeRecorder(100),
 	}
 }
 
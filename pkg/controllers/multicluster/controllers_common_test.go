@@ -7,6 +7,7 @@ import (
 	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
 
 	multiclusterv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/multicluster/v1alpha1"
+	policyv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/policy/v1alpha1"
 	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/test"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	v1 "k8s.io/api/core/v1"
@@ -65,6 +66,18 @@ func serviceImportForTest(svcName string) *multiclusterv1alpha1.ServiceImport {
 	}
 }
 
+func clusterSetPolicyForTest() *policyv1alpha1.ClusterSetPolicy {
+	return &policyv1alpha1.ClusterSetPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "policy",
+			Namespace: test.HttpNsName,
+		},
+		Spec: policyv1alpha1.ClusterSetPolicySpec{
+			Services: []string{test.SvcName},
+		},
+	}
+}
+
 func endpointSliceForTest() *discovery.EndpointSlice {
 	port := int32(test.Port1)
 	protocol := v1.ProtocolTCP
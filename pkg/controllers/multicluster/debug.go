@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/cloudmap"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/common"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// DebugStatePath is the path of the debug endpoint serving the controller state.
+const DebugStatePath = "/debug/state"
+
+// ReconcileState records the latest changes computed and errors encountered by the reconcilers for each service, so
+// they can be inspected through the debug endpoint. A nil ReconcileState records nothing.
+type ReconcileState struct {
+	services map[string]*ServiceState
+	mutex    sync.RWMutex
+}
+
+// ServiceState holds the latest reconciliation results of a service.
+type ServiceState struct {
+	// Changes to the Cloud Map instances computed by the ServiceExport reconciler
+	ExportChanges *model.Changes `json:"exportChanges,omitempty"`
+	// Changes to the EndpointSlices computed by the Cloud Map reconciler, by cluster ID
+	ImportChanges map[string]*EndpointSliceChanges `json:"importChanges,omitempty"`
+	ExportError   *ReconcileError                  `json:"exportError,omitempty"`
+	ImportError   *ReconcileError                  `json:"importError,omitempty"`
+}
+
+// ReconcileError is an error encountered while reconciling a service.
+type ReconcileError struct {
+	Message string            `json:"message"`
+	Class   common.ErrorClass `json:"class"`
+	Time    time.Time         `json:"time"`
+}
+
+// DebugState is the controller state served by the debug endpoint.
+type DebugState struct {
+	ClusterId     string                   `json:"clusterId,omitempty"`
+	ClusterSetId  string                   `json:"clusterSetId,omitempty"`
+	ClusterError  string                   `json:"clusterError,omitempty"`
+	CloudMapCache model.CacheSnapshot      `json:"cloudMapCache"`
+	ServiceStates map[string]*ServiceState `json:"services"`
+}
+
+func NewReconcileState() *ReconcileState {
+	return &ReconcileState{services: make(map[string]*ServiceState)}
+}
+
+func (s *ReconcileState) recordExportChanges(name types.NamespacedName, changes model.Changes) {
+	s.update(name, func(state *ServiceState) {
+		state.ExportChanges = &changes
+	})
+}
+
+func (s *ReconcileState) recordImportChanges(name types.NamespacedName, clusterId string, changes EndpointSliceChanges) {
+	s.update(name, func(state *ServiceState) {
+		if state.ImportChanges == nil {
+			state.ImportChanges = make(map[string]*EndpointSliceChanges)
+		}
+		state.ImportChanges[clusterId] = &changes
+	})
+}
+
+// recordExportError records the error of the latest export of a service, a nil error clearing the previous one.
+func (s *ReconcileState) recordExportError(name types.NamespacedName, err error) {
+	s.update(name, func(state *ServiceState) {
+		state.ExportError = newReconcileError(err)
+	})
+}
+
+// recordImportError records the error of the latest import of a service, a nil error clearing the previous one.
+func (s *ReconcileState) recordImportError(name types.NamespacedName, err error) {
+	s.update(name, func(state *ServiceState) {
+		state.ImportError = newReconcileError(err)
+	})
+}
+
+// forgetExport removes the export state of a service once its ServiceExport is deleted.
+func (s *ReconcileState) forgetExport(name types.NamespacedName) {
+	s.update(name, func(state *ServiceState) {
+		state.ExportChanges = nil
+		state.ExportError = nil
+	})
+}
+
+// forgetImport removes the import state of a service once its ServiceImport is deleted.
+func (s *ReconcileState) forgetImport(name types.NamespacedName) {
+	s.update(name, func(state *ServiceState) {
+		state.ImportChanges = nil
+		state.ImportError = nil
+	})
+}
+
+func (s *ReconcileState) update(name types.NamespacedName, update func(state *ServiceState)) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state, ok := s.services[name.String()]
+	if !ok {
+		state = &ServiceState{}
+		s.services[name.String()] = state
+	}
+	update(state)
+	if state.isEmpty() {
+		delete(s.services, name.String())
+	}
+}
+
+// Services returns a copy of the states of all services, by namespaced name.
+func (s *ReconcileState) Services() map[string]*ServiceState {
+	services := make(map[string]*ServiceState)
+	if s == nil {
+		return services
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for name, state := range s.services {
+		stateCopy := *state
+		if state.ImportChanges != nil {
+			stateCopy.ImportChanges = make(map[string]*EndpointSliceChanges, len(state.ImportChanges))
+			for clusterId, changes := range state.ImportChanges {
+				stateCopy.ImportChanges[clusterId] = changes
+			}
+		}
+		services[name] = &stateCopy
+	}
+	return services
+}
+
+func (state *ServiceState) isEmpty() bool {
+	return state.ExportChanges == nil && state.ImportChanges == nil && state.ExportError == nil && state.ImportError == nil
+}
+
+func newReconcileError(err error) *ReconcileError {
+	if err == nil {
+		return nil
+	}
+	return &ReconcileError{
+		Message: err.Error(),
+		Class:   common.Classify(err),
+		Time:    time.Now(),
+	}
+}
+
+// NewDebugHandler returns an HTTP handler serving the cluster properties, the cached Cloud Map resources and the
+// reconciliation state of each service as JSON.
+func NewDebugHandler(clusterUtils model.ClusterUtils, cloudMap cloudmap.ServiceDiscoveryClient, state *ReconcileState) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		debugState := DebugState{
+			CloudMapCache: cloudMap.CacheSnapshot(),
+			ServiceStates: state.Services(),
+		}
+		clusterProperties, err := clusterUtils.GetClusterProperties(req.Context())
+		if err != nil {
+			debugState.ClusterError = err.Error()
+		} else {
+			debugState.ClusterId = clusterProperties.ClusterId()
+			debugState.ClusterSetId = clusterProperties.ClusterSetId()
+		}
+
+		body, err := json.MarshalIndent(debugState, "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	})
+}
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cloudmapMock "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/mocks/pkg/cloudmap"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/common"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/test"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	discovery "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestReconcileState(t *testing.T) {
+	state := NewReconcileState()
+	name := types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName}
+
+	state.recordExportChanges(name, model.Changes{Create: []*model.Endpoint{test.GetTestEndpoint1()}})
+	state.recordImportChanges(name, test.ClusterId1, EndpointSliceChanges{Create: []*discovery.EndpointSlice{endpointSliceForTest()}})
+	state.recordImportError(name, errors.New("import error"))
+	state.recordExportError(name, nil)
+
+	services := state.Services()
+	assert.Len(t, services, 1)
+	svcState := services[name.String()]
+	assert.Equal(t, []*model.Endpoint{test.GetTestEndpoint1()}, svcState.ExportChanges.Create)
+	assert.Len(t, svcState.ImportChanges[test.ClusterId1].Create, 1)
+	assert.Nil(t, svcState.ExportError)
+	assert.Equal(t, "import error", svcState.ImportError.Message)
+	assert.Equal(t, common.ErrorClassPermanent, svcState.ImportError.Class)
+
+	// returned states are copies
+	state.recordImportChanges(name, test.ClusterId2, EndpointSliceChanges{})
+	assert.Len(t, svcState.ImportChanges, 1)
+}
+
+func TestReconcileState_ClearErrors(t *testing.T) {
+	state := NewReconcileState()
+	name := types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName}
+
+	state.recordExportChanges(name, model.Changes{})
+	state.recordExportError(name, errors.New("export error"))
+	state.recordImportError(name, errors.New("import error"))
+	assert.NotNil(t, state.Services()[name.String()].ExportError)
+
+	// a successful reconciliation clears the previous error
+	state.recordExportError(name, nil)
+	state.recordImportError(name, nil)
+	svcState := state.Services()[name.String()]
+	assert.Nil(t, svcState.ExportError)
+	assert.Nil(t, svcState.ImportError)
+
+	// services without any recorded state are not listed
+	state.recordExportError(types.NamespacedName{Namespace: test.HttpNsName, Name: "other"}, nil)
+	assert.Len(t, state.Services(), 1)
+}
+
+func TestReconcileState_Forget(t *testing.T) {
+	state := NewReconcileState()
+	name := types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName}
+
+	state.recordExportChanges(name, model.Changes{Create: []*model.Endpoint{test.GetTestEndpoint1()}})
+	state.recordExportError(name, errors.New("export error"))
+	state.recordImportChanges(name, test.ClusterId1, EndpointSliceChanges{})
+	state.recordImportError(name, errors.New("import error"))
+
+	// the ServiceExport is deleted, the import state is kept
+	state.forgetExport(name)
+	svcState := state.Services()[name.String()]
+	assert.Nil(t, svcState.ExportChanges)
+	assert.Nil(t, svcState.ExportError)
+	assert.NotNil(t, svcState.ImportError)
+
+	// the ServiceImport is deleted too
+	state.forgetImport(name)
+	assert.Empty(t, state.Services())
+}
+
+func TestReconcileState_Nil(t *testing.T) {
+	var state *ReconcileState
+	state.recordExportError(types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName}, errors.New("error"))
+	assert.Empty(t, state.Services())
+}
+
+func TestDebugHandler(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	snapshot := model.CacheSnapshot{
+		Namespaces: map[string]*model.Namespace{test.HttpNsName: test.GetTestHttpNamespace()},
+		ServiceIds: map[string]map[string]string{test.HttpNsName: {test.SvcName: test.SvcId}},
+	}
+	mock := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mock.EXPECT().CacheSnapshot().Return(snapshot)
+
+	state := NewReconcileState()
+	name := types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName}
+	state.recordExportError(name, errors.New("export error"))
+
+	handler := NewDebugHandler(model.NewClusterUtilsWithValues(test.ClusterId1, test.ClusterSet), mock, state)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, DebugStatePath, nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	got := DebugState{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+	assert.Equal(t, test.ClusterId1, got.ClusterId)
+	assert.Equal(t, test.ClusterSet, got.ClusterSetId)
+	assert.Equal(t, snapshot, got.CloudMapCache)
+	assert.Equal(t, "export error", got.ServiceStates[name.String()].ExportError.Message)
+}
+
+func TestDebugHandler_MethodNotAllowed(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	handler := NewDebugHandler(model.NewClusterUtilsWithValues(test.ClusterId1, test.ClusterSet),
+		cloudmapMock.NewMockServiceDiscoveryClient(mockController), NewReconcileState())
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, DebugStatePath, nil))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
@@ -0,0 +1,20 @@
+package controllers
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DryRunEventReason is the reason of events describing changes that were computed, but not applied in dry-run mode.
+const DryRunEventReason = "DryRun"
+
+// recordDryRunEvent records an event on the given object describing a change that would have been applied outside
+// of dry-run mode. Objects that were never persisted, e.g. ones that would only be created outside of dry-run mode,
+// cannot be referenced by events and are ignored, as are events without a recorder.
+func recordDryRunEvent(recorder record.EventRecorder, object client.Object, messageFmt string, args ...interface{}) {
+	if recorder == nil || object.GetUID() == "" {
+		return
+	}
+	recorder.Eventf(object, v1.EventTypeNormal, DryRunEventReason, messageFmt, args...)
+}
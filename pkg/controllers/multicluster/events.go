@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	multiclusterv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/multicluster/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+// Reasons of the events recorded on ServiceExports
+const (
+	// EndpointsRegisteredEventReason indicates endpoints of an exported Service were registered to Cloud Map.
+	EndpointsRegisteredEventReason = "EndpointsRegistered"
+
+	// EndpointsDeregisteredEventReason indicates endpoints of an exported Service were de-registered from Cloud Map.
+	EndpointsDeregisteredEventReason = "EndpointsDeregistered"
+
+	// CloudMapErrorEventReason indicates a Cloud Map request failed while exporting a Service.
+	CloudMapErrorEventReason = "CloudMapError"
+
+	// ExportConflictEventReason indicates the exported Service conflicts with exports of the same Service from other clusters.
+	ExportConflictEventReason = "ExportConflict"
+
+	// ExportMovedEventReason indicates the exported Service was moved to another clusterset service after its export name changed.
+	ExportMovedEventReason = "ExportMoved"
+
+	// InvalidExportNameEventReason indicates the export name or namespace annotation of a ServiceExport is invalid.
+	InvalidExportNameEventReason = "InvalidExportName"
+
+	// ExportNamespaceNotAllowedEventReason indicates the namespace a Service is exported to does not allow exports from the namespace of its ServiceExport.
+	ExportNamespaceNotAllowedEventReason = "ExportNamespaceNotAllowed"
+
+	// ExportNotAllowedEventReason indicates ClusterSetPolicies do not allow the cluster to export the Service.
+	ExportNotAllowedEventReason = "ExportNotAllowed"
+
+	// InvalidExportModeEventReason indicates the export mode annotation of a ServiceExport is invalid for its Service.
+	InvalidExportModeEventReason = "InvalidExportMode"
+
+	// InvalidReadinessPolicyEventReason indicates the readiness policy annotation of a ServiceExport is invalid.
+	InvalidReadinessPolicyEventReason = "InvalidReadinessPolicy"
+
+	// InvalidTrafficPolicyEventReason indicates the weight or priority of the cluster for an exported Service is invalid.
+	InvalidTrafficPolicyEventReason = "InvalidTrafficPolicy"
+
+	// UnknownExportedPortsEventReason indicates the exported ports annotation of a ServiceExport lists ports the Service does not have.
+	UnknownExportedPortsEventReason = "UnknownExportedPorts"
+
+	// InvalidAttributesEventReason indicates user-defined instance attributes of a ServiceExport are invalid or exceed the Cloud Map limits.
+	InvalidAttributesEventReason = "InvalidAttributes"
+
+	// InstanceQuotaApproachedEventReason indicates the Cloud Map service of an exported Service approaches the quota of instances per service.
+	InstanceQuotaApproachedEventReason = "InstanceQuotaApproached"
+)
+
+// Reasons of the events recorded on ServiceImports and derived Services
+const (
+	// ServiceImportCreatedEventReason indicates a ServiceImport was created for a Cloud Map service.
+	ServiceImportCreatedEventReason = "ServiceImportCreated"
+
+	// DerivedServiceCreatedEventReason indicates a derived Service was created for a cluster exporting the Service.
+	DerivedServiceCreatedEventReason = "DerivedServiceCreated"
+
+	// PortsChangedEventReason indicates the ports of a ServiceImport or derived Service were updated.
+	PortsChangedEventReason = "PortsChanged"
+
+	// ClusterJoinedEventReason indicates a cluster started exporting the imported Service.
+	ClusterJoinedEventReason = "ClusterJoined"
+
+	// ClusterLeftEventReason indicates a cluster stopped exporting the imported Service.
+	ClusterLeftEventReason = "ClusterLeft"
+
+	// InvalidImportModeEventReason indicates the import mode annotation of a ServiceImport is invalid.
+	InvalidImportModeEventReason = "InvalidImportMode"
+)
+
+const (
+	defaultEventCacheSize        = 4096
+	DefaultEventDeduplicationTTL = 10 * time.Minute
+)
+
+// noopEventRecorder drops all events, for reconcilers set up without an event recorder.
+type noopEventRecorder struct{}
+
+func (noopEventRecorder) Event(runtime.Object, string, string, string) {}
+
+func (noopEventRecorder) Eventf(runtime.Object, string, string, string, ...interface{}) {}
+
+func (noopEventRecorder) AnnotatedEventf(runtime.Object, map[string]string, string, string, string, ...interface{}) {
+}
+
+type deduplicatingEventRecorder struct {
+	recorder record.EventRecorder
+	recent   *cache.LRUExpireCache
+	ttl      time.Duration
+}
+
+// NewDeduplicatingEventRecorder wraps an event recorder to drop events identical to an event recorded for the same
+// object within the given time window, so periodic reconciliation does not flood the API server with events.
+func NewDeduplicatingEventRecorder(recorder record.EventRecorder, ttl time.Duration) record.EventRecorder {
+	return &deduplicatingEventRecorder{
+		recorder: recorder,
+		recent:   cache.NewLRUExpireCache(defaultEventCacheSize),
+		ttl:      ttl,
+	}
+}
+
+func (r *deduplicatingEventRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if r.isDuplicate(object, eventtype, reason, message) {
+		return
+	}
+	r.recorder.Event(object, eventtype, reason, message)
+}
+
+func (r *deduplicatingEventRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *deduplicatingEventRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	message := fmt.Sprintf(messageFmt, args...)
+	if r.isDuplicate(object, eventtype, reason, message) {
+		return
+	}
+	r.recorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", message)
+}
+
+func (r *deduplicatingEventRecorder) isDuplicate(object runtime.Object, eventtype, reason, message string) bool {
+	key := fmt.Sprintf("%s/%s/%s/%s", r.objectKey(object), eventtype, reason, message)
+	if _, found := r.recent.Get(key); found {
+		return true
+	}
+	r.recent.Add(key, struct{}{}, r.ttl)
+	return false
+}
+
+func (r *deduplicatingEventRecorder) objectKey(object runtime.Object) string {
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return fmt.Sprintf("%T", object)
+	}
+	return fmt.Sprintf("%T/%s/%s/%s", object, accessor.GetNamespace(), accessor.GetName(), accessor.GetUID())
+}
+
+// formatServicePorts gives a compact representation of Service ports for event messages, e.g. [http:80/TCP]
+func formatServicePorts(ports []v1.ServicePort) string {
+	formatted := make([]string, 0, len(ports))
+	for _, port := range ports {
+		formatted = append(formatted, fmt.Sprintf("%s:%d/%s", port.Name, port.Port, port.Protocol))
+	}
+	return "[" + strings.Join(formatted, " ") + "]"
+}
+
+// formatServiceImportPorts gives a compact representation of ServiceImport ports for event messages, e.g. [http:80/TCP]
+func formatServiceImportPorts(ports []multiclusterv1alpha1.ServicePort) string {
+	formatted := make([]string, 0, len(ports))
+	for _, port := range ports {
+		formatted = append(formatted, fmt.Sprintf("%s:%d/%s", port.Name, port.Port, port.Protocol))
+	}
+	return "[" + strings.Join(formatted, " ") + "]"
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/test"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestDeduplicatingEventRecorder(t *testing.T) {
+	fakeRecorder := record.NewFakeRecorder(10)
+	recorder := NewDeduplicatingEventRecorder(fakeRecorder, time.Minute)
+
+	svcExport := serviceExportForTest()
+	otherSvcExport := serviceExportForTest()
+	otherSvcExport.Name = "other"
+
+	recorder.Eventf(svcExport, v1.EventTypeWarning, CloudMapErrorEventReason, "failed: %s", "error")
+	// duplicate event for the same object is dropped
+	recorder.Eventf(svcExport, v1.EventTypeWarning, CloudMapErrorEventReason, "failed: %s", "error")
+	// different message is recorded
+	recorder.Eventf(svcExport, v1.EventTypeWarning, CloudMapErrorEventReason, "failed: %s", "other error")
+	// same event for a different object is recorded
+	recorder.Eventf(otherSvcExport, v1.EventTypeWarning, CloudMapErrorEventReason, "failed: %s", "error")
+
+	assert.Equal(t, 3, len(fakeRecorder.Events))
+	assert.Equal(t, "Warning CloudMapError failed: error", <-fakeRecorder.Events)
+	assert.Equal(t, "Warning CloudMapError failed: other error", <-fakeRecorder.Events)
+	assert.Equal(t, "Warning CloudMapError failed: error", <-fakeRecorder.Events)
+}
+
+func TestDeduplicatingEventRecorder_Expired(t *testing.T) {
+	fakeRecorder := record.NewFakeRecorder(10)
+	recorder := NewDeduplicatingEventRecorder(fakeRecorder, time.Millisecond)
+
+	svcImport := serviceImportForTest(test.SvcName)
+	recorder.Event(svcImport, v1.EventTypeNormal, ClusterJoinedEventReason, "joined")
+	time.Sleep(5 * time.Millisecond)
+	recorder.Event(svcImport, v1.EventTypeNormal, ClusterJoinedEventReason, "joined")
+
+	assert.Equal(t, 2, len(fakeRecorder.Events))
+}
+
+func TestFormatServicePorts(t *testing.T) {
+	ports := []v1.ServicePort{
+		{Name: test.PortName1, Port: test.ServicePort1, Protocol: test.Protocol1},
+		{Name: test.PortName2, Port: test.ServicePort2, Protocol: test.Protocol2},
+	}
+	assert.Equal(t, "[http:11/TCP https:22/UDP]", formatServicePorts(ports))
+}
+
+func TestRecordDryRunEvent_WithoutRecorder(t *testing.T) {
+	svcExport := serviceExportForTest()
+	svcExport.UID = "uid"
+
+	assert.NotPanics(t, func() {
+		recordDryRunEvent(nil, svcExport, "would register %d endpoints", 1)
+	})
+	assert.NotPanics(t, func() {
+		noopEventRecorder{}.Eventf(svcExport, v1.EventTypeNormal, DryRunEventReason, "would register %d endpoints", 1)
+	})
+}
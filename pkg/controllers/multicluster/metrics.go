@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	serviceExportControllerName = "ServiceExportReconciler"
+	cloudMapControllerName      = "CloudMapReconciler"
+
+	resourceCloudMapService  = "CloudMapService"
+	resourceCloudMapInstance = "CloudMapInstance"
+	resourceServiceExport    = "ServiceExport"
+	resourceServiceImport    = "ServiceImport"
+	resourceDerivedService   = "DerivedService"
+	resourceEndpointSlice    = "EndpointSlice"
+	actionCreate             = "create"
+	actionUpdate             = "update"
+	actionDelete             = "delete"
+	actionRegister           = "register"
+	actionDeregister         = "deregister"
+)
+
+// plannedChanges counts every change computed by the reconcilers. Changes computed in dry-run mode are counted with
+// the dry_run label set to "true" and are never applied.
+var plannedChanges = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "mcs_controller_planned_changes_total",
+		Help: "Number of changes computed by the AWS Cloud Map MCS controller reconcilers.",
+	},
+	[]string{"controller", "resource", "action", "dry_run"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(plannedChanges)
+}
+
+// recordPlannedChanges counts a number of changes of the same kind computed by a reconciler.
+func recordPlannedChanges(controller string, resource string, action string, count int, dryRun bool) {
+	if count <= 0 {
+		return
+	}
+	plannedChanges.WithLabelValues(controller, resource, action, strconv.FormatBool(dryRun)).Add(float64(count))
+}
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"context"
+
+	policyv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/policy/v1alpha1"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ServicePolicy holds the ClusterSetPolicies applying to a clusterset service. A cluster may export or import the
+// service only if every policy applying to it allows the cluster.
+type ServicePolicy struct {
+	policies []policyv1alpha1.ClusterSetPolicy
+}
+
+// IsClusterSetPolicyInstalled returns true if the ClusterSetPolicy CRD is installed in the cluster. ClusterSetPolicies
+// are optional, and are only watched when their CRD is installed at startup.
+func IsClusterSetPolicyInstalled(mapper meta.RESTMapper) (bool, error) {
+	gvk := policyv1alpha1.GroupVersion.WithKind("ClusterSetPolicy")
+	_, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetServicePolicy returns the ClusterSetPolicies of the namespace of a clusterset service which apply to it. No
+// policy applies when the ClusterSetPolicy CRD is not installed, see IsClusterSetPolicyInstalled.
+func GetServicePolicy(ctx context.Context, c client.Reader, name types.NamespacedName) (*ServicePolicy, error) {
+	policies := policyv1alpha1.ClusterSetPolicyList{}
+	err := c.List(ctx, &policies, client.InNamespace(name.Namespace))
+	if meta.IsNoMatchError(err) {
+		return &ServicePolicy{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	servicePolicy := &ServicePolicy{}
+	for _, policy := range policies.Items {
+		if policyAppliesTo(&policy, name.Name) {
+			servicePolicy.policies = append(servicePolicy.policies, policy)
+		}
+	}
+	return servicePolicy, nil
+}
+
+// AllowsExport returns true if a cluster may export the service.
+func (p *ServicePolicy) AllowsExport(clusterId string) bool {
+	for _, policy := range p.policies {
+		if !clusterAllowed(policy.Spec.ExportClusters, clusterId) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowsImport returns true if a cluster may import the service.
+func (p *ServicePolicy) AllowsImport(clusterId string) bool {
+	for _, policy := range p.policies {
+		if !clusterAllowed(policy.Spec.ImportClusters, clusterId) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExportedEndpoints returns the endpoints exported by the clusters allowed to export the service.
+func (p *ServicePolicy) ExportedEndpoints(endpoints []*model.Endpoint) []*model.Endpoint {
+	allowed := make([]*model.Endpoint, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if p.AllowsExport(endpoint.ClusterId) {
+			allowed = append(allowed, endpoint)
+		}
+	}
+	return allowed
+}
+
+func policyAppliesTo(policy *policyv1alpha1.ClusterSetPolicy, serviceName string) bool {
+	if len(policy.Spec.Services) == 0 {
+		return true
+	}
+	for _, name := range policy.Spec.Services {
+		if name == serviceName {
+			return true
+		}
+	}
+	return false
+}
+
+func clusterAllowed(clusterIds []string, clusterId string) bool {
+	if len(clusterIds) == 0 {
+		return true
+	}
+	for _, id := range clusterIds {
+		if id == clusterId {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	policyv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/policy/v1alpha1"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGetServicePolicy(t *testing.T) {
+	// applies to all services of the namespace
+	namespacePolicy := clusterSetPolicyForTest()
+	namespacePolicy.Name = "namespace-policy"
+	namespacePolicy.Spec.Services = nil
+	namespacePolicy.Spec.ExportClusters = []string{test.ClusterId1, test.ClusterId2}
+	// applies to the service only
+	servicePolicy := clusterSetPolicyForTest()
+	servicePolicy.Spec.ExportClusters = []string{test.ClusterId1}
+	servicePolicy.Spec.ImportClusters = []string{test.ClusterId2}
+	// applies to another service
+	otherPolicy := clusterSetPolicyForTest()
+	otherPolicy.Name = "other-policy"
+	otherPolicy.Spec.Services = []string{"other"}
+	otherPolicy.Spec.ExportClusters = []string{"other-cluster"}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(getServiceExportScheme()).
+		WithObjects(namespacePolicy, servicePolicy, otherPolicy).Build()
+
+	policy, err := GetServicePolicy(context.TODO(), fakeClient, types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName})
+	assert.NoError(t, err)
+	assert.True(t, policy.AllowsExport(test.ClusterId1))
+	assert.False(t, policy.AllowsExport(test.ClusterId2))
+	assert.False(t, policy.AllowsExport("other-cluster"))
+	assert.False(t, policy.AllowsImport(test.ClusterId1))
+	assert.True(t, policy.AllowsImport(test.ClusterId2))
+	assert.Equal(t, []*model.Endpoint{test.GetTestEndpoint1()}, policy.ExportedEndpoints(test.GetMulticlusterTestEndpoints()))
+
+	policy, err = GetServicePolicy(context.TODO(), fakeClient, types.NamespacedName{Namespace: "other-namespace", Name: test.SvcName})
+	assert.NoError(t, err)
+	assert.True(t, policy.AllowsExport("other-cluster"))
+	assert.True(t, policy.AllowsImport("other-cluster"))
+}
+
+func TestServicePolicy_NoPolicy(t *testing.T) {
+	policy := &ServicePolicy{}
+	assert.True(t, policy.AllowsExport(test.ClusterId1))
+	assert.True(t, policy.AllowsImport(test.ClusterId1))
+	assert.Equal(t, test.GetMulticlusterTestEndpoints(), policy.ExportedEndpoints(test.GetMulticlusterTestEndpoints()))
+}
+
+func TestIsClusterSetPolicyInstalled(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	installed, err := IsClusterSetPolicyInstalled(mapper)
+	assert.NoError(t, err)
+	assert.False(t, installed)
+
+	mapper.Add(policyv1alpha1.GroupVersion.WithKind("ClusterSetPolicy"), meta.RESTScopeNamespace)
+	installed, err = IsClusterSetPolicyInstalled(mapper)
+	assert.NoError(t, err)
+	assert.True(t, installed)
+}
+
+func TestClusterSetPolicyMappingFunction(t *testing.T) {
+	aliasExport := serviceExportForTest()
+	aliasExport.Name = "aliased"
+	aliasExport.Annotations = map[string]string{ExportNameAnnotation: test.SvcName}
+	otherExport := serviceExportForTest()
+	otherExport.Name = "other"
+	fakeClient := fake.NewClientBuilder().WithScheme(getServiceExportScheme()).
+		WithObjects(serviceExportForTest(), aliasExport, otherExport).Build()
+
+	reconciler := getServiceExportReconciler(t, nil, fakeClient)
+	requests := reconciler.clusterSetPolicyMappingFunction()(clusterSetPolicyForTest())
+	names := make([]types.NamespacedName, 0)
+	for _, request := range requests {
+		names = append(names, request.NamespacedName)
+	}
+	assert.ElementsMatch(t, []types.NamespacedName{
+		{Namespace: test.HttpNsName, Name: test.SvcName},
+		{Namespace: test.HttpNsName, Name: "aliased"},
+	}, names)
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/common"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// Delay before retrying after throttled requests, long enough for the rate limits to recover
+	throttledRequeueDelay = 1 * time.Minute
+
+	// Delay before retrying after transient failures, e.g. Cloud Map operations which did not complete in time
+	transientRequeueDelay = 30 * time.Second
+)
+
+// requeueResult chooses when to reconcile again from the class of an error. Throttled and transient failures are
+// retried after a fixed delay without being reported as reconciliation errors, other failures are returned to be
+// retried with the exponential backoff of the controller.
+func requeueResult(log common.Logger, err error) (ctrl.Result, error) {
+	switch class := common.Classify(err); class {
+	case common.ErrorClassThrottled:
+		log.Info("requests throttled, retrying later", "class", class, "delay", throttledRequeueDelay, "error", err.Error())
+		return ctrl.Result{RequeueAfter: throttledRequeueDelay}, nil
+	case common.ErrorClassTransient:
+		log.Info("transient failure, retrying later", "class", class, "delay", transientRequeueDelay, "error", err.Error())
+		return ctrl.Result{RequeueAfter: transientRequeueDelay}, nil
+	case "":
+		return ctrl.Result{}, nil
+	default:
+		return ctrl.Result{}, err
+	}
+}
+
+// syncDelay returns the delay before the next reconciliation round of a periodic reconciler from the error of the
+// previous round.
+func syncDelay(err error, period time.Duration) time.Duration {
+	if common.Classify(err) == common.ErrorClassThrottled && throttledRequeueDelay > period {
+		return throttledRequeueDelay
+	}
+	return period
+}
+
+// delayedRequeues tracks the requests requeued after a delay. The work queue forgets the failures of the requests
+// requeued after a delay, so their pending retries have to be tracked to keep other sources from enqueuing them early.
+type delayedRequeues struct {
+	deadlines map[types.NamespacedName]time.Time
+	now       func() time.Time
+	mutex     sync.Mutex
+}
+
+// track records when a request is requeued from the result of its reconciliation, or forgets it if it is not requeued
+// after a delay.
+func (d *delayedRequeues) track(name types.NamespacedName, result ctrl.Result, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if err != nil || result.RequeueAfter <= 0 {
+		delete(d.deadlines, name)
+		return
+	}
+	if d.deadlines == nil {
+		d.deadlines = make(map[types.NamespacedName]time.Time)
+	}
+	d.deadlines[name] = d.currentTime().Add(result.RequeueAfter)
+}
+
+// pending returns true if a request is waiting to be requeued after a delay.
+func (d *delayedRequeues) pending(name types.NamespacedName) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	deadline, found := d.deadlines[name]
+	if !found {
+		return false
+	}
+	if !d.currentTime().Before(deadline) {
+		delete(d.deadlines, name)
+		return false
+	}
+	return true
+}
+
+func (d *delayedRequeues) currentTime() time.Time {
+	if d.now != nil {
+		return d.now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/common"
+	"github.com/aws/smithy-go"
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/assert"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestRequeueResult(t *testing.T) {
+	log := common.NewLoggerWithLogr(testr.New(t))
+	permanentErr := errors.New("permanent")
+
+	tests := []struct {
+		name       string
+		err        error
+		wantResult ctrl.Result
+		wantErr    error
+	}{
+		{
+			name:       "nil",
+			err:        nil,
+			wantResult: ctrl.Result{},
+			wantErr:    nil,
+		},
+		{
+			name:       "throttled",
+			err:        &smithy.GenericAPIError{Code: "ThrottlingException"},
+			wantResult: ctrl.Result{RequeueAfter: throttledRequeueDelay},
+			wantErr:    nil,
+		},
+		{
+			name:       "transient",
+			err:        &smithy.GenericAPIError{Code: "ServiceUnavailable"},
+			wantResult: ctrl.Result{RequeueAfter: transientRequeueDelay},
+			wantErr:    nil,
+		},
+		{
+			name:       "permanent",
+			err:        permanentErr,
+			wantResult: ctrl.Result{},
+			wantErr:    permanentErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := requeueResult(log, tt.err)
+			assert.Equal(t, tt.wantResult, result)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func TestSyncDelay(t *testing.T) {
+	assert.Equal(t, syncPeriod, syncDelay(nil, syncPeriod))
+	assert.Equal(t, syncPeriod, syncDelay(errors.New("permanent"), syncPeriod))
+	assert.Equal(t, throttledRequeueDelay, syncDelay(&smithy.GenericAPIError{Code: "ThrottlingException"}, syncPeriod))
+}
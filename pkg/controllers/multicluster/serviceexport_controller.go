@@ -2,9 +2,13 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	aboutv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/about/v1alpha1"
 	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/cloudmap"
@@ -14,8 +18,10 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	v1 "k8s.io/api/core/v1"
 	discovery "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/labels"
 
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -31,6 +37,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	multiclusterv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/multicluster/v1alpha1"
+	policyv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/policy/v1alpha1"
 )
 
 // ServiceExportReconciler reconciles a ServiceExport object
@@ -40,13 +47,31 @@ type ServiceExportReconciler struct {
 	Scheme       *runtime.Scheme
 	CloudMap     cloudmap.ServiceDiscoveryClient
 	ClusterUtils model.ClusterUtils
+	Recorder     record.EventRecorder
+	// DryRun computes and reports the changes to Cloud Map and the ServiceExport without applying them
+	DryRun bool
+	// State records the computed changes and errors of each service for the debug endpoint, if set
+	State *ReconcileState
+	// InstanceQuota is the Cloud Map quota of instances per service. ServiceExports approaching it get a warning
+	// condition, 0 disables the check.
+	InstanceQuota int
 }
 
+// Fraction of the instance quota above which ServiceExports get a warning condition
+const instanceQuotaWarningRatio = 0.8
+
+// Field index of the ServiceExports with pod label attributes
+const podLabelAttributesIndex = "podLabelAttributes"
+
 // +kubebuilder:rbac:groups="",resources=services,verbs=get
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
 // +kubebuilder:rbac:groups=about.k8s.io,resources=clusterproperties,verbs=create;get;list;watch;update;patch;delete
 // +kubebuilder:rbac:groups="discovery.k8s.io",resources=endpointslices,verbs=list;watch;create
 // +kubebuilder:rbac:groups=multicluster.x-k8s.io,resources=serviceexports,verbs=get;list;watch;update;patch
 // +kubebuilder:rbac:groups=multicluster.x-k8s.io,resources=serviceexports/finalizers,verbs=get;update
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=policy.multicluster.k8s.aws,resources=clustersetpolicies,verbs=get;list;watch
 
 func (r *ServiceExportReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	ctx, cancel := context.WithCancel(ctx)
@@ -61,6 +86,7 @@ func (r *ServiceExportReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		if errors.IsNotFound(err) {
 			r.Log.Debug("no ServiceExport found",
 				"Namespace", namespace, "Name", name)
+			r.State.forgetExport(name)
 		} else {
 			r.Log.Error(err, "error fetching ServiceExport",
 				"Namespace", namespace, "Name", name)
@@ -90,12 +116,19 @@ func (r *ServiceExportReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{}, err
 	}
 
+	var result ctrl.Result
 	// Check if the service export is marked to be deleted
 	if isServiceExportMarkedForDelete {
-		return r.handleDelete(ctx, clusterProperties.ClusterId(), &serviceExport)
+		result, err = r.handleDelete(ctx, clusterProperties.ClusterId(), &serviceExport)
+	} else {
+		result, err = r.handleUpdate(ctx, clusterProperties.ClusterId(), &serviceExport, &service)
+	}
+	// Cloud Map errors retried later are already recorded, other results replace the recorded error
+	if err != nil || result.IsZero() {
+		r.State.recordExportError(name, err)
 	}
 
-	return r.handleUpdate(ctx, clusterProperties.ClusterId(), &serviceExport, &service)
+	return result, err
 }
 
 func (r *ServiceExportReconciler) handleUpdate(ctx context.Context, clusterId string, serviceExport *multiclusterv1alpha1.ServiceExport, service *v1.Service) (ctrl.Result, error) {
@@ -104,42 +137,103 @@ func (r *ServiceExportReconciler) handleUpdate(ctx context.Context, clusterId st
 		return ctrl.Result{}, err
 	}
 
-	r.Log.Info("updating Cloud Map service", "namespace", service.Namespace, "name", service.Name)
-	cmService, err := r.createOrGetCloudMapService(ctx, service)
+	exportedName := ExportedServiceName(serviceExport)
+	if errs := ValidateExportedServiceName(exportedName); len(errs) > 0 {
+		// the ServiceExport is reconciled again once its annotations are fixed
+		r.Log.Info("invalid export name", "namespace", serviceExport.Namespace, "name", serviceExport.Name,
+			"exportedName", exportedName.String(), "errors", errs)
+		r.Recorder.Eventf(serviceExport, v1.EventTypeWarning, InvalidExportNameEventReason, "invalid export name %s: %s", exportedName, strings.Join(errs, ", "))
+		return ctrl.Result{}, nil
+	}
+
+	allowed, err := r.isExportNamespaceAllowed(ctx, serviceExport, exportedName)
+	if err != nil {
+		r.Log.Error(err, "error fetching Namespace", "namespace", exportedName.Namespace)
+		return ctrl.Result{}, err
+	}
+	if !allowed {
+		return r.handleExportNamespaceNotAllowed(ctx, clusterId, serviceExport, exportedName)
+	}
+
+	if err = r.moveExport(ctx, clusterId, serviceExport, exportedName); err != nil {
+		return r.cloudMapErrorResult(serviceExport, err)
+	}
+
+	policy, err := GetServicePolicy(ctx, r.Client, exportedName)
 	if err != nil {
-		r.Log.Error(err, "error fetching Service from Cloud Map", "namespace", service.Namespace, "name", service.Name)
+		r.Log.Error(err, "error fetching ClusterSetPolicies", "namespace", exportedName.Namespace, "name", exportedName.Name)
 		return ctrl.Result{}, err
 	}
+	if !policy.AllowsExport(clusterId) {
+		return r.handleExportNotAllowed(ctx, clusterId, serviceExport, exportedName)
+	}
 
-	endpoints, err := r.extractEndpoints(ctx, service, serviceExport)
+	r.Log.Info("updating Cloud Map service", "namespace", exportedName.Namespace, "name", exportedName.Name)
+	cmService, err := r.createOrGetCloudMapService(ctx, exportedName)
+	if err != nil {
+		r.Log.Error(err, "error fetching Service from Cloud Map", "namespace", exportedName.Namespace, "name", exportedName.Name)
+		r.Recorder.Eventf(serviceExport, v1.EventTypeWarning, CloudMapErrorEventReason, "failed to fetch Cloud Map service: %s", err.Error())
+		return r.cloudMapErrorResult(serviceExport, err)
+	}
+
+	r.checkExportConflicts(serviceExport, service, cmService, clusterId)
+	r.checkExportedPorts(serviceExport, service)
+	r.checkCustomAttributes(serviceExport)
+	readinessPolicy := r.checkReadinessPolicy(serviceExport, service)
+	exportMode := r.checkExportMode(serviceExport, service)
+
+	endpoints, err := r.extractEndpoints(ctx, service, serviceExport, exportedName, readinessPolicy, exportMode)
 	if err != nil {
 		r.Log.Error(err, "error extracting Endpoints", "namespace", serviceExport.Namespace, "name", serviceExport.Name)
 		return ctrl.Result{}, err
 	}
 
+	if err = r.checkInstanceQuota(ctx, serviceExport, cmService, endpoints, clusterId); err != nil {
+		r.Log.Error(err, "error updating ServiceExport conditions", "namespace", serviceExport.Namespace, "name", serviceExport.Name)
+		return ctrl.Result{}, err
+	}
+
 	// Compute diff between Cloud Map and K8s endpoints, and apply changes
 	plan := model.Plan{
-		Current: cmService.GetEndpoints(clusterId),
+		Current: exportedEndpoints(cmService, clusterId, serviceExport),
 		Desired: endpoints,
 	}
 	changes := plan.CalculateChanges()
+	r.State.recordExportChanges(types.NamespacedName{Namespace: service.Namespace, Name: service.Name}, changes)
+
+	recordPlannedChanges(serviceExportControllerName, resourceCloudMapInstance, actionRegister, len(changes.Create)+len(changes.Update), r.DryRun)
+	recordPlannedChanges(serviceExportControllerName, resourceCloudMapInstance, actionDeregister, len(changes.Delete), r.DryRun)
+
+	if r.DryRun {
+		if !changes.IsNone() {
+			r.Log.Info("dry-run: computed changes to export to Cloud Map", "namespace", service.Namespace, "name", service.Name,
+				"register", changes.Create, "update", changes.Update, "deregister", changes.Delete)
+			recordDryRunEvent(r.Recorder, serviceExport, "would register %d and deregister %d endpoints in Cloud Map",
+				len(changes.Create)+len(changes.Update), len(changes.Delete))
+		}
+		return ctrl.Result{}, nil
+	}
 
 	if changes.HasUpdates() {
 		// merge creates and updates (Cloud Map RegisterEndpoints can handle both)
 		upserts := changes.Create
 		upserts = append(upserts, changes.Update...)
 
-		if err := r.CloudMap.RegisterEndpoints(ctx, service.Namespace, service.Name, upserts); err != nil {
+		if err := r.CloudMap.RegisterEndpoints(ctx, exportedName.Namespace, exportedName.Name, upserts); err != nil {
 			r.Log.Error(err, "error registering Endpoints to Cloud Map", "namespace", service.Namespace, "name", service.Name)
-			return ctrl.Result{}, err
+			r.Recorder.Eventf(serviceExport, v1.EventTypeWarning, CloudMapErrorEventReason, "failed to register endpoints: %s", err.Error())
+			return r.cloudMapErrorResult(serviceExport, err)
 		}
+		r.Recorder.Eventf(serviceExport, v1.EventTypeNormal, EndpointsRegisteredEventReason, "registered %d endpoints in Cloud Map", len(upserts))
 	}
 
 	if changes.HasDeletes() {
-		if err := r.CloudMap.DeleteEndpoints(ctx, service.Namespace, service.Name, changes.Delete); err != nil {
+		if err := r.CloudMap.DeleteEndpoints(ctx, exportedName.Namespace, exportedName.Name, changes.Delete); err != nil {
 			r.Log.Error(err, "error deleting Endpoints from Cloud Map", "namespace", cmService.Namespace, "name", cmService.Name)
-			return ctrl.Result{}, err
+			r.Recorder.Eventf(serviceExport, v1.EventTypeWarning, CloudMapErrorEventReason, "failed to deregister endpoints: %s", err.Error())
+			return r.cloudMapErrorResult(serviceExport, err)
 		}
+		r.Recorder.Eventf(serviceExport, v1.EventTypeNormal, EndpointsDeregisteredEventReason, "deregistered %d endpoints from Cloud Map", len(changes.Delete))
 	}
 
 	if changes.IsNone() {
@@ -149,7 +243,154 @@ func (r *ServiceExportReconciler) handleUpdate(ctx context.Context, clusterId st
 	return ctrl.Result{}, nil
 }
 
+// cloudMapErrorResult chooses when to reconcile the ServiceExport again from the class of a Cloud Map error.
+func (r *ServiceExportReconciler) cloudMapErrorResult(serviceExport *multiclusterv1alpha1.ServiceExport, err error) (ctrl.Result, error) {
+	// errors retried later are not returned to the caller, so they are recorded here
+	r.State.recordExportError(types.NamespacedName{Namespace: serviceExport.Namespace, Name: serviceExport.Name}, err)
+	return requeueResult(r.Log, err)
+}
+
+// checkExportConflicts records a conflict event when other clusters export the same Service with a different type.
+func (r *ServiceExportReconciler) checkExportConflicts(serviceExport *multiclusterv1alpha1.ServiceExport, service *v1.Service, cmService *model.Service, clusterId string) {
+	serviceType := ExtractServiceType(service)
+	for _, endpoint := range cmService.Endpoints {
+		if endpoint.ClusterId != clusterId && endpoint.ServiceType != serviceType {
+			r.Log.Info("conflicting ServiceExport", "namespace", service.Namespace, "name", service.Name,
+				"serviceType", serviceType, "conflictingServiceType", endpoint.ServiceType, "conflictingCluster", endpoint.ClusterId)
+			r.Recorder.Eventf(serviceExport, v1.EventTypeWarning, ExportConflictEventReason,
+				"service type %s conflicts with service type %s exported by cluster %s", serviceType, endpoint.ServiceType, endpoint.ClusterId)
+			return
+		}
+	}
+}
+
+// checkExportedPorts records a warning event when the exported ports annotation lists ports the Service does not have.
+func (r *ServiceExportReconciler) checkExportedPorts(serviceExport *multiclusterv1alpha1.ServiceExport, service *v1.Service) {
+	if unknown := UnknownExportedPorts(serviceExport, service); len(unknown) > 0 {
+		r.Log.Info("unknown exported ports", "namespace", service.Namespace, "name", service.Name, "ports", unknown)
+		r.Recorder.Eventf(serviceExport, v1.EventTypeWarning, UnknownExportedPortsEventReason,
+			"exported ports %s do not match any port of the service", strings.Join(unknown, ", "))
+	}
+}
+
+// checkCustomAttributes records a warning event when attribute annotations or pod label attributes of the
+// ServiceExport are not valid Cloud Map instance attributes.
+func (r *ServiceExportReconciler) checkCustomAttributes(serviceExport *multiclusterv1alpha1.ServiceExport) {
+	_, errs := CustomAttributes(serviceExport)
+	for _, key := range PodLabelAttributes(serviceExport) {
+		if err := model.ValidateCustomAttribute(key, ""); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		messages := make([]string, 0, len(errs))
+		for _, err := range errs {
+			messages = append(messages, err.Error())
+		}
+		r.Log.Info("invalid instance attributes", "namespace", serviceExport.Namespace, "name", serviceExport.Name, "errors", messages)
+		r.Recorder.Eventf(serviceExport, v1.EventTypeWarning, InvalidAttributesEventReason, "ignoring invalid instance attributes: %s", strings.Join(messages, "; "))
+	}
+}
+
+// checkTrafficAttributes returns the weight and priority instance attributes of the exported Service, and records a
+// warning event when the weight or priority of the cluster for the Service is invalid.
+func (r *ServiceExportReconciler) checkTrafficAttributes(serviceExport *multiclusterv1alpha1.ServiceExport, clusterWeight string, clusterPriority string) map[string]string {
+	attributes, errs := TrafficAttributes(serviceExport, clusterWeight, clusterPriority)
+	if len(errs) > 0 {
+		messages := make([]string, 0, len(errs))
+		for _, err := range errs {
+			messages = append(messages, err.Error())
+		}
+		r.Log.Info("invalid traffic policy", "namespace", serviceExport.Namespace, "name", serviceExport.Name, "errors", messages)
+		r.Recorder.Eventf(serviceExport, v1.EventTypeWarning, InvalidTrafficPolicyEventReason, "ignoring invalid traffic policy: %s", strings.Join(messages, "; "))
+	}
+	return attributes
+}
+
+// checkReadinessPolicy returns the ReadinessPolicy of the exported Service, and records a warning event when the
+// readiness policy annotation of the ServiceExport is invalid.
+func (r *ServiceExportReconciler) checkReadinessPolicy(serviceExport *multiclusterv1alpha1.ServiceExport, service *v1.Service) ReadinessPolicy {
+	policy, valid := ExportReadinessPolicy(service, serviceExport)
+	if !valid {
+		value := serviceExport.Annotations[ReadinessPolicyAnnotation]
+		r.Log.Info("invalid readiness policy", "namespace", serviceExport.Namespace, "name", serviceExport.Name, "readinessPolicy", value)
+		r.Recorder.Eventf(serviceExport, v1.EventTypeWarning, InvalidReadinessPolicyEventReason,
+			"invalid readiness policy %q, expected one of %s, %s or %s: using %s", value,
+			ExportAllEndpoints, ExportReadyEndpoints, PublishNotReadyEndpoints, policy)
+	}
+	return policy
+}
+
+// checkExportMode returns the ExportMode of the exported Service, and records a warning event when the export mode
+// annotation of the ServiceExport is invalid for the Service.
+func (r *ServiceExportReconciler) checkExportMode(serviceExport *multiclusterv1alpha1.ServiceExport, service *v1.Service) ExportMode {
+	mode, valid := ServiceExportMode(service, serviceExport)
+	if !valid {
+		value := serviceExport.Annotations[ExportModeAnnotation]
+		r.Log.Info("invalid export mode", "namespace", serviceExport.Namespace, "name", serviceExport.Name,
+			"exportMode", value, "serviceType", service.Spec.Type)
+		r.Recorder.Eventf(serviceExport, v1.EventTypeWarning, InvalidExportModeEventReason,
+			"invalid export mode %q for a service of type %s: using %s", value, service.Spec.Type, mode)
+	}
+	return mode
+}
+
+// checkInstanceQuota sets a warning condition on the ServiceExport when its Cloud Map service, once the endpoints of
+// this cluster are exported, approaches the quota of instances per service. The condition is cleared once the service
+// is back below the threshold.
+func (r *ServiceExportReconciler) checkInstanceQuota(ctx context.Context, serviceExport *multiclusterv1alpha1.ServiceExport, cmService *model.Service, endpoints []*model.Endpoint, clusterId string) error {
+	if r.InstanceQuota <= 0 {
+		return nil
+	}
+
+	instanceCount := len(cmService.Endpoints) - len(exportedEndpoints(cmService, clusterId, serviceExport)) + len(endpoints)
+	approached := float64(instanceCount) >= float64(r.InstanceQuota)*instanceQuotaWarningRatio
+	existing := meta.FindStatusCondition(serviceExport.Status.Conditions, string(ServiceExportInstanceQuotaApproached))
+	if !approached && (existing == nil || existing.Status == metav1.ConditionFalse) {
+		return nil
+	}
+
+	condition := metav1.Condition{
+		Type:    string(ServiceExportInstanceQuotaApproached),
+		Status:  metav1.ConditionFalse,
+		Reason:  "InstanceQuotaAvailable",
+		Message: fmt.Sprintf("the service has %d instances in Cloud Map, below %d%% of the quota of %d instances per service", instanceCount, int(instanceQuotaWarningRatio*100), r.InstanceQuota),
+	}
+	if approached {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = InstanceQuotaApproachedEventReason
+		condition.Message = fmt.Sprintf("the service has %d instances in Cloud Map, the quota is %d instances per service", instanceCount, r.InstanceQuota)
+	}
+	if existing != nil && existing.Status == condition.Status && existing.Message == condition.Message {
+		return nil
+	}
+
+	if approached {
+		r.Log.Info("Cloud Map service approaching the instance quota", "namespace", serviceExport.Namespace, "name", serviceExport.Name,
+			"instances", instanceCount, "quota", r.InstanceQuota)
+		r.Recorder.Event(serviceExport, v1.EventTypeWarning, InstanceQuotaApproachedEventReason, condition.Message)
+	}
+
+	recordPlannedChanges(serviceExportControllerName, resourceServiceExport, actionUpdate, 1, r.DryRun)
+	if r.DryRun {
+		r.Log.Info("dry-run: would update ServiceExport condition", "namespace", serviceExport.Namespace, "name", serviceExport.Name,
+			"type", condition.Type, "status", condition.Status)
+		return nil
+	}
+
+	meta.SetStatusCondition(&serviceExport.Status.Conditions, condition)
+	return r.Client.Update(ctx, serviceExport)
+}
+
 func (r *ServiceExportReconciler) addFinalizerAndOwnerRef(ctx context.Context, serviceExport *multiclusterv1alpha1.ServiceExport, service *v1.Service) error {
+	if r.DryRun {
+		if !controllerutil.ContainsFinalizer(serviceExport, ServiceExportFinalizer) || len(serviceExport.GetOwnerReferences()) == 0 {
+			recordPlannedChanges(serviceExportControllerName, resourceServiceExport, actionUpdate, 1, true)
+			r.Log.Info("dry-run: would add finalizer and owner reference", "Namespace", serviceExport.Namespace, "Name", serviceExport.Name)
+		}
+		return nil
+	}
+
 	// Add the finalizer to the service export if not present, ensures the ServiceExport won't be deleted
 	if !controllerutil.ContainsFinalizer(serviceExport, ServiceExportFinalizer) {
 		controllerutil.AddFinalizer(serviceExport, ServiceExportFinalizer)
@@ -171,19 +412,26 @@ func (r *ServiceExportReconciler) addFinalizerAndOwnerRef(ctx context.Context, s
 	return nil
 }
 
-func (r *ServiceExportReconciler) createOrGetCloudMapService(ctx context.Context, service *v1.Service) (*model.Service, error) {
-	cmService, err := r.CloudMap.GetService(ctx, service.Namespace, service.Name)
+func (r *ServiceExportReconciler) createOrGetCloudMapService(ctx context.Context, name types.NamespacedName) (*model.Service, error) {
+	cmService, err := r.CloudMap.GetFreshService(ctx, name.Namespace, name.Name)
 	if common.IsUnknown(err) {
 		return nil, err
 	}
 
 	if common.IsNotFound(err) {
-		err = r.CloudMap.CreateService(ctx, service.Namespace, service.Name)
+		recordPlannedChanges(serviceExportControllerName, resourceCloudMapService, actionCreate, 1, r.DryRun)
+		if r.DryRun {
+			r.Log.Info("dry-run: would create a new Service in Cloud Map", "namespace", name.Namespace, "name", name.Name)
+			// nothing is registered to a service that does not exist yet
+			return &model.Service{Namespace: name.Namespace, Name: name.Name}, nil
+		}
+
+		err = r.CloudMap.CreateService(ctx, name.Namespace, name.Name)
 		if err != nil {
-			r.Log.Error(err, "error creating a new Service in Cloud Map", "namespace", service.Namespace, "name", service.Name)
+			r.Log.Error(err, "error creating a new Service in Cloud Map", "namespace", name.Namespace, "name", name.Name)
 			return nil, err
 		}
-		if cmService, err = r.CloudMap.GetService(ctx, service.Namespace, service.Name); err != nil {
+		if cmService, err = r.CloudMap.GetFreshService(ctx, name.Namespace, name.Name); err != nil {
 			return nil, err
 		}
 	}
@@ -192,19 +440,23 @@ func (r *ServiceExportReconciler) createOrGetCloudMapService(ctx context.Context
 }
 
 func (r *ServiceExportReconciler) handleDelete(ctx context.Context, clusterId string, serviceExport *multiclusterv1alpha1.ServiceExport) (ctrl.Result, error) {
+	exportedName := previouslyExportedServiceName(serviceExport)
 	if controllerutil.ContainsFinalizer(serviceExport, ServiceExportFinalizer) {
 		r.Log.Info("removing service export", "namespace", serviceExport.Namespace, "name", serviceExport.Name)
 
-		cmService, err := r.CloudMap.GetService(ctx, serviceExport.Namespace, serviceExport.Name)
+		// the endpoints are registered to the clusterset service the Service was last exported as
+		cmService, err := r.CloudMap.GetFreshService(ctx, exportedName.Namespace, exportedName.Name)
 		if common.IsUnknown(err) {
-			r.Log.Error(err, "error fetching Service from Cloud Map", "namespace", serviceExport.Namespace, "name", serviceExport.Name)
+			r.Log.Error(err, "error fetching Service from Cloud Map", "namespace", exportedName.Namespace, "name", exportedName.Name)
+			r.Recorder.Eventf(serviceExport, v1.EventTypeWarning, CloudMapErrorEventReason, "failed to fetch Cloud Map service: %s", err.Error())
 			return ctrl.Result{}, err
 		}
-		if cmService != nil {
-			if err := r.CloudMap.DeleteEndpoints(ctx, cmService.Namespace, cmService.Name, cmService.GetEndpoints(clusterId)); err != nil {
-				r.Log.Error(err, "error deleting Endpoints from Cloud Map", "namespace", cmService.Namespace, "name", cmService.Name)
-				return ctrl.Result{}, err
-			}
+		if err = r.deregisterEndpoints(ctx, clusterId, serviceExport, cmService); err != nil {
+			return r.cloudMapErrorResult(serviceExport, err)
+		}
+		if r.DryRun {
+			r.Log.Info("dry-run: would remove finalizer", "namespace", serviceExport.Namespace, "name", serviceExport.Name)
+			return ctrl.Result{}, nil
 		}
 
 		// Remove finalizer. Once all finalizers have been
@@ -218,7 +470,144 @@ func (r *ServiceExportReconciler) handleDelete(ctx context.Context, clusterId st
 	return ctrl.Result{}, nil
 }
 
-func (r *ServiceExportReconciler) extractEndpoints(ctx context.Context, svc *v1.Service, svcExport *multiclusterv1alpha1.ServiceExport) ([]*model.Endpoint, error) {
+// isExportNamespaceAllowed returns true if the namespace a ServiceExport exports its Service to allows exports from the
+// namespace of the ServiceExport. Exports to namespaces which do not exist in the cluster are not allowed.
+func (r *ServiceExportReconciler) isExportNamespaceAllowed(ctx context.Context, serviceExport *multiclusterv1alpha1.ServiceExport, exportedName types.NamespacedName) (bool, error) {
+	if exportedName.Namespace == serviceExport.Namespace {
+		return true, nil
+	}
+	namespace := v1.Namespace{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: exportedName.Namespace}, &namespace); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return IsExportNamespaceAllowed(&namespace, serviceExport.Namespace), nil
+}
+
+// handleExportNamespaceNotAllowed de-registers the endpoints of a Service exported to a namespace which does not allow
+// exports from the namespace of its ServiceExport, without creating its Cloud Map service.
+func (r *ServiceExportReconciler) handleExportNamespaceNotAllowed(ctx context.Context, clusterId string, serviceExport *multiclusterv1alpha1.ServiceExport, exportedName types.NamespacedName) (ctrl.Result, error) {
+	r.Log.Info("export namespace not allowed", "namespace", serviceExport.Namespace, "name", serviceExport.Name,
+		"exportedName", exportedName.String())
+	r.Recorder.Eventf(serviceExport, v1.EventTypeWarning, ExportNamespaceNotAllowedEventReason,
+		"namespace %s does not allow exports from namespace %s", exportedName.Namespace, serviceExport.Namespace)
+	return r.withdrawExport(ctx, clusterId, serviceExport, exportedName)
+}
+
+// handleExportNotAllowed de-registers the endpoints of a Service which ClusterSetPolicies do not allow this cluster
+// to export, without creating its Cloud Map service.
+func (r *ServiceExportReconciler) handleExportNotAllowed(ctx context.Context, clusterId string, serviceExport *multiclusterv1alpha1.ServiceExport, exportedName types.NamespacedName) (ctrl.Result, error) {
+	r.Log.Info("export not allowed by ClusterSetPolicies", "namespace", serviceExport.Namespace, "name", serviceExport.Name,
+		"exportedName", exportedName.String(), "clusterId", clusterId)
+	r.Recorder.Eventf(serviceExport, v1.EventTypeWarning, ExportNotAllowedEventReason,
+		"cluster %s is not allowed to export %s by ClusterSetPolicies", clusterId, exportedName)
+	return r.withdrawExport(ctx, clusterId, serviceExport, exportedName)
+}
+
+// withdrawExport de-registers the endpoints of the Service of a ServiceExport from a clusterset service, if any.
+func (r *ServiceExportReconciler) withdrawExport(ctx context.Context, clusterId string, serviceExport *multiclusterv1alpha1.ServiceExport, exportedName types.NamespacedName) (ctrl.Result, error) {
+	cmService, err := r.CloudMap.GetFreshService(ctx, exportedName.Namespace, exportedName.Name)
+	if common.IsUnknown(err) {
+		r.Log.Error(err, "error fetching Service from Cloud Map", "namespace", exportedName.Namespace, "name", exportedName.Name)
+		r.Recorder.Eventf(serviceExport, v1.EventTypeWarning, CloudMapErrorEventReason, "failed to fetch Cloud Map service: %s", err.Error())
+		return r.cloudMapErrorResult(serviceExport, err)
+	}
+	if cmService == nil || len(exportedEndpoints(cmService, clusterId, serviceExport)) == 0 {
+		return ctrl.Result{}, nil
+	}
+	if err = r.deregisterEndpoints(ctx, clusterId, serviceExport, cmService); err != nil {
+		return r.cloudMapErrorResult(serviceExport, err)
+	}
+	return ctrl.Result{}, nil
+}
+
+// moveExport de-registers the endpoints of the Service from the clusterset service it was previously exported as when
+// its export name changed, and records the clusterset service it is now exported as on the ServiceExport.
+func (r *ServiceExportReconciler) moveExport(ctx context.Context, clusterId string, serviceExport *multiclusterv1alpha1.ServiceExport, exportedName types.NamespacedName) error {
+	previousName := previouslyExportedServiceName(serviceExport)
+	if previousName != exportedName {
+		r.Log.Info("export name changed", "namespace", serviceExport.Namespace, "name", serviceExport.Name,
+			"previous", previousName.String(), "current", exportedName.String())
+		cmService, err := r.CloudMap.GetFreshService(ctx, previousName.Namespace, previousName.Name)
+		if common.IsUnknown(err) {
+			r.Log.Error(err, "error fetching Service from Cloud Map", "namespace", previousName.Namespace, "name", previousName.Name)
+			r.Recorder.Eventf(serviceExport, v1.EventTypeWarning, CloudMapErrorEventReason, "failed to fetch Cloud Map service: %s", err.Error())
+			return err
+		}
+		if err = r.deregisterEndpoints(ctx, clusterId, serviceExport, cmService); err != nil {
+			return err
+		}
+		if !r.DryRun {
+			r.Recorder.Eventf(serviceExport, v1.EventTypeNormal, ExportMovedEventReason, "moved export from %s to %s", previousName, exportedName)
+		}
+	}
+
+	annotation := ""
+	if exportedName != (types.NamespacedName{Namespace: serviceExport.Namespace, Name: serviceExport.Name}) {
+		annotation = exportedName.String()
+	}
+	if serviceExport.Annotations[ExportedServiceAnnotation] == annotation {
+		return nil
+	}
+
+	recordPlannedChanges(serviceExportControllerName, resourceServiceExport, actionUpdate, 1, r.DryRun)
+	if r.DryRun {
+		r.Log.Info("dry-run: would record the exported service", "namespace", serviceExport.Namespace, "name", serviceExport.Name,
+			"exportedService", exportedName.String())
+		return nil
+	}
+	if annotation == "" {
+		delete(serviceExport.Annotations, ExportedServiceAnnotation)
+	} else {
+		if serviceExport.Annotations == nil {
+			serviceExport.Annotations = make(map[string]string)
+		}
+		serviceExport.Annotations[ExportedServiceAnnotation] = annotation
+	}
+	return r.Client.Update(ctx, serviceExport)
+}
+
+// deregisterEndpoints de-registers the endpoints of the Service of a ServiceExport from a Cloud Map service, if any.
+func (r *ServiceExportReconciler) deregisterEndpoints(ctx context.Context, clusterId string, serviceExport *multiclusterv1alpha1.ServiceExport, cmService *model.Service) error {
+	if cmService == nil {
+		return nil
+	}
+
+	endpoints := exportedEndpoints(cmService, clusterId, serviceExport)
+	recordPlannedChanges(serviceExportControllerName, resourceCloudMapInstance, actionDeregister, len(endpoints), r.DryRun)
+	if r.DryRun {
+		r.Log.Info("dry-run: would deregister endpoints from Cloud Map", "namespace", cmService.Namespace, "name", cmService.Name, "endpoints", endpoints)
+		recordDryRunEvent(r.Recorder, serviceExport, "would deregister %d endpoints from Cloud Map", len(endpoints))
+		return nil
+	}
+
+	if err := r.CloudMap.DeleteEndpoints(ctx, cmService.Namespace, cmService.Name, endpoints); err != nil {
+		r.Log.Error(err, "error deleting Endpoints from Cloud Map", "namespace", cmService.Namespace, "name", cmService.Name)
+		r.Recorder.Eventf(serviceExport, v1.EventTypeWarning, CloudMapErrorEventReason, "failed to deregister endpoints: %s", err.Error())
+		return err
+	}
+	r.Recorder.Eventf(serviceExport, v1.EventTypeNormal, EndpointsDeregisteredEventReason, "deregistered %d endpoints from Cloud Map", len(endpoints))
+	return nil
+}
+
+// exportedEndpoints returns the endpoints of a Cloud Map service registered by this cluster for the Service of a
+// ServiceExport. Services exported under another name are identified by the SourceServiceAttr attribute of their
+// endpoints, as several Services of the cluster may be exported as the same clusterset service.
+func exportedEndpoints(cmService *model.Service, clusterId string, serviceExport *multiclusterv1alpha1.ServiceExport) (endpoints []*model.Endpoint) {
+	source := types.NamespacedName{Namespace: serviceExport.Namespace, Name: serviceExport.Name}
+	sameName := cmService.Namespace == source.Namespace && cmService.Name == source.Name
+	for _, endpoint := range cmService.GetEndpoints(clusterId) {
+		endpointSource, found := endpoint.Attributes[model.SourceServiceAttr]
+		if endpointSource == source.String() || (!found && sameName) {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
+
+func (r *ServiceExportReconciler) extractEndpoints(ctx context.Context, svc *v1.Service, svcExport *multiclusterv1alpha1.ServiceExport, exportedName types.NamespacedName, readinessPolicy ReadinessPolicy, exportMode ExportMode) ([]*model.Endpoint, error) {
 	clusterProperties, err := r.ClusterUtils.GetClusterProperties(ctx)
 	if err != nil {
 		r.Log.Error(err, "unable to retrieve ClusterId and ClusterSetId")
@@ -226,8 +615,13 @@ func (r *ServiceExportReconciler) extractEndpoints(ctx context.Context, svc *v1.
 	}
 
 	endpointSlices := discovery.EndpointSliceList{}
-	err = r.Client.List(ctx, &endpointSlices,
-		client.InNamespace(svc.Namespace), client.MatchingLabels{discovery.LabelServiceName: svc.Name})
+	if exportMode == EndpointsExportMode {
+		err = r.Client.List(ctx, &endpointSlices,
+			client.InNamespace(svc.Namespace), client.MatchingLabels{discovery.LabelServiceName: svc.Name})
+	} else {
+		// the load balancer or external name of the Service is exported in place of its endpoints
+		endpointSlices.Items = ServiceAddressEndpointSlices(svc, exportMode)
+	}
 
 	if err != nil {
 		return nil, err
@@ -245,23 +639,46 @@ func (r *ServiceExportReconciler) extractEndpoints(ctx context.Context, svc *v1.
 		svcExportCreationTimestamp = svcExport.ObjectMeta.CreationTimestamp.Time.UnixMilli()
 	}
 
-	attributes := make(map[string]string)
-	attributes[model.K8sVersionAttr] = version.GetPackageVersion()
+	baseAttributes := make(map[string]string)
+	baseAttributes[model.K8sVersionAttr] = version.GetPackageVersion()
+	if exportedName.Namespace != svc.Namespace || exportedName.Name != svc.Name {
+		baseAttributes[model.SourceServiceAttr] = types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}.String()
+	}
+	for key, value := range r.checkTrafficAttributes(svcExport, clusterProperties.Weight(), clusterProperties.Priority()) {
+		baseAttributes[key] = value
+	}
+	customAttributes, _ := CustomAttributes(svcExport)
+	podLabels := newPodLabelReader(r.Client, svc.Namespace, PodLabelAttributes(svcExport))
 
 	endpoints := make([]*model.Endpoint, 0)
+	exceedingLimits := 0
 	for _, slice := range endpointSlices.Items {
 		for _, endpointPort := range slice.Ports {
+			servicePort := servicePortMap[*endpointPort.Name]
+			if !IsPortExported(svcExport, servicePort) {
+				continue
+			}
 			for _, endpoint := range slice.Endpoints {
 				port := EndpointPortToPort(endpointPort)
 				readyCondition := aws.ToBool(endpoint.Conditions.Ready)
+				switch {
+				case readinessPolicy == ExportReadyEndpoints && !readyCondition:
+					continue
+				case readinessPolicy == PublishNotReadyEndpoints:
+					readyCondition = true
+				}
+				labels, err := podLabels.read(ctx, endpoint.TargetRef)
+				if err != nil {
+					return nil, err
+				}
 
 				for _, IP := range endpoint.Addresses {
-					endpoints = append(endpoints, &model.Endpoint{
+					ep := &model.Endpoint{
 						Id:                             model.EndpointIdFromIPAddressAndPort(IP, port),
 						IP:                             IP,
 						AddressType:                    slice.AddressType,
 						EndpointPort:                   port,
-						ServicePort:                    servicePortMap[*endpointPort.Name],
+						ServicePort:                    servicePort,
 						ClusterId:                      clusterProperties.ClusterId(),
 						ClusterSetId:                   clusterProperties.ClusterSetId(),
 						ServiceType:                    serviceType,
@@ -269,18 +686,108 @@ func (r *ServiceExportReconciler) extractEndpoints(ctx context.Context, svc *v1.
 						Ready:                          readyCondition,
 						Hostname:                       aws.ToString(endpoint.Hostname),
 						Nodename:                       aws.ToString(endpoint.NodeName),
-						Attributes:                     attributes,
-					})
+						Attributes:                     mergeAttributes(baseAttributes, customAttributes, labels),
+					}
+					if model.ValidateCloudMapAttributes(ep.GetCloudMapAttributes()) != nil {
+						// registering the instance without its user-defined attributes keeps the endpoint reachable
+						exceedingLimits++
+						ep.Attributes = mergeAttributes(baseAttributes)
+					}
+					endpoints = append(endpoints, ep)
 				}
 			}
 		}
 	}
 
+	if exceedingLimits > 0 {
+		r.Log.Info("instance attributes exceed the Cloud Map limits", "namespace", svc.Namespace, "name", svc.Name, "endpoints", exceedingLimits)
+		r.Recorder.Eventf(svcExport, v1.EventTypeWarning, InvalidAttributesEventReason,
+			"user-defined attributes of %d endpoints exceed the Cloud Map limits of %d attributes and %d characters per instance, and were not registered",
+			exceedingLimits, model.MaxCustomAttributes, model.MaxAttributesLength)
+	}
+
 	return endpoints, nil
 }
 
+// mergeAttributes returns a new map with the attributes of all the given maps, later maps taking precedence.
+func mergeAttributes(attributeMaps ...map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for _, attributes := range attributeMaps {
+		for key, value := range attributes {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// podLabelReader reads the labels of the pods backing endpoints which are registered as instance attributes, reading
+// the metadata of each pod once.
+type podLabelReader struct {
+	client    client.Reader
+	namespace string
+	keys      []string
+	labels    map[string]map[string]string
+}
+
+func newPodLabelReader(client client.Reader, namespace string, keys []string) *podLabelReader {
+	return &podLabelReader{
+		client:    client,
+		namespace: namespace,
+		keys:      keys,
+		labels:    make(map[string]map[string]string),
+	}
+}
+
+// read returns the labels registered as attributes of the pod referenced by an endpoint. Endpoints which are not
+// backed by a pod, or whose pod no longer exists, have no label attributes.
+func (p *podLabelReader) read(ctx context.Context, targetRef *v1.ObjectReference) (map[string]string, error) {
+	if len(p.keys) == 0 || targetRef == nil || targetRef.Kind != "Pod" {
+		return nil, nil
+	}
+	if labels, found := p.labels[targetRef.Name]; found {
+		return labels, nil
+	}
+
+	// only the metadata of pods is cached
+	pod := &metav1.PartialObjectMetadata{}
+	pod.SetGroupVersionKind(v1.SchemeGroupVersion.WithKind("Pod"))
+	err := p.client.Get(ctx, types.NamespacedName{Namespace: p.namespace, Name: targetRef.Name}, pod)
+	if client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+
+	labels := make(map[string]string)
+	for _, key := range p.keys {
+		value, found := pod.Labels[key]
+		if found && model.ValidateCustomAttribute(key, value) == nil {
+			labels[key] = value
+		}
+	}
+	p.labels[targetRef.Name] = labels
+	return labels, nil
+}
+
 func (r *ServiceExportReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	if r.Recorder == nil {
+		r.Recorder = noopEventRecorder{}
+	}
+	policyInstalled, err := IsClusterSetPolicyInstalled(mgr.GetRESTMapper())
+	if err != nil {
+		return err
+	}
+	// Index the ServiceExports with pod label attributes, so pod events are mapped without listing the other exports
+	err = mgr.GetFieldIndexer().IndexField(context.Background(), &multiclusterv1alpha1.ServiceExport{}, podLabelAttributesIndex,
+		func(object client.Object) []string {
+			if len(PodLabelAttributes(object.(*multiclusterv1alpha1.ServiceExport))) == 0 {
+				return nil
+			}
+			return []string{"true"}
+		})
+	if err != nil {
+		return err
+	}
+
+	bldr := ctrl.NewControllerManagedBy(mgr).
 		For(&multiclusterv1alpha1.ServiceExport{}).
 		// Filter-out all the events if the cluster-properties are not found
 		WithEventFilter(r.clusterPropertyFilter()).
@@ -297,12 +804,38 @@ func (r *ServiceExportReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			handler.EnqueueRequestsFromMapFunc(r.endpointSliceMappingFunction()),
 			builder.WithPredicates(r.serviceExportPredicates()),
 		).
+		// Watch for changes to the labels of pods, registered as attributes of the endpoints of the ServiceExports
+		// with pod label attributes. Only the metadata of pods is cached.
+		Watches(
+			&source.Kind{Type: &v1.Pod{}},
+			handler.EnqueueRequestsFromMapFunc(r.podMappingFunction()),
+			builder.OnlyMetadata,
+			builder.WithPredicates(predicate.LabelChangedPredicate{}),
+		).
+		// Watch for changes to the annotations of Namespaces, to export or de-register the services exported to them
+		Watches(
+			&source.Kind{Type: &v1.Namespace{}},
+			handler.EnqueueRequestsFromMapFunc(r.namespaceMappingFunction()),
+			builder.WithPredicates(predicate.AnnotationChangedPredicate{}),
+		).
 		// Watch for changes to ClusterProperty objects. If a ClusterProperty object is
 		// created, updated or deleted, the controller will reconcile all service exports
 		Watches(
 			&source.Kind{Type: &aboutv1alpha1.ClusterProperty{}},
 			handler.EnqueueRequestsFromMapFunc(r.clusterPropertyMappingFunction()),
-		).
+		)
+
+	if policyInstalled {
+		// Watch for changes to ClusterSetPolicy objects, to export or de-register the services they apply to
+		bldr = bldr.Watches(
+			&source.Kind{Type: &policyv1alpha1.ClusterSetPolicy{}},
+			handler.EnqueueRequestsFromMapFunc(r.clusterSetPolicyMappingFunction()),
+		)
+	} else {
+		r.Log.Info("ClusterSetPolicy CRD not installed, ClusterSetPolicies are not watched")
+	}
+
+	return bldr.
 		WithOptions(controller.Options{
 			// rate-limiting is applied to reconcile responses with an error
 			// We are increasing the base delay to 500ms, defaults baseDelay: 5ms, maxDelay: 1000s
@@ -350,6 +883,88 @@ func (r *ServiceExportReconciler) clusterPropertyMappingFunction() handler.MapFu
 	}
 }
 
+func (r *ServiceExportReconciler) podMappingFunction() handler.MapFunc {
+	// Return reconcile requests for the service exports with pod label attributes whose service selects a pod
+	return func(object client.Object) []reconcile.Request {
+		serviceExports := &multiclusterv1alpha1.ServiceExportList{}
+		if err := r.Client.List(context.TODO(), serviceExports, client.InNamespace(object.GetNamespace()),
+			client.MatchingFields{podLabelAttributesIndex: "true"}); err != nil {
+			r.Log.Error(err, "error listing ServiceExports")
+			return nil
+		}
+		if len(serviceExports.Items) == 0 {
+			return nil
+		}
+
+		result := make([]reconcile.Request, 0)
+		for _, serviceExport := range serviceExports.Items {
+			if len(PodLabelAttributes(&serviceExport)) == 0 {
+				continue
+			}
+			name := types.NamespacedName{Namespace: serviceExport.Namespace, Name: serviceExport.Name}
+			service := v1.Service{}
+			if err := r.Client.Get(context.TODO(), name, &service); err != nil {
+				continue
+			}
+			// the endpoints of services without selector may reference any pod
+			if len(service.Spec.Selector) == 0 || labels.SelectorFromSet(service.Spec.Selector).Matches(labels.Set(object.GetLabels())) {
+				result = append(result, reconcile.Request{NamespacedName: name})
+			}
+		}
+		return result
+	}
+}
+
+func (r *ServiceExportReconciler) namespaceMappingFunction() handler.MapFunc {
+	// Return reconcile requests for the service exports of other namespaces exporting their service to a namespace
+	return func(object client.Object) []reconcile.Request {
+		serviceExports := &multiclusterv1alpha1.ServiceExportList{}
+		if err := r.Client.List(context.TODO(), serviceExports); err != nil {
+			r.Log.Error(err, "error listing ServiceExports")
+			return nil
+		}
+
+		result := make([]reconcile.Request, 0)
+		for _, serviceExport := range serviceExports.Items {
+			if serviceExport.Namespace != object.GetName() && ExportedServiceName(&serviceExport).Namespace == object.GetName() {
+				result = append(result, reconcile.Request{NamespacedName: types.NamespacedName{
+					Name:      serviceExport.Name,
+					Namespace: serviceExport.Namespace,
+				}})
+			}
+		}
+		return result
+	}
+}
+
+func (r *ServiceExportReconciler) clusterSetPolicyMappingFunction() handler.MapFunc {
+	// Return reconcile requests for the service exports of the clusterset services a policy applies to
+	return func(object client.Object) []reconcile.Request {
+		policy, ok := object.(*policyv1alpha1.ClusterSetPolicy)
+		if !ok {
+			return nil
+		}
+
+		serviceExports := &multiclusterv1alpha1.ServiceExportList{}
+		if err := r.Client.List(context.TODO(), serviceExports); err != nil {
+			r.Log.Error(err, "error listing ServiceExports")
+			return nil
+		}
+
+		result := make([]reconcile.Request, 0)
+		for _, serviceExport := range serviceExports.Items {
+			exportedName := ExportedServiceName(&serviceExport)
+			if exportedName.Namespace == policy.Namespace && policyAppliesTo(policy, exportedName.Name) {
+				result = append(result, reconcile.Request{NamespacedName: types.NamespacedName{
+					Name:      serviceExport.Name,
+					Namespace: serviceExport.Namespace,
+				}})
+			}
+		}
+		return result
+	}
+}
+
 func (r *ServiceExportReconciler) serviceExportPredicates() predicate.Funcs {
 	return predicate.Funcs{
 		GenericFunc: func(e event.GenericEvent) bool {
@@ -2,14 +2,20 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 
 	cloudmapMock "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/mocks/pkg/cloudmap"
 	aboutv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/about/v1alpha1"
 	multiclusterv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/multicluster/v1alpha1"
+	policyv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/policy/v1alpha1"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/cloudmap"
 	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/common"
 	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
 	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/test"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sdTypes "github.com/aws/aws-sdk-go-v2/service/servicediscovery/types"
 	"github.com/go-logr/logr/testr"
 	"github.com/golang/mock/gomock"
 
@@ -18,11 +24,15 @@ import (
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/core/v1"
 	discovery "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 func TestServiceExportReconciler_Reconcile_NewServiceExport(t *testing.T) {
@@ -43,9 +53,9 @@ func TestServiceExportReconciler_Reconcile_NewServiceExport(t *testing.T) {
 	// expected interactions with the Cloud Map client
 	// The first get call is expected to return nil, then second call after the creation of service is
 	// supposed to return the value
-	first := mock.EXPECT().GetService(gomock.Any(), test.HttpNsName, test.SvcName).
+	first := mock.EXPECT().GetFreshService(gomock.Any(), test.HttpNsName, test.SvcName).
 		Return(nil, common.NotFoundError(""))
-	second := mock.EXPECT().GetService(gomock.Any(), test.HttpNsName, test.SvcName).
+	second := mock.EXPECT().GetFreshService(gomock.Any(), test.HttpNsName, test.SvcName).
 		Return(&model.Service{Namespace: test.HttpNsName, Name: test.SvcName}, nil)
 	gomock.InOrder(first, second)
 	mock.EXPECT().CreateService(gomock.Any(), test.HttpNsName, test.SvcName).Return(nil).Times(1)
@@ -72,6 +82,50 @@ func TestServiceExportReconciler_Reconcile_NewServiceExport(t *testing.T) {
 	err = fakeClient.Get(context.TODO(), types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName}, serviceExport)
 	assert.NoError(t, err)
 	assert.Contains(t, serviceExport.Finalizers, ServiceExportFinalizer, "Finalizer added to the service export")
+
+	events := reconciler.Recorder.(*record.FakeRecorder).Events
+	assert.Equal(t, "Normal EndpointsRegistered registered 1 endpoints in Cloud Map", <-events)
+}
+
+func TestServiceExportReconciler_Reconcile_OperationTimeout(t *testing.T) {
+	// create a fake controller client and add some objects
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(getServiceExportScheme()).
+		WithObjects(k8sServiceForTest(), serviceExportForTest(), test.ClusterIdForTest(), test.ClusterSetIdForTest()).
+		WithLists(&discovery.EndpointSliceList{
+			Items: []discovery.EndpointSlice{*endpointSliceForTest()},
+		}).
+		Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	mock := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mock.EXPECT().GetFreshService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(&model.Service{Namespace: test.HttpNsName, Name: test.SvcName}, nil)
+	// the registration did not complete in time
+	timeoutErr := &cloudmap.OperationTimeoutError{OperationId: test.OpId1, OperationType: sdTypes.OperationTypeRegisterInstance}
+	mock.EXPECT().RegisterEndpoints(gomock.Any(), test.HttpNsName, test.SvcName,
+		[]*model.Endpoint{test.GetTestEndpoint1()}).Return(timeoutErr)
+
+	reconciler := getServiceExportReconciler(t, mock, fakeClient)
+	reconciler.State = NewReconcileState()
+
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: test.HttpNsName,
+			Name:      test.SvcName,
+		},
+	}
+
+	got, err := reconciler.Reconcile(context.Background(), request)
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: transientRequeueDelay}, got, "Requeue after operation timeout")
+
+	// the computed changes and the error retried later are recorded for the debug endpoint
+	svcState := reconciler.State.Services()[request.NamespacedName.String()]
+	assert.Equal(t, []*model.Endpoint{test.GetTestEndpoint1()}, svcState.ExportChanges.Create)
+	assert.Equal(t, common.ErrorClassTransient, svcState.ExportError.Class)
 }
 
 func TestServiceExportReconciler_Reconcile_ExistingServiceExport(t *testing.T) {
@@ -90,7 +144,7 @@ func TestServiceExportReconciler_Reconcile_ExistingServiceExport(t *testing.T) {
 	mock := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
 
 	// GetService from Cloudmap returns endpoint1 and endpoint2
-	mock.EXPECT().GetService(gomock.Any(), test.HttpNsName, test.SvcName).
+	mock.EXPECT().GetFreshService(gomock.Any(), test.HttpNsName, test.SvcName).
 		Return(test.GetTestService(), nil)
 	// call to delete the endpoint not present in the k8s cluster
 	mock.EXPECT().DeleteEndpoints(gomock.Any(), test.HttpNsName, test.SvcName,
@@ -118,6 +172,505 @@ func TestServiceExportReconciler_Reconcile_ExistingServiceExport(t *testing.T) {
 	assert.Contains(t, serviceExport.Finalizers, ServiceExportFinalizer, "Finalizer added to the service export")
 }
 
+func TestServiceExportReconciler_Reconcile_InstanceQuota(t *testing.T) {
+	// create a fake controller client and add some objects
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(getServiceExportScheme()).
+		WithObjects(k8sServiceForTest(), serviceExportForTest(), test.ClusterIdForTest(), test.ClusterSetIdForTest()).
+		WithLists(&discovery.EndpointSliceList{
+			Items: []discovery.EndpointSlice{*endpointSliceForTest()},
+		}).
+		Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	// GetService from Cloudmap returns endpoint1 of this cluster and endpoint2 of another cluster
+	mock := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mock.EXPECT().GetFreshService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(test.GetTestMulticlusterService(), nil).Times(2)
+
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: test.HttpNsName,
+			Name:      test.SvcName,
+		},
+	}
+
+	reconciler := getServiceExportReconciler(t, mock, fakeClient)
+	reconciler.InstanceQuota = 2
+
+	_, err := reconciler.Reconcile(context.Background(), request)
+	assert.NoError(t, err)
+
+	serviceExport := &multiclusterv1alpha1.ServiceExport{}
+	err = fakeClient.Get(context.TODO(), request.NamespacedName, serviceExport)
+	assert.NoError(t, err)
+	condition := meta.FindStatusCondition(serviceExport.Status.Conditions, string(ServiceExportInstanceQuotaApproached))
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, metav1.ConditionTrue, condition.Status)
+		assert.Equal(t, "the service has 2 instances in Cloud Map, the quota is 2 instances per service", condition.Message)
+	}
+
+	events := reconciler.Recorder.(*record.FakeRecorder).Events
+	assert.Equal(t, "Warning InstanceQuotaApproached the service has 2 instances in Cloud Map, the quota is 2 instances per service", <-events)
+
+	// the condition is cleared once the service is below the threshold
+	reconciler.InstanceQuota = 10
+	_, err = reconciler.Reconcile(context.Background(), request)
+	assert.NoError(t, err)
+
+	err = fakeClient.Get(context.TODO(), request.NamespacedName, serviceExport)
+	assert.NoError(t, err)
+	condition = meta.FindStatusCondition(serviceExport.Status.Conditions, string(ServiceExportInstanceQuotaApproached))
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	}
+}
+
+func TestServiceExportReconciler_Reconcile_ExportName(t *testing.T) {
+	// the service was exported under its own name, and is now exported under an alias
+	serviceExport := serviceExportForTest()
+	serviceExport.Annotations = map[string]string{ExportNameAnnotation: "alias"}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(getServiceExportScheme()).
+		WithObjects(k8sServiceForTest(), serviceExport, test.ClusterIdForTest(), test.ClusterSetIdForTest()).
+		WithLists(&discovery.EndpointSliceList{
+			Items: []discovery.EndpointSlice{*endpointSliceForTest()},
+		}).
+		Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	mock := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	// the endpoints are de-registered from the service previously exported
+	mock.EXPECT().GetFreshService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(test.GetTestMulticlusterService(), nil)
+	mock.EXPECT().DeleteEndpoints(gomock.Any(), test.HttpNsName, test.SvcName,
+		[]*model.Endpoint{test.GetTestEndpoint1()}).Return(nil)
+	// and registered to the alias, with the name of the exported service
+	first := mock.EXPECT().GetFreshService(gomock.Any(), test.HttpNsName, "alias").
+		Return(nil, common.NotFoundError(""))
+	second := mock.EXPECT().GetFreshService(gomock.Any(), test.HttpNsName, "alias").
+		Return(&model.Service{Namespace: test.HttpNsName, Name: "alias"}, nil)
+	gomock.InOrder(first, second)
+	mock.EXPECT().CreateService(gomock.Any(), test.HttpNsName, "alias").Return(nil)
+	endpoint := test.GetTestEndpoint1()
+	endpoint.Attributes[model.SourceServiceAttr] = test.HttpNsName + "/" + test.SvcName
+	mock.EXPECT().RegisterEndpoints(gomock.Any(), test.HttpNsName, "alias", []*model.Endpoint{endpoint}).Return(nil)
+
+	reconciler := getServiceExportReconciler(t, mock, fakeClient)
+
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: test.HttpNsName,
+			Name:      test.SvcName,
+		},
+	}
+
+	_, err := reconciler.Reconcile(context.Background(), request)
+	assert.NoError(t, err)
+
+	// the alias is recorded to de-register the endpoints on deletion
+	err = fakeClient.Get(context.TODO(), request.NamespacedName, serviceExport)
+	assert.NoError(t, err)
+	assert.Equal(t, test.HttpNsName+"/alias", serviceExport.Annotations[ExportedServiceAnnotation])
+
+	events := reconciler.Recorder.(*record.FakeRecorder).Events
+	assert.Equal(t, "Normal EndpointsDeregistered deregistered 1 endpoints from Cloud Map", <-events)
+	assert.Equal(t, "Normal ExportMoved moved export from "+test.HttpNsName+"/"+test.SvcName+" to "+test.HttpNsName+"/alias", <-events)
+	assert.Equal(t, "Normal EndpointsRegistered registered 1 endpoints in Cloud Map", <-events)
+}
+
+func TestServiceExportReconciler_Reconcile_InvalidExportName(t *testing.T) {
+	serviceExport := serviceExportForTest()
+	serviceExport.Annotations = map[string]string{ExportNameAnnotation: "Invalid_Name"}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(getServiceExportScheme()).
+		WithObjects(k8sServiceForTest(), serviceExport, test.ClusterIdForTest(), test.ClusterSetIdForTest()).
+		Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	// no calls to Cloud Map are expected
+	mock := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	reconciler := getServiceExportReconciler(t, mock, fakeClient)
+
+	got, err := reconciler.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, got)
+
+	events := reconciler.Recorder.(*record.FakeRecorder).Events
+	assert.Contains(t, <-events, "Warning InvalidExportName invalid export name "+test.HttpNsName+"/Invalid_Name")
+}
+
+func TestServiceExportReconciler_Reconcile_ExportNamespaceNotAllowed(t *testing.T) {
+	// the service was exported to another namespace, which does not allow exports from the namespace of the service
+	serviceExport := serviceExportForTest()
+	serviceExport.Annotations = map[string]string{
+		ExportNamespaceAnnotation: "shared",
+		ExportedServiceAnnotation: "shared/" + test.SvcName,
+	}
+	namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "shared",
+		Annotations: map[string]string{AllowedExportNamespacesAnnotation: "other"},
+	}}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(getServiceExportScheme()).
+		WithObjects(k8sServiceForTest(), serviceExport, namespace, test.ClusterIdForTest(), test.ClusterSetIdForTest()).
+		Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	// the endpoints are de-registered from the other namespace, and not exported
+	cmService := test.GetTestMulticlusterService()
+	cmService.Namespace = "shared"
+	endpoint := test.GetTestEndpoint1()
+	endpoint.Attributes[model.SourceServiceAttr] = test.HttpNsName + "/" + test.SvcName
+	cmService.Endpoints = []*model.Endpoint{endpoint, test.GetTestEndpoint2()}
+	mock := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mock.EXPECT().GetFreshService(gomock.Any(), "shared", test.SvcName).Return(cmService, nil)
+	mock.EXPECT().DeleteEndpoints(gomock.Any(), "shared", test.SvcName, []*model.Endpoint{endpoint}).Return(nil)
+
+	reconciler := getServiceExportReconciler(t, mock, fakeClient)
+
+	got, err := reconciler.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, got)
+
+	events := reconciler.Recorder.(*record.FakeRecorder).Events
+	assert.Equal(t, "Warning ExportNamespaceNotAllowed namespace shared does not allow exports from namespace "+test.HttpNsName, <-events)
+	assert.Equal(t, "Normal EndpointsDeregistered deregistered 1 endpoints from Cloud Map", <-events)
+}
+
+func TestServiceExportReconciler_Reconcile_ExportNamespaceAllowed(t *testing.T) {
+	serviceExport := serviceExportForTest()
+	serviceExport.Annotations = map[string]string{ExportNamespaceAnnotation: "shared"}
+	namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "shared",
+		Annotations: map[string]string{AllowedExportNamespacesAnnotation: test.HttpNsName},
+	}}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(getServiceExportScheme()).
+		WithObjects(k8sServiceForTest(), serviceExport, namespace, test.ClusterIdForTest(), test.ClusterSetIdForTest()).
+		WithLists(&discovery.EndpointSliceList{
+			Items: []discovery.EndpointSlice{*endpointSliceForTest()},
+		}).
+		Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	mock := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	// nothing was exported under the name of the service
+	mock.EXPECT().GetFreshService(gomock.Any(), test.HttpNsName, test.SvcName).Return(nil, nil)
+	mock.EXPECT().GetFreshService(gomock.Any(), "shared", test.SvcName).
+		Return(&model.Service{Namespace: "shared", Name: test.SvcName}, nil)
+	endpoint := test.GetTestEndpoint1()
+	endpoint.Attributes[model.SourceServiceAttr] = test.HttpNsName + "/" + test.SvcName
+	mock.EXPECT().RegisterEndpoints(gomock.Any(), "shared", test.SvcName, []*model.Endpoint{endpoint}).Return(nil)
+
+	reconciler := getServiceExportReconciler(t, mock, fakeClient)
+
+	_, err := reconciler.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName},
+	})
+	assert.NoError(t, err)
+}
+
+func TestServiceExportReconciler_Reconcile_ExportedPorts(t *testing.T) {
+	// only the metrics port is exported, which the service does not have
+	serviceExport := serviceExportForTest()
+	serviceExport.Annotations = map[string]string{ExportedPortsAnnotation: "metrics"}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(getServiceExportScheme()).
+		WithObjects(k8sServiceForTest(), serviceExport, test.ClusterIdForTest(), test.ClusterSetIdForTest()).
+		WithLists(&discovery.EndpointSliceList{
+			Items: []discovery.EndpointSlice{*endpointSliceForTest()},
+		}).
+		Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	// the endpoint of the port previously exported is de-registered
+	mock := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mock.EXPECT().GetFreshService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(test.GetTestMulticlusterService(), nil)
+	mock.EXPECT().DeleteEndpoints(gomock.Any(), test.HttpNsName, test.SvcName,
+		[]*model.Endpoint{test.GetTestEndpoint1()}).Return(nil)
+
+	reconciler := getServiceExportReconciler(t, mock, fakeClient)
+
+	_, err := reconciler.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName},
+	})
+	assert.NoError(t, err)
+
+	events := reconciler.Recorder.(*record.FakeRecorder).Events
+	assert.Equal(t, "Warning UnknownExportedPorts exported ports metrics do not match any port of the service", <-events)
+	assert.Equal(t, "Normal EndpointsDeregistered deregistered 1 endpoints from Cloud Map", <-events)
+}
+
+func TestServiceExportReconciler_Reconcile_ReadyEndpointsOnly(t *testing.T) {
+	serviceExport := serviceExportForTest()
+	serviceExport.Annotations = map[string]string{ReadinessPolicyAnnotation: string(ExportReadyEndpoints)}
+	endpointSlice := endpointSliceForTest()
+	endpointSlice.Endpoints[0].Conditions.Ready = aws.Bool(false)
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(getServiceExportScheme()).
+		WithObjects(k8sServiceForTest(), serviceExport, test.ClusterIdForTest(), test.ClusterSetIdForTest()).
+		WithLists(&discovery.EndpointSliceList{
+			Items: []discovery.EndpointSlice{*endpointSlice},
+		}).
+		Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	// the endpoint is de-registered once not ready
+	mock := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mock.EXPECT().GetFreshService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(test.GetTestMulticlusterService(), nil)
+	mock.EXPECT().DeleteEndpoints(gomock.Any(), test.HttpNsName, test.SvcName,
+		[]*model.Endpoint{test.GetTestEndpoint1()}).Return(nil)
+
+	reconciler := getServiceExportReconciler(t, mock, fakeClient)
+
+	_, err := reconciler.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName},
+	})
+	assert.NoError(t, err)
+}
+
+func TestServiceExportReconciler_Reconcile_PublishNotReadyAddresses(t *testing.T) {
+	service := k8sServiceForTest()
+	service.Spec.PublishNotReadyAddresses = true
+	endpointSlice := endpointSliceForTest()
+	endpointSlice.Endpoints[0].Conditions.Ready = aws.Bool(false)
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(getServiceExportScheme()).
+		WithObjects(service, serviceExportForTest(), test.ClusterIdForTest(), test.ClusterSetIdForTest()).
+		WithLists(&discovery.EndpointSliceList{
+			Items: []discovery.EndpointSlice{*endpointSlice},
+		}).
+		Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	// the endpoint remains registered as ready
+	mock := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mock.EXPECT().GetFreshService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(test.GetTestMulticlusterService(), nil)
+
+	reconciler := getServiceExportReconciler(t, mock, fakeClient)
+
+	_, err := reconciler.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName},
+	})
+	assert.NoError(t, err)
+}
+
+func TestServiceExportReconciler_Reconcile_LoadBalancer(t *testing.T) {
+	service := k8sServiceForTest()
+	service.Spec.Type = v1.ServiceTypeLoadBalancer
+	service.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{Hostname: "lb.example.com"}}
+	serviceExport := serviceExportForTest()
+	serviceExport.Annotations = map[string]string{ExportModeAnnotation: string(LoadBalancerExportMode)}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(getServiceExportScheme()).
+		WithObjects(service, serviceExport, test.ClusterIdForTest(), test.ClusterSetIdForTest()).
+		WithLists(&discovery.EndpointSliceList{
+			Items: []discovery.EndpointSlice{*endpointSliceForTest()},
+		}).
+		Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	// the load balancer hostname replaces the pod IP
+	mock := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mock.EXPECT().GetFreshService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(test.GetTestMulticlusterService(), nil)
+	endpoint := test.GetTestEndpoint1()
+	endpoint.IP = "lb.example.com"
+	endpoint.AddressType = discovery.AddressTypeFQDN
+	endpoint.EndpointPort.Port = test.ServicePort1
+	endpoint.Id = model.EndpointIdFromIPAddressAndPort(endpoint.IP, endpoint.EndpointPort)
+	endpoint.Hostname = ""
+	endpoint.Nodename = ""
+	mock.EXPECT().RegisterEndpoints(gomock.Any(), test.HttpNsName, test.SvcName, []*model.Endpoint{endpoint}).Return(nil)
+	mock.EXPECT().DeleteEndpoints(gomock.Any(), test.HttpNsName, test.SvcName, []*model.Endpoint{test.GetTestEndpoint1()}).Return(nil)
+
+	reconciler := getServiceExportReconciler(t, mock, fakeClient)
+
+	_, err := reconciler.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName},
+	})
+	assert.NoError(t, err)
+}
+
+func TestServiceExportReconciler_Reconcile_CustomAttributes(t *testing.T) {
+	serviceExport := serviceExportForTest()
+	serviceExport.Annotations = map[string]string{
+		AttributeAnnotationPrefix + "team":     "payments",
+		AttributeAnnotationPrefix + "AWS_ZONE": "us-west-2a",
+		PodLabelAttributesAnnotation:           "app, version",
+	}
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace: test.HttpNsName,
+		Name:      "pod1",
+		Labels:    map[string]string{"app": "web", "tier": "frontend"},
+	}}
+	endpointSlice := endpointSliceForTest()
+	endpointSlice.Endpoints[0].TargetRef = &v1.ObjectReference{Kind: "Pod", Namespace: test.HttpNsName, Name: "pod1"}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(getServiceExportScheme()).
+		WithObjects(k8sServiceForTest(), serviceExport, pod, test.ClusterIdForTest(), test.ClusterSetIdForTest()).
+		WithLists(&discovery.EndpointSliceList{
+			Items: []discovery.EndpointSlice{*endpointSlice},
+		}).
+		Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	// the endpoint is registered again with the valid annotation and the pod labels as attributes
+	mock := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mock.EXPECT().GetFreshService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(test.GetTestMulticlusterService(), nil)
+	endpoint := test.GetTestEndpoint1()
+	endpoint.Attributes["team"] = "payments"
+	endpoint.Attributes["app"] = "web"
+	mock.EXPECT().RegisterEndpoints(gomock.Any(), test.HttpNsName, test.SvcName, []*model.Endpoint{endpoint}).Return(nil)
+
+	reconciler := getServiceExportReconciler(t, mock, fakeClient)
+
+	_, err := reconciler.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName},
+	})
+	assert.NoError(t, err)
+
+	events := reconciler.Recorder.(*record.FakeRecorder).Events
+	assert.Equal(t, "Warning InvalidAttributes ignoring invalid instance attributes: attribute AWS_ZONE is reserved by Cloud Map", <-events)
+	assert.Equal(t, "Normal EndpointsRegistered registered 1 endpoints in Cloud Map", <-events)
+}
+
+func TestServiceExportReconciler_Reconcile_AttributesLimit(t *testing.T) {
+	serviceExport := serviceExportForTest()
+	serviceExport.Annotations = map[string]string{}
+	for i := 0; i <= model.MaxCustomAttributes; i++ {
+		serviceExport.Annotations[AttributeAnnotationPrefix+"attr"+strconv.Itoa(i)] = "value"
+	}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(getServiceExportScheme()).
+		WithObjects(k8sServiceForTest(), serviceExport, test.ClusterIdForTest(), test.ClusterSetIdForTest()).
+		WithLists(&discovery.EndpointSliceList{
+			Items: []discovery.EndpointSlice{*endpointSliceForTest()},
+		}).
+		Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	// the endpoint is left unchanged, without the attributes exceeding the limits
+	mock := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mock.EXPECT().GetFreshService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(test.GetTestMulticlusterService(), nil)
+
+	reconciler := getServiceExportReconciler(t, mock, fakeClient)
+
+	_, err := reconciler.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName},
+	})
+	assert.NoError(t, err)
+
+	events := reconciler.Recorder.(*record.FakeRecorder).Events
+	assert.Equal(t, "Warning InvalidAttributes user-defined attributes of 1 endpoints exceed the Cloud Map limits of 30 attributes "+
+		"and 5000 characters per instance, and were not registered", <-events)
+}
+
+func TestServiceExportReconciler_Reconcile_TrafficPolicy(t *testing.T) {
+	serviceExport := serviceExportForTest()
+	serviceExport.Annotations = map[string]string{PriorityAnnotation: "first"}
+	clusterWeight := &aboutv1alpha1.ClusterProperty{
+		ObjectMeta: metav1.ObjectMeta{Name: model.ClusterWeightPropertyName},
+		Spec:       aboutv1alpha1.ClusterPropertySpec{Value: "50"},
+	}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(getServiceExportScheme()).
+		WithObjects(k8sServiceForTest(), serviceExport, clusterWeight, test.ClusterIdForTest(), test.ClusterSetIdForTest()).
+		WithLists(&discovery.EndpointSliceList{
+			Items: []discovery.EndpointSlice{*endpointSliceForTest()},
+		}).
+		Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	// the endpoint is registered again with the weight of the cluster, and without the invalid priority
+	mock := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mock.EXPECT().GetFreshService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(test.GetTestMulticlusterService(), nil)
+	endpoint := test.GetTestEndpoint1()
+	endpoint.Attributes[model.ClusterWeightAttr] = "50"
+	mock.EXPECT().RegisterEndpoints(gomock.Any(), test.HttpNsName, test.SvcName, []*model.Endpoint{endpoint}).Return(nil)
+
+	reconciler := getServiceExportReconciler(t, mock, fakeClient)
+
+	_, err := reconciler.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName},
+	})
+	assert.NoError(t, err)
+
+	events := reconciler.Recorder.(*record.FakeRecorder).Events
+	assert.Equal(t, "Warning InvalidTrafficPolicy ignoring invalid traffic policy: priority \"first\" must be an integer from 0 to 1000", <-events)
+	assert.Equal(t, "Normal EndpointsRegistered registered 1 endpoints in Cloud Map", <-events)
+}
+
+func TestServiceExportReconciler_Reconcile_ExportNotAllowed(t *testing.T) {
+	// only cluster 2 is allowed to export the service
+	policy := clusterSetPolicyForTest()
+	policy.Spec.ExportClusters = []string{test.ClusterId2}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(getServiceExportScheme()).
+		WithObjects(k8sServiceForTest(), serviceExportForTest(), policy, test.ClusterIdForTest(), test.ClusterSetIdForTest()).
+		WithLists(&discovery.EndpointSliceList{
+			Items: []discovery.EndpointSlice{*endpointSliceForTest()},
+		}).
+		Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	// the endpoint previously exported by this cluster is de-registered
+	mock := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	mock.EXPECT().GetFreshService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(test.GetTestMulticlusterService(), nil)
+	mock.EXPECT().DeleteEndpoints(gomock.Any(), test.HttpNsName, test.SvcName,
+		[]*model.Endpoint{test.GetTestEndpoint1()}).Return(nil)
+
+	reconciler := getServiceExportReconciler(t, mock, fakeClient)
+
+	_, err := reconciler.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName},
+	})
+	assert.NoError(t, err)
+
+	events := reconciler.Recorder.(*record.FakeRecorder).Events
+	assert.Equal(t, "Warning ExportNotAllowed cluster "+test.ClusterId1+" is not allowed to export "+
+		test.HttpNsName+"/"+test.SvcName+" by ClusterSetPolicies", <-events)
+	assert.Equal(t, "Normal EndpointsDeregistered deregistered 1 endpoints from Cloud Map", <-events)
+}
+
 func TestServiceExportReconciler_Reconcile_DeleteExistingService(t *testing.T) {
 	// create a fake controller client and add some objects
 	serviceExportObj := serviceExportForTest()
@@ -137,7 +690,7 @@ func TestServiceExportReconciler_Reconcile_DeleteExistingService(t *testing.T) {
 	mock := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
 
 	// GetService from Cloudmap returns endpoint1 and endpoint2
-	mock.EXPECT().GetService(gomock.Any(), test.HttpNsName, test.SvcName).
+	mock.EXPECT().GetFreshService(gomock.Any(), test.HttpNsName, test.SvcName).
 		Return(test.GetTestService(), nil)
 	// call to delete the endpoint in the cloudmap
 	mock.EXPECT().DeleteEndpoints(gomock.Any(), test.HttpNsName, test.SvcName,
@@ -162,6 +715,71 @@ func TestServiceExportReconciler_Reconcile_DeleteExistingService(t *testing.T) {
 	assert.Empty(t, serviceExport.Finalizers, "Finalizer removed from the service export")
 }
 
+func TestServiceExportReconciler_Reconcile_DeletedServiceExport(t *testing.T) {
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(getServiceExportScheme()).
+		WithObjects(test.ClusterIdForTest(), test.ClusterSetIdForTest()).
+		Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: test.HttpNsName,
+			Name:      test.SvcName,
+		},
+	}
+
+	reconciler := getServiceExportReconciler(t, cloudmapMock.NewMockServiceDiscoveryClient(mockController), fakeClient)
+	reconciler.State = NewReconcileState()
+	reconciler.State.recordExportError(request.NamespacedName, errors.New("export error"))
+
+	got, err := reconciler.Reconcile(context.Background(), request)
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, got, "Result should be empty")
+	assert.Empty(t, reconciler.State.Services(), "the state of the deleted ServiceExport is pruned")
+}
+
+func TestServiceExportReconciler_Reconcile_DryRun(t *testing.T) {
+	// create a fake controller client and add some objects
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(getServiceExportScheme()).
+		WithObjects(k8sServiceForTest(), serviceExportForTest(), test.ClusterIdForTest(), test.ClusterSetIdForTest()).
+		WithLists(&discovery.EndpointSliceList{
+			Items: []discovery.EndpointSlice{*endpointSliceForTest()},
+		}).
+		Build()
+
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	mock := cloudmapMock.NewMockServiceDiscoveryClient(mockController)
+	// no Cloud Map service is created and no endpoint is registered in dry-run mode
+	mock.EXPECT().GetFreshService(gomock.Any(), test.HttpNsName, test.SvcName).
+		Return(nil, common.NotFoundError(""))
+
+	reconciler := getServiceExportReconciler(t, mock, fakeClient)
+	reconciler.DryRun = true
+
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: test.HttpNsName,
+			Name:      test.SvcName,
+		},
+	}
+
+	got, err := reconciler.Reconcile(context.Background(), request)
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, got, "Result should be empty")
+
+	serviceExport := &multiclusterv1alpha1.ServiceExport{}
+	err = fakeClient.Get(context.TODO(), types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName}, serviceExport)
+	assert.NoError(t, err)
+	assert.Empty(t, serviceExport.Finalizers, "Finalizer not added in dry-run mode")
+	assert.Empty(t, serviceExport.OwnerReferences, "Owner reference not added in dry-run mode")
+}
+
 func TestServiceExportReconciler_Reconcile_NoClusterProperty(t *testing.T) {
 	// create a fake controller client and add some objects
 	fakeClient := fake.NewClientBuilder().
@@ -194,12 +812,47 @@ func TestServiceExportReconciler_Reconcile_NoClusterProperty(t *testing.T) {
 	assert.Equal(t, ctrl.Result{}, got, "Result should be empty")
 }
 
+func TestServiceExportReconciler_PodMappingFunction(t *testing.T) {
+	withLabels := serviceExportForTest()
+	withLabels.Annotations = map[string]string{PodLabelAttributesAnnotation: "version"}
+	withoutLabels := serviceExportForTest()
+	withoutLabels.Name = "other"
+	service := k8sServiceForTest()
+	service.Spec.Selector = map[string]string{"app": "web"}
+	otherService := k8sServiceForTest()
+	otherService.Name = "other"
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(getServiceExportScheme()).
+		WithObjects(service, otherService, withLabels, withoutLabels).
+		Build()
+
+	reconciler := getServiceExportReconciler(t, nil, fakeClient)
+	mapping := reconciler.podMappingFunction()
+
+	// only the service exports with pod label attributes whose service selects the pod are reconciled
+	pod := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{
+		Namespace: test.HttpNsName,
+		Name:      "pod1",
+		Labels:    map[string]string{"app": "web", "version": "v2"},
+	}}
+	assert.Equal(t, []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName}}}, mapping(pod))
+
+	pod.Labels = map[string]string{"app": "db"}
+	assert.Empty(t, mapping(pod))
+
+	// pods of namespaces without service exports with pod label attributes are ignored
+	pod.Namespace = "other"
+	pod.Labels = map[string]string{"app": "web"}
+	assert.Empty(t, mapping(pod))
+}
+
 func getServiceExportScheme() *runtime.Scheme {
 	scheme := runtime.NewScheme()
 	scheme.AddKnownTypes(aboutv1alpha1.GroupVersion, &aboutv1alpha1.ClusterProperty{}, &aboutv1alpha1.ClusterPropertyList{})
-	scheme.AddKnownTypes(multiclusterv1alpha1.GroupVersion, &multiclusterv1alpha1.ServiceExport{})
-	scheme.AddKnownTypes(v1.SchemeGroupVersion, &v1.Service{})
+	scheme.AddKnownTypes(multiclusterv1alpha1.GroupVersion, &multiclusterv1alpha1.ServiceExport{}, &multiclusterv1alpha1.ServiceExportList{})
+	scheme.AddKnownTypes(v1.SchemeGroupVersion, &v1.Service{}, &v1.Pod{}, &v1.Namespace{})
 	scheme.AddKnownTypes(discovery.SchemeGroupVersion, &discovery.EndpointSlice{}, &discovery.EndpointSliceList{})
+	scheme.AddKnownTypes(policyv1alpha1.GroupVersion, &policyv1alpha1.ClusterSetPolicy{}, &policyv1alpha1.ClusterSetPolicyList{})
 	return scheme
 }
 
@@ -211,5 +864,6 @@ func getServiceExportReconciler(t *testing.T, mockClient *cloudmapMock.MockServi
 		Scheme:       client.Scheme(),
 		CloudMap:     mockClient,
 		ClusterUtils: model.NewClusterUtils(client),
+		Recorder:     record.NewFakeRecorder(100),
 	}
 }
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"math"
+	"sort"
+
+	multiclusterv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/multicluster/v1alpha1"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+)
+
+// TrafficDistribution holds the endpoints of each cluster exporting an imported service, once the weights and
+// priorities of the clusters are applied.
+type TrafficDistribution struct {
+	// Endpoints holds the endpoints of each cluster, those which must not receive traffic being marked not ready.
+	Endpoints map[string][]*model.Endpoint
+
+	// Serving holds the clusters which receive traffic.
+	Serving map[string]bool
+}
+
+// clusterTraffic holds the traffic settings and ready addresses of a cluster.
+type clusterTraffic struct {
+	priority         int
+	explicitPriority bool
+	weight           int
+	explicitWeight   bool
+	readyAddresses   []string
+}
+
+// DistributeTraffic applies the weights and priorities of the clusters exporting a service to their endpoints:
+//   - only the clusters with the lowest priority value among those with ready endpoints receive traffic, so the
+//     clusters of the next priority take over once none of them has ready endpoints left,
+//   - when one of these clusters has a weight, clusters with a zero weight receive no traffic, unless all of them have
+//     a zero weight,
+//   - for Headless service imports, whose clients pick one of the ready endpoint addresses, the number of ready
+//     addresses of each of these clusters is also reduced to be proportional to its weight, while keeping as many
+//     addresses as possible.
+//
+// The other weights do not apply to ClusterSetIP service imports: their clients pick one of the derived Service IPs of
+// the clusters receiving traffic, regardless of the number of endpoints behind each IP.
+//
+// Endpoints are not changed when no cluster has a weight or priority, or none of them is ready. The given endpoints
+// are never modified, the endpoints marked not ready are copies.
+func DistributeTraffic(endpointsByCluster map[string][]*model.Endpoint, importType multiclusterv1alpha1.ServiceImportType) *TrafficDistribution {
+	clusters := make(map[string]*clusterTraffic, len(endpointsByCluster))
+	activePriority, configured := -1, false
+	for clusterId, endpoints := range endpointsByCluster {
+		traffic := newClusterTraffic(endpoints)
+		clusters[clusterId] = traffic
+		configured = configured || traffic.explicitPriority || traffic.explicitWeight
+		if len(traffic.readyAddresses) > 0 && (activePriority < 0 || traffic.priority < activePriority) {
+			activePriority = traffic.priority
+		}
+	}
+
+	distribution := &TrafficDistribution{
+		Endpoints: endpointsByCluster,
+		Serving:   make(map[string]bool, len(endpointsByCluster)),
+	}
+	if !configured || activePriority < 0 {
+		// all clusters are equal, or there is no traffic to distribute
+		for clusterId := range endpointsByCluster {
+			distribution.Serving[clusterId] = true
+		}
+		return distribution
+	}
+
+	weighted, totalWeight := false, 0
+	for _, traffic := range clusters {
+		if traffic.priority == activePriority && len(traffic.readyAddresses) > 0 {
+			weighted = weighted || traffic.explicitWeight
+			totalWeight += traffic.weight
+		}
+	}
+	weighted = weighted && totalWeight > 0
+
+	// the largest number of addresses per unit of weight all serving clusters can provide
+	scale := math.Inf(1)
+	if weighted && importType == multiclusterv1alpha1.Headless {
+		for _, traffic := range clusters {
+			if traffic.priority == activePriority && traffic.weight > 0 && len(traffic.readyAddresses) > 0 {
+				scale = math.Min(scale, float64(len(traffic.readyAddresses))/float64(traffic.weight))
+			}
+		}
+	}
+
+	distribution.Endpoints = make(map[string][]*model.Endpoint, len(endpointsByCluster))
+	for clusterId, endpoints := range endpointsByCluster {
+		traffic := clusters[clusterId]
+		serving := 0
+		if traffic.priority == activePriority && len(traffic.readyAddresses) > 0 && (!weighted || traffic.weight > 0) {
+			serving = len(traffic.readyAddresses)
+			if weighted && importType == multiclusterv1alpha1.Headless {
+				serving = int(math.Max(1, math.Round(scale*float64(traffic.weight))))
+			}
+		}
+		distribution.Serving[clusterId] = serving > 0
+		distribution.Endpoints[clusterId] = limitReadyEndpoints(endpoints, traffic.readyAddresses[:serving])
+	}
+	return distribution
+}
+
+// DistributeTrafficLocalFirst sends all the traffic of a service to the endpoints of the local cluster while it has
+// ready endpoints, marking the endpoints of the other clusters not ready. Otherwise, the traffic is distributed among
+// the other clusters according to their weights and priorities.
+func DistributeTrafficLocalFirst(endpointsByCluster map[string][]*model.Endpoint, importType multiclusterv1alpha1.ServiceImportType, localClusterId string) *TrafficDistribution {
+	if len(newClusterTraffic(endpointsByCluster[localClusterId]).readyAddresses) == 0 {
+		return DistributeTraffic(endpointsByCluster, importType)
+	}
+
+	distribution := &TrafficDistribution{
+		Endpoints: make(map[string][]*model.Endpoint, len(endpointsByCluster)),
+		Serving:   make(map[string]bool, len(endpointsByCluster)),
+	}
+	for clusterId, endpoints := range endpointsByCluster {
+		if clusterId == localClusterId {
+			distribution.Endpoints[clusterId] = endpoints
+			distribution.Serving[clusterId] = true
+		} else {
+			distribution.Endpoints[clusterId] = limitReadyEndpoints(endpoints, nil)
+			distribution.Serving[clusterId] = false
+		}
+	}
+	return distribution
+}
+
+func newClusterTraffic(endpoints []*model.Endpoint) *clusterTraffic {
+	traffic := &clusterTraffic{priority: model.DefaultClusterPriority, weight: model.DefaultClusterWeight}
+	if len(endpoints) > 0 {
+		traffic.priority, traffic.explicitPriority = endpoints[0].ClusterPriority()
+		traffic.weight, traffic.explicitWeight = endpoints[0].ClusterWeight()
+	}
+
+	// endpoints of the same address on several ports count as a single address
+	addresses := make(map[string]struct{})
+	for _, endpoint := range endpoints {
+		if endpoint.Ready {
+			addresses[endpoint.IP] = struct{}{}
+		}
+	}
+	traffic.readyAddresses = make([]string, 0, len(addresses))
+	for address := range addresses {
+		traffic.readyAddresses = append(traffic.readyAddresses, address)
+	}
+	sort.Strings(traffic.readyAddresses)
+	return traffic
+}
+
+// limitReadyEndpoints returns the endpoints with those whose address is not one of the given ones marked not ready.
+func limitReadyEndpoints(endpoints []*model.Endpoint, readyAddresses []string) []*model.Endpoint {
+	ready := make(map[string]struct{}, len(readyAddresses))
+	for _, address := range readyAddresses {
+		ready[address] = struct{}{}
+	}
+	limited := make([]*model.Endpoint, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if _, found := ready[endpoint.IP]; endpoint.Ready && !found {
+			notReady := *endpoint
+			notReady.Ready = false
+			endpoint = &notReady
+		}
+		limited = append(limited, endpoint)
+	}
+	return limited
+}
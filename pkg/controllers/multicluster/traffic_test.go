@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"fmt"
+	"testing"
+
+	multiclusterv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/multicluster/v1alpha1"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/test"
+	"github.com/stretchr/testify/assert"
+)
+
+const clusterId3 = "test-mcs-clusterid-3"
+
+func TestDistributeTraffic(t *testing.T) {
+	tests := []struct {
+		name      string
+		clusters  map[string]clusterEndpointsForTest
+		wantReady map[string]int
+		// ready addresses of ClusterSetIP service imports, when weights reduce those of Headless ones
+		wantClusterSetIPReady map[string]int
+		wantServing           map[string]bool
+	}{
+		{
+			name: "no weights nor priorities",
+			clusters: map[string]clusterEndpointsForTest{
+				test.ClusterId1: {ready: 4},
+				test.ClusterId2: {ready: 0, notReady: 1},
+			},
+			wantReady:   map[string]int{test.ClusterId1: 4, test.ClusterId2: 0},
+			wantServing: map[string]bool{test.ClusterId1: true, test.ClusterId2: true},
+		},
+		{
+			name: "highest priority",
+			clusters: map[string]clusterEndpointsForTest{
+				test.ClusterId1: {ready: 2, priority: "1"},
+				test.ClusterId2: {ready: 3, priority: "0"},
+			},
+			wantReady:   map[string]int{test.ClusterId1: 0, test.ClusterId2: 3},
+			wantServing: map[string]bool{test.ClusterId1: false, test.ClusterId2: true},
+		},
+		{
+			name: "failover to the next priority",
+			clusters: map[string]clusterEndpointsForTest{
+				test.ClusterId1: {ready: 2, priority: "1"},
+				test.ClusterId2: {notReady: 3, priority: "0"},
+			},
+			wantReady:   map[string]int{test.ClusterId1: 2, test.ClusterId2: 0},
+			wantServing: map[string]bool{test.ClusterId1: true, test.ClusterId2: false},
+		},
+		{
+			name: "no ready endpoints",
+			clusters: map[string]clusterEndpointsForTest{
+				test.ClusterId1: {notReady: 2, priority: "1"},
+				test.ClusterId2: {notReady: 3, priority: "0"},
+			},
+			wantReady:   map[string]int{test.ClusterId1: 0, test.ClusterId2: 0},
+			wantServing: map[string]bool{test.ClusterId1: true, test.ClusterId2: true},
+		},
+		{
+			name: "weights",
+			clusters: map[string]clusterEndpointsForTest{
+				test.ClusterId1: {ready: 3, weight: "75"},
+				test.ClusterId2: {ready: 3, weight: "25"},
+			},
+			wantReady:             map[string]int{test.ClusterId1: 3, test.ClusterId2: 1},
+			wantClusterSetIPReady: map[string]int{test.ClusterId1: 3, test.ClusterId2: 3},
+			wantServing:           map[string]bool{test.ClusterId1: true, test.ClusterId2: true},
+		},
+		{
+			name: "default weight",
+			clusters: map[string]clusterEndpointsForTest{
+				test.ClusterId1: {ready: 10},
+				test.ClusterId2: {ready: 10, weight: "50"},
+			},
+			wantReady:             map[string]int{test.ClusterId1: 10, test.ClusterId2: 5},
+			wantClusterSetIPReady: map[string]int{test.ClusterId1: 10, test.ClusterId2: 10},
+			wantServing:           map[string]bool{test.ClusterId1: true, test.ClusterId2: true},
+		},
+		{
+			name: "zero weight",
+			clusters: map[string]clusterEndpointsForTest{
+				test.ClusterId1: {ready: 2, weight: "0"},
+				test.ClusterId2: {ready: 3, weight: "10"},
+			},
+			wantReady:   map[string]int{test.ClusterId1: 0, test.ClusterId2: 3},
+			wantServing: map[string]bool{test.ClusterId1: false, test.ClusterId2: true},
+		},
+		{
+			name: "all zero weights",
+			clusters: map[string]clusterEndpointsForTest{
+				test.ClusterId1: {ready: 2, weight: "0"},
+				test.ClusterId2: {ready: 3, weight: "0"},
+			},
+			wantReady:   map[string]int{test.ClusterId1: 2, test.ClusterId2: 3},
+			wantServing: map[string]bool{test.ClusterId1: true, test.ClusterId2: true},
+		},
+		{
+			name: "weights within the highest priority",
+			clusters: map[string]clusterEndpointsForTest{
+				test.ClusterId1: {ready: 4, weight: "50", priority: "0"},
+				test.ClusterId2: {ready: 4, weight: "100", priority: "0"},
+				clusterId3:      {ready: 4, weight: "100", priority: "1"},
+			},
+			wantReady:             map[string]int{test.ClusterId1: 2, test.ClusterId2: 4, clusterId3: 0},
+			wantClusterSetIPReady: map[string]int{test.ClusterId1: 4, test.ClusterId2: 4, clusterId3: 0},
+			wantServing:           map[string]bool{test.ClusterId1: true, test.ClusterId2: true, clusterId3: false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpointsByCluster := make(map[string][]*model.Endpoint)
+			for clusterId, cluster := range tt.clusters {
+				endpointsByCluster[clusterId] = cluster.endpoints(clusterId)
+			}
+
+			wantReady := map[multiclusterv1alpha1.ServiceImportType]map[string]int{
+				multiclusterv1alpha1.Headless:     tt.wantReady,
+				multiclusterv1alpha1.ClusterSetIP: tt.wantReady,
+			}
+			if tt.wantClusterSetIPReady != nil {
+				wantReady[multiclusterv1alpha1.ClusterSetIP] = tt.wantClusterSetIPReady
+			}
+			for importType, want := range wantReady {
+				got := DistributeTraffic(endpointsByCluster, importType)
+				assert.Equal(t, tt.wantServing, got.Serving, "serving clusters of %s", importType)
+				for clusterId, endpoints := range got.Endpoints {
+					ready := make(map[string]bool)
+					for _, endpoint := range endpoints {
+						if endpoint.Ready {
+							ready[endpoint.IP] = true
+						}
+					}
+					assert.Equal(t, want[clusterId], len(ready), "ready addresses of %s for %s", clusterId, importType)
+				}
+			}
+			// the given endpoints are not modified
+			for clusterId, cluster := range tt.clusters {
+				assert.Equal(t, cluster.endpoints(clusterId), endpointsByCluster[clusterId])
+			}
+		})
+	}
+}
+
+func TestDistributeTraffic_SameAddressOnSeveralPorts(t *testing.T) {
+	cluster := clusterEndpointsForTest{ready: 2, weight: "25"}
+	endpoints := cluster.endpoints(test.ClusterId1)
+	for _, endpoint := range cluster.endpoints(test.ClusterId1) {
+		endpoint.EndpointPort.Port = test.Port2
+		endpoints = append(endpoints, endpoint)
+	}
+	got := DistributeTraffic(map[string][]*model.Endpoint{
+		test.ClusterId1: endpoints,
+		test.ClusterId2: clusterEndpointsForTest{ready: 2, weight: "50"}.endpoints(test.ClusterId2),
+	}, multiclusterv1alpha1.Headless)
+
+	// the first address of the cluster is ready on both ports
+	assert.Len(t, got.Endpoints[test.ClusterId1], 4)
+	for _, endpoint := range got.Endpoints[test.ClusterId1] {
+		assert.Equal(t, endpoint.IP == endpoints[0].IP, endpoint.Ready)
+	}
+}
+
+func TestDistributeTrafficLocalFirst(t *testing.T) {
+	tests := []struct {
+		name        string
+		clusters    map[string]clusterEndpointsForTest
+		wantReady   map[string]int
+		wantServing map[string]bool
+	}{
+		{
+			name: "local cluster ready",
+			clusters: map[string]clusterEndpointsForTest{
+				test.ClusterId1: {ready: 1, notReady: 1},
+				test.ClusterId2: {ready: 3},
+			},
+			wantReady:   map[string]int{test.ClusterId1: 1, test.ClusterId2: 0},
+			wantServing: map[string]bool{test.ClusterId1: true, test.ClusterId2: false},
+		},
+		{
+			name: "local cluster ready with a lower priority",
+			clusters: map[string]clusterEndpointsForTest{
+				test.ClusterId1: {ready: 2, priority: "1"},
+				test.ClusterId2: {ready: 3, priority: "0"},
+			},
+			wantReady:   map[string]int{test.ClusterId1: 2, test.ClusterId2: 0},
+			wantServing: map[string]bool{test.ClusterId1: true, test.ClusterId2: false},
+		},
+		{
+			name: "local cluster not ready",
+			clusters: map[string]clusterEndpointsForTest{
+				test.ClusterId1: {notReady: 2},
+				test.ClusterId2: {ready: 3, weight: "50"},
+				clusterId3:      {ready: 3, weight: "100"},
+			},
+			wantReady:   map[string]int{test.ClusterId1: 0, test.ClusterId2: 2, clusterId3: 3},
+			wantServing: map[string]bool{test.ClusterId1: false, test.ClusterId2: true, clusterId3: true},
+		},
+		{
+			name: "local cluster not exporting",
+			clusters: map[string]clusterEndpointsForTest{
+				test.ClusterId2: {ready: 3},
+			},
+			wantReady:   map[string]int{test.ClusterId2: 3},
+			wantServing: map[string]bool{test.ClusterId2: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpointsByCluster := make(map[string][]*model.Endpoint)
+			for clusterId, cluster := range tt.clusters {
+				endpointsByCluster[clusterId] = cluster.endpoints(clusterId)
+			}
+
+			got := DistributeTrafficLocalFirst(endpointsByCluster, multiclusterv1alpha1.Headless, test.ClusterId1)
+			assert.Equal(t, tt.wantServing, got.Serving)
+			for clusterId, endpoints := range got.Endpoints {
+				ready := 0
+				for _, endpoint := range endpoints {
+					if endpoint.Ready {
+						ready++
+					}
+				}
+				assert.Equal(t, tt.wantReady[clusterId], ready, "ready endpoints of %s", clusterId)
+			}
+		})
+	}
+}
+
+// clusterEndpointsForTest describes the endpoints of a cluster and its traffic attributes.
+type clusterEndpointsForTest struct {
+	ready    int
+	notReady int
+	weight   string
+	priority string
+}
+
+func (c clusterEndpointsForTest) endpoints(clusterId string) (endpoints []*model.Endpoint) {
+	for i := 0; i < c.ready+c.notReady; i++ {
+		endpoint := test.GetTestEndpoint1()
+		endpoint.ClusterId = clusterId
+		endpoint.IP = fmt.Sprintf("10.0.%d.%d", len(clusterId), i)
+		endpoint.Ready = i < c.ready
+		if c.weight != "" {
+			endpoint.Attributes[model.ClusterWeightAttr] = c.weight
+		}
+		if c.priority != "" {
+			endpoint.Attributes[model.ClusterPriorityAttr] = c.priority
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
+}
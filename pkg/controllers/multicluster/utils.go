@@ -4,23 +4,76 @@ import (
 	"crypto/sha256"
 	"encoding/base32"
 	"encoding/json"
+	"net"
+	"sort"
+	"strconv"
 	"strings"
 
 	multiclusterv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/multicluster/v1alpha1"
 	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	v1 "k8s.io/api/core/v1"
 	discovery "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 const (
 	// DerivedServiceAnnotation annotates a ServiceImport with derived Service name
 	DerivedServiceAnnotation = "multicluster.k8s.aws/derived-service"
 
+	// ExportNameAnnotation annotates a ServiceExport with the name of the clusterset service the Service is exported as,
+	// instead of the Service name.
+	ExportNameAnnotation = "multicluster.k8s.aws/export-name"
+
+	// ExportNamespaceAnnotation annotates a ServiceExport with the namespace of the clusterset service the Service is
+	// exported to, instead of the Service namespace.
+	ExportNamespaceAnnotation = "multicluster.k8s.aws/export-namespace"
+
+	// AllowedExportNamespacesAnnotation annotates a Namespace with the comma-separated namespaces whose ServiceExports
+	// are allowed to export their Service to it with the export namespace annotation, or * for all namespaces.
+	AllowedExportNamespacesAnnotation = "multicluster.k8s.aws/allowed-export-namespaces"
+
+	// ExportedServiceAnnotation annotates a ServiceExport with the clusterset service the Service is currently exported
+	// as, when it differs from the Service, so its endpoints can be de-registered after the export name changes.
+	ExportedServiceAnnotation = "multicluster.k8s.aws/exported-service"
+
+	// ExportedPortsAnnotation annotates a ServiceExport with the comma-separated names or numbers of the Service ports
+	// to export. All ports are exported when the annotation is not set.
+	ExportedPortsAnnotation = "multicluster.k8s.aws/exported-ports"
+
+	// ExportModeAnnotation annotates a ServiceExport with the ExportMode of its Service.
+	ExportModeAnnotation = "multicluster.k8s.aws/export-mode"
+
+	// ImportModeAnnotation annotates a ServiceImport with its ImportMode, overriding the default import mode of the
+	// controller.
+	ImportModeAnnotation = "multicluster.k8s.aws/import-mode"
+
+	// ReadinessPolicyAnnotation annotates a ServiceExport with the ReadinessPolicy of its endpoints, overriding the
+	// publishNotReadyAddresses field of the Service.
+	ReadinessPolicyAnnotation = "multicluster.k8s.aws/readiness-policy"
+
+	// WeightAnnotation annotates a ServiceExport with the traffic weight of the cluster for its Service, overriding
+	// the cluster weight ClusterProperty.
+	WeightAnnotation = "multicluster.k8s.aws/weight"
+
+	// PriorityAnnotation annotates a ServiceExport with the failover priority of the cluster for its Service,
+	// overriding the cluster priority ClusterProperty.
+	PriorityAnnotation = "multicluster.k8s.aws/priority"
+
+	// AttributeAnnotationPrefix prefixes the annotations of a ServiceExport registered as attributes of its Cloud Map
+	// instances, e.g. "attribute.multicluster.k8s.aws/team: payments" registers the attribute team=payments.
+	AttributeAnnotationPrefix = "attribute.multicluster.k8s.aws/"
+
+	// PodLabelAttributesAnnotation annotates a ServiceExport with the comma-separated keys of the pod labels
+	// registered as attributes of the Cloud Map instances of its endpoints.
+	PodLabelAttributesAnnotation = "multicluster.k8s.aws/pod-label-attributes"
+
 	// ServiceExportFinalizer finalizer to perform cloudmap resource cleanup on delete
 	ServiceExportFinalizer = "multicluster.k8s.aws/service-export-finalizer"
 
@@ -38,8 +91,321 @@ const (
 
 	// ValueEndpointSliceManagedBy indicates the name of the entity that manages the EndpointSlice.
 	ValueEndpointSliceManagedBy = "aws-cloud-map-mcs-controller-for-k8s"
+
+	// ServiceExportInstanceQuotaApproached is a condition of ServiceExports whose Cloud Map service approaches the quota of instances per service.
+	ServiceExportInstanceQuotaApproached multiclusterv1alpha1.ServiceExportConditionType = "InstanceQuotaApproached"
+
+	// DefaultInstanceQuota is the default AWS Cloud Map quota of instances per service.
+	DefaultInstanceQuota = 1000
+)
+
+// ExportedServiceName returns the namespace and name of the clusterset service a ServiceExport exports its Service as,
+// from its export annotations.
+func ExportedServiceName(svcExport *multiclusterv1alpha1.ServiceExport) types.NamespacedName {
+	name := types.NamespacedName{Namespace: svcExport.Namespace, Name: svcExport.Name}
+	if namespace := svcExport.Annotations[ExportNamespaceAnnotation]; namespace != "" {
+		name.Namespace = namespace
+	}
+	if alias := svcExport.Annotations[ExportNameAnnotation]; alias != "" {
+		name.Name = alias
+	}
+	return name
+}
+
+// IsExportNamespaceAllowed returns true if the ServiceExports of a namespace are allowed to export their Service to
+// another namespace, according to its allowed export namespaces annotation.
+func IsExportNamespaceAllowed(namespace *v1.Namespace, sourceNamespace string) bool {
+	if namespace.Name == sourceNamespace {
+		return true
+	}
+	for _, entry := range strings.Split(namespace.Annotations[AllowedExportNamespacesAnnotation], ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "*" || entry == sourceNamespace {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateExportedServiceName returns the reasons the namespace and name of a clusterset service are invalid, as
+// ServiceImports and derived Services are created with them.
+func ValidateExportedServiceName(name types.NamespacedName) []string {
+	errs := validation.IsDNS1123Label(name.Namespace)
+	return append(errs, validation.IsDNS1035Label(name.Name)...)
+}
+
+// IsPortExported returns true if a Service port is exported by a ServiceExport, according to its exported ports
+// annotation.
+func IsPortExported(svcExport *multiclusterv1alpha1.ServiceExport, port model.Port) bool {
+	value, found := svcExport.Annotations[ExportedPortsAnnotation]
+	if !found {
+		return true
+	}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry != "" && (entry == port.Name || entry == strconv.Itoa(int(port.Port))) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExportMode defines which addresses of a Service are exported.
+type ExportMode string
+
+const (
+	// EndpointsExportMode exports the addresses of the endpoints of the Service, which must be routable from the other
+	// clusters of the clusterset
+	EndpointsExportMode ExportMode = "Endpoints"
+
+	// LoadBalancerExportMode exports the ingress IPs and hostnames of the load balancer of a LoadBalancer Service, for
+	// clusters without network connectivity between their pods
+	LoadBalancerExportMode ExportMode = "LoadBalancer"
+
+	// ExternalNameExportMode exports the external name of an ExternalName Service
+	ExternalNameExportMode ExportMode = "ExternalName"
+)
+
+// ServiceExportMode returns the ExportMode of an exported Service. ExternalName Services are exported by their
+// external name, other Services by the mode set by the export mode annotation of their ServiceExport, Endpoints by
+// default. It returns false when the annotation is not a valid mode for the Service, in which case the Endpoints mode
+// applies.
+func ServiceExportMode(svc *v1.Service, svcExport *multiclusterv1alpha1.ServiceExport) (ExportMode, bool) {
+	value, found := svcExport.Annotations[ExportModeAnnotation]
+	if svc.Spec.Type == v1.ServiceTypeExternalName {
+		return ExternalNameExportMode, !found || ExportMode(value) == ExternalNameExportMode
+	}
+	switch mode := ExportMode(value); {
+	case !found || mode == EndpointsExportMode:
+		return EndpointsExportMode, true
+	case mode == LoadBalancerExportMode && svc.Spec.Type == v1.ServiceTypeLoadBalancer:
+		return LoadBalancerExportMode, true
+	}
+	return EndpointsExportMode, false
+}
+
+// ImportMode defines which clusters exporting an imported service receive its traffic.
+type ImportMode string
+
+const (
+	// AllClustersImportMode sends the traffic to the endpoints of all clusters, according to their weights and priorities
+	AllClustersImportMode ImportMode = "AllClusters"
+
+	// LocalFirstImportMode sends the traffic to the endpoints of the local cluster while it has ready endpoints, and
+	// to the other clusters, according to their weights and priorities, only when it has none
+	LocalFirstImportMode ImportMode = "LocalFirst"
+)
+
+// IsValidImportMode returns true if the mode is a known ImportMode.
+func IsValidImportMode(mode ImportMode) bool {
+	return mode == AllClustersImportMode || mode == LocalFirstImportMode
+}
+
+// ServiceImportMode returns the ImportMode of a ServiceImport, set by its import mode annotation or else by the given
+// default mode, AllClusters if empty. It returns false when the annotation is not a valid mode, in which case the
+// default mode applies.
+func ServiceImportMode(svcImport *multiclusterv1alpha1.ServiceImport, defaultMode ImportMode) (ImportMode, bool) {
+	if defaultMode == "" {
+		defaultMode = AllClustersImportMode
+	}
+	value, found := svcImport.Annotations[ImportModeAnnotation]
+	if !found {
+		return defaultMode, true
+	}
+	if mode := ImportMode(value); IsValidImportMode(mode) {
+		return mode, true
+	}
+	return defaultMode, false
+}
+
+// ServiceAddressEndpointSlices returns EndpointSlices with the load balancer ingress addresses or the external name
+// of a Service, according to its ExportMode, as ready endpoints listening on the ports of the Service.
+func ServiceAddressEndpointSlices(svc *v1.Service, mode ExportMode) []discovery.EndpointSlice {
+	var addresses []string
+	switch mode {
+	case LoadBalancerExportMode:
+		for _, ingress := range svc.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				addresses = append(addresses, ingress.IP)
+			} else if ingress.Hostname != "" {
+				addresses = append(addresses, ingress.Hostname)
+			}
+		}
+	case ExternalNameExportMode:
+		if svc.Spec.ExternalName != "" {
+			addresses = append(addresses, svc.Spec.ExternalName)
+		}
+	}
+
+	ports := make([]discovery.EndpointPort, 0, len(svc.Spec.Ports))
+	for _, svcPort := range svc.Spec.Ports {
+		protocol := svcPort.Protocol
+		ports = append(ports, discovery.EndpointPort{
+			Name:     aws.String(svcPort.Name),
+			Protocol: &protocol,
+			Port:     aws.Int32(svcPort.Port),
+		})
+	}
+
+	sliceIndexes := make(map[discovery.AddressType]int)
+	slices := make([]discovery.EndpointSlice, 0)
+	for _, address := range addresses {
+		addressType := AddressTypeOf(address)
+		index, found := sliceIndexes[addressType]
+		if !found {
+			index = len(slices)
+			sliceIndexes[addressType] = index
+			slices = append(slices, discovery.EndpointSlice{AddressType: addressType, Ports: ports})
+		}
+		slices[index].Endpoints = append(slices[index].Endpoints, discovery.Endpoint{
+			Addresses:  []string{address},
+			Conditions: discovery.EndpointConditions{Ready: aws.Bool(true)},
+		})
+	}
+	return slices
+}
+
+// AddressTypeOf returns the address type of an IP address or hostname.
+func AddressTypeOf(address string) discovery.AddressType {
+	ip := net.ParseIP(address)
+	switch {
+	case ip == nil:
+		return discovery.AddressTypeFQDN
+	case ip.To4() != nil:
+		return discovery.AddressTypeIPv4
+	default:
+		return discovery.AddressTypeIPv6
+	}
+}
+
+// ReadinessPolicy defines which endpoints of an exported Service are registered in Cloud Map, and with which readiness.
+type ReadinessPolicy string
+
+const (
+	// ExportAllEndpoints exports all endpoints with their readiness
+	ExportAllEndpoints ReadinessPolicy = "All"
+
+	// ExportReadyEndpoints exports the ready endpoints only
+	ExportReadyEndpoints ReadinessPolicy = "ReadyOnly"
+
+	// PublishNotReadyEndpoints exports all endpoints as ready, like the publishNotReadyAddresses field of Services
+	PublishNotReadyEndpoints ReadinessPolicy = "PublishNotReady"
 )
 
+// ExportReadinessPolicy returns the ReadinessPolicy of an exported Service, set by the readiness policy annotation of
+// its ServiceExport or else by the publishNotReadyAddresses field of the Service. It returns false when the annotation
+// is not a valid policy, in which case the policy of the Service applies.
+func ExportReadinessPolicy(svc *v1.Service, svcExport *multiclusterv1alpha1.ServiceExport) (ReadinessPolicy, bool) {
+	if value, found := svcExport.Annotations[ReadinessPolicyAnnotation]; found {
+		switch policy := ReadinessPolicy(value); policy {
+		case ExportAllEndpoints, ExportReadyEndpoints, PublishNotReadyEndpoints:
+			return policy, true
+		}
+		return serviceReadinessPolicy(svc), false
+	}
+	return serviceReadinessPolicy(svc), true
+}
+
+func serviceReadinessPolicy(svc *v1.Service) ReadinessPolicy {
+	if svc.Spec.PublishNotReadyAddresses {
+		return PublishNotReadyEndpoints
+	}
+	return ExportAllEndpoints
+}
+
+// CustomAttributes returns the user-defined Cloud Map instance attributes set by the attribute annotations of a
+// ServiceExport, and the errors of the invalid ones, which are left out.
+func CustomAttributes(svcExport *multiclusterv1alpha1.ServiceExport) (attributes map[string]string, errs []error) {
+	attributes = make(map[string]string)
+	for annotation, value := range svcExport.Annotations {
+		key := strings.TrimPrefix(annotation, AttributeAnnotationPrefix)
+		if key == annotation {
+			continue
+		}
+		if err := model.ValidateCustomAttribute(key, value); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		attributes[key] = value
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return attributes, errs
+}
+
+// TrafficAttributes returns the weight and priority Cloud Map instance attributes of the endpoints of an exported
+// Service, set by the weight and priority annotations of its ServiceExport or else by the values of the cluster weight
+// and priority ClusterProperties. It also returns the errors of the invalid values, which are left out.
+func TrafficAttributes(svcExport *multiclusterv1alpha1.ServiceExport, clusterWeight string, clusterPriority string) (attributes map[string]string, errs []error) {
+	attributes = make(map[string]string)
+	if value := trafficSetting(svcExport, WeightAnnotation, clusterWeight); value != "" {
+		if weight, err := model.ParseClusterWeight(value); err != nil {
+			errs = append(errs, err)
+		} else {
+			attributes[model.ClusterWeightAttr] = strconv.Itoa(weight)
+		}
+	}
+	if value := trafficSetting(svcExport, PriorityAnnotation, clusterPriority); value != "" {
+		if priority, err := model.ParseClusterPriority(value); err != nil {
+			errs = append(errs, err)
+		} else {
+			attributes[model.ClusterPriorityAttr] = strconv.Itoa(priority)
+		}
+	}
+	return attributes, errs
+}
+
+func trafficSetting(svcExport *multiclusterv1alpha1.ServiceExport, annotation string, clusterValue string) string {
+	if value, found := svcExport.Annotations[annotation]; found {
+		return strings.TrimSpace(value)
+	}
+	return strings.TrimSpace(clusterValue)
+}
+
+// PodLabelAttributes returns the keys of the pod labels registered as Cloud Map instance attributes, according to the
+// pod label attributes annotation of a ServiceExport.
+func PodLabelAttributes(svcExport *multiclusterv1alpha1.ServiceExport) (keys []string) {
+	for _, key := range strings.Split(svcExport.Annotations[PodLabelAttributesAnnotation], ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// UnknownExportedPorts returns the entries of the exported ports annotation of a ServiceExport which match no port of
+// its Service.
+func UnknownExportedPorts(svcExport *multiclusterv1alpha1.ServiceExport, svc *v1.Service) (unknown []string) {
+	value, found := svcExport.Annotations[ExportedPortsAnnotation]
+	if !found {
+		return nil
+	}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		matched := false
+		for _, svcPort := range svc.Spec.Ports {
+			if entry == svcPort.Name || entry == strconv.Itoa(int(svcPort.Port)) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			unknown = append(unknown, entry)
+		}
+	}
+	return unknown
+}
+
+// previouslyExportedServiceName returns the clusterset service a ServiceExport last exported its Service as.
+func previouslyExportedServiceName(svcExport *multiclusterv1alpha1.ServiceExport) types.NamespacedName {
+	if namespace, name, found := strings.Cut(svcExport.Annotations[ExportedServiceAnnotation], string(types.Separator)); found {
+		return types.NamespacedName{Namespace: namespace, Name: name}
+	}
+	return types.NamespacedName{Namespace: svcExport.Namespace, Name: svcExport.Name}
+}
+
 // ServicePortToPort converts a k8s service port to internal model port
 func ServicePortToPort(svcPort v1.ServicePort) model.Port {
 	return model.Port{
@@ -143,15 +509,68 @@ func IPsEqualIgnoreOrder(a, b []string) (equal bool) {
 	return equalIgnoreOrder
 }
 
-// GetClusterIpsFromServices returns list of ClusterIPs from services
+func ClustersEqualIgnoreOrder(a, b []multiclusterv1alpha1.ClusterStatus) (equal bool) {
+	less := func(x, y multiclusterv1alpha1.ClusterStatus) bool { return x.Cluster < y.Cluster }
+	equalIgnoreOrder := cmp.Diff(a, b, cmpopts.SortSlices(less), cmpopts.EquateEmpty()) == ""
+	return equalIgnoreOrder
+}
+
+// GetClusterIpsFromServices returns list of ClusterIPs from services, excluding ExternalName services which have none
 func GetClusterIpsFromServices(services []*v1.Service) []string {
 	clusterIPs := make([]string, 0)
 	for _, svc := range services {
+		if svc.Spec.Type == v1.ServiceTypeExternalName {
+			continue
+		}
 		clusterIPs = append(clusterIPs, svc.Spec.ClusterIP)
 	}
 	return clusterIPs
 }
 
+// DerivedServiceExternalName returns the external name of the derived Service of the endpoints of a cluster, which is
+// the first of their hostnames when the cluster exports hostnames only, e.g. of its load balancer. It returns an empty
+// string when the derived Service is not an ExternalName Service.
+func DerivedServiceExternalName(endpoints []*model.Endpoint) string {
+	hostnames := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if endpoint.AddressType != discovery.AddressTypeFQDN {
+			return ""
+		}
+		hostnames = append(hostnames, endpoint.IP)
+	}
+	if len(hostnames) == 0 {
+		return ""
+	}
+	sort.Strings(hostnames)
+	return hostnames[0]
+}
+
+// UpdateDerivedServiceExternalName turns a derived Service into an ExternalName Service with the given external name,
+// or back into the Service type of its ServiceImport when the external name is empty. It returns true if the Service
+// changed.
+func UpdateDerivedServiceExternalName(svc *v1.Service, svcImport *multiclusterv1alpha1.ServiceImport, externalName string) bool {
+	if externalName == "" {
+		if svc.Spec.Type != v1.ServiceTypeExternalName {
+			return false
+		}
+		svc.Spec.Type = v1.ServiceTypeClusterIP
+		svc.Spec.ExternalName = ""
+		if svcImport.Spec.Type == multiclusterv1alpha1.Headless {
+			svc.Spec.ClusterIP = "None"
+		}
+		return true
+	}
+
+	if svc.Spec.Type == v1.ServiceTypeExternalName && svc.Spec.ExternalName == externalName {
+		return false
+	}
+	svc.Spec.Type = v1.ServiceTypeExternalName
+	svc.Spec.ExternalName = externalName
+	svc.Spec.ClusterIP = ""
+	svc.Spec.ClusterIPs = nil
+	return true
+}
+
 // DerivedName computes the "placeholder" name for an imported service
 func DerivedName(namespace string, name string, clusterId string) string {
 	hash := sha256.New()
@@ -166,13 +585,6 @@ func CreateServiceImportStruct(svc *model.Service, clusterIds []string, serviceP
 		serviceImportPorts = append(serviceImportPorts, PortToServiceImportPort(*port))
 	}
 
-	clusters := make([]multiclusterv1alpha1.ClusterStatus, 0)
-	for _, clusterId := range clusterIds {
-		clusters = append(clusters, multiclusterv1alpha1.ClusterStatus{
-			Cluster: clusterId,
-		})
-	}
-
 	return &multiclusterv1alpha1.ServiceImport{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: svc.Namespace,
@@ -187,11 +599,22 @@ func CreateServiceImportStruct(svc *model.Service, clusterIds []string, serviceP
 			Ports: serviceImportPorts,
 		},
 		Status: multiclusterv1alpha1.ServiceImportStatus{
-			Clusters: clusters,
+			Clusters: CreateServiceImportClusterStatus(clusterIds),
 		},
 	}
 }
 
+// CreateServiceImportClusterStatus creates the ServiceImport status entries for a list of clusters
+func CreateServiceImportClusterStatus(clusterIds []string) []multiclusterv1alpha1.ClusterStatus {
+	clusters := make([]multiclusterv1alpha1.ClusterStatus, 0, len(clusterIds))
+	for _, clusterId := range clusterIds {
+		clusters = append(clusters, multiclusterv1alpha1.ClusterStatus{
+			Cluster: clusterId,
+		})
+	}
+	return clusters
+}
+
 // CreateDerivedServiceStruct creates struct representation of a derived service
 func CreateDerivedServiceStruct(svcImport *multiclusterv1alpha1.ServiceImport, importedSvcPorts []*model.Port, clusterId string) *v1.Service {
 	ownerRef := metav1.NewControllerRef(svcImport, schema.GroupVersionKind{
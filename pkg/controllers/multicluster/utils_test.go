@@ -12,6 +12,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	discovery "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
@@ -820,3 +821,263 @@ func TestCreateDerivedServiceAnnotation(t *testing.T) {
 		})
 	}
 }
+
+func TestExportedServiceName(t *testing.T) {
+	svcExport := &multiclusterv1alpha1.ServiceExport{ObjectMeta: metav1.ObjectMeta{Namespace: test.HttpNsName, Name: test.SvcName}}
+	assert.Equal(t, types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName}, ExportedServiceName(svcExport))
+	assert.Equal(t, types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName}, previouslyExportedServiceName(svcExport))
+
+	svcExport.Annotations = map[string]string{
+		ExportNameAnnotation:      "alias",
+		ExportNamespaceAnnotation: "other-namespace",
+		ExportedServiceAnnotation: "previous-namespace/previous",
+	}
+	assert.Equal(t, types.NamespacedName{Namespace: "other-namespace", Name: "alias"}, ExportedServiceName(svcExport))
+	assert.Equal(t, types.NamespacedName{Namespace: "previous-namespace", Name: "previous"}, previouslyExportedServiceName(svcExport))
+}
+
+func TestIsExportNamespaceAllowed(t *testing.T) {
+	namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shared"}}
+	assert.True(t, IsExportNamespaceAllowed(namespace, "shared"), "exports within a namespace are always allowed")
+	assert.False(t, IsExportNamespaceAllowed(namespace, test.HttpNsName))
+
+	namespace.Annotations = map[string]string{AllowedExportNamespacesAnnotation: "other, " + test.HttpNsName}
+	assert.True(t, IsExportNamespaceAllowed(namespace, test.HttpNsName))
+	assert.False(t, IsExportNamespaceAllowed(namespace, "unknown"))
+
+	namespace.Annotations[AllowedExportNamespacesAnnotation] = "*"
+	assert.True(t, IsExportNamespaceAllowed(namespace, "unknown"))
+}
+
+func TestValidateExportedServiceName(t *testing.T) {
+	assert.Empty(t, ValidateExportedServiceName(types.NamespacedName{Namespace: test.HttpNsName, Name: test.SvcName}))
+	assert.NotEmpty(t, ValidateExportedServiceName(types.NamespacedName{Namespace: test.HttpNsName, Name: "1-service"}))
+	assert.NotEmpty(t, ValidateExportedServiceName(types.NamespacedName{Namespace: "Namespace", Name: test.SvcName}))
+}
+
+func TestExportedEndpoints(t *testing.T) {
+	svcExport := &multiclusterv1alpha1.ServiceExport{ObjectMeta: metav1.ObjectMeta{Namespace: test.HttpNsName, Name: test.SvcName}}
+
+	// endpoints exported under the name of the service do not have a source service
+	cmService := test.GetTestMulticlusterService()
+	assert.Equal(t, []*model.Endpoint{test.GetTestEndpoint1()}, exportedEndpoints(cmService, test.ClusterId1, svcExport))
+
+	// endpoints of services exported under an alias are told apart by their source service
+	aliased := test.GetTestEndpoint1()
+	aliased.Attributes[model.SourceServiceAttr] = test.HttpNsName + "/" + test.SvcName
+	other := test.GetTestEndpoint2()
+	other.ClusterId = test.ClusterId1
+	other.Attributes[model.SourceServiceAttr] = test.HttpNsName + "/other"
+	aliasService := &model.Service{Namespace: test.HttpNsName, Name: "alias", Endpoints: []*model.Endpoint{aliased, other, test.GetTestEndpoint2()}}
+	assert.Equal(t, []*model.Endpoint{aliased}, exportedEndpoints(aliasService, test.ClusterId1, svcExport))
+}
+
+func TestIsPortExported(t *testing.T) {
+	port := model.Port{Name: test.PortName1, Port: test.ServicePort1}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        bool
+	}{
+		{name: "no annotation", annotations: nil, want: true},
+		{name: "by name", annotations: map[string]string{ExportedPortsAnnotation: "metrics, " + test.PortName1}, want: true},
+		{name: "by number", annotations: map[string]string{ExportedPortsAnnotation: strconv.Itoa(test.ServicePort1)}, want: true},
+		{name: "not listed", annotations: map[string]string{ExportedPortsAnnotation: "metrics,9090"}, want: false},
+		{name: "empty", annotations: map[string]string{ExportedPortsAnnotation: ""}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svcExport := &multiclusterv1alpha1.ServiceExport{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			assert.Equal(t, tt.want, IsPortExported(svcExport, port))
+		})
+	}
+}
+
+func TestUnknownExportedPorts(t *testing.T) {
+	svc := &v1.Service{Spec: v1.ServiceSpec{Ports: []v1.ServicePort{{Name: test.PortName1, Port: test.ServicePort1}}}}
+	svcExport := &multiclusterv1alpha1.ServiceExport{}
+	assert.Empty(t, UnknownExportedPorts(svcExport, svc))
+
+	svcExport.Annotations = map[string]string{ExportedPortsAnnotation: test.PortName1 + ", metrics, " + strconv.Itoa(test.ServicePort1) + ",9090"}
+	assert.Equal(t, []string{"metrics", "9090"}, UnknownExportedPorts(svcExport, svc))
+}
+
+func TestCustomAttributes(t *testing.T) {
+	svcExport := &multiclusterv1alpha1.ServiceExport{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		AttributeAnnotationPrefix + "team":              "payments",
+		AttributeAnnotationPrefix + "cost-center":       "1234",
+		AttributeAnnotationPrefix + model.ClusterIdAttr: "cluster",
+		ExportedPortsAnnotation:                         "http",
+	}}}
+	attributes, errs := CustomAttributes(svcExport)
+	assert.Equal(t, map[string]string{"team": "payments", "cost-center": "1234"}, attributes)
+	assert.Len(t, errs, 1)
+}
+
+func TestTrafficAttributes(t *testing.T) {
+	svcExport := &multiclusterv1alpha1.ServiceExport{}
+	attributes, errs := TrafficAttributes(svcExport, "", "")
+	assert.Empty(t, attributes)
+	assert.Empty(t, errs)
+
+	// the cluster properties apply unless the ServiceExport annotations override them
+	attributes, errs = TrafficAttributes(svcExport, "50", "1")
+	assert.Equal(t, map[string]string{model.ClusterWeightAttr: "50", model.ClusterPriorityAttr: "1"}, attributes)
+	assert.Empty(t, errs)
+
+	svcExport.Annotations = map[string]string{WeightAnnotation: " 025", PriorityAnnotation: "high"}
+	attributes, errs = TrafficAttributes(svcExport, "50", "1")
+	assert.Equal(t, map[string]string{model.ClusterWeightAttr: "25"}, attributes)
+	assert.Len(t, errs, 1)
+}
+
+func TestPodLabelAttributes(t *testing.T) {
+	svcExport := &multiclusterv1alpha1.ServiceExport{}
+	assert.Empty(t, PodLabelAttributes(svcExport))
+
+	svcExport.Annotations = map[string]string{PodLabelAttributesAnnotation: "app, version,,"}
+	assert.Equal(t, []string{"app", "version"}, PodLabelAttributes(svcExport))
+}
+
+func TestServiceImportMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotation  string
+		defaultMode ImportMode
+		want        ImportMode
+		wantValid   bool
+	}{
+		{name: "default", want: AllClustersImportMode, wantValid: true},
+		{name: "controller_default", defaultMode: LocalFirstImportMode, want: LocalFirstImportMode, wantValid: true},
+		{name: "annotation", annotation: "LocalFirst", want: LocalFirstImportMode, wantValid: true},
+		{name: "annotation_overrides_default", annotation: "AllClusters", defaultMode: LocalFirstImportMode, want: AllClustersImportMode, wantValid: true},
+		{name: "invalid_annotation", annotation: "local", defaultMode: LocalFirstImportMode, want: LocalFirstImportMode, wantValid: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svcImport := &multiclusterv1alpha1.ServiceImport{}
+			if tt.annotation != "" {
+				svcImport.Annotations = map[string]string{ImportModeAnnotation: tt.annotation}
+			}
+			got, valid := ServiceImportMode(svcImport, tt.defaultMode)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantValid, valid)
+		})
+	}
+}
+
+func TestExportReadinessPolicy(t *testing.T) {
+	tests := []struct {
+		name                     string
+		annotation               string
+		publishNotReadyAddresses bool
+		want                     ReadinessPolicy
+		wantValid                bool
+	}{
+		{name: "default", want: ExportAllEndpoints, wantValid: true},
+		{name: "publish_not_ready_addresses", publishNotReadyAddresses: true, want: PublishNotReadyEndpoints, wantValid: true},
+		{name: "annotation", annotation: "ReadyOnly", want: ExportReadyEndpoints, wantValid: true},
+		{name: "annotation_overrides_service", annotation: "All", publishNotReadyAddresses: true, want: ExportAllEndpoints, wantValid: true},
+		{name: "invalid_annotation", annotation: "ready", publishNotReadyAddresses: true, want: PublishNotReadyEndpoints, wantValid: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &v1.Service{Spec: v1.ServiceSpec{PublishNotReadyAddresses: tt.publishNotReadyAddresses}}
+			svcExport := &multiclusterv1alpha1.ServiceExport{}
+			if tt.annotation != "" {
+				svcExport.Annotations = map[string]string{ReadinessPolicyAnnotation: tt.annotation}
+			}
+			got, valid := ExportReadinessPolicy(svc, svcExport)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantValid, valid)
+		})
+	}
+}
+
+func TestServiceExportMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		serviceType v1.ServiceType
+		annotation  string
+		want        ExportMode
+		wantValid   bool
+	}{
+		{name: "default", serviceType: v1.ServiceTypeClusterIP, want: EndpointsExportMode, wantValid: true},
+		{name: "load_balancer", serviceType: v1.ServiceTypeLoadBalancer, annotation: "LoadBalancer", want: LoadBalancerExportMode, wantValid: true},
+		{name: "load_balancer_endpoints", serviceType: v1.ServiceTypeLoadBalancer, annotation: "Endpoints", want: EndpointsExportMode, wantValid: true},
+		{name: "external_name", serviceType: v1.ServiceTypeExternalName, want: ExternalNameExportMode, wantValid: true},
+		{name: "load_balancer_without_load_balancer", serviceType: v1.ServiceTypeClusterIP, annotation: "LoadBalancer", want: EndpointsExportMode, wantValid: false},
+		{name: "external_name_with_other_mode", serviceType: v1.ServiceTypeExternalName, annotation: "Endpoints", want: ExternalNameExportMode, wantValid: false},
+		{name: "unknown_mode", serviceType: v1.ServiceTypeClusterIP, annotation: "NodePort", want: EndpointsExportMode, wantValid: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &v1.Service{Spec: v1.ServiceSpec{Type: tt.serviceType}}
+			svcExport := &multiclusterv1alpha1.ServiceExport{}
+			if tt.annotation != "" {
+				svcExport.Annotations = map[string]string{ExportModeAnnotation: tt.annotation}
+			}
+			got, valid := ServiceExportMode(svc, svcExport)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantValid, valid)
+		})
+	}
+}
+
+func TestServiceAddressEndpointSlices(t *testing.T) {
+	svc := k8sServiceForTest()
+	svc.Spec.Type = v1.ServiceTypeLoadBalancer
+	svc.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{
+		{IP: "10.0.0.1"}, {Hostname: "lb.example.com"}, {IP: "10.0.0.2"},
+	}
+
+	slices := ServiceAddressEndpointSlices(svc, LoadBalancerExportMode)
+	assert.Len(t, slices, 2)
+	assert.Equal(t, discovery.AddressTypeIPv4, slices[0].AddressType)
+	assert.Equal(t, []string{"10.0.0.1"}, slices[0].Endpoints[0].Addresses)
+	assert.Equal(t, []string{"10.0.0.2"}, slices[0].Endpoints[1].Addresses)
+	assert.Equal(t, discovery.AddressTypeFQDN, slices[1].AddressType)
+	assert.Equal(t, []string{"lb.example.com"}, slices[1].Endpoints[0].Addresses)
+	assert.True(t, *slices[1].Endpoints[0].Conditions.Ready)
+	assert.Equal(t, test.PortName1, *slices[0].Ports[0].Name)
+	assert.Equal(t, int32(test.ServicePort1), *slices[0].Ports[0].Port)
+
+	svc.Spec.Type = v1.ServiceTypeExternalName
+	svc.Spec.ExternalName = "db.example.com"
+	slices = ServiceAddressEndpointSlices(svc, ExternalNameExportMode)
+	assert.Len(t, slices, 1)
+	assert.Equal(t, discovery.AddressTypeFQDN, slices[0].AddressType)
+	assert.Equal(t, []string{"db.example.com"}, slices[0].Endpoints[0].Addresses)
+
+	svc.Status.LoadBalancer.Ingress = nil
+	assert.Empty(t, ServiceAddressEndpointSlices(svc, LoadBalancerExportMode))
+}
+
+func TestAddressTypeOf(t *testing.T) {
+	assert.Equal(t, discovery.AddressTypeIPv4, AddressTypeOf("10.0.0.1"))
+	assert.Equal(t, discovery.AddressTypeIPv6, AddressTypeOf("2001:db8::1"))
+	assert.Equal(t, discovery.AddressTypeFQDN, AddressTypeOf("lb.example.com"))
+}
+
+func TestDerivedServiceExternalName(t *testing.T) {
+	lb1 := &model.Endpoint{IP: "lb1.example.com", AddressType: discovery.AddressTypeFQDN}
+	lb2 := &model.Endpoint{IP: "lb2.example.com", AddressType: discovery.AddressTypeFQDN}
+	assert.Equal(t, "lb1.example.com", DerivedServiceExternalName([]*model.Endpoint{lb2, lb1}))
+	assert.Equal(t, "", DerivedServiceExternalName([]*model.Endpoint{lb1, test.GetTestEndpoint1()}))
+	assert.Equal(t, "", DerivedServiceExternalName(nil))
+}
+
+func TestUpdateDerivedServiceExternalName(t *testing.T) {
+	svcImport := serviceImportForTest(test.SvcName)
+	svc := &v1.Service{Spec: v1.ServiceSpec{Type: v1.ServiceTypeClusterIP, ClusterIP: "10.10.10.10", ClusterIPs: []string{"10.10.10.10"}}}
+
+	assert.False(t, UpdateDerivedServiceExternalName(svc, svcImport, ""))
+
+	assert.True(t, UpdateDerivedServiceExternalName(svc, svcImport, "lb.example.com"))
+	assert.Equal(t, v1.ServiceSpec{Type: v1.ServiceTypeExternalName, ExternalName: "lb.example.com"}, svc.Spec)
+	assert.False(t, UpdateDerivedServiceExternalName(svc, svcImport, "lb.example.com"))
+
+	svcImport.Spec.Type = multiclusterv1alpha1.Headless
+	assert.True(t, UpdateDerivedServiceExternalName(svc, svcImport, ""))
+	assert.Equal(t, v1.ServiceSpec{Type: v1.ServiceTypeClusterIP, ClusterIP: "None"}, svc.Spec)
+}
@@ -0,0 +1,276 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	multiclusterv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/multicluster/v1alpha1"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/common"
+	controllers "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/controllers/multicluster"
+	"golang.org/x/net/dns/dnsmessage"
+	v1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// resolver answers the questions about the names of the imported services:
+//   - <service>.<namespace>.svc.<domain> for the service addresses and ports,
+//   - _<port>._<protocol>.<service>.<namespace>.svc.<domain> for a named service port,
+//   - <hostname>.<cluster>.<service>.<namespace>.svc.<domain> for an endpoint of a headless service.
+type resolver struct {
+	client client.Reader
+	suffix string
+	ttl    uint32
+	log    common.Logger
+}
+
+// importedService holds the ServiceImport of a name and the EndpointSlices of its derived services.
+type importedService struct {
+	name   string
+	svc    *multiclusterv1alpha1.ServiceImport
+	slices []discovery.EndpointSlice
+}
+
+func newResolver(c client.Reader, domain string, ttl time.Duration, log common.Logger) *resolver {
+	return &resolver{
+		client: c,
+		suffix: ".svc." + strings.ToLower(strings.Trim(domain, ".")) + ".",
+		ttl:    uint32(ttl.Seconds()),
+		log:    log,
+	}
+}
+
+// resolve returns the answers to a question and the response code. Names outside the clusterset domain are refused.
+func (r *resolver) resolve(ctx context.Context, q dnsmessage.Question) ([]dnsmessage.Resource, dnsmessage.RCode) {
+	name := strings.ToLower(q.Name.String())
+	if q.Class != dnsmessage.ClassINET || !strings.HasSuffix(name, r.suffix) {
+		return nil, dnsmessage.RCodeRefused
+	}
+	labels := strings.Split(strings.TrimSuffix(name, r.suffix), ".")
+	if len(labels) < 2 {
+		// <namespace>.svc.<domain> has no records, but the names of the services below it do.
+		return nil, dnsmessage.RCodeSuccess
+	}
+
+	service, err := r.getImportedService(ctx, labels[len(labels)-1], labels[len(labels)-2])
+	if err != nil {
+		r.log.Error(err, "failed to resolve DNS name", "name", name)
+		return nil, dnsmessage.RCodeServerFailure
+	}
+	if service == nil {
+		return nil, dnsmessage.RCodeNameError
+	}
+
+	var answers []dnsmessage.Resource
+	switch {
+	case len(labels) == 2:
+		answers = r.serviceAnswers(q, service)
+	case len(labels) == 3:
+		// <cluster>.<service>.<namespace>.svc.<domain> has no records, but the endpoints below it do.
+		return nil, dnsmessage.RCodeSuccess
+	case len(labels) == 4 && strings.HasPrefix(labels[0], "_") && strings.HasPrefix(labels[1], "_"):
+		port, found := service.port(labels[0][1:], labels[1][1:])
+		if !found {
+			return nil, dnsmessage.RCodeNameError
+		}
+		if q.Type == dnsmessage.TypeSRV {
+			answers = r.srvAnswers(q.Name, service, []multiclusterv1alpha1.ServicePort{port})
+		}
+	case len(labels) == 4:
+		endpoints := service.endpoints(labels[0], labels[1])
+		if len(endpoints) == 0 {
+			return nil, dnsmessage.RCodeNameError
+		}
+		for _, endpoint := range endpoints {
+			answers = append(answers, r.addressAnswers(q, endpoint.Addresses)...)
+		}
+	default:
+		return nil, dnsmessage.RCodeNameError
+	}
+	return answers, dnsmessage.RCodeSuccess
+}
+
+// getImportedService returns the imported service of a namespace, or nil if there is no such ServiceImport.
+func (r *resolver) getImportedService(ctx context.Context, namespace string, name string) (*importedService, error) {
+	svcImport := &multiclusterv1alpha1.ServiceImport{}
+	err := r.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, svcImport)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	slices := discovery.EndpointSliceList{}
+	err = r.client.List(ctx, &slices, client.InNamespace(namespace),
+		client.MatchingLabels{controllers.LabelServiceImportName: name})
+	if err != nil {
+		return nil, err
+	}
+	return &importedService{name: name, svc: svcImport, slices: slices.Items}, nil
+}
+
+func (r *resolver) serviceAnswers(q dnsmessage.Question, service *importedService) []dnsmessage.Resource {
+	if q.Type == dnsmessage.TypeSRV {
+		return r.srvAnswers(q.Name, service, service.svc.Spec.Ports)
+	}
+	if service.svc.Spec.Type != multiclusterv1alpha1.Headless {
+		return r.addressAnswers(q, service.svc.Spec.IPs)
+	}
+	var answers []dnsmessage.Resource
+	for _, slice := range service.slices {
+		for _, endpoint := range slice.Endpoints {
+			if isReady(endpoint) {
+				answers = append(answers, r.addressAnswers(q, endpoint.Addresses)...)
+			}
+		}
+	}
+	return answers
+}
+
+// addressAnswers returns the A or AAAA records of the addresses matching the question type.
+func (r *resolver) addressAnswers(q dnsmessage.Question, addresses []string) []dnsmessage.Resource {
+	var answers []dnsmessage.Resource
+	for _, address := range addresses {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			continue
+		}
+		if ip4 := ip.To4(); ip4 != nil && q.Type == dnsmessage.TypeA {
+			resource := &dnsmessage.AResource{}
+			copy(resource.A[:], ip4)
+			answers = append(answers, r.answer(q.Name, dnsmessage.TypeA, resource))
+		} else if ip.To4() == nil && q.Type == dnsmessage.TypeAAAA {
+			resource := &dnsmessage.AAAAResource{}
+			copy(resource.AAAA[:], ip.To16())
+			answers = append(answers, r.answer(q.Name, dnsmessage.TypeAAAA, resource))
+		}
+	}
+	return answers
+}
+
+// srvAnswers returns the SRV records of the given service ports. They target the service name of a ClusterSetIP
+// service, and the name of each ready endpoint of a headless service.
+func (r *resolver) srvAnswers(name dnsmessage.Name, service *importedService, ports []multiclusterv1alpha1.ServicePort) []dnsmessage.Resource {
+	var answers []dnsmessage.Resource
+	if service.svc.Spec.Type != multiclusterv1alpha1.Headless {
+		target, err := dnsmessage.NewName(service.name + "." + service.svc.Namespace + r.suffix)
+		if err != nil {
+			return nil
+		}
+		for _, port := range ports {
+			answers = append(answers, r.answer(name, dnsmessage.TypeSRV,
+				&dnsmessage.SRVResource{Port: uint16(port.Port), Target: target}))
+		}
+		return answers
+	}
+
+	for _, slice := range service.slices {
+		cluster := slice.Labels[controllers.LabelSourceCluster]
+		for _, port := range ports {
+			slicePort, found := endpointPort(slice.Ports, port)
+			if !found {
+				continue
+			}
+			for _, endpoint := range slice.Endpoints {
+				if !isReady(endpoint) || len(endpoint.Addresses) == 0 {
+					continue
+				}
+				target, err := dnsmessage.NewName(endpointHostname(endpoint) + "." + cluster + "." +
+					service.name + "." + service.svc.Namespace + r.suffix)
+				if err != nil {
+					continue
+				}
+				answers = append(answers, r.answer(name, dnsmessage.TypeSRV,
+					&dnsmessage.SRVResource{Port: uint16(slicePort), Target: target}))
+			}
+		}
+	}
+	return answers
+}
+
+func (r *resolver) answer(name dnsmessage.Name, qtype dnsmessage.Type, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  name,
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+			TTL:   r.ttl,
+		},
+		Body: body,
+	}
+}
+
+// port returns the service port with the given name and protocol.
+func (s *importedService) port(name string, protocol string) (multiclusterv1alpha1.ServicePort, bool) {
+	for _, port := range s.svc.Spec.Ports {
+		if strings.ToLower(port.Name) == name && strings.ToLower(string(portProtocol(port.Protocol))) == protocol {
+			return port, true
+		}
+	}
+	return multiclusterv1alpha1.ServicePort{}, false
+}
+
+// endpoints returns the ready endpoints of a cluster with the given hostname.
+func (s *importedService) endpoints(hostname string, cluster string) []discovery.Endpoint {
+	var endpoints []discovery.Endpoint
+	for _, slice := range s.slices {
+		if strings.ToLower(slice.Labels[controllers.LabelSourceCluster]) != cluster {
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			if isReady(endpoint) && len(endpoint.Addresses) > 0 && strings.ToLower(endpointHostname(endpoint)) == hostname {
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+	}
+	return endpoints
+}
+
+// endpointHostname returns the hostname of an endpoint, or its first address with dashes when it has none.
+func endpointHostname(endpoint discovery.Endpoint) string {
+	if endpoint.Hostname != nil && *endpoint.Hostname != "" {
+		return *endpoint.Hostname
+	}
+	if len(endpoint.Addresses) == 0 {
+		return ""
+	}
+	return strings.NewReplacer(".", "-", ":", "-").Replace(endpoint.Addresses[0])
+}
+
+// endpointPort returns the number of the EndpointSlice port matching a service port.
+func endpointPort(slicePorts []discovery.EndpointPort, port multiclusterv1alpha1.ServicePort) (int32, bool) {
+	for _, slicePort := range slicePorts {
+		if slicePort.Port == nil {
+			continue
+		}
+		name := ""
+		if slicePort.Name != nil {
+			name = *slicePort.Name
+		}
+		var protocol v1.Protocol
+		if slicePort.Protocol != nil {
+			protocol = *slicePort.Protocol
+		}
+		if name == port.Name && portProtocol(protocol) == portProtocol(port.Protocol) {
+			return *slicePort.Port, true
+		}
+	}
+	return 0, false
+}
+
+func portProtocol(protocol v1.Protocol) v1.Protocol {
+	if protocol == "" {
+		return v1.ProtocolTCP
+	}
+	return protocol
+}
+
+// isReady returns true unless the endpoint is known not to be ready.
+func isReady(endpoint discovery.Endpoint) bool {
+	return endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+}
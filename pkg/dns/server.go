@@ -0,0 +1,268 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/common"
+	"golang.org/x/net/dns/dnsmessage"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultDomain is the clusterset domain of the multi-cluster service names.
+	DefaultDomain = "clusterset.local"
+
+	// DefaultTTL is the time to live of the answered records.
+	DefaultTTL = 5 * time.Second
+
+	// DefaultMaxConcurrentUDPQueries is the default number of UDP queries answered concurrently.
+	DefaultMaxConcurrentUDPQueries = 256
+
+	// DefaultMaxTCPConnections is the default number of TCP connections served concurrently.
+	DefaultMaxTCPConnections = 64
+
+	// Maximum size of a response sent over UDP, larger responses are truncated so that the client retries over TCP.
+	maxUDPMessageSize = 512
+
+	// Size of the buffer receiving UDP queries.
+	udpBufferSize = 4096
+
+	// Time until an idle TCP connection is closed.
+	tcpIdleTimeout = 10 * time.Second
+)
+
+// Config holds the settings of the DNS responder.
+type Config struct {
+	// Address is the UDP and TCP address the responder listens on, e.g. ":5353".
+	Address string
+
+	// Domain is the clusterset domain of the answered names.
+	Domain string
+
+	// TTL is the time to live of the answered records.
+	TTL time.Duration
+
+	// MaxConcurrentUDPQueries is the number of UDP queries answered concurrently. UDP queries received while as many
+	// queries are being answered are dropped, and retried by the clients.
+	MaxConcurrentUDPQueries int
+
+	// MaxTCPConnections is the number of TCP connections served concurrently. TCP connections accepted while as many
+	// connections are open are closed.
+	MaxTCPConnections int
+}
+
+// DefaultConfig returns the default DNS responder settings, without a listen address.
+func DefaultConfig() *Config {
+	return &Config{
+		Domain:                  DefaultDomain,
+		TTL:                     DefaultTTL,
+		MaxConcurrentUDPQueries: DefaultMaxConcurrentUDPQueries,
+		MaxTCPConnections:       DefaultMaxTCPConnections,
+	}
+}
+
+// Server answers the A, AAAA and SRV queries for the clusterset names of the imported services, from the
+// ServiceImports and the EndpointSlices of their derived services.
+type Server struct {
+	config   *Config
+	resolver *resolver
+	log      common.Logger
+	// slots of the UDP queries being answered
+	udpSlots chan struct{}
+	// slots of the open TCP connections
+	tcpSlots chan struct{}
+}
+
+// NewServer creates a DNS responder reading the imported services with the given client.
+func NewServer(config *Config, c client.Reader, log common.Logger) *Server {
+	maxUDPQueries := config.MaxConcurrentUDPQueries
+	if maxUDPQueries <= 0 {
+		maxUDPQueries = DefaultMaxConcurrentUDPQueries
+	}
+	maxTCPConnections := config.MaxTCPConnections
+	if maxTCPConnections <= 0 {
+		maxTCPConnections = DefaultMaxTCPConnections
+	}
+	return &Server{
+		config:   config,
+		resolver: newResolver(c, config.Domain, config.TTL, log),
+		log:      log,
+		udpSlots: make(chan struct{}, maxUDPQueries),
+		tcpSlots: make(chan struct{}, maxTCPConnections),
+	}
+}
+
+// NeedLeaderElection returns false, every controller replica answers DNS queries.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Start listens for UDP and TCP queries until the context is done.
+func (s *Server) Start(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", s.config.Address)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", s.config.Address)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	s.log.Info("serving DNS", "address", s.config.Address, "domain", s.config.Domain)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		errs <- s.serveUDP(ctx, conn)
+	}()
+	go func() {
+		defer wg.Done()
+		errs <- s.serveTCP(ctx, listener)
+	}()
+
+	select {
+	case <-ctx.Done():
+		err = nil
+	case err = <-errs:
+	}
+	conn.Close()
+	listener.Close()
+	wg.Wait()
+	return err
+}
+
+// serveUDP answers each UDP query in its own goroutine, up to the maximum number of concurrent queries. Queries received
+// beyond it are dropped rather than queued, so that a flood of queries does not exhaust the memory of the controller.
+func (s *Server) serveUDP(ctx context.Context, conn net.PacketConn) error {
+	buf := make([]byte, udpBufferSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		select {
+		case s.udpSlots <- struct{}{}:
+		default:
+			s.log.Debug("dropping DNS query, too many queries in flight", "client", addr.String())
+			continue
+		}
+		req := make([]byte, n)
+		copy(req, buf[:n])
+		go func() {
+			defer func() { <-s.udpSlots }()
+			if resp := s.handle(ctx, req, maxUDPMessageSize); resp != nil {
+				if _, err := conn.WriteTo(resp, addr); err != nil && ctx.Err() == nil {
+					s.log.Debug("failed to send DNS response", "client", addr.String(), "error", err.Error())
+				}
+			}
+		}()
+	}
+}
+
+// serveTCP serves each TCP connection in its own goroutine, up to the maximum number of connections. Connections
+// accepted beyond it are closed, so that idle or slow clients do not exhaust the goroutines of the controller.
+func (s *Server) serveTCP(ctx context.Context, listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		select {
+		case s.tcpSlots <- struct{}{}:
+		default:
+			s.log.Debug("closing DNS connection, too many connections open", "client", conn.RemoteAddr().String())
+			conn.Close()
+			continue
+		}
+		go func() {
+			defer func() { <-s.tcpSlots }()
+			s.serveTCPConn(ctx, conn)
+		}()
+	}
+}
+
+// serveTCPConn answers the length-prefixed queries of a TCP connection until the client closes it or stays idle.
+func (s *Server) serveTCPConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	for ctx.Err() == nil {
+		if err := conn.SetDeadline(time.Now().Add(tcpIdleTimeout)); err != nil {
+			return
+		}
+		var length uint16
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			if !errors.Is(err, io.EOF) {
+				s.log.Debug("failed to read DNS query", "client", conn.RemoteAddr().String(), "error", err.Error())
+			}
+			return
+		}
+		req := make([]byte, length)
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		resp := s.handle(ctx, req, 0)
+		if resp == nil {
+			return
+		}
+		out := make([]byte, 2, 2+len(resp))
+		binary.BigEndian.PutUint16(out, uint16(len(resp)))
+		if _, err := conn.Write(append(out, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+// handle returns the packed response to a packed query, or nil if the query cannot be answered at all. A positive
+// maxSize truncates the larger responses.
+func (s *Server) handle(ctx context.Context, req []byte, maxSize int) []byte {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(req)
+	if err != nil || header.Response {
+		return nil
+	}
+
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               header.ID,
+			Response:         true,
+			OpCode:           header.OpCode,
+			RecursionDesired: header.RecursionDesired,
+		},
+	}
+	questions, err := parser.AllQuestions()
+	switch {
+	case err != nil || len(questions) != 1:
+		resp.Header.RCode = dnsmessage.RCodeFormatError
+	case header.OpCode != 0:
+		resp.Header.RCode = dnsmessage.RCodeNotImplemented
+	default:
+		resp.Questions = questions
+		resp.Answers, resp.Header.RCode = s.resolver.resolve(ctx, questions[0])
+		resp.Header.Authoritative = resp.Header.RCode != dnsmessage.RCodeRefused
+	}
+
+	packed, err := resp.Pack()
+	if err == nil && maxSize > 0 && len(packed) > maxSize {
+		resp.Header.Truncated = true
+		resp.Answers = nil
+		packed, err = resp.Pack()
+	}
+	if err != nil {
+		s.log.Error(err, "failed to pack DNS response")
+		return nil
+	}
+	return packed
+}
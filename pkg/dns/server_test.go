@@ -0,0 +1,386 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	multiclusterv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/multicluster/v1alpha1"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/common"
+	controllers "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/controllers/multicluster"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/test"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+	v1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const headlessSvcName = "headless-svc"
+
+func TestServer_Handle(t *testing.T) {
+	tests := []struct {
+		name      string
+		qname     string
+		qtype     dnsmessage.Type
+		wantRCode dnsmessage.RCode
+		want      []dnsmessage.ResourceBody
+	}{
+		{
+			name:      "clusterset ip",
+			qname:     test.SvcName + "." + test.HttpNsName + ".svc.clusterset.local.",
+			qtype:     dnsmessage.TypeA,
+			wantRCode: dnsmessage.RCodeSuccess,
+			want:      []dnsmessage.ResourceBody{aResource(test.ClusterIp1)},
+		},
+		{
+			name:      "case insensitive name",
+			qname:     test.SvcName + "." + test.HttpNsName + ".SVC.ClusterSet.Local.",
+			qtype:     dnsmessage.TypeA,
+			wantRCode: dnsmessage.RCodeSuccess,
+			want:      []dnsmessage.ResourceBody{aResource(test.ClusterIp1)},
+		},
+		{
+			name:      "no record of the type",
+			qname:     test.SvcName + "." + test.HttpNsName + ".svc.clusterset.local.",
+			qtype:     dnsmessage.TypeAAAA,
+			wantRCode: dnsmessage.RCodeSuccess,
+		},
+		{
+			name:      "clusterset ip srv",
+			qname:     test.SvcName + "." + test.HttpNsName + ".svc.clusterset.local.",
+			qtype:     dnsmessage.TypeSRV,
+			wantRCode: dnsmessage.RCodeSuccess,
+			want: []dnsmessage.ResourceBody{
+				srvResource(test.ServicePort1, test.SvcName+"."+test.HttpNsName+".svc.clusterset.local."),
+				srvResource(test.ServicePort2, test.SvcName+"."+test.HttpNsName+".svc.clusterset.local."),
+			},
+		},
+		{
+			name:      "named port srv",
+			qname:     "_" + test.PortName2 + "._udp." + test.SvcName + "." + test.HttpNsName + ".svc.clusterset.local.",
+			qtype:     dnsmessage.TypeSRV,
+			wantRCode: dnsmessage.RCodeSuccess,
+			want: []dnsmessage.ResourceBody{
+				srvResource(test.ServicePort2, test.SvcName+"."+test.HttpNsName+".svc.clusterset.local."),
+			},
+		},
+		{
+			name:      "unknown named port",
+			qname:     "_" + test.PortName2 + "._tcp." + test.SvcName + "." + test.HttpNsName + ".svc.clusterset.local.",
+			qtype:     dnsmessage.TypeSRV,
+			wantRCode: dnsmessage.RCodeNameError,
+		},
+		{
+			name:      "headless ready endpoints",
+			qname:     headlessSvcName + "." + test.HttpNsName + ".svc.clusterset.local.",
+			qtype:     dnsmessage.TypeA,
+			wantRCode: dnsmessage.RCodeSuccess,
+			want:      []dnsmessage.ResourceBody{aResource(test.EndptIp1)},
+		},
+		{
+			name:      "headless srv",
+			qname:     headlessSvcName + "." + test.HttpNsName + ".svc.clusterset.local.",
+			qtype:     dnsmessage.TypeSRV,
+			wantRCode: dnsmessage.RCodeSuccess,
+			want: []dnsmessage.ResourceBody{
+				srvResource(test.Port1, test.Hostname+"."+test.ClusterId1+"."+headlessSvcName+"."+test.HttpNsName+".svc.clusterset.local."),
+			},
+		},
+		{
+			name:      "headless endpoint hostname",
+			qname:     test.Hostname + "." + test.ClusterId1 + "." + headlessSvcName + "." + test.HttpNsName + ".svc.clusterset.local.",
+			qtype:     dnsmessage.TypeA,
+			wantRCode: dnsmessage.RCodeSuccess,
+			want:      []dnsmessage.ResourceBody{aResource(test.EndptIp1)},
+		},
+		{
+			name:      "headless endpoint of another cluster",
+			qname:     test.Hostname + "." + test.ClusterId2 + "." + headlessSvcName + "." + test.HttpNsName + ".svc.clusterset.local.",
+			qtype:     dnsmessage.TypeA,
+			wantRCode: dnsmessage.RCodeNameError,
+		},
+		{
+			name:      "headless not ready endpoint",
+			qname:     "192-168-0-2." + test.ClusterId1 + "." + headlessSvcName + "." + test.HttpNsName + ".svc.clusterset.local.",
+			qtype:     dnsmessage.TypeA,
+			wantRCode: dnsmessage.RCodeNameError,
+		},
+		{
+			name:      "namespace",
+			qname:     test.HttpNsName + ".svc.clusterset.local.",
+			qtype:     dnsmessage.TypeA,
+			wantRCode: dnsmessage.RCodeSuccess,
+		},
+		{
+			name:      "unknown service",
+			qname:     "unknown." + test.HttpNsName + ".svc.clusterset.local.",
+			qtype:     dnsmessage.TypeA,
+			wantRCode: dnsmessage.RCodeNameError,
+		},
+		{
+			name:      "outside the domain",
+			qname:     test.SvcName + "." + test.HttpNsName + ".svc.cluster.local.",
+			qtype:     dnsmessage.TypeA,
+			wantRCode: dnsmessage.RCodeRefused,
+		},
+	}
+	server := serverForTest(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := server.handle(context.TODO(), queryForTest(t, tt.qname, tt.qtype), maxUDPMessageSize)
+			require.NotNil(t, resp)
+
+			msg := dnsmessage.Message{}
+			require.NoError(t, msg.Unpack(resp))
+			assert.Equal(t, uint16(42), msg.Header.ID)
+			assert.True(t, msg.Header.Response)
+			assert.Equal(t, tt.wantRCode, msg.Header.RCode)
+			assert.Equal(t, tt.wantRCode != dnsmessage.RCodeRefused, msg.Header.Authoritative)
+
+			bodies := make([]dnsmessage.ResourceBody, 0, len(msg.Answers))
+			for _, answer := range msg.Answers {
+				assert.Equal(t, tt.qname, answer.Header.Name.String())
+				assert.Equal(t, uint32(5), answer.Header.TTL)
+				bodies = append(bodies, answer.Body)
+			}
+			assert.ElementsMatch(t, tt.want, bodies)
+		})
+	}
+}
+
+func TestServer_HandleMalformedQuery(t *testing.T) {
+	server := serverForTest(t)
+	assert.Nil(t, server.handle(context.TODO(), []byte{0x01}, maxUDPMessageSize))
+
+	msg := dnsmessage.Message{Header: dnsmessage.Header{ID: 42}}
+	req, err := msg.Pack()
+	require.NoError(t, err)
+	resp := server.handle(context.TODO(), req, maxUDPMessageSize)
+	require.NotNil(t, resp)
+	require.NoError(t, msg.Unpack(resp))
+	assert.Equal(t, dnsmessage.RCodeFormatError, msg.Header.RCode)
+}
+
+func TestServer_HandleTruncatesUDPResponse(t *testing.T) {
+	svcImport := serviceImportForTest(test.SvcName, multiclusterv1alpha1.ClusterSetIP)
+	svcImport.Spec.IPs = nil
+	for i := 0; i < 40; i++ {
+		svcImport.Spec.IPs = append(svcImport.Spec.IPs, net.IPv4(10, 0, 0, byte(i)).String())
+	}
+	server := NewServer(DefaultConfig(), fakeClientForTest(svcImport), common.NewLoggerWithLogr(testr.New(t)))
+	req := queryForTest(t, test.SvcName+"."+test.HttpNsName+".svc.clusterset.local.", dnsmessage.TypeA)
+
+	msg := dnsmessage.Message{}
+	require.NoError(t, msg.Unpack(server.handle(context.TODO(), req, maxUDPMessageSize)))
+	assert.True(t, msg.Header.Truncated)
+	assert.Empty(t, msg.Answers)
+
+	require.NoError(t, msg.Unpack(server.handle(context.TODO(), req, 0)))
+	assert.False(t, msg.Header.Truncated)
+	assert.Len(t, msg.Answers, 40)
+}
+
+func TestServer_ServeTCPConn(t *testing.T) {
+	server := serverForTest(t)
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	go server.serveTCPConn(context.TODO(), serverConn)
+
+	req := queryForTest(t, test.SvcName+"."+test.HttpNsName+".svc.clusterset.local.", dnsmessage.TypeA)
+	out := make([]byte, 2, 2+len(req))
+	binary.BigEndian.PutUint16(out, uint16(len(req)))
+	require.NoError(t, clientConn.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err := clientConn.Write(append(out, req...))
+	require.NoError(t, err)
+
+	var length uint16
+	require.NoError(t, binary.Read(clientConn, binary.BigEndian, &length))
+	resp := make([]byte, length)
+	_, err = io.ReadFull(clientConn, resp)
+	require.NoError(t, err)
+
+	msg := dnsmessage.Message{}
+	require.NoError(t, msg.Unpack(resp))
+	assert.Equal(t, dnsmessage.RCodeSuccess, msg.Header.RCode)
+	require.Len(t, msg.Answers, 1)
+	assert.Equal(t, aResource(test.ClusterIp1), msg.Answers[0].Body)
+}
+
+func TestServer_ServeUDPDropsQueriesWhenSaturated(t *testing.T) {
+	server := serverForTest(t)
+	server.udpSlots = make(chan struct{}, 1)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer func() {
+		cancel()
+		conn.Close()
+	}()
+	go func() { _ = server.serveUDP(ctx, conn) }()
+
+	clientConn, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer clientConn.Close()
+	req := queryForTest(t, test.SvcName+"."+test.HttpNsName+".svc.clusterset.local.", dnsmessage.TypeA)
+	resp := make([]byte, maxUDPMessageSize)
+
+	// the only slot is taken, the query is dropped
+	server.udpSlots <- struct{}{}
+	_, err = clientConn.Write(req)
+	require.NoError(t, err)
+	require.NoError(t, clientConn.SetReadDeadline(time.Now().Add(200*time.Millisecond)))
+	_, err = clientConn.Read(resp)
+	assert.Error(t, err)
+
+	// the query is answered once the slot is released
+	<-server.udpSlots
+	_, err = clientConn.Write(req)
+	require.NoError(t, err)
+	require.NoError(t, clientConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, err := clientConn.Read(resp)
+	require.NoError(t, err)
+	msg := dnsmessage.Message{}
+	require.NoError(t, msg.Unpack(resp[:n]))
+	assert.Equal(t, dnsmessage.RCodeSuccess, msg.Header.RCode)
+}
+
+func TestServer_ServeTCPClosesConnectionsWhenSaturated(t *testing.T) {
+	server := serverForTest(t)
+	server.tcpSlots = make(chan struct{}, 1)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer func() {
+		cancel()
+		listener.Close()
+	}()
+	go func() { _ = server.serveTCP(ctx, listener) }()
+
+	req := queryForTest(t, test.SvcName+"."+test.HttpNsName+".svc.clusterset.local.", dnsmessage.TypeA)
+	out := make([]byte, 2, 2+len(req))
+	binary.BigEndian.PutUint16(out, uint16(len(req)))
+	query := func() (uint16, error) {
+		clientConn, err := net.Dial("tcp", listener.Addr().String())
+		require.NoError(t, err)
+		defer clientConn.Close()
+		require.NoError(t, clientConn.SetDeadline(time.Now().Add(5*time.Second)))
+		if _, err = clientConn.Write(append(out, req...)); err != nil {
+			return 0, err
+		}
+		var length uint16
+		err = binary.Read(clientConn, binary.BigEndian, &length)
+		return length, err
+	}
+
+	// the only slot is taken, the connection is closed
+	server.tcpSlots <- struct{}{}
+	_, err = query()
+	assert.Error(t, err)
+
+	// the connection is served once the slot is released
+	<-server.tcpSlots
+	length, err := query()
+	require.NoError(t, err)
+	assert.NotZero(t, length)
+}
+
+func serverForTest(t *testing.T) *Server {
+	return NewServer(DefaultConfig(), fakeClientForTest(
+		serviceImportForTest(test.SvcName, multiclusterv1alpha1.ClusterSetIP),
+		serviceImportForTest(headlessSvcName, multiclusterv1alpha1.Headless),
+		headlessEndpointSliceForTest(),
+	), common.NewLoggerWithLogr(testr.New(t)))
+}
+
+func fakeClientForTest(objs ...client.Object) client.Reader {
+	s := runtime.NewScheme()
+	_ = scheme.AddToScheme(s)
+	s.AddKnownTypes(multiclusterv1alpha1.GroupVersion, &multiclusterv1alpha1.ServiceImportList{}, &multiclusterv1alpha1.ServiceImport{})
+	return fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build()
+}
+
+func serviceImportForTest(name string, importType multiclusterv1alpha1.ServiceImportType) *multiclusterv1alpha1.ServiceImport {
+	svcImport := &multiclusterv1alpha1.ServiceImport{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: test.HttpNsName,
+		},
+		Spec: multiclusterv1alpha1.ServiceImportSpec{
+			Type: importType,
+			Ports: []multiclusterv1alpha1.ServicePort{
+				{Name: test.PortName1, Protocol: test.Protocol1, Port: test.ServicePort1},
+				{Name: test.PortName2, Protocol: test.Protocol2, Port: test.ServicePort2},
+			},
+		},
+	}
+	if importType == multiclusterv1alpha1.ClusterSetIP {
+		svcImport.Spec.IPs = []string{test.ClusterIp1}
+	}
+	return svcImport
+}
+
+func headlessEndpointSliceForTest() *discovery.EndpointSlice {
+	protocol := v1.ProtocolTCP
+	return &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: test.HttpNsName,
+			Name:      headlessSvcName + "-slice",
+			Labels: map[string]string{
+				controllers.LabelServiceImportName: headlessSvcName,
+				controllers.LabelSourceCluster:     test.ClusterId1,
+			},
+		},
+		AddressType: discovery.AddressTypeIPv4,
+		Endpoints: []discovery.Endpoint{
+			{
+				Addresses:  []string{test.EndptIp1},
+				Conditions: discovery.EndpointConditions{Ready: aws.Bool(true)},
+				Hostname:   aws.String(test.Hostname),
+			},
+			{
+				Addresses:  []string{test.EndptIp2},
+				Conditions: discovery.EndpointConditions{Ready: aws.Bool(false)},
+			},
+		},
+		Ports: []discovery.EndpointPort{{
+			Name:     aws.String(test.PortName1),
+			Protocol: &protocol,
+			Port:     aws.Int32(test.Port1),
+		}},
+	}
+}
+
+func queryForTest(t *testing.T, qname string, qtype dnsmessage.Type) []byte {
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 42, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(qname),
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	req, err := msg.Pack()
+	require.NoError(t, err)
+	return req
+}
+
+func aResource(ip string) dnsmessage.ResourceBody {
+	resource := &dnsmessage.AResource{}
+	copy(resource.A[:], net.ParseIP(ip).To4())
+	return resource
+}
+
+func srvResource(port int, target string) dnsmessage.ResourceBody {
+	return &dnsmessage.SRVResource{Port: uint16(port), Target: dnsmessage.MustNewName(target)}
+}
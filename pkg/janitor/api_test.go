@@ -4,7 +4,7 @@ import (
 	"context"
 	"testing"
 
-	janitorMock "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/mocks/integration/janitor"
+	janitorMock "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/mocks/pkg/janitor"
 	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/test"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	sd "github.com/aws/aws-sdk-go-v2/service/servicediscovery"
@@ -9,7 +9,7 @@ import (
 )
 
 // SdkJanitorFacade extends the minimal surface area of ServiceDiscovery API calls of the client
-// for integration test janitor operations.
+// for janitor operations.
 type SdkJanitorFacade interface {
 	// DeleteNamespace provides ServiceDiscovery DeleteNamespace wrapper interface.
 	DeleteNamespace(context.Context, *sd.DeleteNamespaceInput, ...func(*sd.Options)) (*sd.DeleteNamespaceOutput, error)
@@ -25,7 +25,7 @@ type sdkJanitorFacade struct {
 }
 
 // NewSdkJanitorFacadeFromConfig creates a new AWS facade from an AWS client config
-// extended for integration test janitor operations.
+// extended for janitor operations.
 func NewSdkJanitorFacadeFromConfig(cfg *aws.Config) SdkJanitorFacade {
 	return &sdkJanitorFacade{sd.NewFromConfig(*cfg)}
 }
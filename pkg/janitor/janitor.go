@@ -0,0 +1,270 @@
+package janitor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/cloudmap"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/servicediscovery/types"
+)
+
+// CloudMapJanitor removes the AWS Cloud Map resources of a clusterset. Only the instances of its clusterset are ever
+// removed, along with the services and namespaces they leave empty when requested.
+type CloudMapJanitor interface {
+	// Plan returns the resources of the Cloud Map namespace mapped from a Kubernetes namespace which a cleanup within
+	// the given scope removes, without changing them.
+	Plan(ctx context.Context, nsName string, scope Scope) (*Plan, error)
+
+	// Apply removes the resources of a plan. It returns the resources actually removed, also when it fails.
+	Apply(ctx context.Context, plan *Plan) (*Plan, error)
+
+	// Cleanup removes all instances of the clusterset from the Cloud Map namespace mapped from a Kubernetes namespace,
+	// then the services and the namespace left empty. It returns the resources removed, also when it fails.
+	Cleanup(ctx context.Context, nsName string) (*Plan, error)
+}
+
+// Scope selects the instances of the clusterset a cleanup removes.
+type Scope struct {
+	// ClusterId restricts the cleanup to the instances of a cluster, all clusters of the clusterset if empty.
+	ClusterId string
+
+	// Service restricts the cleanup to a service, all services of the namespace if empty.
+	Service string
+
+	// MinExportAge restricts the cleanup to the instances whose ServiceExport was created at least MinExportAge ago,
+	// rather than the instances themselves. Instances without a ServiceExport creation timestamp are kept when set.
+	MinExportAge time.Duration
+
+	// DeleteServices deletes the services left without instances of any clusterset once their last instances are
+	// removed.
+	DeleteServices bool
+
+	// DeleteNamespace deletes the namespace when all its services are deleted. It requires DeleteServices, and no
+	// Service restriction.
+	DeleteNamespace bool
+}
+
+// Plan lists the resources of a Cloud Map namespace removed by a cleanup.
+type Plan struct {
+	// Namespace is the name of the Cloud Map namespace.
+	Namespace string `json:"namespace"`
+
+	// NamespaceId is the ID of the Cloud Map namespace, empty if it does not exist.
+	NamespaceId string `json:"namespaceId,omitempty"`
+
+	// Instances are the instances to de-register.
+	Instances []Instance `json:"instances"`
+
+	// Services are the services to delete, once their instances are de-registered.
+	Services []Service `json:"services"`
+
+	// DeleteNamespace is true if the namespace is deleted, once its services are deleted.
+	DeleteNamespace bool `json:"deleteNamespace"`
+}
+
+// Instance is a Cloud Map service instance.
+type Instance struct {
+	Service   string `json:"service"`
+	ServiceId string `json:"serviceId"`
+	Id        string `json:"id"`
+	ClusterId string `json:"clusterId"`
+}
+
+// Service is a Cloud Map service.
+type Service struct {
+	Name string `json:"name"`
+	Id   string `json:"id"`
+}
+
+func newPlan(nsName string) *Plan {
+	return &Plan{Namespace: nsName, Instances: []Instance{}, Services: []Service{}}
+}
+
+// IsEmpty returns true if the plan removes nothing.
+func (p *Plan) IsEmpty() bool {
+	return len(p.Instances) == 0 && len(p.Services) == 0 && !p.DeleteNamespace
+}
+
+type cloudMapJanitor struct {
+	clusterSetId string
+	sdApi        ServiceDiscoveryJanitorApi
+	nsMapper     cloudmap.NamespaceMapper
+	now          func() time.Time
+}
+
+// NewDefaultJanitor returns a new janitor object.
+func NewDefaultJanitor(clusterId string, clusterSetId string) (CloudMapJanitor, error) {
+	return NewJanitorWithNamespaceMapping(clusterId, clusterSetId, cloudmap.DefaultNamespaceMapperConfig())
+}
+
+// NewJanitorWithNamespaceMapping returns a new janitor object cleaning up the Cloud Map namespaces mapped from
+// Kubernetes namespaces with the given configuration, as the controller does. Namespace annotations are not supported.
+func NewJanitorWithNamespaceMapping(clusterId string, clusterSetId string, nsMapperConfig *cloudmap.NamespaceMapperConfig) (CloudMapJanitor, error) {
+	awsCfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		return nil, fmt.Errorf("unable to configure AWS session: %w", err)
+	}
+
+	nsMapper, err := cloudmap.NewNamespaceMapper(nsMapperConfig, nil, model.NewClusterUtilsWithValues(clusterId, clusterSetId))
+	if err != nil {
+		return nil, fmt.Errorf("unable to configure namespace mapping: %w", err)
+	}
+
+	return NewJanitorFromConfig(&awsCfg, clusterSetId, nsMapper), nil
+}
+
+// NewJanitorFromConfig returns a new janitor object removing the instances of a clusterset from the Cloud Map
+// namespaces mapped by the given namespace mapper.
+func NewJanitorFromConfig(awsCfg *aws.Config, clusterSetId string, nsMapper cloudmap.NamespaceMapper) CloudMapJanitor {
+	return &cloudMapJanitor{
+		clusterSetId: clusterSetId,
+		sdApi:        NewServiceDiscoveryJanitorApiFromConfig(awsCfg),
+		nsMapper:     nsMapper,
+		now:          time.Now,
+	}
+}
+
+func (j *cloudMapJanitor) Cleanup(ctx context.Context, k8sNsName string) (*Plan, error) {
+	plan, err := j.Plan(ctx, k8sNsName, Scope{DeleteServices: true, DeleteNamespace: true})
+	if err != nil {
+		return newPlan(""), err
+	}
+	return j.Apply(ctx, plan)
+}
+
+func (j *cloudMapJanitor) Plan(ctx context.Context, k8sNsName string, scope Scope) (*Plan, error) {
+	nsName, err := j.nsMapper.CloudMapNamespaceName(ctx, k8sNsName)
+	if err != nil {
+		return nil, fmt.Errorf("could not map namespace %s: %w", k8sNsName, err)
+	}
+	plan := newPlan(nsName)
+
+	nsMap, err := j.sdApi.GetNamespaceMap(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not list namespaces: %w", err)
+	}
+	ns, found := nsMap[nsName]
+	if !found {
+		// nothing to clean
+		return plan, nil
+	}
+	plan.NamespaceId = ns.Id
+
+	svcIdMap, err := j.sdApi.GetServiceIdMap(ctx, ns.Id)
+	if err != nil {
+		return nil, fmt.Errorf("could not list services of namespace %s: %w", nsName, err)
+	}
+	svcNames := make([]string, 0, len(svcIdMap))
+	for svcName := range svcIdMap {
+		if scope.Service == "" || scope.Service == svcName {
+			svcNames = append(svcNames, svcName)
+		}
+	}
+	sort.Strings(svcNames)
+
+	for _, svcName := range svcNames {
+		svcId := svcIdMap[svcName]
+		insts, err := j.sdApi.ListInstances(ctx, svcId)
+		if err != nil {
+			return nil, fmt.Errorf("could not list instances of service %s: %w", svcName, err)
+		}
+
+		removed := 0
+		for _, inst := range insts {
+			if j.inScope(inst, scope) {
+				plan.Instances = append(plan.Instances, Instance{
+					Service:   svcName,
+					ServiceId: svcId,
+					Id:        aws.ToString(inst.Id),
+					ClusterId: inst.Attributes[model.ClusterIdAttr],
+				})
+				removed++
+			}
+		}
+		// services still holding instances of other clusters or clustersets are kept, and so are the services without
+		// instances in scope, e.g. of other clusters than the one cleaned up
+		if scope.DeleteServices && removed > 0 && removed == len(insts) {
+			plan.Services = append(plan.Services, Service{Name: svcName, Id: svcId})
+		}
+	}
+
+	plan.DeleteNamespace = scope.DeleteNamespace && scope.DeleteServices && scope.Service == "" &&
+		len(plan.Services) == len(svcIdMap)
+	return plan, nil
+}
+
+// inScope returns true if an instance belongs to the clusterset of the janitor, and is within the scope.
+func (j *cloudMapJanitor) inScope(inst types.InstanceSummary, scope Scope) bool {
+	if inst.Attributes[model.ClusterSetIdAttr] != j.clusterSetId {
+		return false
+	}
+	if scope.ClusterId != "" && inst.Attributes[model.ClusterIdAttr] != scope.ClusterId {
+		return false
+	}
+	if scope.MinExportAge > 0 {
+		created, err := strconv.ParseInt(inst.Attributes[model.ServiceExportCreationAttr], 10, 64)
+		if err != nil || j.now().Sub(time.UnixMilli(created)) < scope.MinExportAge {
+			return false
+		}
+	}
+	return true
+}
+
+func (j *cloudMapJanitor) Apply(ctx context.Context, plan *Plan) (*Plan, error) {
+	removed := newPlan(plan.Namespace)
+	removed.NamespaceId = plan.NamespaceId
+
+	// de-register the instances of each service together
+	instsBySvc := make(map[string][]Instance)
+	svcIds := make([]string, 0)
+	for _, inst := range plan.Instances {
+		if _, found := instsBySvc[inst.ServiceId]; !found {
+			svcIds = append(svcIds, inst.ServiceId)
+		}
+		instsBySvc[inst.ServiceId] = append(instsBySvc[inst.ServiceId], inst)
+	}
+	for _, svcId := range svcIds {
+		if err := j.deregisterInstances(ctx, svcId, instsBySvc[svcId]); err != nil {
+			return removed, fmt.Errorf("could not de-register instances of service %s: %w", instsBySvc[svcId][0].Service, err)
+		}
+		removed.Instances = append(removed.Instances, instsBySvc[svcId]...)
+	}
+
+	for _, svc := range plan.Services {
+		if err := j.sdApi.DeleteService(ctx, svc.Id); err != nil {
+			return removed, fmt.Errorf("could not delete service %s: %w", svc.Name, err)
+		}
+		removed.Services = append(removed.Services, svc)
+	}
+
+	if plan.DeleteNamespace {
+		opId, err := j.sdApi.DeleteNamespace(ctx, plan.NamespaceId)
+		if err == nil {
+			_, err = cloudmap.NewOperationPoller(j.sdApi).Poll(ctx, types.OperationTypeDeleteNamespace, opId)
+		}
+		if err != nil {
+			return removed, fmt.Errorf("could not delete namespace %s: %w", plan.Namespace, err)
+		}
+		removed.DeleteNamespace = true
+	}
+	return removed, nil
+}
+
+func (j *cloudMapJanitor) deregisterInstances(ctx context.Context, svcId string, insts []Instance) error {
+	pollerConfig := cloudmap.DefaultOperationPollerConfig()
+	pollerConfig.ServiceId = svcId
+	opPoller := cloudmap.NewOperationPollerWithConfig(pollerConfig, j.sdApi)
+	for _, inst := range insts {
+		instId := inst.Id
+		opPoller.Submit(ctx, types.OperationTypeDeregisterInstance, func() (opId string, err error) {
+			return j.sdApi.DeregisterInstance(ctx, svcId, instId)
+		})
+	}
+	return opPoller.Await()
+}
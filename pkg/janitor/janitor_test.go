@@ -0,0 +1,275 @@
+package janitor
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	janitorMock "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/mocks/pkg/janitor"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/cloudmap"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/test"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/servicediscovery/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+type testJanitor struct {
+	janitor *cloudMapJanitor
+	mockApi *janitorMock.MockServiceDiscoveryJanitorApi
+	close   func()
+}
+
+func TestNewDefaultJanitor(t *testing.T) {
+	j, err := NewDefaultJanitor(test.ClusterId1, test.ClusterSet)
+	assert.NoError(t, err)
+	assert.NotNil(t, j)
+}
+
+func TestCleanupHappyCase(t *testing.T) {
+	tj := getTestJanitor(t)
+	defer tj.close()
+
+	tj.mockApi.EXPECT().GetNamespaceMap(context.TODO()).
+		Return(map[string]*model.Namespace{test.HttpNsName: test.GetTestHttpNamespace()}, nil)
+	tj.mockApi.EXPECT().GetServiceIdMap(context.TODO(), test.HttpNsId).
+		Return(map[string]string{test.SvcName: test.SvcId}, nil)
+	tj.mockApi.EXPECT().ListInstances(context.TODO(), test.SvcId).
+		Return([]types.InstanceSummary{instanceForTest(test.EndptId1, test.ClusterId1, test.ClusterSet)}, nil)
+
+	tj.mockApi.EXPECT().DeregisterInstance(context.TODO(), test.SvcId, test.EndptId1).
+		Return(test.OpId1, nil)
+	tj.mockApi.EXPECT().ListOperations(context.TODO(), gomock.Any()).
+		Return(map[string]types.OperationStatus{test.OpId1: types.OperationStatusSuccess}, nil)
+	tj.mockApi.EXPECT().DeleteService(context.TODO(), test.SvcId).
+		Return(nil)
+	tj.mockApi.EXPECT().DeleteNamespace(context.TODO(), test.HttpNsId).
+		Return(test.OpId2, nil)
+	tj.mockApi.EXPECT().GetOperation(context.TODO(), test.OpId2).
+		Return(&types.Operation{Status: types.OperationStatusSuccess,
+			Targets: map[string]string{string(types.OperationTargetTypeNamespace): test.HttpNsId}}, nil)
+
+	removed, err := tj.janitor.Cleanup(context.TODO(), test.HttpNsName)
+	assert.NoError(t, err)
+	assert.Equal(t, &Plan{
+		Namespace:       test.HttpNsName,
+		NamespaceId:     test.HttpNsId,
+		Instances:       []Instance{{Service: test.SvcName, ServiceId: test.SvcId, Id: test.EndptId1, ClusterId: test.ClusterId1}},
+		Services:        []Service{{Name: test.SvcName, Id: test.SvcId}},
+		DeleteNamespace: true,
+	}, removed)
+}
+
+func TestCleanupNothingToClean(t *testing.T) {
+	tj := getTestJanitor(t)
+	defer tj.close()
+
+	tj.mockApi.EXPECT().GetNamespaceMap(context.TODO()).
+		Return(map[string]*model.Namespace{}, nil)
+
+	removed, err := tj.janitor.Cleanup(context.TODO(), test.HttpNsName)
+	assert.NoError(t, err)
+	assert.True(t, removed.IsEmpty())
+}
+
+func TestCleanupMappedNamespace(t *testing.T) {
+	tj := getTestJanitor(t)
+	defer tj.close()
+
+	nsMapper, err := cloudmap.NewNamespaceMapper(&cloudmap.NamespaceMapperConfig{Template: "{{.ClusterSetId}}-{{.Namespace}}"},
+		nil, model.NewClusterUtilsWithValues(test.ClusterId1, test.ClusterSet))
+	assert.NoError(t, err)
+	tj.janitor.nsMapper = nsMapper
+
+	// the namespace named after the Kubernetes namespace belongs to another clusterset
+	tj.mockApi.EXPECT().GetNamespaceMap(context.TODO()).
+		Return(map[string]*model.Namespace{test.HttpNsName: test.GetTestHttpNamespace()}, nil)
+
+	removed, err := tj.janitor.Cleanup(context.TODO(), test.HttpNsName)
+	assert.NoError(t, err)
+	assert.True(t, removed.IsEmpty())
+	assert.Equal(t, test.ClusterSet+"-"+test.HttpNsName, removed.Namespace)
+}
+
+func TestCleanupError(t *testing.T) {
+	tj := getTestJanitor(t)
+	defer tj.close()
+
+	tj.mockApi.EXPECT().GetNamespaceMap(context.TODO()).
+		Return(nil, errors.New("error"))
+
+	removed, err := tj.janitor.Cleanup(context.TODO(), test.HttpNsName)
+	assert.Error(t, err)
+	assert.True(t, removed.IsEmpty())
+}
+
+func TestPlanScope(t *testing.T) {
+	now := time.UnixMilli(test.SvcExportCreationTimestamp).Add(time.Hour)
+	old := instanceForTest("old", test.ClusterId1, test.ClusterSet)
+	recent := instanceForTest("recent", test.ClusterId1, test.ClusterSet)
+	recent.Attributes[model.ServiceExportCreationAttr] = "1640998000000"
+	noTimestamp := instanceForTest("no-timestamp", test.ClusterId1, test.ClusterSet)
+	delete(noTimestamp.Attributes, model.ServiceExportCreationAttr)
+	otherCluster := instanceForTest("other-cluster", test.ClusterId2, test.ClusterSet)
+	otherClusterSet := instanceForTest("other-clusterset", test.ClusterId1, "other-clusterset")
+
+	tests := []struct {
+		name     string
+		scope    Scope
+		expected *Plan
+	}{
+		{
+			name:  "clusterset",
+			scope: Scope{DeleteServices: true, DeleteNamespace: true},
+			expected: &Plan{Instances: []Instance{
+				planned("empty-svc", "old"), planned("empty-svc", "other-cluster"),
+				planned(test.SvcName, "old"), planned(test.SvcName, "recent"), planned(test.SvcName, "no-timestamp"), planned(test.SvcName, "other-cluster"),
+			}, Services: []Service{{Name: "empty-svc", Id: "empty-svc-id"}}},
+		},
+		{
+			name:  "cluster",
+			scope: Scope{ClusterId: test.ClusterId2, DeleteServices: true},
+			expected: &Plan{Instances: []Instance{
+				planned("empty-svc", "other-cluster"), planned(test.SvcName, "other-cluster"),
+			}, Services: []Service{}},
+		},
+		{
+			name:  "service",
+			scope: Scope{Service: "empty-svc", DeleteServices: true, DeleteNamespace: true},
+			expected: &Plan{Instances: []Instance{
+				planned("empty-svc", "old"), planned("empty-svc", "other-cluster"),
+			}, Services: []Service{{Name: "empty-svc", Id: "empty-svc-id"}}},
+		},
+		{
+			name:  "age",
+			scope: Scope{ClusterId: test.ClusterId1, Service: test.SvcName, MinExportAge: 30 * time.Minute},
+			expected: &Plan{Instances: []Instance{
+				planned(test.SvcName, "old"),
+			}, Services: []Service{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tj := getTestJanitor(t)
+			defer tj.close()
+			tj.janitor.now = func() time.Time { return now }
+
+			tj.mockApi.EXPECT().GetNamespaceMap(context.TODO()).
+				Return(map[string]*model.Namespace{test.HttpNsName: test.GetTestHttpNamespace()}, nil)
+			tj.mockApi.EXPECT().GetServiceIdMap(context.TODO(), test.HttpNsId).
+				Return(map[string]string{test.SvcName: test.SvcId, "empty-svc": "empty-svc-id"}, nil)
+			tj.mockApi.EXPECT().ListInstances(context.TODO(), test.SvcId).
+				Return([]types.InstanceSummary{old, recent, noTimestamp, otherCluster, otherClusterSet}, nil).AnyTimes()
+			tj.mockApi.EXPECT().ListInstances(context.TODO(), "empty-svc-id").
+				Return([]types.InstanceSummary{old, otherCluster}, nil).AnyTimes()
+
+			plan, err := tj.janitor.Plan(context.TODO(), test.HttpNsName, tt.scope)
+			assert.NoError(t, err)
+			tt.expected.Namespace = test.HttpNsName
+			tt.expected.NamespaceId = test.HttpNsId
+			assert.Equal(t, tt.expected, plan)
+		})
+	}
+}
+
+func TestPlanKeepsServicesWithoutInstancesInScope(t *testing.T) {
+	tj := getTestJanitor(t)
+	defer tj.close()
+
+	tj.mockApi.EXPECT().GetNamespaceMap(context.TODO()).
+		Return(map[string]*model.Namespace{test.HttpNsName: test.GetTestHttpNamespace()}, nil)
+	tj.mockApi.EXPECT().GetServiceIdMap(context.TODO(), test.HttpNsId).
+		Return(map[string]string{test.SvcName: test.SvcId}, nil)
+	tj.mockApi.EXPECT().ListInstances(context.TODO(), test.SvcId).
+		Return([]types.InstanceSummary{}, nil)
+
+	// the cleanup of a cluster does not delete the services it did not remove instances from
+	plan, err := tj.janitor.Plan(context.TODO(), test.HttpNsName, Scope{ClusterId: test.ClusterId1, DeleteServices: true})
+	assert.NoError(t, err)
+	assert.Empty(t, plan.Services)
+	assert.True(t, plan.IsEmpty())
+}
+
+func TestPlanDeleteNamespace(t *testing.T) {
+	tj := getTestJanitor(t)
+	defer tj.close()
+
+	tj.mockApi.EXPECT().GetNamespaceMap(context.TODO()).
+		Return(map[string]*model.Namespace{test.HttpNsName: test.GetTestHttpNamespace()}, nil)
+	tj.mockApi.EXPECT().GetServiceIdMap(context.TODO(), test.HttpNsId).
+		Return(map[string]string{}, nil)
+
+	plan, err := tj.janitor.Plan(context.TODO(), test.HttpNsName, Scope{DeleteServices: true, DeleteNamespace: true})
+	assert.NoError(t, err)
+	assert.True(t, plan.DeleteNamespace)
+	assert.False(t, plan.IsEmpty())
+}
+
+func TestApplyPartialFailure(t *testing.T) {
+	tj := getTestJanitor(t)
+	defer tj.close()
+
+	plan := &Plan{
+		Namespace:       test.HttpNsName,
+		NamespaceId:     test.HttpNsId,
+		Instances:       []Instance{{Service: test.SvcName, ServiceId: test.SvcId, Id: test.EndptId1, ClusterId: test.ClusterId1}},
+		Services:        []Service{{Name: test.SvcName, Id: test.SvcId}},
+		DeleteNamespace: true,
+	}
+	tj.mockApi.EXPECT().DeregisterInstance(context.TODO(), test.SvcId, test.EndptId1).
+		Return(test.OpId1, nil)
+	tj.mockApi.EXPECT().ListOperations(context.TODO(), gomock.Any()).
+		Return(map[string]types.OperationStatus{test.OpId1: types.OperationStatusSuccess}, nil)
+	tj.mockApi.EXPECT().DeleteService(context.TODO(), test.SvcId).
+		Return(errors.New("ResourceInUse"))
+
+	removed, err := tj.janitor.Apply(context.TODO(), plan)
+	assert.ErrorContains(t, err, "could not delete service "+test.SvcName)
+	assert.Equal(t, &Plan{
+		Namespace:   test.HttpNsName,
+		NamespaceId: test.HttpNsId,
+		Instances:   plan.Instances,
+		Services:    []Service{},
+	}, removed)
+}
+
+func getTestJanitor(t *testing.T) *testJanitor {
+	mockController := gomock.NewController(t)
+	api := janitorMock.NewMockServiceDiscoveryJanitorApi(mockController)
+	return &testJanitor{
+		janitor: &cloudMapJanitor{
+			clusterSetId: test.ClusterSet,
+			sdApi:        api,
+			nsMapper:     cloudmap.NewDefaultNamespaceMapper(),
+			now:          time.Now,
+		},
+		mockApi: api,
+		close:   func() { mockController.Finish() },
+	}
+}
+
+func instanceForTest(id string, clusterId string, clusterSetId string) types.InstanceSummary {
+	return types.InstanceSummary{
+		Id: aws.String(id),
+		Attributes: map[string]string{
+			model.ClusterIdAttr:             clusterId,
+			model.ClusterSetIdAttr:          clusterSetId,
+			model.ServiceExportCreationAttr: strconv.FormatInt(test.SvcExportCreationTimestamp, 10),
+		},
+	}
+}
+
+func planned(svcName string, instId string) Instance {
+	clusterId := test.ClusterId1
+	if instId == "other-cluster" {
+		clusterId = test.ClusterId2
+	}
+	svcId := test.SvcId
+	if svcName != test.SvcName {
+		svcId = svcName + "-id"
+	}
+	return Instance{Service: svcName, ServiceId: svcId, Id: instId, ClusterId: clusterId}
+}
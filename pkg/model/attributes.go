@@ -0,0 +1,89 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Limits of the attributes of Cloud Map instances
+const (
+	// MaxCustomAttributes is the maximum number of attributes of an instance, excluding the AWS_ attributes
+	MaxCustomAttributes = 30
+
+	// MaxAttributeKeyLength is the maximum length of an attribute key
+	MaxAttributeKeyLength = 255
+
+	// MaxAttributeValueLength is the maximum length of an attribute value
+	MaxAttributeValueLength = 1024
+
+	// MaxAttributesLength is the maximum total length of the keys and values of the attributes of an instance
+	MaxAttributesLength = 5000
+
+	// Prefix of the attributes reserved by Cloud Map
+	reservedAttributePrefix = "AWS_"
+)
+
+var (
+	attributeKeyPattern   = regexp.MustCompile(`^[!-~]+$`)
+	attributeValuePattern = regexp.MustCompile(`^([!-~]([ \t!-~]*[!-~])?)?$`)
+
+	// Attributes set by the controller, which user-defined attributes must not override
+	controllerAttributes = map[string]struct{}{
+		EndpointFqdnAttr:          {},
+		EndpointPortNameAttr:      {},
+		EndpointProtocolAttr:      {},
+		EndpointReadyAttr:         {},
+		EndpointHostnameAttr:      {},
+		EndpointNodeNameAttr:      {},
+		ClusterIdAttr:             {},
+		ClusterSetIdAttr:          {},
+		ServicePortNameAttr:       {},
+		ServicePortAttr:           {},
+		ServiceTargetPortAttr:     {},
+		ServiceProtocolAttr:       {},
+		ServiceTypeAttr:           {},
+		ServiceExportCreationAttr: {},
+		K8sVersionAttr:            {},
+		SourceServiceAttr:         {},
+		ClusterWeightAttr:         {},
+		ClusterPriorityAttr:       {},
+	}
+)
+
+// ValidateCustomAttribute returns an error if a user-defined attribute is not a valid Cloud Map instance attribute,
+// or is reserved by Cloud Map or the controller.
+func ValidateCustomAttribute(key string, value string) error {
+	if len(key) > MaxAttributeKeyLength || !attributeKeyPattern.MatchString(key) {
+		return fmt.Errorf("attribute key %q must be 1 to %d printable ASCII characters without spaces", key, MaxAttributeKeyLength)
+	}
+	if len(value) > MaxAttributeValueLength || !attributeValuePattern.MatchString(value) {
+		return fmt.Errorf("value of attribute %s must be up to %d printable ASCII characters, without leading or trailing spaces", key, MaxAttributeValueLength)
+	}
+	if strings.HasPrefix(key, reservedAttributePrefix) {
+		return fmt.Errorf("attribute %s is reserved by Cloud Map", key)
+	}
+	if _, found := controllerAttributes[key]; found {
+		return fmt.Errorf("attribute %s is reserved by the controller", key)
+	}
+	return nil
+}
+
+// ValidateCloudMapAttributes returns an error if the attributes of an instance exceed the Cloud Map limits on their
+// number or total length.
+func ValidateCloudMapAttributes(attrs map[string]string) error {
+	custom, length := 0, 0
+	for key, value := range attrs {
+		if !strings.HasPrefix(key, reservedAttributePrefix) {
+			custom++
+		}
+		length += len(key) + len(value)
+	}
+	if custom > MaxCustomAttributes {
+		return fmt.Errorf("%d attributes exceed the limit of %d attributes per instance", custom, MaxCustomAttributes)
+	}
+	if length > MaxAttributesLength {
+		return fmt.Errorf("attributes of %d characters exceed the limit of %d characters per instance", length, MaxAttributesLength)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCustomAttribute(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		value   string
+		wantErr bool
+	}{
+		{name: "valid", key: "team", value: "payments"},
+		{name: "label_key", key: "app.kubernetes.io/name", value: "my app"},
+		{name: "empty_value", key: "team", value: ""},
+		{name: "empty_key", key: "", value: "payments", wantErr: true},
+		{name: "key_with_space", key: "my team", value: "payments", wantErr: true},
+		{name: "key_too_long", key: strings.Repeat("k", MaxAttributeKeyLength+1), value: "payments", wantErr: true},
+		{name: "value_with_trailing_space", key: "team", value: "payments ", wantErr: true},
+		{name: "value_too_long", key: "team", value: strings.Repeat("v", MaxAttributeValueLength+1), wantErr: true},
+		{name: "non_ascii_value", key: "team", value: "paiements€", wantErr: true},
+		{name: "reserved_by_cloud_map", key: "AWS_INSTANCE_PORT", value: "80", wantErr: true},
+		{name: "reserved_by_controller", key: ClusterIdAttr, value: "cluster", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCustomAttribute(tt.key, tt.value)
+			assert.Equal(t, tt.wantErr, err != nil, "error = %v", err)
+		})
+	}
+}
+
+func TestValidateCloudMapAttributes(t *testing.T) {
+	attrs := map[string]string{EndpointIpv4Attr: ipv4, EndpointPortAttr: "80"}
+	for i := 0; i < MaxCustomAttributes; i++ {
+		attrs["attr"+strconv.Itoa(i)] = "value"
+	}
+	// AWS_ attributes are not counted
+	assert.NoError(t, ValidateCloudMapAttributes(attrs))
+
+	attrs["one-too-many"] = "value"
+	assert.Error(t, ValidateCloudMapAttributes(attrs))
+
+	long := map[string]string{"a": strings.Repeat("v", MaxAttributeValueLength), "b": strings.Repeat("v", MaxAttributeValueLength),
+		"c": strings.Repeat("v", MaxAttributeValueLength), "d": strings.Repeat("v", MaxAttributeValueLength),
+		"e": strings.Repeat("v", MaxAttributeValueLength)}
+	assert.Error(t, ValidateCloudMapAttributes(long))
+}
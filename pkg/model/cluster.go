@@ -12,12 +12,20 @@ import (
 const (
 	ClusterIdPropertyName    = "cluster.clusterset.k8s.io"
 	ClusterSetIdPropertyName = "clusterset.k8s.io"
+
+	// ClusterWeightPropertyName is the ClusterProperty holding the default traffic weight of the services exported by the cluster.
+	ClusterWeightPropertyName = "weight.multicluster.k8s.aws"
+
+	// ClusterPriorityPropertyName is the ClusterProperty holding the default failover priority of the services exported by the cluster.
+	ClusterPriorityPropertyName = "priority.multicluster.k8s.aws"
 )
 
 // Non-exported type, accessible via read-only func
 type clusterProperties struct {
 	clusterId    string
 	clusterSetId string
+	weight       string
+	priority     string
 }
 
 func (r clusterProperties) ClusterId() string {
@@ -28,6 +36,16 @@ func (r clusterProperties) ClusterSetId() string {
 	return r.clusterSetId
 }
 
+// Weight returns the value of the cluster weight ClusterProperty, empty if it does not exist.
+func (r clusterProperties) Weight() string {
+	return r.weight
+}
+
+// Priority returns the value of the cluster priority ClusterProperty, empty if it does not exist.
+func (r clusterProperties) Priority() string {
+	return r.priority
+}
+
 func (r clusterProperties) IsValid() bool {
 	return r.clusterSetId != "" && r.clusterId != ""
 }
@@ -71,12 +89,17 @@ func (r *ClusterUtils) LoadClusterProperties(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	r.clusterProperties.weight, r.clusterProperties.priority = "", ""
 	for _, clusterProperty := range clusterPropertyList.Items {
 		switch clusterProperty.Name {
 		case ClusterIdPropertyName:
 			r.clusterProperties.clusterId = clusterProperty.Spec.Value
 		case ClusterSetIdPropertyName:
 			r.clusterProperties.clusterSetId = clusterProperty.Spec.Value
+		case ClusterWeightPropertyName:
+			r.clusterProperties.weight = clusterProperty.Spec.Value
+		case ClusterPriorityPropertyName:
+			r.clusterProperties.priority = clusterProperty.Spec.Value
 		}
 	}
 	if !r.clusterProperties.IsValid() {
@@ -50,6 +50,17 @@ func TestClusterUtils_GetClusterProperties(t *testing.T) {
 			want:    &clusterProperties{clusterId: clusterId, clusterSetId: clusterSetId},
 			wantErr: false,
 		},
+		{
+			name: "happy case with weight and priority",
+			fields: fields{
+				client: fake.NewClientBuilder().WithScheme(GetScheme()).WithObjects(ClusterIdForTest(clusterId), ClusterSetIdForTest(clusterSetId),
+					clusterPropertyForTest(ClusterWeightPropertyName, "50"), clusterPropertyForTest(ClusterPriorityPropertyName, "1")).Build(),
+				clusterProperties: clusterProperties{},
+			},
+			args:    args{ctx: context.TODO()},
+			want:    &clusterProperties{clusterId: clusterId, clusterSetId: clusterSetId, weight: "50", priority: "1"},
+			wantErr: false,
+		},
 		{
 			name: "error cluster properties not present",
 			fields: fields{
@@ -101,6 +112,17 @@ func ClusterSetIdForTest(clusterSetId string) *aboutv1alpha1.ClusterProperty {
 	}
 }
 
+func clusterPropertyForTest(name string, value string) *aboutv1alpha1.ClusterProperty {
+	return &aboutv1alpha1.ClusterProperty{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: aboutv1alpha1.ClusterPropertySpec{
+			Value: value,
+		},
+	}
+}
+
 func GetScheme() *runtime.Scheme {
 	scheme := runtime.NewScheme()
 	scheme.AddKnownTypes(aboutv1alpha1.GroupVersion, &aboutv1alpha1.ClusterProperty{}, &aboutv1alpha1.ClusterPropertyList{})
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	// DefaultClusterWeight is the traffic weight of the clusters without a configured weight.
+	DefaultClusterWeight = 100
+
+	// MaxClusterWeight is the maximum traffic weight of a cluster.
+	MaxClusterWeight = 1000
+
+	// DefaultClusterPriority is the failover priority of the clusters without a configured priority. Clusters with
+	// lower priority values are preferred.
+	DefaultClusterPriority = 0
+
+	// MaxClusterPriority is the maximum failover priority of a cluster.
+	MaxClusterPriority = 1000
+)
+
+// ParseClusterWeight parses a cluster traffic weight, an integer from 0 to MaxClusterWeight.
+func ParseClusterWeight(value string) (int, error) {
+	weight, err := strconv.Atoi(value)
+	if err != nil || weight < 0 || weight > MaxClusterWeight {
+		return 0, fmt.Errorf("weight %q must be an integer from 0 to %d", value, MaxClusterWeight)
+	}
+	return weight, nil
+}
+
+// ParseClusterPriority parses a cluster failover priority, an integer from 0 to MaxClusterPriority.
+func ParseClusterPriority(value string) (int, error) {
+	priority, err := strconv.Atoi(value)
+	if err != nil || priority < 0 || priority > MaxClusterPriority {
+		return 0, fmt.Errorf("priority %q must be an integer from 0 to %d", value, MaxClusterPriority)
+	}
+	return priority, nil
+}
+
+// ClusterWeight returns the traffic weight of the cluster exporting the endpoint, and whether the cluster configured
+// it. Invalid weights are ignored.
+func (e *Endpoint) ClusterWeight() (int, bool) {
+	if value, found := e.Attributes[ClusterWeightAttr]; found {
+		if weight, err := ParseClusterWeight(value); err == nil {
+			return weight, true
+		}
+	}
+	return DefaultClusterWeight, false
+}
+
+// ClusterPriority returns the failover priority of the cluster exporting the endpoint, and whether the cluster
+// configured it. Invalid priorities are ignored.
+func (e *Endpoint) ClusterPriority() (int, bool) {
+	if value, found := e.Attributes[ClusterPriorityAttr]; found {
+		if priority, err := ParseClusterPriority(value); err == nil {
+			return priority, true
+		}
+	}
+	return DefaultClusterPriority, false
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseClusterWeight(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "0", want: 0},
+		{value: "75", want: 75},
+		{value: "1000", want: MaxClusterWeight},
+		{value: "1001", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "half", wantErr: true},
+		{value: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseClusterWeight(tt.value)
+			assert.Equal(t, tt.wantErr, err != nil, "error = %v", err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseClusterPriority(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "0", want: 0},
+		{value: "10", want: 10},
+		{value: "1001", wantErr: true},
+		{value: "first", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseClusterPriority(tt.value)
+			assert.Equal(t, tt.wantErr, err != nil, "error = %v", err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestEndpoint_ClusterWeightAndPriority(t *testing.T) {
+	endpoint := &Endpoint{Attributes: map[string]string{}}
+	weight, explicit := endpoint.ClusterWeight()
+	assert.Equal(t, DefaultClusterWeight, weight)
+	assert.False(t, explicit)
+	priority, explicit := endpoint.ClusterPriority()
+	assert.Equal(t, DefaultClusterPriority, priority)
+	assert.False(t, explicit)
+
+	endpoint.Attributes[ClusterWeightAttr] = "25"
+	endpoint.Attributes[ClusterPriorityAttr] = "1"
+	weight, explicit = endpoint.ClusterWeight()
+	assert.Equal(t, 25, weight)
+	assert.True(t, explicit)
+	priority, explicit = endpoint.ClusterPriority()
+	assert.Equal(t, 1, priority)
+	assert.True(t, explicit)
+
+	endpoint.Attributes[ClusterWeightAttr] = "heavy"
+	endpoint.Attributes[ClusterPriorityAttr] = "-1"
+	weight, explicit = endpoint.ClusterWeight()
+	assert.Equal(t, DefaultClusterWeight, weight)
+	assert.False(t, explicit)
+	priority, explicit = endpoint.ClusterPriority()
+	assert.Equal(t, DefaultClusterPriority, priority)
+	assert.False(t, explicit)
+}
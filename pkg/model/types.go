@@ -1,6 +1,8 @@
 package model
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"reflect"
@@ -35,6 +37,15 @@ type Service struct {
 	Endpoints []*Endpoint
 }
 
+// CacheSnapshot holds the AWS Cloud Map resources cached at a point in time.
+type CacheSnapshot struct {
+	Namespaces map[string]*Namespace `json:"namespaces,omitempty"`
+	// Service IDs by namespace and service name
+	ServiceIds map[string]map[string]string `json:"serviceIds,omitempty"`
+	// Endpoints by namespace and service name
+	Endpoints map[string]map[string][]*Endpoint `json:"endpoints,omitempty"`
+}
+
 const (
 	HeadlessType     ServiceType = "Headless"
 	ClusterSetIPType ServiceType = "ClusterSetIP"
@@ -42,6 +53,9 @@ const (
 
 type ServiceType string
 
+// Maximum length of the ID of Cloud Map instances
+const maxInstanceIdLength = 64
+
 // Endpoint holds basic values and attributes for an endpoint.
 type Endpoint struct {
 	Id                             string
@@ -69,8 +83,10 @@ type Port struct {
 // Cloudmap Instances IP and Port is supposed to be AWS_INSTANCE_IPV4 and AWS_INSTANCE_PORT
 // Rest are custom attributes
 const (
-	EndpointIpv4Attr          = "AWS_INSTANCE_IPV4"
-	EndpointIpv6Attr          = "AWS_INSTANCE_IPV6"
+	EndpointIpv4Attr = "AWS_INSTANCE_IPV4"
+	EndpointIpv6Attr = "AWS_INSTANCE_IPV6"
+	// EndpointFqdnAttr is the hostname of endpoints of the FQDN address type, e.g. load balancer hostnames
+	EndpointFqdnAttr          = "ENDPOINT_FQDN"
 	EndpointPortAttr          = "AWS_INSTANCE_PORT"
 	EndpointPortNameAttr      = "ENDPOINT_PORT_NAME"
 	EndpointProtocolAttr      = "ENDPOINT_PROTOCOL"
@@ -86,6 +102,12 @@ const (
 	ServiceTypeAttr           = "SERVICE_TYPE"
 	ServiceExportCreationAttr = "SERVICE_EXPORT_CREATION_TIMESTAMP"
 	K8sVersionAttr            = "K8S_CONTROLLER"
+	// SourceServiceAttr is the namespace and name of the exported Service, set when it is exported under another name
+	SourceServiceAttr = "SOURCE_SERVICE"
+	// ClusterWeightAttr is the traffic weight of the exporting cluster, set when it is configured
+	ClusterWeightAttr = "CLUSTER_WEIGHT"
+	// ClusterPriorityAttr is the failover priority of the exporting cluster, set when it is configured
+	ClusterPriorityAttr = "CLUSTER_PRIORITY"
 )
 
 // NewEndpointFromInstance converts a Cloud Map HttpInstanceSummary to an endpoint.
@@ -123,6 +145,12 @@ func NewEndpointFromInstance(inst *types.HttpInstanceSummary) (*Endpoint, error)
 	if ipv4Exists && ipv6Exists {
 		fmt.Printf("WARNING: Found both address types in one Endpoint... IPv4: %s  IPv6: %s\n", ipv4, ipv6)
 	}
+	if !ipv4Exists && !ipv6Exists {
+		if fqdn, err := removeStringAttr(attributes, EndpointFqdnAttr); err == nil {
+			endpoint.IP = fqdn
+			endpoint.AddressType = discovery.AddressTypeFQDN
+		}
+	}
 
 	endpointPort, err := endpointPortFromAttr(attributes)
 	if err != nil {
@@ -252,6 +280,8 @@ func (e *Endpoint) GetCloudMapAttributes() map[string]string {
 		attrs[EndpointIpv4Attr] = e.IP
 	} else if e.AddressType == discovery.AddressTypeIPv6 {
 		attrs[EndpointIpv6Attr] = e.IP
+	} else if e.AddressType == discovery.AddressTypeFQDN {
+		attrs[EndpointFqdnAttr] = e.IP
 	}
 
 	attrs[ClusterIdAttr] = e.ClusterId
@@ -291,11 +321,18 @@ func (e *Endpoint) String() string {
 	return string(bytes)
 }
 
-// EndpointIdFromIPAddressAndPort converts an IP address to human-readable identifier.
+// EndpointIdFromIPAddressAndPort converts an IP address or hostname to human-readable identifier. Identifiers longer
+// than the Cloud Map limit, e.g. of long hostnames, are shortened with a hash of the address.
 func EndpointIdFromIPAddressAndPort(address string, port Port) string {
-	address = strings.ReplaceAll(address, ".", "_")
-	address = strings.ReplaceAll(address, ":", "_")
-	return fmt.Sprintf("%s-%s-%d", strings.ToLower(port.Protocol), address, port.Port)
+	escaped := strings.ReplaceAll(address, ".", "_")
+	escaped = strings.ReplaceAll(escaped, ":", "_")
+	id := fmt.Sprintf("%s-%s-%d", strings.ToLower(port.Protocol), escaped, port.Port)
+	if len(id) <= maxInstanceIdLength {
+		return id
+	}
+	hash := sha256.Sum256([]byte(address))
+	suffix := fmt.Sprintf("-%s-%d", hex.EncodeToString(hash[:])[:16], port.Port)
+	return id[:maxInstanceIdLength-len(suffix)] + suffix
 }
 
 // Gives string representation for ServiceType
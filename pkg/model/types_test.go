@@ -14,6 +14,7 @@ import (
 var instId = "my-instance"
 var ipv4 = "192.168.0.1"
 var ipv6 = "2001:0db8:0001:0000:0000:0ab9:C0A8:0102"
+var fqdn = "a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6-1234567890.elb.us-west-2.amazonaws.com"
 var clusterId = "test-mcs-clusterId"
 var clusterId2 = "test-mcs-clusterid-2"
 var clusterId3 = "test-mcs-clusterid-3"
@@ -122,6 +123,52 @@ func TestNewEndpointFromInstance(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "happy case fqdn",
+			inst: &types.HttpInstanceSummary{
+				InstanceId: &instId,
+				Attributes: map[string]string{
+					ClusterIdAttr:             clusterId,
+					ClusterSetIdAttr:          clusterSetId,
+					EndpointFqdnAttr:          fqdn,
+					EndpointPortAttr:          "80",
+					EndpointProtocolAttr:      "TCP",
+					EndpointPortNameAttr:      "http",
+					EndpointReadyAttr:         "true",
+					ServicePortNameAttr:       "http",
+					ServiceProtocolAttr:       "TCP",
+					ServicePortAttr:           "65535",
+					ServiceTargetPortAttr:     "80",
+					ServiceTypeAttr:           serviceType,
+					ServiceExportCreationAttr: strconv.FormatInt(svcExportCreationTimestamp, 10),
+					"custom-attr":             "custom-val",
+				},
+			},
+			want: &Endpoint{
+				Id:          instId,
+				IP:          fqdn,
+				AddressType: discovery.AddressTypeFQDN,
+				EndpointPort: Port{
+					Name:     "http",
+					Port:     80,
+					Protocol: "TCP",
+				},
+				ServicePort: Port{
+					Name:       "http",
+					Port:       65535,
+					TargetPort: "80",
+					Protocol:   "TCP",
+				},
+				ClusterId:                      clusterId,
+				ClusterSetId:                   clusterSetId,
+				ServiceType:                    ServiceType(serviceType),
+				ServiceExportCreationTimestamp: svcExportCreationTimestamp,
+				Ready:                          true,
+				Attributes: map[string]string{
+					"custom-attr": "custom-val",
+				},
+			},
+		},
 		{
 			name: "ipv4 and ipv6 defaults to ipv4",
 			inst: &types.HttpInstanceSummary{
@@ -381,6 +428,50 @@ func TestEndpoint_GetAttributes(t *testing.T) {
 				"custom-attr":             "custom-val",
 			},
 		},
+		{
+			name: "happy case fqdn",
+			endpoint: Endpoint{
+				IP:          fqdn,
+				AddressType: discovery.AddressTypeFQDN,
+				EndpointPort: Port{
+					Name:     "http",
+					Port:     80,
+					Protocol: "TCP",
+				},
+				ServicePort: Port{
+					Name:       "http",
+					Port:       30,
+					TargetPort: "80",
+					Protocol:   "TCP",
+				},
+				Ready:                          true,
+				ClusterId:                      clusterId,
+				ClusterSetId:                   clusterSetId,
+				ServiceType:                    ServiceType(serviceType),
+				ServiceExportCreationTimestamp: svcExportCreationTimestamp,
+				Attributes: map[string]string{
+					"custom-attr": "custom-val",
+				},
+			},
+			want: map[string]string{
+				ClusterIdAttr:             clusterId,
+				ClusterSetIdAttr:          clusterSetId,
+				EndpointFqdnAttr:          fqdn,
+				EndpointPortAttr:          "80",
+				EndpointProtocolAttr:      "TCP",
+				EndpointPortNameAttr:      "http",
+				EndpointReadyAttr:         "true",
+				EndpointHostnameAttr:      "",
+				EndpointNodeNameAttr:      "",
+				ServicePortNameAttr:       "http",
+				ServiceProtocolAttr:       "TCP",
+				ServicePortAttr:           "30",
+				ServiceTargetPortAttr:     "80",
+				ServiceTypeAttr:           serviceType,
+				ServiceExportCreationAttr: strconv.FormatInt(svcExportCreationTimestamp, 10),
+				"custom-attr":             "custom-val",
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -418,6 +509,26 @@ func TestEndpointIdFromIPAddressAndPort(t *testing.T) {
 			},
 			want: "tcp-2001_0db8_0001_0000_0000_0ab9_C0A8_0102-80",
 		},
+		{
+			name:    "short hostname",
+			address: "example.com",
+			port: Port{
+				Name:     "http",
+				Port:     80,
+				Protocol: "TCP",
+			},
+			want: "tcp-example_com-80",
+		},
+		{
+			name:    "long hostname is shortened",
+			address: fqdn,
+			port: Port{
+				Name:     "http",
+				Port:     80,
+				Protocol: "TCP",
+			},
+			want: "tcp-a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6-1234567-50320312fbbe4b13-80",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
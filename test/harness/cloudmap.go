@@ -0,0 +1,342 @@
+package harness
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/cloudmap"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/servicediscovery/types"
+)
+
+// CloudMap is an in-memory AWS Cloud Map, shared by the clusters of a Harness. Its operations succeed as soon as they
+// are submitted, and its errors carry the error codes of the Cloud Map API.
+type CloudMap struct {
+	mu         sync.Mutex
+	namespaces map[string]*memoryNamespace
+	operations map[string]*types.Operation
+	lastId     int
+}
+
+type memoryNamespace struct {
+	namespace model.Namespace
+	services  map[string]*memoryService
+}
+
+type memoryService struct {
+	id        string
+	name      string
+	instances map[string]map[string]string
+}
+
+var _ cloudmap.ServiceDiscoveryApi = &CloudMap{}
+
+// NewCloudMap returns an empty in-memory Cloud Map.
+func NewCloudMap() *CloudMap {
+	return &CloudMap{
+		namespaces: make(map[string]*memoryNamespace),
+		operations: make(map[string]*types.Operation),
+	}
+}
+
+// Instances returns the attributes of the instances of a service indexed by instance ID, nil if the service does not
+// exist.
+func (c *CloudMap) Instances(nsName string, svcName string) map[string]map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	svc := c.service(nsName, svcName)
+	if svc == nil {
+		return nil
+	}
+	instances := make(map[string]map[string]string, len(svc.instances))
+	for id, attrs := range svc.instances {
+		instances[id] = copyAttributes(attrs)
+	}
+	return instances
+}
+
+func (c *CloudMap) GetNamespaceMap(_ context.Context) (map[string]*model.Namespace, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	namespaces := make(map[string]*model.Namespace, len(c.namespaces))
+	for name, ns := range c.namespaces {
+		namespace := ns.namespace
+		namespaces[name] = &namespace
+	}
+	return namespaces, nil
+}
+
+func (c *CloudMap) GetServiceIdMap(_ context.Context, nsId string) (map[string]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	serviceIds := make(map[string]string)
+	if ns := c.namespaceById(nsId); ns != nil {
+		for name, svc := range ns.services {
+			serviceIds[name] = svc.id
+		}
+	}
+	return serviceIds, nil
+}
+
+func (c *CloudMap) DiscoverInstances(_ context.Context, nsName string, svcName string, queryParameters map[string]string) ([]types.HttpInstanceSummary, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.namespaces[nsName] == nil {
+		return nil, &types.NamespaceNotFound{Message: aws.String("namespace " + nsName + " not found")}
+	}
+	svc := c.service(nsName, svcName)
+	if svc == nil {
+		return nil, &types.ServiceNotFound{Message: aws.String("service " + svcName + " not found")}
+	}
+
+	insts := make([]types.HttpInstanceSummary, 0)
+	for _, id := range sortedIds(svc.instances) {
+		attrs := svc.instances[id]
+		if !matchesQuery(attrs, queryParameters) {
+			continue
+		}
+		insts = append(insts, types.HttpInstanceSummary{
+			InstanceId:    aws.String(id),
+			NamespaceName: aws.String(nsName),
+			ServiceName:   aws.String(svcName),
+			HealthStatus:  types.HealthStatusHealthy,
+			Attributes:    copyAttributes(attrs),
+		})
+		if len(insts) == cloudmap.DiscoverInstancesMaxResults {
+			break
+		}
+	}
+	return insts, nil
+}
+
+func (c *CloudMap) ListInstances(_ context.Context, svcId string) ([]types.InstanceSummary, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	svc := c.serviceById(svcId)
+	if svc == nil {
+		return nil, &types.ServiceNotFound{Message: aws.String("service " + svcId + " not found")}
+	}
+	insts := make([]types.InstanceSummary, 0, len(svc.instances))
+	for _, id := range sortedIds(svc.instances) {
+		insts = append(insts, types.InstanceSummary{Id: aws.String(id), Attributes: copyAttributes(svc.instances[id])})
+	}
+	return insts, nil
+}
+
+func (c *CloudMap) GetOperation(_ context.Context, opId string) (*types.Operation, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	op, found := c.operations[opId]
+	if !found {
+		return nil, &types.OperationNotFound{Message: aws.String("operation " + opId + " not found")}
+	}
+	operation := *op
+	return &operation, nil
+}
+
+func (c *CloudMap) ListOperations(_ context.Context, filters []types.OperationFilter) (map[string]types.OperationStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	statuses := make(map[string]types.OperationStatus)
+	for id, op := range c.operations {
+		if matchesFilters(op, filters) {
+			statuses[id] = op.Status
+		}
+	}
+	return statuses, nil
+}
+
+func (c *CloudMap) CreateHttpNamespace(_ context.Context, nsName string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.namespaces[nsName] != nil {
+		return "", &types.NamespaceAlreadyExists{Message: aws.String("namespace " + nsName + " already exists")}
+	}
+	nsId := c.nextId("ns")
+	c.namespaces[nsName] = &memoryNamespace{
+		namespace: model.Namespace{Id: nsId, Name: nsName, Type: model.HttpNamespaceType},
+		services:  make(map[string]*memoryService),
+	}
+	return c.addOperation(types.OperationTypeCreateNamespace, map[string]string{
+		string(types.OperationTargetTypeNamespace): nsId,
+	}), nil
+}
+
+func (c *CloudMap) CreateService(_ context.Context, namespace model.Namespace, svcName string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ns := c.namespaceById(namespace.Id)
+	if ns == nil {
+		return "", &types.NamespaceNotFound{Message: aws.String("namespace " + namespace.Id + " not found")}
+	}
+	if svc, found := ns.services[svcName]; found {
+		return "", &types.ServiceAlreadyExists{Message: aws.String("service " + svcName + " already exists"), ServiceId: aws.String(svc.id)}
+	}
+	svc := &memoryService{id: c.nextId("srv"), name: svcName, instances: make(map[string]map[string]string)}
+	ns.services[svcName] = svc
+	return svc.id, nil
+}
+
+func (c *CloudMap) RegisterInstance(_ context.Context, svcId string, instId string, instAttrs map[string]string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	svc := c.serviceById(svcId)
+	if svc == nil {
+		return "", &types.ServiceNotFound{Message: aws.String("service " + svcId + " not found")}
+	}
+	svc.instances[instId] = copyAttributes(instAttrs)
+	return c.addOperation(types.OperationTypeRegisterInstance, map[string]string{
+		string(types.OperationTargetTypeService):  svcId,
+		string(types.OperationTargetTypeInstance): instId,
+	}), nil
+}
+
+func (c *CloudMap) DeregisterInstance(_ context.Context, svcId string, instId string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	svc := c.serviceById(svcId)
+	if svc == nil {
+		return "", &types.ServiceNotFound{Message: aws.String("service " + svcId + " not found")}
+	}
+	if _, found := svc.instances[instId]; !found {
+		return "", &types.InstanceNotFound{Message: aws.String("instance " + instId + " not found")}
+	}
+	delete(svc.instances, instId)
+	return c.addOperation(types.OperationTypeDeregisterInstance, map[string]string{
+		string(types.OperationTargetTypeService):  svcId,
+		string(types.OperationTargetTypeInstance): instId,
+	}), nil
+}
+
+func (c *CloudMap) nextId(prefix string) string {
+	c.lastId++
+	return fmt.Sprintf("%s-%d", prefix, c.lastId)
+}
+
+// addOperation records a successful operation, and returns its ID.
+func (c *CloudMap) addOperation(opType types.OperationType, targets map[string]string) string {
+	opId := c.nextId("op")
+	now := time.Now()
+	c.operations[opId] = &types.Operation{
+		Id:         aws.String(opId),
+		Type:       opType,
+		Status:     types.OperationStatusSuccess,
+		Targets:    targets,
+		CreateDate: &now,
+		UpdateDate: &now,
+	}
+	return opId
+}
+
+func (c *CloudMap) service(nsName string, svcName string) *memoryService {
+	if ns := c.namespaces[nsName]; ns != nil {
+		return ns.services[svcName]
+	}
+	return nil
+}
+
+func (c *CloudMap) namespaceById(nsId string) *memoryNamespace {
+	for _, ns := range c.namespaces {
+		if ns.namespace.Id == nsId {
+			return ns
+		}
+	}
+	return nil
+}
+
+func (c *CloudMap) serviceById(svcId string) *memoryService {
+	for _, ns := range c.namespaces {
+		for _, svc := range ns.services {
+			if svc.id == svcId {
+				return svc
+			}
+		}
+	}
+	return nil
+}
+
+func matchesQuery(attrs map[string]string, queryParameters map[string]string) bool {
+	for key, value := range queryParameters {
+		if attrs[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesFilters evaluates the ListOperations filters used by the operation poller against an operation.
+func matchesFilters(op *types.Operation, filters []types.OperationFilter) bool {
+	for _, filter := range filters {
+		switch filter.Name {
+		case types.OperationFilterNameStatus:
+			if !contains(filter.Values, string(op.Status)) {
+				return false
+			}
+		case types.OperationFilterNameType:
+			if !contains(filter.Values, string(op.Type)) {
+				return false
+			}
+		case types.OperationFilterNameServiceId:
+			if !contains(filter.Values, op.Targets[string(types.OperationTargetTypeService)]) {
+				return false
+			}
+		case types.OperationFilterNameNamespaceId:
+			if !contains(filter.Values, op.Targets[string(types.OperationTargetTypeNamespace)]) {
+				return false
+			}
+		case types.OperationFilterNameUpdateDate:
+			if len(filter.Values) != 2 {
+				return false
+			}
+			start, startErr := strconv.ParseInt(filter.Values[0], 10, 64)
+			end, endErr := strconv.ParseInt(filter.Values[1], 10, 64)
+			updated := op.UpdateDate.UnixMilli()
+			if startErr != nil || endErr != nil || updated < start || updated > end {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedIds(instances map[string]map[string]string) []string {
+	ids := make([]string, 0, len(instances))
+	for id := range instances {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func copyAttributes(attrs map[string]string) map[string]string {
+	attributes := make(map[string]string, len(attrs))
+	for key, value := range attrs {
+		attributes[key] = value
+	}
+	return attributes
+}
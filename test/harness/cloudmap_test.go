@@ -0,0 +1,152 @@
+package harness
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/cloudmap"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/common"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/test"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/servicediscovery/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloudMap_ServiceDiscoveryClient(t *testing.T) {
+	cm := NewCloudMap()
+	sdc := sdClientForTest(cm)
+	ctx := context.Background()
+
+	require.NoError(t, sdc.CreateService(ctx, test.HttpNsName, test.SvcName))
+	require.NoError(t, sdc.RegisterEndpoints(ctx, test.HttpNsName, test.SvcName,
+		[]*model.Endpoint{test.GetTestEndpoint1(), test.GetTestEndpoint2()}))
+	assert.Len(t, cm.Instances(test.HttpNsName, test.SvcName), 2)
+
+	svc, err := sdc.GetService(ctx, test.HttpNsName, test.SvcName)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []*model.Endpoint{test.GetTestEndpoint1(), test.GetTestEndpoint2()}, svc.Endpoints)
+
+	require.NoError(t, sdc.DeleteEndpoints(ctx, test.HttpNsName, test.SvcName, []*model.Endpoint{test.GetTestEndpoint1()}))
+	assert.Len(t, cm.Instances(test.HttpNsName, test.SvcName), 1)
+	assert.Contains(t, cm.Instances(test.HttpNsName, test.SvcName), test.EndptId2)
+	assert.Nil(t, cm.Instances(test.HttpNsName, "other"))
+}
+
+func TestCloudMap_Errors(t *testing.T) {
+	cm := NewCloudMap()
+	ctx := context.Background()
+
+	_, err := cm.DiscoverInstances(ctx, test.HttpNsName, test.SvcName, nil)
+	assert.True(t, common.IsNotFound(err))
+
+	opId, err := cm.CreateHttpNamespace(ctx, test.HttpNsName)
+	require.NoError(t, err)
+	op, err := cm.GetOperation(ctx, opId)
+	require.NoError(t, err)
+	assert.Equal(t, types.OperationStatusSuccess, op.Status)
+
+	_, err = cm.CreateHttpNamespace(ctx, test.HttpNsName)
+	assert.Equal(t, common.ErrorClassAlreadyExists, common.Classify(err))
+
+	namespaces, err := cm.GetNamespaceMap(ctx)
+	require.NoError(t, err)
+	ns := namespaces[test.HttpNsName]
+	svcId, err := cm.CreateService(ctx, *ns, test.SvcName)
+	require.NoError(t, err)
+	_, err = cm.CreateService(ctx, *ns, test.SvcName)
+	assert.Equal(t, common.ErrorClassAlreadyExists, common.Classify(err))
+	var exists *types.ServiceAlreadyExists
+	assert.ErrorAs(t, err, &exists)
+	assert.Equal(t, svcId, aws.ToString(exists.ServiceId))
+
+	_, err = cm.DiscoverInstances(ctx, test.HttpNsName, "other", nil)
+	assert.True(t, common.IsNotFound(err))
+	_, err = cm.ListInstances(ctx, "other")
+	assert.True(t, common.IsNotFound(err))
+	_, err = cm.RegisterInstance(ctx, "other", test.EndptId1, nil)
+	assert.True(t, common.IsNotFound(err))
+	_, err = cm.DeregisterInstance(ctx, svcId, test.EndptId1)
+	assert.True(t, common.IsNotFound(err))
+	_, err = cm.GetOperation(ctx, "other")
+	assert.True(t, common.IsNotFound(err))
+}
+
+func TestCloudMap_DiscoverInstances(t *testing.T) {
+	cm := NewCloudMap()
+	ctx := context.Background()
+	svcId := serviceForTest(t, cm)
+
+	_, err := cm.RegisterInstance(ctx, svcId, test.EndptId1, map[string]string{model.ClusterIdAttr: test.ClusterId1})
+	require.NoError(t, err)
+	_, err = cm.RegisterInstance(ctx, svcId, test.EndptId2, map[string]string{model.ClusterIdAttr: test.ClusterId2})
+	require.NoError(t, err)
+
+	insts, err := cm.DiscoverInstances(ctx, test.HttpNsName, test.SvcName, map[string]string{model.ClusterIdAttr: test.ClusterId2})
+	require.NoError(t, err)
+	require.Len(t, insts, 1)
+	assert.Equal(t, test.EndptId2, aws.ToString(insts[0].InstanceId))
+	assert.Equal(t, test.ClusterId2, insts[0].Attributes[model.ClusterIdAttr])
+
+	summaries, err := cm.ListInstances(ctx, svcId)
+	require.NoError(t, err)
+	assert.Len(t, summaries, 2)
+	assert.Equal(t, test.EndptId1, aws.ToString(summaries[0].Id))
+}
+
+func TestCloudMap_ListOperations(t *testing.T) {
+	cm := NewCloudMap()
+	ctx := context.Background()
+	svcId := serviceForTest(t, cm)
+	start := time.Now().Add(-time.Minute).UnixMilli()
+
+	registerOpId, err := cm.RegisterInstance(ctx, svcId, test.EndptId1, nil)
+	require.NoError(t, err)
+	deregisterOpId, err := cm.DeregisterInstance(ctx, svcId, test.EndptId1)
+	require.NoError(t, err)
+
+	ops, err := cm.ListOperations(ctx, []types.OperationFilter{
+		{Name: types.OperationFilterNameServiceId, Values: []string{svcId}},
+		{Name: types.OperationFilterNameStatus, Values: []string{string(types.OperationStatusSuccess), string(types.OperationStatusFail)}},
+		{Name: types.OperationFilterNameUpdateDate, Values: []string{strconv.FormatInt(start, 10), strconv.FormatInt(time.Now().UnixMilli(), 10)}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]types.OperationStatus{
+		registerOpId:   types.OperationStatusSuccess,
+		deregisterOpId: types.OperationStatusSuccess,
+	}, ops)
+
+	ops, err = cm.ListOperations(ctx, []types.OperationFilter{
+		{Name: types.OperationFilterNameType, Values: []string{string(types.OperationTypeDeregisterInstance)}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]types.OperationStatus{deregisterOpId: types.OperationStatusSuccess}, ops)
+
+	ops, err = cm.ListOperations(ctx, []types.OperationFilter{
+		{Name: types.OperationFilterNameUpdateDate, Values: []string{strconv.FormatInt(start, 10), strconv.FormatInt(start+1, 10)}},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, ops)
+}
+
+func sdClientForTest(cm *CloudMap) cloudmap.ServiceDiscoveryClient {
+	pollerConfig := cloudmap.DefaultOperationPollerConfig()
+	pollerConfig.PollInterval = 10 * time.Millisecond
+	pollerConfig.MaxPollInterval = 10 * time.Millisecond
+	return cloudmap.NewServiceDiscoveryClientWithApi(cm, cloudmap.DefaultSdCacheConfig(), pollerConfig,
+		cloudmap.NewDefaultNamespaceMapper(), model.NewClusterUtilsWithValues(test.ClusterId1, test.ClusterSet))
+}
+
+func serviceForTest(t *testing.T, cm *CloudMap) string {
+	ctx := context.Background()
+	_, err := cm.CreateHttpNamespace(ctx, test.HttpNsName)
+	require.NoError(t, err)
+	namespaces, err := cm.GetNamespaceMap(ctx)
+	require.NoError(t, err)
+	svcId, err := cm.CreateService(ctx, *namespaces[test.HttpNsName], test.SvcName)
+	require.NoError(t, err)
+	return svcId
+}
@@ -0,0 +1,87 @@
+package harness
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/integration/shared/scenarios"
+	multiclusterv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/multicluster/v1alpha1"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CreateNamespace creates a namespace.
+func (c *Cluster) CreateNamespace(t *testing.T, name string) {
+	t.Helper()
+	c.create(t, &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}})
+}
+
+// CreateService creates a Service with the service type and ports of an export, and the EndpointSlice of its ready
+// endpoints at the export addresses, which the EndpointSlice controller creates in a real cluster.
+func (c *Cluster) CreateService(t *testing.T, namespace string, name string, export scenarios.Export) {
+	t.Helper()
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+	}
+	if export.ServiceType == model.HeadlessType {
+		svc.Spec.ClusterIP = v1.ClusterIPNone
+	}
+	slice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name + "-harness",
+			Labels:    map[string]string{discovery.LabelServiceName: name},
+		},
+		AddressType: discovery.AddressType(export.AddressType),
+	}
+	for _, port := range export.Ports {
+		svc.Spec.Ports = append(svc.Spec.Ports, v1.ServicePort{
+			Name:       port.Name,
+			Port:       port.Port,
+			TargetPort: intstr.FromInt(int(port.TargetPort)),
+			Protocol:   v1.Protocol(port.Protocol),
+		})
+		protocol := v1.Protocol(port.Protocol)
+		slice.Ports = append(slice.Ports, discovery.EndpointPort{
+			Name:     aws.String(port.Name),
+			Port:     aws.Int32(port.TargetPort),
+			Protocol: &protocol,
+		})
+	}
+	for _, address := range export.Addresses {
+		slice.Endpoints = append(slice.Endpoints, discovery.Endpoint{
+			Addresses:  []string{address},
+			Conditions: discovery.EndpointConditions{Ready: aws.Bool(true)},
+		})
+	}
+	c.create(t, svc)
+	c.create(t, slice)
+}
+
+// CreateServiceExport exports a Service.
+func (c *Cluster) CreateServiceExport(t *testing.T, namespace string, name string) {
+	t.Helper()
+	c.create(t, &multiclusterv1alpha1.ServiceExport{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}})
+}
+
+// DeleteServiceExport stops exporting a Service. The ServiceExport is gone once the controller deregistered its
+// endpoints and removed its finalizer.
+func (c *Cluster) DeleteServiceExport(t *testing.T, namespace string, name string) {
+	t.Helper()
+	svcExport := &multiclusterv1alpha1.ServiceExport{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	if err := c.Client.Delete(context.Background(), svcExport); err != nil {
+		t.Fatalf("failed to delete ServiceExport %s/%s of cluster %s: %v", namespace, name, c.ClusterId, err)
+	}
+}
+
+func (c *Cluster) create(t *testing.T, obj client.Object) {
+	t.Helper()
+	if err := c.Client.Create(context.Background(), obj); err != nil {
+		t.Fatalf("failed to create %T %s of cluster %s: %v", obj, client.ObjectKeyFromObject(obj), c.ClusterId, err)
+	}
+}
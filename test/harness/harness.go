@@ -0,0 +1,307 @@
+// Package harness runs the controllers of several clusters in-process, each against its own envtest API server, on
+// top of one in-memory Cloud Map, to test the export and import of services end-to-end without AWS or real clusters.
+package harness
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/integration/shared/scenarios"
+	aboutv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/about/v1alpha1"
+	multiclusterv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/multicluster/v1alpha1"
+	policyv1alpha1 "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/apis/policy/v1alpha1"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/cloudmap"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/common"
+	controllers "github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/controllers/multicluster"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+const (
+	// defaultPollInterval is the time between two checks of a scenario.
+	defaultPollInterval = 200 * time.Millisecond
+	// defaultPollTimeout is the time after which a scenario still not matching has failed.
+	defaultPollTimeout = 30 * time.Second
+	// cacheTTL is the TTL of the Cloud Map caches of the controllers and of the scenario checks.
+	cacheTTL = 500 * time.Millisecond
+)
+
+var scheme = k8sruntime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(multiclusterv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(aboutv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(policyv1alpha1.AddToScheme(scheme))
+}
+
+// Config holds the clusters of a Harness.
+type Config struct {
+	// ClusterSetId is the clusterset of all clusters.
+	ClusterSetId string
+	// ClusterIds are the IDs of the clusters, one controller manager and API server each.
+	ClusterIds []string
+	// ImportMode is the import mode of the controllers, AllClusters if not set.
+	ImportMode controllers.ImportMode
+	// PollInterval is the time between two checks of a scenario, 200ms if not set.
+	PollInterval time.Duration
+	// PollTimeout is the time after which a scenario still not matching has failed, 30s if not set.
+	PollTimeout time.Duration
+}
+
+// Harness is a clusterset of in-process clusters sharing an in-memory Cloud Map.
+//
+// The API servers run without the kube-controller-manager: the harness creates the EndpointSlices of the exported
+// Services itself, and nothing garbage collects the resources owned by deleted ones.
+type Harness struct {
+	// CloudMap is the Cloud Map shared by the clusters.
+	CloudMap *CloudMap
+
+	config   Config
+	clusters map[string]*Cluster
+	sdClient cloudmap.ServiceDiscoveryClient
+}
+
+// Cluster is a cluster of a Harness.
+type Cluster struct {
+	// ClusterId is the ID of the cluster in its ClusterProperty.
+	ClusterId string
+	// Client reads and writes the resources of the cluster directly through its API server.
+	Client client.Client
+}
+
+// Start starts the clusters of the config, and stops them when the test ends. It skips the test when the envtest
+// binaries are missing, i.e. KUBEBUILDER_ASSETS is not set.
+func Start(t *testing.T, config Config) *Harness {
+	t.Helper()
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set, skipping the multi-cluster tests")
+	}
+	if config.ImportMode == "" {
+		config.ImportMode = controllers.AllClustersImportMode
+	}
+	if config.PollInterval == 0 {
+		config.PollInterval = defaultPollInterval
+	}
+	if config.PollTimeout == 0 {
+		config.PollTimeout = defaultPollTimeout
+	}
+
+	h := &Harness{
+		CloudMap: NewCloudMap(),
+		config:   config,
+		clusters: make(map[string]*Cluster, len(config.ClusterIds)),
+	}
+	// the cluster ID is only used to register endpoints, which the scenario checks never do
+	h.sdClient = h.newServiceDiscoveryClient(model.NewClusterUtilsWithValues("harness", config.ClusterSetId))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var managers sync.WaitGroup
+	var envs []*envtest.Environment
+	t.Cleanup(func() {
+		cancel()
+		managers.Wait()
+		for _, env := range envs {
+			if err := env.Stop(); err != nil {
+				t.Errorf("failed to stop the API server: %v", err)
+			}
+		}
+	})
+
+	for _, clusterId := range config.ClusterIds {
+		env := &envtest.Environment{
+			CRDDirectoryPaths:     []string{crdDirectory()},
+			ErrorIfCRDPathMissing: true,
+		}
+		restConfig, err := env.Start()
+		if err != nil {
+			t.Fatalf("failed to start the API server of cluster %s: %v", clusterId, err)
+		}
+		envs = append(envs, env)
+
+		mgr, err := h.newManager(ctx, restConfig, clusterId)
+		if err != nil {
+			t.Fatalf("failed to set up the controllers of cluster %s: %v", clusterId, err)
+		}
+		managers.Add(1)
+		go func(clusterId string) {
+			defer managers.Done()
+			if err := mgr.Start(ctx); err != nil {
+				t.Errorf("controllers of cluster %s failed: %v", clusterId, err)
+			}
+		}(clusterId)
+	}
+	return h
+}
+
+// Cluster returns the cluster with a given ID, and fails the test if there is none.
+func (h *Harness) Cluster(t *testing.T, clusterId string) *Cluster {
+	t.Helper()
+	cluster, found := h.clusters[clusterId]
+	if !found {
+		t.Fatalf("unknown cluster %s", clusterId)
+	}
+	return cluster
+}
+
+// CreateNamespace creates a namespace in every cluster. The namespaces are never deleted, as the API servers have no
+// namespace controller, so that every test should use its own.
+func (h *Harness) CreateNamespace(t *testing.T, name string) {
+	t.Helper()
+	for _, clusterId := range h.config.ClusterIds {
+		h.clusters[clusterId].CreateNamespace(t, name)
+	}
+}
+
+// Export creates the Services, EndpointSlices and ServiceExports of the exports of a scenario in their clusters.
+func (h *Harness) Export(t *testing.T, s *scenarios.Scenario) {
+	t.Helper()
+	for _, export := range s.Exports {
+		cluster := h.Cluster(t, export.ClusterId)
+		cluster.CreateService(t, s.Namespace, s.Service, export)
+		cluster.CreateServiceExport(t, s.Namespace, s.Service)
+	}
+}
+
+// Unexport deletes the ServiceExports of the exports of a scenario in their clusters.
+func (h *Harness) Unexport(t *testing.T, s *scenarios.Scenario) {
+	t.Helper()
+	for _, export := range s.Exports {
+		h.Cluster(t, export.ClusterId).DeleteServiceExport(t, s.Namespace, s.Service)
+	}
+}
+
+// Assert waits for the clusterset to match a scenario, and fails the test if it does not before the poll timeout.
+// The clusters of the scenario are found by their cluster IDs, their contexts are ignored.
+func (h *Harness) Assert(t *testing.T, s *scenarios.Scenario) {
+	t.Helper()
+	runner := scenarios.NewRunner(scenarios.RunnerConfig{
+		CloudMap:     h.cloudMapClient,
+		Cluster:      h.clusterClient,
+		PollInterval: h.config.PollInterval,
+		PollTimeout:  h.config.PollTimeout,
+	})
+	if err := runner.Run(context.Background(), h.withClusterContexts(s)); err != nil {
+		t.Fatalf("scenario %s failed: %v", s.Name, err)
+	}
+}
+
+// newManager creates the controller manager of a cluster, with its ClusterProperties and the controllers set up as
+// in the controller binary.
+func (h *Harness) newManager(ctx context.Context, restConfig *rest.Config, clusterId string) (ctrl.Manager, error) {
+	k8sClient, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range map[string]string{
+		model.ClusterIdPropertyName:    clusterId,
+		model.ClusterSetIdPropertyName: h.config.ClusterSetId,
+	} {
+		property := &aboutv1alpha1.ClusterProperty{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       aboutv1alpha1.ClusterPropertySpec{Value: value},
+		}
+		if err = k8sClient.Create(ctx, property); err != nil {
+			return nil, fmt.Errorf("failed to create ClusterProperty %s: %w", name, err)
+		}
+	}
+	h.clusters[clusterId] = &Cluster{ClusterId: clusterId, Client: k8sClient}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
+		Scheme:             scheme,
+		MetricsBindAddress: "0",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	clusterUtils := model.NewClusterUtils(mgr.GetClient())
+	sdClient := h.newServiceDiscoveryClient(clusterUtils)
+	if err = (&controllers.ServiceExportReconciler{
+		Client:        mgr.GetClient(),
+		Log:           common.NewLogger("controllers", "ServiceExportReconciler", clusterId),
+		Scheme:        mgr.GetScheme(),
+		CloudMap:      sdClient,
+		ClusterUtils:  clusterUtils,
+		Recorder:      controllers.NewDeduplicatingEventRecorder(mgr.GetEventRecorderFor("ServiceExportReconciler"), controllers.DefaultEventDeduplicationTTL),
+		InstanceQuota: controllers.DefaultInstanceQuota,
+	}).SetupWithManager(mgr); err != nil {
+		return nil, err
+	}
+	if err = (&controllers.CloudMapReconciler{
+		Client:       mgr.GetClient(),
+		Cloudmap:     sdClient,
+		Log:          common.NewLogger("controllers", "CloudmapReconciler", clusterId),
+		ClusterUtils: clusterUtils,
+		Recorder:     controllers.NewDeduplicatingEventRecorder(mgr.GetEventRecorderFor("CloudmapReconciler"), controllers.DefaultEventDeduplicationTTL),
+		ImportMode:   h.config.ImportMode,
+	}).SetupWithManager(mgr); err != nil {
+		return nil, err
+	}
+	return mgr, nil
+}
+
+// newServiceDiscoveryClient returns a client of the shared Cloud Map, with short-lived caches and a fast operation
+// poller, since the in-memory operations complete immediately.
+func (h *Harness) newServiceDiscoveryClient(clusterUtils model.ClusterUtils) cloudmap.ServiceDiscoveryClient {
+	pollerConfig := cloudmap.DefaultOperationPollerConfig()
+	pollerConfig.PollInterval = 50 * time.Millisecond
+	pollerConfig.MaxPollInterval = 200 * time.Millisecond
+	return cloudmap.NewServiceDiscoveryClientWithApi(h.CloudMap,
+		&cloudmap.SdCacheConfig{
+			NsTTL:    cacheTTL,
+			SvcTTL:   cacheTTL,
+			EndptTTL: cacheTTL,
+		}, pollerConfig, cloudmap.NewDefaultNamespaceMapper(), clusterUtils)
+}
+
+func (h *Harness) cloudMapClient(clusterSetId string) (cloudmap.ServiceDiscoveryClient, error) {
+	if clusterSetId != h.config.ClusterSetId {
+		return nil, fmt.Errorf("unknown clusterset %s", clusterSetId)
+	}
+	return h.sdClient, nil
+}
+
+func (h *Harness) clusterClient(clusterId string) (client.Client, error) {
+	cluster, found := h.clusters[clusterId]
+	if !found {
+		return nil, fmt.Errorf("unknown cluster %s", clusterId)
+	}
+	return cluster.Client, nil
+}
+
+// withClusterContexts returns a copy of a scenario whose clusters have their cluster IDs as contexts, which the
+// harness resolves to their clients.
+func (h *Harness) withClusterContexts(s *scenarios.Scenario) *scenarios.Scenario {
+	scenario := *s
+	scenario.Exports = make([]scenarios.Export, len(s.Exports))
+	for i, export := range s.Exports {
+		export.Context = export.ClusterId
+		scenario.Exports[i] = export
+	}
+	scenario.Imports = make([]scenarios.Cluster, len(s.Imports))
+	for i, cluster := range s.Imports {
+		cluster.Context = cluster.ClusterId
+		scenario.Imports[i] = cluster
+	}
+	return &scenario
+}
+
+// crdDirectory returns the directory of the CRDs of the repository.
+func crdDirectory() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "config", "crd", "bases")
+}
@@ -0,0 +1,93 @@
+package harness
+
+import (
+	"testing"
+
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/integration/shared/scenarios"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/pkg/model"
+	"github.com/aws/aws-cloud-map-mcs-controller-for-k8s/test"
+)
+
+func TestHarness_ExportImport(t *testing.T) {
+	h := startForTest(t)
+	h.CreateNamespace(t, "export-import")
+
+	export := scenarioForTest("export-import", scenarios.ImportKind, model.ClusterSetIPType)
+	h.Export(t, export)
+	h.Assert(t, export)
+	export.Kind = scenarios.ExportKind
+	h.Assert(t, export)
+}
+
+func TestHarness_Headless(t *testing.T) {
+	h := startForTest(t)
+	h.CreateNamespace(t, "headless")
+
+	headless := scenarioForTest("headless", scenarios.HeadlessKind, model.HeadlessType)
+	h.Export(t, headless)
+	h.Assert(t, headless)
+}
+
+func TestHarness_Deletion(t *testing.T) {
+	h := startForTest(t)
+	h.CreateNamespace(t, "deletion")
+
+	both := scenarioForTest("deletion", scenarios.ImportKind, model.ClusterSetIPType)
+	both.Exports = append(both.Exports, exportForTest(test.ClusterId2, model.ClusterSetIPType, test.EndptIp2))
+	h.Export(t, both)
+	h.Assert(t, both)
+
+	// the clusters still import the service of cluster 2 once cluster 1 stops exporting it
+	deleted := scenarioForTest("deletion", scenarios.DeletionKind, model.ClusterSetIPType)
+	h.Unexport(t, deleted)
+	h.Assert(t, deleted)
+	remaining := scenarioForTest("deletion", scenarios.ImportKind, model.ClusterSetIPType)
+	remaining.Exports = both.Exports[1:]
+	h.Assert(t, remaining)
+}
+
+func TestHarness_Conflict(t *testing.T) {
+	h := startForTest(t)
+	h.CreateNamespace(t, "conflict")
+
+	conflict := scenarioForTest("conflict", scenarios.ConflictKind, model.ClusterSetIPType)
+	conflict.Exports = append(conflict.Exports, exportForTest(test.ClusterId2, model.HeadlessType, test.EndptIp2))
+	h.Export(t, conflict)
+	h.Assert(t, conflict)
+}
+
+func startForTest(t *testing.T) *Harness {
+	return Start(t, Config{
+		ClusterSetId: test.ClusterSet,
+		ClusterIds:   []string{test.ClusterId1, test.ClusterId2},
+	})
+}
+
+// scenarioForTest returns a scenario of a service exported by cluster 1 and imported by both clusters.
+func scenarioForTest(namespace string, kind scenarios.Kind, serviceType model.ServiceType) *scenarios.Scenario {
+	return &scenarios.Scenario{
+		Name:         namespace + "-" + string(kind),
+		Kind:         kind,
+		Namespace:    namespace,
+		Service:      test.SvcName,
+		ClusterSetId: test.ClusterSet,
+		ServiceType:  serviceType,
+		Exports:      []scenarios.Export{exportForTest(test.ClusterId1, serviceType, test.EndptIp1)},
+		Imports:      []scenarios.Cluster{{ClusterId: test.ClusterId1}, {ClusterId: test.ClusterId2}},
+	}
+}
+
+func exportForTest(clusterId string, serviceType model.ServiceType, address string) scenarios.Export {
+	return scenarios.Export{
+		Cluster:     scenarios.Cluster{ClusterId: clusterId},
+		ServiceType: serviceType,
+		AddressType: "IPv4",
+		Ports: []scenarios.Port{{
+			Name:       test.PortName1,
+			Port:       test.ServicePort1,
+			TargetPort: test.Port1,
+			Protocol:   test.Protocol1,
+		}},
+		Addresses: []string{address},
+	}
+}